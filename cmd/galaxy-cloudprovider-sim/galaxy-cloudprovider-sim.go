@@ -0,0 +1,83 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/pflag"
+	"google.golang.org/grpc"
+	"k8s.io/component-base/cli/flag"
+	"k8s.io/component-base/logs"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/sim"
+	"tkestack.io/galaxy/pkg/utils/ldflags"
+)
+
+func main() {
+	var (
+		bind string
+		opts sim.Options
+	)
+	pflag.StringVar(&bind, "bind", "127.0.0.1:9091", "The address to serve grpc requests")
+	pflag.StringVar(&opts.StateFile, "state-file", "",
+		"The json file to persist ip bindings, bindings are kept in memory only if empty")
+	pflag.DurationVar(&opts.Latency, "latency", 0, "The injected delay of each request")
+	pflag.Float64Var(&opts.FailureRate, "failure-rate", 0, "The probability in [0, 1] of failing a request")
+	pflag.IntVar(&opts.MaxIPsPerNode, "max-ips-per-node", 0, "The max number of ips assigned to a node, 0 means unlimited")
+	pflag.StringVar(&opts.HookScript, "hook", "",
+		"The script executed as \"<hook> assign|unassign <node> <ip>\" before changing bindings")
+	pflag.BoolVar(&opts.V1Only, "v1-only", false, "Serve only the v1 protocol without batch, list and health check")
+
+	flag.InitFlags()
+	logs.InitLogs()
+	defer logs.FlushLogs()
+
+	// if checking version, print it and exit
+	ldflags.PrintAndExitIfRequested()
+
+	if err := run(bind, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err) // nolint: errcheck
+		os.Exit(1)
+	}
+}
+
+func run(bind string, opts sim.Options) error {
+	s, err := sim.NewServer(opts)
+	if err != nil {
+		return err
+	}
+	lis, err := net.Listen("tcp", bind)
+	if err != nil {
+		return err
+	}
+	gs := grpc.NewServer()
+	s.Register(gs)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		glog.Infof("received signal %v, stopping", sig)
+		gs.GracefulStop()
+	}()
+	glog.Infof("serving cloud provider on %s", bind)
+	return gs.Serve(lis)
+}
@@ -0,0 +1,159 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	"sigs.k8s.io/yaml"
+	"tkestack.io/galaxy/pkg/api/galaxy/private"
+)
+
+const debugUsage = `galaxy debug queries the read only introspection API of the galaxy daemon on this node.
+
+Usage:
+  galaxy debug pods [flags]                      List containers galaxy has set up networks for
+  galaxy debug pod <namespace>/<name> [flags]    Show networks of a pod in detail
+
+Flags:
+`
+
+// runDebug runs the debug client sub command
+func runDebug(args []string) error {
+	var socket, output string
+	fs := pflag.NewFlagSet("debug", pflag.ExitOnError)
+	fs.StringVar(&socket, "socket", private.GalaxySocketPath, "unix socket of the galaxy daemon")
+	fs.StringVarP(&output, "output", "o", "", "output format, table, json or yaml. Default table for pods "+
+		"and yaml for pod")
+	fs.Usage = func() { fmt.Fprint(os.Stderr, debugUsage+fs.FlagUsages()) } // nolint: errcheck
+	_ = fs.Parse(args)
+	args = fs.Args()
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	var containers []private.ContainerInfo
+	switch args[0] {
+	case "pods":
+		if err := getDebug(socket, "/v1/pods", &containers); err != nil {
+			return err
+		}
+		if output == "" {
+			output = "table"
+		}
+	case "pod":
+		if len(args) != 2 || strings.Count(args[1], "/") != 1 {
+			return fmt.Errorf("pod requires an argument <namespace>/<name>")
+		}
+		if err := getDebug(socket, "/v1/pods/"+args[1], &containers); err != nil {
+			return err
+		}
+		if output == "" {
+			output = "yaml"
+		}
+	default:
+		return fmt.Errorf("unknown debug command %q\n%s", args[0], debugUsage)
+	}
+	return printContainers(output, containers)
+}
+
+// getDebug gets path of the introspection API via the unix socket
+func getDebug(socket, path string, obj interface{}) error {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			Dial: func(proto, addr string) (net.Conn, error) {
+				return net.Dial("unix", socket)
+			},
+		},
+	}
+	resp, err := client.Get("http://galaxy" + path)
+	if err != nil {
+		return fmt.Errorf("failed to query galaxy via %s: %v", socket, err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return json.Unmarshal(data, obj)
+}
+
+// printContainers prints containers in json or yaml format, or a table with a row for each network
+func printContainers(format string, containers []private.ContainerInfo) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(containers, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		data, err := yaml.Marshal(containers)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(w, "NAMESPACE\tPOD\tCONTAINER\tNETWORK\tIFNAME\tIPS\tVLAN\tPORTS\tPOLICY CHAINS") // nolint: errcheck
+		for _, c := range containers {
+			containerID := c.ContainerID
+			if len(containerID) > 12 {
+				containerID = containerID[:12]
+			}
+			var ports []string
+			for _, p := range c.Ports {
+				ports = append(ports, fmt.Sprintf("%d:%d/%s", p.HostPort, p.ContainerPort, p.Protocol))
+			}
+			for _, n := range c.Networks {
+				vlan := ""
+				if n.Vlan != 0 {
+					vlan = strconv.Itoa(int(n.Vlan))
+				}
+				fmt.Fprintln(w, strings.Join([]string{orNone(c.PodNamespace), orNone(c.PodName), containerID, // nolint: errcheck
+					n.Name, n.IfName, orNone(strings.Join(n.IPs, ",")), orNone(vlan),
+					orNone(strings.Join(ports, ",")), orNone(strings.Join(c.PolicyChains, ","))}, "\t"))
+			}
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	return nil
+}
+
+// orNone returns "<none>" for empty strings in tables
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
@@ -17,7 +17,9 @@
 package main
 
 import (
+	"fmt"
 	"math/rand"
+	"os"
 	"time"
 
 	"github.com/spf13/pflag"
@@ -30,6 +32,14 @@ import (
 )
 
 func main() {
+	// galaxy debug is a client of the daemon on the same node
+	if len(os.Args) > 1 && os.Args[1] == "debug" {
+		if err := runDebug(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err) // nolint: errcheck
+			os.Exit(1)
+		}
+		return
+	}
 	// initialize rand seed
 	rand.Seed(time.Now().UTC().UnixNano())
 	galaxy := galaxy.NewGalaxy()
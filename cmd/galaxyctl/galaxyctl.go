@@ -0,0 +1,283 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/pflag"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+)
+
+const usage = `galaxyctl is the command line client of galaxy-ipam API.
+
+Usage:
+  galaxyctl [global flags] <command> [flags]
+
+Commands:
+  ip list               List ips with the same filters as GET /v1/ip
+  ip get <ip>...        Get ips and pods they are allocated to
+  ip release <ip>...    Release ips which don't belong to any pod
+  lookup <ip>|<namespace>/<pod>
+                        Look up the pod of an ip or ips of a pod
+  pool list             List pools with their utilization
+  pool get <name>       Get a pool
+  pool create <name>    Create a pool
+  pool update <name>    Update a pool
+  pool delete <name>    Delete a pool
+  subnet list           List floating ip pools of the configmap with their utilization
+  audit                 Check ips allocated to deleted pods and pods whose ip differs from the allocated one
+  export                Export allocated ips as a snapshot
+  import                Import a snapshot by allocating ips to their original owners
+  transfer              Transfer all ips of a workload to another workload
+
+Use "galaxyctl <command> --help" for flags of a command.
+
+Global flags:
+`
+
+// options are global flags
+type options struct {
+	server           string
+	token            string
+	kubeconfig       string
+	serviceNamespace string
+	service          string
+}
+
+// client sends requests to galaxy-ipam API
+type client struct {
+	options
+	baseURL    string
+	viaProxy   bool
+	httpClient *http.Client
+	restConfig *rest.Config
+}
+
+func main() {
+	var opts options
+	global := pflag.NewFlagSet("galaxyctl", pflag.ExitOnError)
+	global.StringVar(&opts.server, "server", "", "galaxy-ipam API server address, e.g. http://127.0.0.1:9041. "+
+		"If empty, galaxy-ipam service is discovered by kubeconfig and accessed via apiserver proxy")
+	global.StringVar(&opts.token, "token", "", "bearer token for galaxy-ipam API authentication, default "+
+		"$GALAXY_TOKEN. It is not forwarded by apiserver proxy, so --server is required if API auth is enabled")
+	global.StringVar(&opts.kubeconfig, "kubeconfig", "", "kubeconfig file, default $KUBECONFIG or ~/.kube/config")
+	global.StringVar(&opts.serviceNamespace, "service-namespace", "kube-system", "namespace of galaxy-ipam service")
+	global.StringVar(&opts.service, "service", "galaxy-ipam:api-port", "name and port of galaxy-ipam service, "+
+		"prefix it with \"https:\" if API is served over https")
+	global.SetInterspersed(false)
+	global.Usage = func() { fmt.Fprint(os.Stderr, usage+global.FlagUsages()) } // nolint: errcheck
+	_ = global.Parse(os.Args[1:])
+	args := global.Args()
+	if len(args) == 0 {
+		global.Usage()
+		os.Exit(1)
+	}
+	if opts.token == "" {
+		opts.token = os.Getenv("GALAXY_TOKEN")
+	}
+	c := &client{options: opts}
+	var err error
+	switch args[0] {
+	case "ip":
+		err = c.ip(args[1:])
+	case "lookup":
+		err = c.lookup(args[1:])
+	case "pool":
+		err = c.pool(args[1:])
+	case "subnet":
+		err = c.subnet(args[1:])
+	case "audit":
+		err = c.audit(args[1:])
+	case "export":
+		err = c.export(args[1:])
+	case "import":
+		err = c.importSnapshot(args[1:])
+	case "transfer":
+		err = c.transfer(args[1:])
+	default:
+		err = fmt.Errorf("unknown command %q\n%s", args[0], usage)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err) // nolint: errcheck
+		os.Exit(1)
+	}
+}
+
+// newFlagSet creates a flag set of a command with an output flag
+func newFlagSet(name string, output *string) *pflag.FlagSet {
+	fs := pflag.NewFlagSet(name, pflag.ExitOnError)
+	if output != nil {
+		fs.StringVarP(output, "output", "o", "table", "output format, table, json or yaml")
+	}
+	return fs
+}
+
+// loadRestConfig loads the kubeconfig
+func (c *client) loadRestConfig() (*rest.Config, error) {
+	if c.restConfig != nil {
+		return c.restConfig, nil
+	}
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = c.kubeconfig
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules,
+		&clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	c.restConfig = cfg
+	return cfg, nil
+}
+
+// init discovers the API server address and creates the http client
+func (c *client) init() error {
+	if c.httpClient != nil {
+		return nil
+	}
+	if c.server != "" {
+		c.baseURL = strings.TrimSuffix(c.server, "/")
+		c.httpClient = &http.Client{Timeout: time.Minute}
+		return nil
+	}
+	cfg, err := c.loadRestConfig()
+	if err != nil {
+		if clientcmd.IsEmptyConfig(err) {
+			// neither server nor kubeconfig is given, assume running on the node of galaxy-ipam
+			c.baseURL = "http://127.0.0.1:9041"
+			c.httpClient = &http.Client{Timeout: time.Minute}
+			return nil
+		}
+		return fmt.Errorf("failed to load kubeconfig: %v", err)
+	}
+	transport, err := rest.TransportFor(cfg)
+	if err != nil {
+		return err
+	}
+	c.baseURL = fmt.Sprintf("%s/api/v1/namespaces/%s/services/%s/proxy", strings.TrimSuffix(cfg.Host, "/"),
+		c.serviceNamespace, c.service)
+	c.viaProxy = true
+	c.httpClient = &http.Client{Timeout: time.Minute, Transport: transport}
+	return nil
+}
+
+// do sends a json request if req is not nil and decodes the json response into resp if resp is not nil
+func (c *client) do(method, path string, query url.Values, req, resp interface{}) error {
+	if err := c.init(); err != nil {
+		return err
+	}
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	httpReq, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.token != "" && !c.viaProxy {
+		// apiserver authenticates requests of kubeconfig by Authorization header and drops it before proxying
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	httpResp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close() // nolint: errcheck
+	data, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode == http.StatusUnauthorized && c.viaProxy {
+		return fmt.Errorf("%s: %s\ngalaxy-ipam API requires a bearer token with --api-auth, which apiserver proxy "+
+			"doesn't forward, please access it directly by --server and --token", httpResp.Status,
+			strings.TrimSpace(string(data)))
+	}
+	if httpResp.StatusCode != http.StatusOK && httpResp.StatusCode != http.StatusAccepted {
+		return &statusError{code: httpResp.StatusCode, status: httpResp.Status, body: strings.TrimSpace(string(data))}
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.Unmarshal(data, resp)
+}
+
+// statusError is the error of an unexpected response status
+type statusError struct {
+	code   int
+	status string
+	body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.status, e.body)
+}
+
+// printObject prints obj in json or yaml format, or rows as a table with the header
+func printObject(format string, obj interface{}, header []string, rows [][]string) error {
+	switch format {
+	case "json":
+		data, err := json.MarshalIndent(obj, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	case "yaml":
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+	case "table", "":
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+		fmt.Fprintln(w, strings.Join(header, "\t")) // nolint: errcheck
+		for _, row := range rows {
+			fmt.Fprintln(w, strings.Join(row, "\t")) // nolint: errcheck
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	return nil
+}
+
+// orNone returns "<none>" for empty strings in tables
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
@@ -0,0 +1,442 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/api"
+)
+
+// maxPageSize is the max page size of list APIs
+const maxPageSize = 9999
+
+// Snapshot is the exported allocated ips
+type Snapshot struct {
+	IPs []api.FloatingIP `json:"ips"`
+}
+
+func (c *client) ip(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("ip command requires a sub command, list, get or release")
+	}
+	switch args[0] {
+	case "list":
+		return c.listIPCmd(args[1:])
+	case "get":
+		return c.getIPCmd(args[1:])
+	case "release":
+		return c.releaseIPCmd(args[1:])
+	default:
+		return fmt.Errorf("unknown ip sub command %q", args[0])
+	}
+}
+
+func (c *client) listIPCmd(args []string) error {
+	var output string
+	var all bool
+	query := url.Values{}
+	fs := newFlagSet("ip list", &output)
+	params := map[string]*string{}
+	for _, p := range []struct{ flag, param, usage string }{
+		{"keyword", "keyword", "fuzzy query by keyword of ip keys, other filters are ignored if specified"},
+		{"pool", "poolName", "pool name"},
+		{"namespace", "namespace", "namespace"},
+		{"app", "appName", "app name"},
+		{"app-type", "appType", "app type, deployment, statefulset or tapp, default statefulset"},
+		{"pod", "podName", "pod name"},
+		{"sort", "sort", "sort by which field, supports ip/namespace/podname/policy asc/desc"},
+	} {
+		params[p.param] = fs.String(p.flag, "", p.usage)
+	}
+	page := fs.Int("page", 0, "page number")
+	size := fs.Int("size", 10, "page size")
+	fs.BoolVar(&all, "all", false, "list ips of all pages")
+	_ = fs.Parse(args)
+	for param, value := range params {
+		if *value != "" {
+			query.Set(param, *value)
+		}
+	}
+	var ips []api.FloatingIP
+	if all {
+		var err error
+		if ips, err = c.listAllIPs(query); err != nil {
+			return err
+		}
+	} else {
+		query.Set("page", strconv.Itoa(*page))
+		query.Set("size", strconv.Itoa(*size))
+		var resp api.ListIPResp
+		if err := c.do(http.MethodGet, "/v1/ip", query, nil, &resp); err != nil {
+			return err
+		}
+		ips = resp.Content
+	}
+	return printIPs(output, ips)
+}
+
+// listAllIPs lists ips of all pages
+func (c *client) listAllIPs(query url.Values) ([]api.FloatingIP, error) {
+	var ips []api.FloatingIP
+	query.Set("size", strconv.Itoa(maxPageSize))
+	for page := 0; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var resp api.ListIPResp
+		if err := c.do(http.MethodGet, "/v1/ip", query, nil, &resp); err != nil {
+			return nil, err
+		}
+		ips = append(ips, resp.Content...)
+		if resp.Last {
+			return ips, nil
+		}
+	}
+}
+
+// listAllocatedIPs lists all ips allocated to pods, workloads or pools
+func (c *client) listAllocatedIPs() ([]api.FloatingIP, error) {
+	// listing without any filter returns all ips including unallocated ones
+	ips, err := c.listAllIPs(url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	var allocated []api.FloatingIP
+	for i := range ips {
+		if ips[i].AppType != "" || ips[i].PoolName != "" {
+			allocated = append(allocated, ips[i])
+		}
+	}
+	return allocated, nil
+}
+
+// getIP gets an ip, it returns nil if the ip is not within any floating ip pool
+func (c *client) getIP(ip string) (*api.FloatingIP, error) {
+	var resp api.ListIPResp
+	if err := c.do(http.MethodGet, "/v1/ip", url.Values{"ip": []string{ip}}, nil, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Content) == 0 {
+		return nil, nil
+	}
+	return &resp.Content[0], nil
+}
+
+func (c *client) getIPCmd(args []string) error {
+	var output string
+	fs := newFlagSet("ip get", &output)
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("ip is required")
+	}
+	var ips []api.FloatingIP
+	for _, ip := range fs.Args() {
+		fip, err := c.getIP(ip)
+		if err != nil {
+			return err
+		}
+		if fip == nil {
+			return fmt.Errorf("ip %s is not within any floating ip pool", ip)
+		}
+		ips = append(ips, *fip)
+	}
+	return printIPs(output, ips)
+}
+
+func (c *client) releaseIPCmd(args []string) error {
+	fs := newFlagSet("ip release", nil)
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("ip is required")
+	}
+	var req api.ReleaseIPReq
+	for _, ip := range fs.Args() {
+		fip, err := c.getIP(ip)
+		if err != nil {
+			return err
+		}
+		if fip == nil || (fip.AppType == "" && fip.PoolName == "") {
+			return fmt.Errorf("ip %s is not allocated", ip)
+		}
+		req.IPs = append(req.IPs, *fip)
+	}
+	var resp api.ReleaseIPResp
+	if err := c.do(http.MethodPost, "/v1/ip", nil, &req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Unreleased) > 0 {
+		return fmt.Errorf("%s: %s", resp.Message, strings.Join(resp.Unreleased, ","))
+	}
+	return nil
+}
+
+func (c *client) lookup(args []string) error {
+	var output string
+	fs := newFlagSet("lookup", &output)
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("an ip or namespace/pod is required")
+	}
+	arg := fs.Arg(0)
+	if net.ParseIP(arg) != nil {
+		fip, err := c.getIP(arg)
+		if err != nil {
+			return err
+		}
+		if fip == nil || (fip.AppType == "" && fip.PoolName == "") {
+			return fmt.Errorf("ip %s is not allocated", arg)
+		}
+		return printIPs(output, []api.FloatingIP{*fip})
+	}
+	parts := strings.Split(arg, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("invalid ip or namespace/pod %q", arg)
+	}
+	ips, err := c.listAllIPs(url.Values{"keyword": []string{parts[1]}})
+	if err != nil {
+		return err
+	}
+	var podIPs []api.FloatingIP
+	for i := range ips {
+		if ips[i].Namespace == parts[0] && ips[i].PodName == parts[1] {
+			podIPs = append(podIPs, ips[i])
+		}
+	}
+	if len(podIPs) == 0 {
+		return fmt.Errorf("pod %s has no ip", arg)
+	}
+	return printIPs(output, podIPs)
+}
+
+func printIPs(output string, ips []api.FloatingIP) error {
+	var rows [][]string
+	for _, ip := range ips {
+		rows = append(rows, []string{ip.IP, orNone(ip.Namespace), orNone(ip.AppType), orNone(ip.AppName),
+			orNone(ip.PodName), orNone(ip.PoolName), policyName(ip.Policy), orNone(ip.Status),
+			strconv.FormatBool(ip.Releasable), ip.UpdateTime.Format(time.RFC3339)})
+	}
+	return printObject(output, ips, []string{"IP", "NAMESPACE", "TYPE", "APP", "POD", "POOL", "POLICY", "STATUS",
+		"RELEASABLE", "UPDATED"}, rows)
+}
+
+func policyName(policy uint16) string {
+	switch constant.ReleasePolicy(policy) {
+	case constant.ReleasePolicyImmutable:
+		return constant.Immutable
+	case constant.ReleasePolicyNever:
+		return constant.Never
+	default:
+		return "podDelete"
+	}
+}
+
+// #lizard forgives
+func (c *client) audit(args []string) error {
+	var output string
+	var checkPods bool
+	fs := newFlagSet("audit", &output)
+	fs.BoolVar(&checkPods, "check-pods", true, "check whether ips of running pods are the allocated ones, "+
+		"which requires kubeconfig")
+	_ = fs.Parse(args)
+	ips, err := c.listAllocatedIPs()
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	var problems []map[string]string
+	report := func(problem string, ip *api.FloatingIP, detail string) {
+		rows = append(rows, []string{problem, ip.IP, orNone(ip.Namespace), orNone(ip.PodName), detail})
+		problems = append(problems, map[string]string{"problem": problem, "ip": ip.IP, "namespace": ip.Namespace,
+			"pod": ip.PodName, "detail": detail})
+	}
+	podIPs := map[string][]*api.FloatingIP{}
+	for i := range ips {
+		ip := &ips[i]
+		if ip.Status == "Deleted" && constant.ReleasePolicy(ip.Policy) == constant.ReleasePolicyPodDelete {
+			report("Leaked", ip, "pod has been deleted but ip of podDelete release policy is not released")
+		} else if ip.Status != "" && ip.Status != "Deleted" {
+			podIPs[ip.Namespace+"/"+ip.PodName] = append(podIPs[ip.Namespace+"/"+ip.PodName], ip)
+		}
+	}
+	if checkPods && len(podIPs) > 0 {
+		cfg, err := c.loadRestConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load kubeconfig to check pods, add --check-pods=false to skip: %v", err)
+		}
+		kubeClient, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			return err
+		}
+		for _, fips := range podIPs {
+			pod, err := kubeClient.CoreV1().Pods(fips[0].Namespace).Get(fips[0].PodName, metav1.GetOptions{})
+			if err != nil {
+				if errors.IsNotFound(err) {
+					continue
+				}
+				return err
+			}
+			if pod.Status.PodIP == "" {
+				continue
+			}
+			var matched bool
+			for _, fip := range fips {
+				if fip.IP == pod.Status.PodIP {
+					matched = true
+				}
+			}
+			if !matched {
+				report("Mismatch", fips[0], fmt.Sprintf("pod ip is %s", pod.Status.PodIP))
+			}
+		}
+	}
+	if err := printObject(output, problems, []string{"PROBLEM", "IP", "NAMESPACE", "POD", "DETAIL"},
+		rows); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+	return nil
+}
+
+func (c *client) export(args []string) error {
+	var output, file string
+	fs := newFlagSet("export", nil)
+	fs.StringVarP(&output, "output", "o", "yaml", "output format, json or yaml")
+	fs.StringVarP(&file, "file", "f", "", "write the snapshot to the file instead of stdout")
+	_ = fs.Parse(args)
+	if output != "json" && output != "yaml" {
+		return fmt.Errorf("unknown output format %q", output)
+	}
+	ips, err := c.listAllocatedIPs()
+	if err != nil {
+		return err
+	}
+	snapshot := Snapshot{IPs: ips}
+	for i := range snapshot.IPs {
+		// status is not part of the snapshot
+		snapshot.IPs[i].Status, snapshot.IPs[i].Releasable = "", false
+	}
+	if file == "" {
+		return printObject(output, snapshot, nil, nil)
+	}
+	var data []byte
+	if output == "json" {
+		data, err = json.MarshalIndent(snapshot, "", "  ")
+	} else {
+		data, err = yaml.Marshal(snapshot)
+	}
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// #lizard forgives
+func (c *client) importSnapshot(args []string) error {
+	var file string
+	var dryRun bool
+	fs := newFlagSet("import", nil)
+	fs.StringVarP(&file, "file", "f", "", "the snapshot file in json or yaml format")
+	fs.BoolVar(&dryRun, "dry-run", false, "only print ips to be imported")
+	_ = fs.Parse(args)
+	if file == "" {
+		return fmt.Errorf("--file is required")
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var snapshot Snapshot
+	if err := yaml.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("invalid snapshot: %v", err)
+	}
+	for _, ip := range snapshot.IPs {
+		if net.ParseIP(ip.IP) == nil {
+			return fmt.Errorf("invalid ip %q", ip.IP)
+		}
+		if dryRun {
+			key, err := ip.ImportKey()
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\t%s\n", ip.IP, key)
+		}
+	}
+	if dryRun {
+		return nil
+	}
+	// galaxy-ipam allocates ips to their original keys with their policies and attributes
+	var resp api.ImportIPResp
+	if err := c.do(http.MethodPost, "/v1/ip/import", nil, api.ImportIPReq{IPs: snapshot.IPs}, &resp); err != nil {
+		return err
+	}
+	for _, ip := range resp.Imported {
+		fmt.Printf("imported %s\n", ip)
+	}
+	for ip, reason := range resp.Unimported {
+		fmt.Fprintf(os.Stderr, "failed to import %s: %s\n", ip, reason) // nolint: errcheck
+	}
+	if len(resp.Unimported) > 0 {
+		return fmt.Errorf("%d of %d ips are not imported", len(resp.Unimported), len(snapshot.IPs))
+	}
+	return nil
+}
+
+func (c *client) transfer(args []string) error {
+	var req api.TransferRequest
+	fs := newFlagSet("transfer", nil)
+	fs.StringVar(&req.From.Namespace, "from-namespace", "", "namespace of the source workload")
+	fs.StringVar(&req.From.AppName, "from-name", "", "name of the source workload")
+	fs.StringVar(&req.From.AppType, "from-type", "statefulset", "type of the source workload, deployment, "+
+		"statefulset or tapp")
+	fs.StringVar(&req.To.Namespace, "to-namespace", "", "namespace of the target workload, default the source "+
+		"namespace")
+	fs.StringVar(&req.To.AppName, "to-name", "", "name of the target workload, default the source name")
+	fs.StringVar(&req.To.AppType, "to-type", "", "type of the target workload, default the source type")
+	_ = fs.Parse(args)
+	if req.To.Namespace == "" {
+		req.To.Namespace = req.From.Namespace
+	}
+	if req.To.AppName == "" {
+		req.To.AppName = req.From.AppName
+	}
+	if req.To.AppType == "" {
+		req.To.AppType = req.From.AppType
+	}
+	var resp api.TransferResp
+	if err := c.do(http.MethodPost, "/v1/ip/transfer", nil, &req, &resp); err != nil {
+		return err
+	}
+	for _, ip := range resp.Transferred {
+		fmt.Printf("%s\t%s/%s\t%s\n", ip.IP, ip.Namespace, ip.AppName, ip.PodName)
+	}
+	return nil
+}
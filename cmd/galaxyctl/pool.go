@@ -0,0 +1,157 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"tkestack.io/galaxy/pkg/ipam/api"
+)
+
+func (c *client) pool(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("pool command requires a sub command, list, get, create, update or delete")
+	}
+	switch args[0] {
+	case "list":
+		return c.listPoolCmd(args[1:])
+	case "get":
+		return c.getPoolCmd(args[1:])
+	case "create":
+		return c.createOrUpdatePoolCmd(args[1:], true)
+	case "update":
+		return c.createOrUpdatePoolCmd(args[1:], false)
+	case "delete":
+		return c.deletePoolCmd(args[1:])
+	default:
+		return fmt.Errorf("unknown pool sub command %q", args[0])
+	}
+}
+
+// pagingQuery adds paging flags to fs and returns a func to get the query
+func pagingQuery(fs *pflag.FlagSet, sortUsage string) func() url.Values {
+	sort := fs.String("sort", "", sortUsage)
+	page := fs.Int("page", 0, "page number")
+	size := fs.Int("size", maxPageSize, "page size")
+	return func() url.Values {
+		query := url.Values{"page": []string{strconv.Itoa(*page)}, "size": []string{strconv.Itoa(*size)}}
+		if *sort != "" {
+			query.Set("sort", *sort)
+		}
+		return query
+	}
+}
+
+func (c *client) listPoolCmd(args []string) error {
+	var output string
+	fs := newFlagSet("pool list", &output)
+	query := pagingQuery(fs, "sort by which field, supports name/size/allocated/reserved/free asc/desc")
+	_ = fs.Parse(args)
+	var resp api.ListPoolResp
+	if err := c.do(http.MethodGet, "/v1/pool", query(), nil, &resp); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, pool := range resp.Content {
+		rows = append(rows, []string{pool.Name, strconv.Itoa(pool.Size), strconv.FormatBool(pool.PreAllocateIP),
+			orNone(pool.Gateway), strconv.Itoa(int(pool.Vlan)), orNone(strings.Join(pool.IPRanges, ",")),
+			orNone(strings.Join(pool.NodeSubnets, ",")), strconv.Itoa(pool.Allocated), strconv.Itoa(pool.Reserved),
+			strconv.Itoa(pool.Free)})
+	}
+	return printObject(output, resp.Content, []string{"NAME", "SIZE", "PRE-ALLOCATE-IP", "GATEWAY", "VLAN",
+		"IP-RANGES", "NODE-SUBNETS", "ALLOCATED", "RESERVED", "FREE"}, rows)
+}
+
+func (c *client) getPoolCmd(args []string) error {
+	var output string
+	fs := newFlagSet("pool get", &output)
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("pool name is required")
+	}
+	var resp api.GetPoolResp
+	if err := c.do(http.MethodGet, "/v1/pool/"+url.PathEscape(fs.Arg(0)), nil, nil, &resp); err != nil {
+		return err
+	}
+	pool := resp.Pool
+	return printObject(output, pool, []string{"NAME", "SIZE", "PRE-ALLOCATE-IP"},
+		[][]string{{pool.Name, strconv.Itoa(pool.Size), strconv.FormatBool(pool.PreAllocateIP)}})
+}
+
+func (c *client) createOrUpdatePoolCmd(args []string, create bool) error {
+	var pool api.Pool
+	fs := newFlagSet("pool", nil)
+	fs.IntVar(&pool.Size, "size", 0, "pool size, 0 means the pool size grows as replicas grow")
+	fs.BoolVar(&pool.PreAllocateIP, "pre-allocate-ip", false, "allocate ips of pool size right now")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("pool name is required")
+	}
+	pool.Name = fs.Arg(0)
+	if create {
+		err := c.do(http.MethodGet, "/v1/pool/"+url.PathEscape(pool.Name), nil, nil, nil)
+		if err == nil {
+			return fmt.Errorf("pool %s already exists", pool.Name)
+		} else if statusErr, ok := err.(*statusError); !ok || statusErr.code != http.StatusNotFound {
+			return err
+		}
+	}
+	var resp api.UpdatePoolResp
+	if err := c.do(http.MethodPost, "/v1/pool", nil, &pool, &resp); err != nil {
+		return err
+	}
+	if resp.Code == http.StatusAccepted {
+		return fmt.Errorf("%s, real pool size %d", resp.Message, resp.RealPoolSize)
+	}
+	return nil
+}
+
+func (c *client) deletePoolCmd(args []string) error {
+	fs := newFlagSet("pool delete", nil)
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("pool name is required")
+	}
+	return c.do(http.MethodDelete, "/v1/pool/"+url.PathEscape(fs.Arg(0)), nil, nil, nil)
+}
+
+func (c *client) subnet(args []string) error {
+	if len(args) == 0 || args[0] != "list" {
+		return fmt.Errorf("subnet command requires a sub command list")
+	}
+	var output string
+	fs := newFlagSet("subnet list", &output)
+	query := pagingQuery(fs, "sort by which field, supports subnet/name/allocated/reserved/free asc/desc")
+	_ = fs.Parse(args[1:])
+	var resp api.ListSubnetResp
+	if err := c.do(http.MethodGet, "/v1/subnet", query(), nil, &resp); err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, subnet := range resp.Content {
+		rows = append(rows, []string{orNone(subnet.Name), subnet.Subnet, subnet.Gateway,
+			strconv.Itoa(int(subnet.Vlan)), strings.Join(subnet.IPRanges, ","), strings.Join(subnet.NodeSubnets, ","),
+			strconv.Itoa(subnet.Allocated), strconv.Itoa(subnet.Reserved), strconv.Itoa(subnet.Free)})
+	}
+	return printObject(output, resp.Content, []string{"NAME", "SUBNET", "GATEWAY", "VLAN", "IP-RANGES",
+		"NODE-SUBNETS", "ALLOCATED", "RESERVED", "FREE"}, rows)
+}
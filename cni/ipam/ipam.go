@@ -17,13 +17,14 @@
 package ipam
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	t020 "github.com/containernetworking/cni/pkg/types/020"
-	"github.com/containernetworking/plugins/pkg/ipam"
+	"github.com/containernetworking/cni/pkg/invoke"
 	"tkestack.io/galaxy/pkg/api/cniutil"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 )
@@ -60,7 +61,7 @@ func Allocate(ipamType string, args *skel.CmdArgs) ([]uint16, []types.Result, er
 		return nil, nil, fmt.Errorf("neither ipInfo from cni args nor ipam type from netconf")
 	}
 	// run the IPAM plugin and get back the config to apply
-	generalResult, err := ipam.ExecAdd(ipamType, args.StdinData)
+	generalResult, err := invoke.DelegateAdd(context.TODO(), ipamType, args.StdinData, nil)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -79,5 +80,5 @@ func Release(ipamType string, args *skel.CmdArgs) error {
 		return nil
 	}
 	// run the IPAM plugin and get back the config to apply
-	return ipam.ExecDel(ipamType, args.StdinData)
+	return invoke.DelegateDel(context.TODO(), ipamType, args.StdinData, nil)
 }
@@ -192,5 +192,5 @@ func cmdDel(args *skel.CmdArgs) error {
 
 func main() {
 	d = &vlan.VlanDriver{}
-	skel.PluginMain(cmdAdd, cmdDel, version.Legacy)
+	skel.PluginMain(cmdAdd, nil, cmdDel, version.Legacy, "")
 }
@@ -27,8 +27,9 @@ import (
 	"strings"
 
 	"github.com/containernetworking/cni/pkg/skel"
-	t020 "github.com/containernetworking/cni/pkg/types/020"
+	"github.com/containernetworking/cni/pkg/types"
 	"github.com/containernetworking/cni/pkg/version"
+	"tkestack.io/galaxy/pkg/api/cniutil"
 	galaxyapi "tkestack.io/galaxy/pkg/api/galaxy"
 	"tkestack.io/galaxy/pkg/api/galaxy/private"
 )
@@ -93,15 +94,19 @@ func (p *cniPlugin) doCNI(url string, req *galaxyapi.CNIRequest) ([]byte, error)
 }
 
 // Send the ADD command environment and config to the CNI server, returning
-// the IPAM result to the caller
-func (p *cniPlugin) CmdAdd(args *skel.CmdArgs) (*t020.Result, error) {
+// the IPAM result in the version of config to the caller
+func (p *cniPlugin) CmdAdd(args *skel.CmdArgs) (types.Result, error) {
 	body, err := p.doCNI("http://dummy/cni", newCNIRequest(args))
 	if err != nil {
 		return nil, err
 	}
 
-	result := &t020.Result{}
-	if err := json.Unmarshal(body, result); err != nil {
+	confVersion, err := cniutil.ConfVersion(args.StdinData)
+	if err != nil {
+		return nil, err
+	}
+	result, err := version.NewResult(confVersion, body)
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal response '%s': %v", string(body), err)
 	}
 
@@ -118,6 +123,12 @@ func (p *cniPlugin) skelCmdAdd(args *skel.CmdArgs) error {
 	return result.Print()
 }
 
+// Send the CHECK command environment and config to the CNI server
+func (p *cniPlugin) CmdCheck(args *skel.CmdArgs) error {
+	_, err := p.doCNI("http://dummy/cni", newCNIRequest(args))
+	return err
+}
+
 // Send the DEL command environment and config to the CNI server
 func (p *cniPlugin) CmdDel(args *skel.CmdArgs) error {
 	_, err := p.doCNI("http://dummy/cni", newCNIRequest(args))
@@ -126,5 +137,5 @@ func (p *cniPlugin) CmdDel(args *skel.CmdArgs) error {
 
 func main() {
 	p := NewCNIPlugin(private.GalaxySocketPath)
-	skel.PluginMain(p.skelCmdAdd, p.CmdDel, version.Legacy)
+	skel.PluginMain(p.skelCmdAdd, p.CmdCheck, p.CmdDel, version.All, "galaxy-sdn")
 }
@@ -27,13 +27,13 @@ import (
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	t020 "github.com/containernetworking/cni/pkg/types/020"
-	"github.com/containernetworking/cni/pkg/types/current"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
 	cniSpecVersion "github.com/containernetworking/cni/pkg/version"
-	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/vishvananda/netlink"
 
 	galaxyIpam "tkestack.io/galaxy/cni/ipam"
+	"tkestack.io/galaxy/pkg/api/cniutil"
 )
 
 const (
@@ -155,15 +155,14 @@ func cmdAdd(args *skel.CmdArgs) error {
 	}
 
 	contIndex := 1
-	ips := []*current.IPConfig{
+	ips := []*types100.IPConfig{
 		{
-			Version:   "4",
 			Address:   *addr,
 			Interface: &contIndex,
 		},
 	}
 
-	result := &current.Result{
+	result := &types100.Result{
 		IPs:        ips,
 		Interfaces: infList,
 		DNS:        conf.DNS,
@@ -208,19 +207,40 @@ func cmdDel(args *skel.CmdArgs) error {
 	}
 
 	err = ns.WithNetNSPath(args.Netns, func(_ ns.NetNS) error {
-		subErr := ip.DelLinkByName(args.IfName)
-		if subErr == nil {
-			return nil
+		link, subErr := netlink.LinkByName(args.IfName)
+		if subErr != nil {
+			if _, ok := subErr.(netlink.LinkNotFoundError); ok {
+				return nil
+			}
+			return fmt.Errorf("failed to lookup ns %s link %s: %v", args.Netns, args.IfName, subErr)
 		}
-		if subErr == ip.ErrLinkNotFound {
-			return nil
+		if subErr = netlink.LinkDel(link); subErr != nil {
+			return fmt.Errorf("failed to delete ns %s link %s: %v", args.Netns, args.IfName, subErr)
 		}
-		return fmt.Errorf("failed to delete ns %s link %s: %v", args.Netns, args.IfName, subErr)
+		return nil
 	})
 
 	return err
 }
 
+func cmdCheck(args *skel.CmdArgs) error {
+	conf, err := loadConf(args)
+	if err != nil {
+		return err
+	}
+	if err := cniSpecVersion.ParsePrevResult(&conf.NetConf); err != nil {
+		return err
+	}
+	if conf.PrevResult == nil {
+		return fmt.Errorf("prevResult is required for CHECK")
+	}
+	result, err := types100.NewResultFromResult(conf.PrevResult)
+	if err != nil {
+		return err
+	}
+	return cniutil.CheckResult(args.Netns, result)
+}
+
 func main() {
-	skel.PluginMain(cmdAdd, cmdDel, cniSpecVersion.All)
+	skel.PluginMain(cmdAdd, cmdCheck, cmdDel, cniSpecVersion.All, "tke-route-eni")
 }
@@ -1,3 +1,6 @@
+//go:build linux
+// +build linux
+
 /*
  * Tencent is pleased to support the open source community by making TKEStack available.
  *
@@ -14,7 +17,6 @@
  * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
  * specific language governing permissions and limitations under the License.
  */
-// +build linux
 
 package main
 
@@ -23,7 +25,7 @@ import (
 	"net"
 	"syscall"
 
-	"github.com/containernetworking/cni/pkg/types/current"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/vishvananda/netlink"
 )
@@ -41,7 +43,7 @@ const (
 
 type NetworkAPIs interface {
 	SetupNS(hostVethName string, podVethName string, netns string, addr *net.IPNet,
-		routeTable int) ([]*current.Interface, error)
+		routeTable int) ([]*types100.Interface, error)
 	TeardownNS(podVethName string, netns string, routeTable int) error
 }
 
@@ -55,7 +57,7 @@ func NewDriver() NetworkAPIs {
 // #lizard forgives
 func (network *linuxNetwork) SetupNS(
 	hostVethName string, podVethName string, netns string,
-	addr *net.IPNet, routeTable int) ([]*current.Interface, error) {
+	addr *net.IPNet, routeTable int) ([]*types100.Interface, error) {
 
 	if oldHostVeth, err := netlink.LinkByName(hostVethName); err == nil {
 		if err = netlink.LinkDel(oldHostVeth); err != nil {
@@ -63,8 +65,8 @@ func (network *linuxNetwork) SetupNS(
 		}
 	}
 
-	contInf := &current.Interface{}
-	hostInf := &current.Interface{}
+	contInf := &types100.Interface{}
+	hostInf := &types100.Interface{}
 
 	vethCtx := newVethPairCreateContext(hostVethName, podVethName, addr)
 	if err := ns.WithNetNSPath(netns, func(hostNs ns.NetNS) error {
@@ -118,7 +120,7 @@ func (network *linuxNetwork) SetupNS(
 			return nil, fmt.Errorf("failed to add fromContainer rule: %v", err)
 		}
 	}
-	return []*current.Interface{hostInf, contInf}, nil
+	return []*types100.Interface{hostInf, contInf}, nil
 }
 
 func (network *linuxNetwork) TeardownNS(podVethName string, netns string, routeTable int) error {
@@ -25,7 +25,7 @@ func init() {
 }
 
 func main() {
-	skel.PluginMain(cmdAdd, cmdDel, version.Legacy)
+	skel.PluginMain(cmdAdd, nil, cmdDel, version.Legacy, "")
 }
 
 func cmdDel(args *skel.CmdArgs) error {
@@ -17,17 +17,18 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
 	"os"
 	"runtime"
 
+	"github.com/containernetworking/cni/pkg/invoke"
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	t020 "github.com/containernetworking/cni/pkg/types/020"
 	"github.com/containernetworking/cni/pkg/version"
-	"github.com/containernetworking/plugins/pkg/ipam"
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/vishvananda/netlink"
 	"tkestack.io/galaxy/pkg/utils"
@@ -176,7 +177,7 @@ func cmdAdd(args *skel.CmdArgs) error {
 		return err
 	}
 	// run the IPAM plugin and get back the config to apply
-	generalResult, err := ipam.ExecAdd(conf.IPAM.Type, args.StdinData)
+	generalResult, err := invoke.DelegateAdd(context.TODO(), conf.IPAM.Type, args.StdinData, nil)
 	if err != nil {
 		return err
 	}
@@ -215,12 +216,12 @@ func cmdDel(args *skel.CmdArgs) error {
 		return err
 	}
 
-	if err := ipam.ExecDel(conf.IPAM.Type, args.StdinData); err != nil {
+	if err := invoke.DelegateDel(context.TODO(), conf.IPAM.Type, args.StdinData, nil); err != nil {
 		return err
 	}
 	return nil
 }
 
 func main() {
-	skel.PluginMain(cmdAdd, cmdDel, version.Legacy)
+	skel.PluginMain(cmdAdd, nil, cmdDel, version.Legacy, "")
 }
@@ -17,6 +17,7 @@
 package helper
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"os"
@@ -46,15 +47,16 @@ func fillDefaultArgs(root string, args *invoke.Args) *invoke.Args {
 	return args
 }
 
-//export PATH=`pwd`/bin
-//ip netns add ctn
+// ip netns add ctn
 // CNI_ARGS="IP=192.168.33.3" CNI_COMMAND="ADD" CNI_CONTAINERID=ctn1 CNI_NETNS=/var/run/netns/ctn CNI_IFNAME=eth0 CNI_PATH=`pwd`/bin galaxy-vlan < /etc/cni/net.d/10-mynet.conf
+//
+//export PATH=`pwd`/bin
 func ExecCNIWithResult(cniName string, netConfStdin []byte, args *invoke.Args) (types.Result, error) {
 	root := ProjectDir()
 	pluginPath := path.Join(root, "bin", cniName)
 	cniArgs := fillDefaultArgs(root, args)
 	glog.V(4).Infof("echo %s | %s %s", compressJson(string(netConfStdin)), strings.Join(cniArgs.AsEnv()[:6], " "), pluginPath)
-	return invoke.ExecPluginWithResult(pluginPath, netConfStdin, cniArgs)
+	return invoke.ExecPluginWithResult(context.TODO(), pluginPath, netConfStdin, cniArgs, nil)
 }
 
 func compressJson(str string) string {
@@ -66,7 +68,8 @@ func compressJson(str string) string {
 
 func ExecCNI(cniName string, netConfStdin []byte, args *invoke.Args) error {
 	root := ProjectDir()
-	return invoke.ExecPluginWithoutResult(path.Join(root, "bin", cniName), netConfStdin, fillDefaultArgs(root, args))
+	return invoke.ExecPluginWithoutResult(context.TODO(), path.Join(root, "bin", cniName), netConfStdin,
+		fillDefaultArgs(root, args), nil)
 }
 
 func NewContainerId() string {
@@ -127,7 +130,7 @@ func SetupDummyDev(ifName, cidr string) error {
 }
 
 func SetupVlanDev(ifName, parent, cidr string, vlanID int) error {
-	if out, err := Command("ip", "link", "add", "link",parent, "name", ifName, "type", "vlan", "id", fmt.Sprintf("%d", vlanID)).CombinedOutput(); err != nil {
+	if out, err := Command("ip", "link", "add", "link", parent, "name", ifName, "type", "vlan", "id", fmt.Sprintf("%d", vlanID)).CombinedOutput(); err != nil {
 		if !strings.HasPrefix(string(out), "RTNETLINK answers: File exists") {
 			return fmt.Errorf("failed to add link %s: %v, %s", ifName, err, string(out))
 		}
@@ -30,3 +30,11 @@ go build -o bin/galaxy $flags $PKG/cmd/galaxy
 echo "Building galaxy-ipam"
 echo go build -o bin/galaxy-ipam $flags $PKG/cmd/galaxy-ipam
 go build -o bin/galaxy-ipam $flags $PKG/cmd/galaxy-ipam
+
+echo "Building galaxyctl"
+echo go build -o bin/galaxyctl $flags $PKG/cmd/galaxyctl
+go build -o bin/galaxyctl $flags $PKG/cmd/galaxyctl
+
+echo "Building galaxy-cloudprovider-sim"
+echo go build -o bin/galaxy-cloudprovider-sim $flags $PKG/cmd/galaxy-cloudprovider-sim
+go build -o bin/galaxy-cloudprovider-sim $flags $PKG/cmd/galaxy-cloudprovider-sim
@@ -0,0 +1,158 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package cniutil
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/cni/pkg/types"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	glog "k8s.io/klog"
+)
+
+// Observer observes executions of networks and their delegate plugins. Galaxy daemon sets it to collect metrics
+// without making cni plugins depend on prometheus.
+type Observer interface {
+	// ObserveNetwork is called after executing a command of all plugins of a network
+	ObserveNetwork(command, networkType string, duration time.Duration, err error)
+	// ObserveDelegate is called after executing a command of a delegate plugin
+	ObserveDelegate(command, pluginType string, duration time.Duration, err error)
+}
+
+type nopObserver struct{}
+
+func (nopObserver) ObserveNetwork(string, string, time.Duration, error)  {}
+func (nopObserver) ObserveDelegate(string, string, time.Duration, error) {}
+
+var observer Observer = nopObserver{}
+
+// SetObserver sets the observer of executions of networks and delegate plugins
+func SetObserver(o Observer) {
+	observer = o
+}
+
+// observeDelegate executes a command of a delegate plugin and observes it
+func observeDelegate(command string, conf map[string]interface{}, f func() error) error {
+	start := time.Now()
+	err := f()
+	pluginType, _ := conf["type"].(string)
+	observer.ObserveDelegate(command, pluginType, time.Since(start), err)
+	return err
+}
+
+// chainPlugins returns confs of plugins of a conflist with name and cniVersion of the list, or nil if conf is not a
+// conflist
+func chainPlugins(conf map[string]interface{}) []map[string]interface{} {
+	list, ok := conf["plugins"].([]interface{})
+	if !ok {
+		return nil
+	}
+	var plugins []map[string]interface{}
+	for i := range list {
+		plugin, ok := list[i].(map[string]interface{})
+		if !ok {
+			glog.Warningf("bad plugin %v of network %v", list[i], conf["name"])
+			continue
+		}
+		copied := make(map[string]interface{}, len(plugin)+2)
+		for k, v := range plugin {
+			copied[k] = v
+		}
+		copied["name"] = conf["name"]
+		if v, ok := conf["cniVersion"]; ok {
+			copied["cniVersion"] = v
+		}
+		plugins = append(plugins, copied)
+	}
+	return plugins
+}
+
+// delegates returns confs of plugins which set up the network in order
+func (info *NetworkInfo) delegates() []map[string]interface{} {
+	if len(info.Plugins) > 0 {
+		return info.Plugins
+	}
+	return []map[string]interface{}{info.Conf}
+}
+
+// delegateAddChain executes ADD of plugins of the network in order, each plugin gets the result of the previous one
+// as prevResult. The first plugin gets results of previous networks.
+func delegateAddChain(info *NetworkInfo, cmdArgs *skel.CmdArgs, prevResult *types100.Result) (result *types100.Result,
+	err error) {
+	defer func(start time.Time) {
+		observer.ObserveNetwork(COMMAND_ADD, info.NetworkType, time.Since(start), err)
+	}(time.Now())
+	for _, conf := range info.delegates() {
+		var r types.Result
+		if err := observeDelegate(COMMAND_ADD, conf, func() (err error) {
+			r, err = DelegateAdd(withPrevResult(conf, prevResult), cmdArgs, info.IfName)
+			return
+		}); err != nil {
+			return nil, fmt.Errorf("plugin %v: %v", conf["type"], err)
+		}
+		if prevResult, err = types100.NewResultFromResult(r); err != nil {
+			return nil, fmt.Errorf("failed to convert result of plugin %v: %v", conf["type"], err)
+		}
+	}
+	return prevResult, nil
+}
+
+// delegateDelChain executes DEL of all plugins of the network in reverse order with the result of ADD as prevResult
+func delegateDelChain(info *NetworkInfo, cmdArgs *skel.CmdArgs) (err error) {
+	defer func(start time.Time) {
+		observer.ObserveNetwork(COMMAND_DEL, info.NetworkType, time.Since(start), err)
+	}(time.Now())
+	plugins := info.delegates()
+	var errorSet []string
+	for i := len(plugins) - 1; i >= 0; i-- {
+		conf := plugins[i]
+		if err := observeDelegate(COMMAND_DEL, conf, func() error {
+			return DelegateDel(withPrevResult(conf, info.Result), cmdArgs, info.IfName)
+		}); err != nil {
+			errorSet = append(errorSet, fmt.Sprintf("plugin %v: %v", plugins[i]["type"], err))
+		}
+	}
+	if len(errorSet) > 0 {
+		return fmt.Errorf(strings.Join(errorSet, " / "))
+	}
+	return nil
+}
+
+// delegateCheckChain executes CHECK of plugins of the network which support it in order. prevResult is the result of
+// ADD of the network if saved, otherwise the result passed by runtime.
+func delegateCheckChain(info *NetworkInfo, cmdArgs *skel.CmdArgs, prevResult *types100.Result) (err error) {
+	defer func(start time.Time) {
+		observer.ObserveNetwork(COMMAND_CHECK, info.NetworkType, time.Since(start), err)
+	}(time.Now())
+	if info.Result != nil {
+		prevResult = info.Result
+	}
+	for _, conf := range info.delegates() {
+		if !supportCheck(networkConfVersion(conf)) {
+			continue
+		}
+		if err := observeDelegate(COMMAND_CHECK, conf, func() error {
+			return DelegateCheck(withPrevResult(conf, prevResult), cmdArgs, info.IfName)
+		}); err != nil {
+			return fmt.Errorf("plugin %v: %v", conf["type"], err)
+		}
+	}
+	return nil
+}
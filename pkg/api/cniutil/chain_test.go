@@ -0,0 +1,123 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package cniutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/containernetworking/cni/pkg/skel"
+)
+
+// writePlugin writes a plugin script which logs its command and stdin to log and prints result on ADD
+func writePlugin(dir, name, log, result string) error {
+	script := fmt.Sprintf(`#!/bin/sh
+echo "$CNI_COMMAND %s $(cat)" >> %s
+if [ "$CNI_COMMAND" = "ADD" ]; then echo '%s'; fi
+`, name, log, result)
+	return ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755)
+}
+
+// recordObserver records observed executions as "command type"
+type recordObserver struct {
+	networks, delegates []string
+}
+
+func (o *recordObserver) ObserveNetwork(command, networkType string, _ time.Duration, _ error) {
+	o.networks = append(o.networks, command+" "+networkType)
+}
+
+func (o *recordObserver) ObserveDelegate(command, pluginType string, _ time.Duration, _ error) {
+	o.delegates = append(o.delegates, command+" "+pluginType)
+}
+
+// #lizard forgives
+func TestPluginChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestPluginChain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	useTempStateStore(t, dir)
+	o := &recordObserver{}
+	SetObserver(o)
+	defer SetObserver(nopObserver{})
+	log := filepath.Join(dir, "log")
+	if err := writePlugin(dir, "p1", log,
+		`{"cniVersion":"1.0.0","ips":[{"address":"10.0.0.2/24","gateway":"10.0.0.1"}]}`); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePlugin(dir, "p2", log, `{"cniVersion":"1.0.0","interfaces":[{"name":"eth0",`+
+		`"sandbox":"/var/run/netns/ctn"}],"ips":[{"address":"10.0.0.2/24","gateway":"10.0.0.1"}]}`); err != nil {
+		t.Fatal(err)
+	}
+	conf := map[string]interface{}{"cniVersion": "1.0.0", "name": "chain",
+		"plugins": []interface{}{map[string]interface{}{"type": "p1"}, map[string]interface{}{"type": "p2"}}}
+	info := NewNetworkInfo("chain", conf, "eth0")
+	if len(info.Plugins) != 2 || info.Plugins[1]["name"] != "chain" || info.Plugins[1]["cniVersion"] != "1.0.0" {
+		t.Fatalf("unexpected plugins %v", info.Plugins)
+	}
+	cmdArgs := &skel.CmdArgs{ContainerID: "ctn1", Netns: "/var/run/netns/ctn", IfName: "eth0", Path: dir}
+	result, err := CmdAdd(cmdArgs, PodInfo{UID: "uid1", Name: "pod1", Namespace: "ns1"}, []*NetworkInfo{info})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Interfaces) != 1 || len(result.IPs) != 1 {
+		t.Fatalf("unexpected result %v", result)
+	}
+	if state, err := LoadState("ctn1"); err != nil || len(state.Networks) != 1 || state.Networks[0].Result == nil {
+		t.Fatalf("expect result of the chain is saved, got %v, %v", state, err)
+	}
+	if err := CmdDel(cmdArgs, -1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState("ctn1"); err != ErrStateNotFound {
+		t.Fatalf("expect state is deleted, got %v", err)
+	}
+	data, err := ioutil.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	var cmds []string
+	for _, line := range lines {
+		cmds = append(cmds, strings.Join(strings.Fields(line)[:2], " "))
+	}
+	if strings.Join(cmds, ",") != "ADD p1,ADD p2,DEL p2,DEL p1" {
+		t.Fatalf("unexpected commands %v", cmds)
+	}
+	if strings.Join(o.delegates, ",") != strings.Join(cmds, ",") ||
+		strings.Join(o.networks, ",") != "ADD chain,DEL chain" {
+		t.Fatalf("unexpected observed executions %v, %v", o.networks, o.delegates)
+	}
+	if strings.Contains(lines[0], "prevResult") {
+		t.Fatalf("unexpected prevResult of the first plugin: %s", lines[0])
+	}
+	// the second plugin gets result of the first one, and DEL gets result of the chain
+	for i, expect := range []string{`"prevResult":{"cniVersion":"1.0.0","ips":[{"address":"10.0.0.2/24"`,
+		`"prevResult":{"cniVersion":"1.0.0","interfaces":[{"name":"eth0"`,
+		`"prevResult":{"cniVersion":"1.0.0","interfaces":[{"name":"eth0"`} {
+		if !strings.Contains(lines[i+1], expect) {
+			t.Fatalf("expect %s in %s", expect, lines[i+1])
+		}
+	}
+}
@@ -17,6 +17,7 @@
 package cniutil
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -30,7 +31,7 @@ import (
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
 	t020 "github.com/containernetworking/cni/pkg/types/020"
-	"github.com/containernetworking/plugins/pkg/ip"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
 	"github.com/vishvananda/netlink"
 	glog "k8s.io/klog"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
@@ -50,8 +51,10 @@ const (
 	CNI_IFNAME      = "CNI_IFNAME"
 	CNI_PATH        = "CNI_PATH"
 
-	COMMAND_ADD = "ADD"
-	COMMAND_DEL = "DEL"
+	COMMAND_ADD     = "ADD"
+	COMMAND_DEL     = "DEL"
+	COMMAND_CHECK   = "CHECK"
+	COMMAND_VERSION = "VERSION"
 )
 
 // BuildCNIArgs builds cni args as string such as key1=val1;key2=val2
@@ -91,14 +94,35 @@ func DelegateAdd(netconf map[string]interface{}, args *skel.CmdArgs, ifName stri
 		return nil, err
 	}
 	glog.Infof("delegate add %s args %s conf %s", args.ContainerID, args.Args, string(netconfBytes))
-	return invoke.ExecPluginWithResult(pluginPath, netconfBytes, &invoke.Args{
+	return invoke.ExecPluginWithResult(context.TODO(), pluginPath, netconfBytes, &invoke.Args{
 		Command:       "ADD",
 		ContainerID:   args.ContainerID,
 		NetNS:         args.Netns,
 		PluginArgsStr: args.Args,
 		IfName:        ifName,
 		Path:          args.Path,
-	})
+	}, nil)
+}
+
+// DelegateCheck calles delegate cni binary to execute cmdCheck
+func DelegateCheck(netconf map[string]interface{}, args *skel.CmdArgs, ifName string) error {
+	netconfBytes, err := json.Marshal(netconf)
+	if err != nil {
+		return fmt.Errorf("error serializing delegate netconf: %v", err)
+	}
+	pluginPath, err := invoke.FindInPath(netconf["type"].(string), strings.Split(args.Path, ":"))
+	if err != nil {
+		return err
+	}
+	glog.V(4).Infof("delegate check %s args %s conf %s", args.ContainerID, args.Args, string(netconfBytes))
+	return invoke.ExecPluginWithoutResult(context.TODO(), pluginPath, netconfBytes, &invoke.Args{
+		Command:       "CHECK",
+		ContainerID:   args.ContainerID,
+		NetNS:         args.Netns,
+		PluginArgsStr: args.Args,
+		IfName:        ifName,
+		Path:          args.Path,
+	}, nil)
 }
 
 // DelegateDel calles delegate cni binary to execute cmdDEL
@@ -112,35 +136,41 @@ func DelegateDel(netconf map[string]interface{}, args *skel.CmdArgs, ifName stri
 		return err
 	}
 	glog.Infof("delegate del %s args %s conf %s", args.ContainerID, args.Args, string(netconfBytes))
-	return invoke.ExecPluginWithoutResult(pluginPath, netconfBytes, &invoke.Args{
+	return invoke.ExecPluginWithoutResult(context.TODO(), pluginPath, netconfBytes, &invoke.Args{
 		Command:       "DEL",
 		ContainerID:   args.ContainerID,
 		NetNS:         args.Netns,
 		PluginArgsStr: args.Args,
 		IfName:        ifName,
 		Path:          args.Path,
-	})
+	}, nil)
 }
 
-// CmdAdd saves networkInfos to disk and executes each cni binary to setup network
-func CmdAdd(cmdArgs *skel.CmdArgs, networkInfos []*NetworkInfo) (types.Result, error) {
+// CmdAdd saves networkInfos to disk and executes each cni binary to setup network. Results of cni binaries of any
+// version are merged into a current version result.
+func CmdAdd(cmdArgs *skel.CmdArgs, pod PodInfo, networkInfos []*NetworkInfo) (*types100.Result, error) {
 	if len(networkInfos) == 0 {
 		return nil, fmt.Errorf("No network info returned")
 	}
-	if err := saveNetworkInfo(cmdArgs.ContainerID, networkInfos); err != nil {
+	saveNetworks := func(state *ContainerState) {
+		state.Pod, state.Networks = pod, networkInfos
+	}
+	if err := updateState(cmdArgs.ContainerID, saveNetworks); err != nil {
 		return nil, fmt.Errorf("Error save network info %v for %s: %v", networkInfos, cmdArgs.ContainerID, err)
 	}
-	var (
-		err    error
-		result types.Result
-	)
+	var merged *types100.Result
 	for idx, networkInfo := range networkInfos {
 		//append additional args from network info
 		cmdArgs.Args = strings.TrimRight(fmt.Sprintf("%s;%s", cmdArgs.Args, BuildCNIArgs(networkInfo.Args)), ";")
-		if result != nil {
-			networkInfo.Conf["prevResult"] = result
+		result, err := delegateAddChain(networkInfo, cmdArgs, merged)
+		if err == nil {
+			networkInfo.Result = result
+			if err := updateState(cmdArgs.ContainerID, saveNetworks); err != nil {
+				// DEL works without prevResult
+				glog.Warningf("Error save network info %v for %s: %v", networkInfos, cmdArgs.ContainerID, err)
+			}
+			merged, err = MergeResult(merged, result)
 		}
-		result, err = DelegateAdd(networkInfo.Conf, cmdArgs, networkInfo.IfName)
 		if err != nil {
 			//fail to add cni, then delete all established CNIs recursively
 			glog.Errorf("fail to add network %s: %v, begin to rollback and delete it", networkInfo.Args, err)
@@ -149,10 +179,50 @@ func CmdAdd(cmdArgs *skel.CmdArgs, networkInfos []*NetworkInfo) (types.Result, e
 			return nil, fmt.Errorf("fail to establish network %s:%v", networkInfo.Args, err)
 		}
 	}
+	return merged, nil
+}
+
+// withPrevResult returns a copy of conf with prevResult converted to the version of conf
+func withPrevResult(conf map[string]interface{}, prevResult *types100.Result) map[string]interface{} {
+	if prevResult == nil {
+		return conf
+	}
+	confVersion := networkConfVersion(conf)
+	prev, err := prevResult.GetAsVersion(confVersion)
 	if err != nil {
-		return nil, err
+		glog.Warningf("failed to convert prevResult to %s: %v", confVersion, err)
+		return conf
+	}
+	copied := make(map[string]interface{}, len(conf)+1)
+	for k, v := range conf {
+		copied[k] = v
 	}
-	return result, nil
+	copied["prevResult"] = prev
+	return copied
+}
+
+// CmdCheck checks that interfaces and ips of prevResult exist in the container and executes CHECK of each cni binary
+// which supports it. Cni binaries of versions earlier than 0.4.0 are skipped.
+func CmdCheck(cmdArgs *skel.CmdArgs, prevResult *types100.Result) error {
+	state, err := LoadState(cmdArgs.ContainerID)
+	if err != nil {
+		if err == ErrStateNotFound {
+			return fmt.Errorf("no network info for %s", cmdArgs.ContainerID)
+		}
+		return fmt.Errorf("Error load network info for %s: %v", cmdArgs.ContainerID, err)
+	}
+	networkInfos := state.Networks
+	if err := CheckResult(cmdArgs.Netns, prevResult); err != nil {
+		return err
+	}
+	for _, networkInfo := range networkInfos {
+		//append additional args from network info
+		cmdArgs.Args = strings.TrimRight(fmt.Sprintf("%s;%s", cmdArgs.Args, BuildCNIArgs(networkInfo.Args)), ";")
+		if err := delegateCheckChain(networkInfo, cmdArgs, prevResult); err != nil {
+			return fmt.Errorf("failed to check network %s: %v", networkInfo.Args, err)
+		}
+	}
+	return nil
 }
 
 // NetworkInfo wraps network infos which are needed for cni plugin to setup network
@@ -161,11 +231,16 @@ type NetworkInfo struct {
 	Args        map[string]string
 	Conf        map[string]interface{}
 	IfName      string
+	// Plugins is the plugin chain of a conflist network
+	Plugins []map[string]interface{} `json:",omitempty"`
+	// Result is the result of setting up the network, which is passed to plugins as prevResult during DEL
+	Result *types100.Result `json:",omitempty"`
 }
 
-// NewNetworkInfo creates a NetworkInfo
+// NewNetworkInfo creates a NetworkInfo. If conf is a conflist, the network is set up by its plugin chain.
 func NewNetworkInfo(networkType string, conf map[string]interface{}, ifName string) *NetworkInfo {
-	return &NetworkInfo{NetworkType: networkType, Args: map[string]string{}, Conf: conf, IfName: ifName}
+	return &NetworkInfo{NetworkType: networkType, Args: map[string]string{}, Conf: conf, IfName: ifName,
+		Plugins: chainPlugins(conf)}
 }
 
 func reverse(infos []*NetworkInfo) {
@@ -174,16 +249,19 @@ func reverse(infos []*NetworkInfo) {
 	}
 }
 
-// CmdDel restores networkInfos from disk and executes each cni binary to delete network
+// CmdDel restores networkInfos from the state store and executes each cni binary to delete network. Networks are
+// removed from the store only after all of them are deleted except the failed ones, so that a DEL interrupted by a
+// crash can be retried.
 func CmdDel(cmdArgs *skel.CmdArgs, lastIdx int) error {
-	networkInfos, err := consumeNetworkInfo(cmdArgs.ContainerID)
+	state, err := LoadState(cmdArgs.ContainerID)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if err == ErrStateNotFound {
 			// Duplicated cmdDel invoked by kubelet
 			return nil
 		}
-		return fmt.Errorf("Error consume network info %v for %s: %v", networkInfos, cmdArgs.ContainerID, err)
+		return fmt.Errorf("Error load network info for %s: %v", cmdArgs.ContainerID, err)
 	}
+	networkInfos := state.Networks
 	if lastIdx == -1 {
 		lastIdx = len(networkInfos) - 1
 	}
@@ -193,18 +271,20 @@ func CmdDel(cmdArgs *skel.CmdArgs, lastIdx int) error {
 		networkInfo := networkInfos[idx]
 		//append additional args from network info
 		cmdArgs.Args = strings.TrimRight(fmt.Sprintf("%s;%s", cmdArgs.Args, BuildCNIArgs(networkInfo.Args)), ";")
-		err := DelegateDel(networkInfo.Conf, cmdArgs, networkInfo.IfName)
+		err := delegateDelChain(networkInfo, cmdArgs)
 		if err != nil {
 			errorSet = append(errorSet, err.Error())
 			fails = append(fails, networkInfo)
 			glog.Errorf("failed to delete network %v: %v", networkInfo.Args, err)
 		}
 	}
+	reverse(fails)
+	if err := updateState(cmdArgs.ContainerID, func(state *ContainerState) {
+		state.Networks = fails
+	}); err != nil {
+		glog.Warningf("Error save network info %v for %s: %v", fails, cmdArgs.ContainerID, err)
+	}
 	if len(errorSet) > 0 {
-		reverse(fails)
-		if err := saveNetworkInfo(cmdArgs.ContainerID, fails); err != nil {
-			glog.Warningf("Error save network info %v for %s: %v", fails, cmdArgs.ContainerID, err)
-		}
 		return fmt.Errorf(strings.Join(errorSet, " / "))
 	}
 	return nil
@@ -249,7 +329,12 @@ func ConfigureIface(ifName string, res *t020.Result) error {
 		if gw == nil {
 			gw = res.IP4.Gateway
 		}
-		if err = ip.AddRoute(&r.Dst, gw, link); err != nil {
+		if err = netlink.RouteAdd(&netlink.Route{
+			LinkIndex: link.Attrs().Index,
+			Scope:     netlink.SCOPE_UNIVERSE,
+			Dst:       &r.Dst,
+			Gw:        gw,
+		}); err != nil {
 			// we skip over duplicate routes as we assume the first one wins
 			if !os.IsExist(err) {
 				return fmt.Errorf("failed to add route '%v via %v dev %v': %v", r.Dst, gw, ifName, err)
@@ -260,38 +345,46 @@ func ConfigureIface(ifName string, res *t020.Result) error {
 	return nil
 }
 
-const (
-	stateDir = "/var/lib/cni/galaxy"
-)
-
-func saveNetworkInfo(containerID string, infos []*NetworkInfo) error {
-	if err := os.MkdirAll(stateDir, 0700); err != nil {
-		return err
-	}
-	path := filepath.Join(stateDir, containerID)
-	data, err := json.Marshal(infos)
+func GetNetworkConfig(networkName, confdir string) ([]byte, error) {
+	files, err := NetworkConfigFiles(confdir)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return ioutil.WriteFile(path, data, 0600)
-}
+	for _, confFile := range files {
+		var confList *libcni.NetworkConfigList
+		if strings.HasSuffix(confFile, ".conflist") {
+			confList, err = libcni.ConfListFromFile(confFile)
+			if err != nil {
+				glog.Warningf("Error loading CNI conflist file %s: %v", confFile, err)
+				continue
+			}
 
-func consumeNetworkInfo(containerID string) ([]*NetworkInfo, error) {
-	var infos []*NetworkInfo
-	path := filepath.Join(stateDir, containerID)
-	defer os.Remove(path) // nolint: errcheck
+			if confList.Name == networkName || networkName == "" {
+				return confList.Bytes, nil
+			}
 
-	data, err := ioutil.ReadFile(path)
-	if err != nil {
-		return infos, err
-	}
-	if err := json.Unmarshal(data, &infos); err != nil {
-		return infos, err
+		} else {
+			conf, err := libcni.ConfFromFile(confFile)
+			if err != nil {
+				glog.Warningf("Error loading CNI config file %s: %v", confFile, err)
+				continue
+			}
+
+			if conf.Network.Name == networkName || networkName == "" {
+				// Ensure the config has a "type" so we know what plugin to run.
+				// Also catches the case where somebody put a conflist into a conf file.
+				if conf.Network.Type == "" {
+					return nil, fmt.Errorf("Error loading CNI config file %s: no 'type'; perhaps this is a .conflist?", confFile)
+				}
+				return conf.Bytes, nil
+			}
+		}
 	}
-	return infos, nil
+	return nil, fmt.Errorf("no network available in the name %s in cni dir %s", networkName, confdir)
 }
 
-func GetNetworkConfig(networkName, confdir string) ([]byte, error) {
+// NetworkConfigFiles returns network config files in confdir and its sub directories.
+func NetworkConfigFiles(confdir string) ([]string, error) {
 	// In part, adapted from K8s pkg/kubelet/dockershim/network/cni/cni.go#getDefaultCNINetwork
 	// Different from original code, the following search conf files for max dir depth=2
 	// if confdir=/etc/cni/net.d/, we will search for /etc/cni/net.d/tke-bridge-1.conf
@@ -316,35 +409,50 @@ func GetNetworkConfig(networkName, confdir string) ([]byte, error) {
 			files = append(files, moreFiles...)
 		}
 	}
+	return files, nil
+}
+
+// LoadNetworkConfigs loads all network configs in confdir and returns them by network name. If several files have
+// the same network name, the first one wins just like GetNetworkConfig. Files which fail to load are skipped and
+// reported in the returned error.
+func LoadNetworkConfigs(confdir string) (map[string][]byte, error) {
+	files, err := NetworkConfigFiles(confdir)
+	if err != nil {
+		return nil, err
+	}
+	confs := map[string][]byte{}
+	var errs []string
 	for _, confFile := range files {
-		var confList *libcni.NetworkConfigList
+		var (
+			name string
+			data []byte
+		)
 		if strings.HasSuffix(confFile, ".conflist") {
-			confList, err = libcni.ConfListFromFile(confFile)
+			confList, err := libcni.ConfListFromFile(confFile)
 			if err != nil {
-				glog.Warningf("Error loading CNI conflist file %s: %v", confFile, err)
+				errs = append(errs, fmt.Sprintf("error loading CNI conflist file %s: %v", confFile, err))
 				continue
 			}
-
-			if confList.Name == networkName || networkName == "" {
-				return confList.Bytes, nil
-			}
-
+			name, data = confList.Name, confList.Bytes
 		} else {
 			conf, err := libcni.ConfFromFile(confFile)
 			if err != nil {
-				glog.Warningf("Error loading CNI config file %s: %v", confFile, err)
+				errs = append(errs, fmt.Sprintf("error loading CNI config file %s: %v", confFile, err))
 				continue
 			}
-
-			if conf.Network.Name == networkName || networkName == "" {
-				// Ensure the config has a "type" so we know what plugin to run.
-				// Also catches the case where somebody put a conflist into a conf file.
-				if conf.Network.Type == "" {
-					return nil, fmt.Errorf("Error loading CNI config file %s: no 'type'; perhaps this is a .conflist?", confFile)
-				}
-				return conf.Bytes, nil
+			if conf.Network.Type == "" {
+				errs = append(errs, fmt.Sprintf("error loading CNI config file %s: no 'type'; perhaps this is "+
+					"a .conflist?", confFile))
+				continue
 			}
+			name, data = conf.Network.Name, conf.Bytes
+		}
+		if _, ok := confs[name]; !ok {
+			confs[name] = data
 		}
 	}
-	return nil, fmt.Errorf("no network available in the name %s in cni dir %s", networkName, confdir)
+	if len(errs) > 0 {
+		return confs, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return confs, nil
 }
@@ -22,6 +22,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -71,3 +72,45 @@ func TestGetNetworkConfig(t *testing.T) {
 		t.Fatalf("nc %s, err %v", string(nc), err)
 	}
 }
+
+func TestLoadNetworkConfigs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadNetworkConfigs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	nc1 := []byte(`{"type": "t1", "name": "n1"}`)
+	nc2 := []byte(`{"name": "n2", "plugins": [{"type": "t2"}]}`)
+	if err := ioutil.WriteFile(filepath.Join(dir, "01-n1.conf"), nc1, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "multus"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "multus", "n2.conflist"), nc2, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// a later config with the same name doesn't override the first one
+	if err := ioutil.WriteFile(filepath.Join(dir, "02-n1.conf"), []byte(`{"type": "t3", "name": "n1"}`),
+		0644); err != nil {
+		t.Fatal(err)
+	}
+	confs, err := LoadNetworkConfigs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(confs) != 2 || !bytes.Equal(confs["n1"], nc1) || !bytes.Equal(confs["n2"], nc2) {
+		t.Fatalf("unexpected configs %v", confs)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "03-bad.conf"), []byte(`{"name": "bad"`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	confs, err = LoadNetworkConfigs(dir)
+	if err == nil || !strings.Contains(err.Error(), "03-bad.conf") {
+		t.Fatalf("expect error of the bad file, got %v", err)
+	}
+	if len(confs) != 2 {
+		t.Fatalf("expect good configs are still loaded, got %v", confs)
+	}
+}
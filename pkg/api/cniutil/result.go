@@ -0,0 +1,176 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package cniutil
+
+import (
+	"fmt"
+
+	"github.com/containernetworking/cni/pkg/types"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+)
+
+// ConfVersion returns the cniVersion of network config. An empty cniVersion is treated as 0.1.0 as CNI spec says.
+func ConfVersion(conf []byte) (string, error) {
+	return (&version.ConfigDecoder{}).Decode(conf)
+}
+
+// supportCheck returns true if plugins of the config version support CHECK command
+func supportCheck(confVersion string) bool {
+	ok, err := version.GreaterThanOrEqualTo(confVersion, "0.4.0")
+	return err == nil && ok
+}
+
+// networkConfVersion returns the cniVersion of network conf map
+func networkConfVersion(conf map[string]interface{}) string {
+	if v, ok := conf["cniVersion"].(string); ok && v != "" {
+		return v
+	}
+	return "0.1.0"
+}
+
+// MergeResult merges a delegate's result of any version into the merged current version result of previous
+// delegates. Interfaces, ips and routes already in merged, e.g. those of prevResult returned by chained plugins, are
+// not duplicated.
+func MergeResult(merged *types100.Result, result types.Result) (*types100.Result, error) {
+	r, err := types100.NewResultFromResult(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert result to %s: %v", types100.ImplementedSpecVersion, err)
+	}
+	if merged == nil {
+		return r, nil
+	}
+	ifIndex := map[int]int{}
+	for i, iface := range r.Interfaces {
+		j := findInterface(merged.Interfaces, iface)
+		if j < 0 {
+			merged.Interfaces = append(merged.Interfaces, iface)
+			j = len(merged.Interfaces) - 1
+		}
+		ifIndex[i] = j
+	}
+	for _, ipc := range r.IPs {
+		if hasIP(merged.IPs, ipc) {
+			continue
+		}
+		if ipc.Interface != nil {
+			if j, ok := ifIndex[*ipc.Interface]; ok {
+				ipc.Interface = types100.Int(j)
+			} else {
+				ipc.Interface = nil
+			}
+		}
+		merged.IPs = append(merged.IPs, ipc)
+	}
+	for _, route := range r.Routes {
+		if !hasRoute(merged.Routes, route) {
+			merged.Routes = append(merged.Routes, route)
+		}
+	}
+	if len(merged.DNS.Nameservers) == 0 {
+		merged.DNS = r.DNS
+	}
+	return merged, nil
+}
+
+func findInterface(ifaces []*types100.Interface, iface *types100.Interface) int {
+	for i := range ifaces {
+		if ifaces[i].Name == iface.Name && ifaces[i].Sandbox == iface.Sandbox {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasIP(ips []*types100.IPConfig, ipc *types100.IPConfig) bool {
+	for i := range ips {
+		if ips[i].Address.IP.Equal(ipc.Address.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRoute(routes []*types.Route, route *types.Route) bool {
+	for i := range routes {
+		if routes[i].String() == route.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// PrimaryIPv4 returns the first ipv4 address of result
+func PrimaryIPv4(result *types100.Result) (*types100.IPConfig, error) {
+	for _, ipc := range result.IPs {
+		if ipc.Address.IP.To4() != nil {
+			return ipc, nil
+		}
+	}
+	return nil, fmt.Errorf("CNI plugin reported no IPv4 address")
+}
+
+// CheckResult checks that container side interfaces and ips of result exist in the network namespace
+func CheckResult(netns string, result *types100.Result) error {
+	netNS, err := ns.GetNS(netns)
+	if err != nil {
+		return fmt.Errorf("failed to open netns %s: %v", netns, err)
+	}
+	defer netNS.Close() // nolint: errcheck
+	return netNS.Do(func(_ ns.NetNS) error {
+		for _, iface := range result.Interfaces {
+			if iface.Sandbox == "" {
+				continue
+			}
+			if _, err := netlink.LinkByName(iface.Name); err != nil {
+				return fmt.Errorf("failed to find interface %s: %v", iface.Name, err)
+			}
+		}
+		for _, ipc := range result.IPs {
+			var link netlink.Link
+			if ipc.Interface != nil && *ipc.Interface >= 0 && *ipc.Interface < len(result.Interfaces) {
+				iface := result.Interfaces[*ipc.Interface]
+				if iface.Sandbox == "" {
+					// host side ip
+					continue
+				}
+				if link, err = netlink.LinkByName(iface.Name); err != nil {
+					return fmt.Errorf("failed to find interface %s: %v", iface.Name, err)
+				}
+			}
+			addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+			if err != nil {
+				return fmt.Errorf("failed to list addresses: %v", err)
+			}
+			if !hasAddr(addrs, ipc) {
+				return fmt.Errorf("ip %s is not found in netns %s", ipc.Address.String(), netns)
+			}
+		}
+		return nil
+	})
+}
+
+func hasAddr(addrs []netlink.Addr, ipc *types100.IPConfig) bool {
+	for i := range addrs {
+		if addrs[i].IPNet != nil && addrs[i].IP.Equal(ipc.Address.IP) {
+			return true
+		}
+	}
+	return false
+}
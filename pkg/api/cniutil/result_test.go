@@ -0,0 +1,83 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package cniutil
+
+import (
+	"net"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/types"
+	t020 "github.com/containernetworking/cni/pkg/types/020"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+)
+
+func TestConfVersion(t *testing.T) {
+	for conf, expect := range map[string]string{
+		`{"name":"n1","type":"t1"}`:                      "0.1.0",
+		`{"cniVersion":"0.2.0","name":"n1","type":"t1"}`: "0.2.0",
+		`{"cniVersion":"1.0.0","name":"n1","type":"t1"}`: "1.0.0",
+	} {
+		if v, err := ConfVersion([]byte(conf)); err != nil || v != expect {
+			t.Fatalf("conf %s, expect %s, got %s, err %v", conf, expect, v, err)
+		}
+	}
+}
+
+// #lizard forgives
+func TestMergeResult(t *testing.T) {
+	ip1 := &net.IPNet{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(24, 32)}
+	ip2 := &net.IPNet{IP: net.ParseIP("10.0.1.2"), Mask: net.CIDRMask(24, 32)}
+	// result of a 0.2.0 plugin
+	merged, err := MergeResult(nil, &t020.Result{CNIVersion: "0.2.0", IP4: &t020.IPConfig{IP: *ip1,
+		Gateway: net.ParseIP("10.0.0.1")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// result of a 1.0.0 plugin containing prevResult
+	eth1 := &types100.Interface{Name: "eth1", Sandbox: "/var/run/netns/ctn"}
+	merged, err = MergeResult(merged, &types100.Result{
+		CNIVersion: types100.ImplementedSpecVersion,
+		Interfaces: []*types100.Interface{{Name: "veth1"}, eth1},
+		IPs:        []*types100.IPConfig{{Address: *ip1}, {Address: *ip2, Interface: types100.Int(1)}},
+		Routes: []*types.Route{{Dst: net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)},
+			GW: net.ParseIP("10.0.0.1")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merged.Interfaces) != 2 || merged.Interfaces[1].Name != "eth1" {
+		t.Fatalf("unexpected interfaces %v", merged.Interfaces)
+	}
+	if len(merged.IPs) != 2 || !merged.IPs[1].Address.IP.Equal(ip2.IP) || *merged.IPs[1].Interface != 1 {
+		t.Fatalf("unexpected ips %v", merged.IPs)
+	}
+	if len(merged.Routes) != 1 {
+		t.Fatalf("unexpected routes %v", merged.Routes)
+	}
+	ipc, err := PrimaryIPv4(merged)
+	if err != nil || !ipc.Address.IP.Equal(ip1.IP) {
+		t.Fatalf("unexpected primary ip %v, err %v", ipc, err)
+	}
+	// 0.2.0 results carry only the first ip
+	r, err := merged.GetAsVersion("0.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result020 := r.(*t020.Result); !result020.IP4.IP.IP.Equal(ip1.IP) {
+		t.Fatalf("unexpected 0.2.0 result %v", result020)
+	}
+}
@@ -0,0 +1,372 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package cniutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/k8s"
+)
+
+var (
+	// stateDBPath is the bolt db saving states of containers which galaxy sets up
+	stateDBPath = "/var/lib/cni/galaxy.db"
+	// legacyStateDir and legacyPortDir are where earlier versions saved network infos and ports of containers as
+	// files, they are migrated into the db on opening it
+	legacyStateDir = "/var/lib/cni/galaxy"
+	legacyPortDir  = "/var/lib/cni/galaxy/port"
+
+	containersBucket = []byte("containers")
+	// podsBucket indexes containers by pod uid, its keys are podUID/containerID
+	podsBucket = []byte("pods")
+
+	// ErrStateNotFound is returned if there is no state of a container
+	ErrStateNotFound = errors.New("container state not found")
+)
+
+const (
+	// stateSchemaVersion is the schema version of ContainerState. Bump it and upgrade states of older versions in
+	// decodeState if the schema changes incompatibly.
+	stateSchemaVersion = 1
+	openStateTimeout   = 10 * time.Second
+)
+
+// PodInfo identifies the pod of a container
+type PodInfo struct {
+	UID       string `json:"uid,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ContainerState is the record of a container in the state store. It's deleted once it has neither networks nor
+// ports.
+type ContainerState struct {
+	SchemaVersion int            `json:"schemaVersion"`
+	ContainerID   string         `json:"containerID"`
+	Pod           PodInfo        `json:"pod"`
+	Networks      []*NetworkInfo `json:"networks,omitempty"`
+	Ports         []k8s.Port     `json:"ports,omitempty"`
+}
+
+func (s *ContainerState) empty() bool {
+	return len(s.Networks) == 0 && len(s.Ports) == 0
+}
+
+// stateStore opens the db lazily, only one process can open it at a time
+type stateStore struct {
+	sync.Mutex
+	db *bolt.DB
+}
+
+var store stateStore
+
+// OpenStateStore opens the state store and migrates states saved as files by earlier versions
+func OpenStateStore() error {
+	_, err := store.open()
+	return err
+}
+
+func (s *stateStore) open() (*bolt.DB, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.db != nil {
+		return s.db, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(stateDBPath), 0700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(stateDBPath, 0600, &bolt.Options{Timeout: openStateTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state db %s: %v", stateDBPath, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{containersBucket, podsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create buckets of state db %s: %v", stateDBPath, err)
+	}
+	if err := migrateLegacyStates(db); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to migrate legacy states: %v", err)
+	}
+	s.db = db
+	return db, nil
+}
+
+func (s *stateStore) close() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.db == nil {
+		return nil
+	}
+	err := s.db.Close()
+	s.db = nil
+	return err
+}
+
+func decodeState(data []byte) (*ContainerState, error) {
+	var state ContainerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if state.SchemaVersion > stateSchemaVersion {
+		return nil, fmt.Errorf("state of %s has schema version %d, newer than supported version %d",
+			state.ContainerID, state.SchemaVersion, stateSchemaVersion)
+	}
+	// upgrade states of older schema versions here
+	state.SchemaVersion = stateSchemaVersion
+	return &state, nil
+}
+
+func podKey(podUID, containerID string) []byte {
+	return []byte(podUID + "/" + containerID)
+}
+
+func getState(tx *bolt.Tx, containerID string) (*ContainerState, error) {
+	data := tx.Bucket(containersBucket).Get([]byte(containerID))
+	if data == nil {
+		return nil, ErrStateNotFound
+	}
+	return decodeState(data)
+}
+
+// putState saves state and maintains the pod index, the state is deleted if it's empty
+func putState(tx *bolt.Tx, old, state *ContainerState) error {
+	containers, pods := tx.Bucket(containersBucket), tx.Bucket(podsBucket)
+	if old != nil && old.Pod.UID != "" && (state.empty() || old.Pod.UID != state.Pod.UID) {
+		if err := pods.Delete(podKey(old.Pod.UID, old.ContainerID)); err != nil {
+			return err
+		}
+	}
+	if state.empty() {
+		return containers.Delete([]byte(state.ContainerID))
+	}
+	state.SchemaVersion = stateSchemaVersion
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := containers.Put([]byte(state.ContainerID), data); err != nil {
+		return err
+	}
+	if state.Pod.UID != "" {
+		return pods.Put(podKey(state.Pod.UID, state.ContainerID), []byte{})
+	}
+	return nil
+}
+
+// updateState updates the state of a container by f in a transaction, f gets an empty state if there is none. The
+// state is deleted if f leaves neither networks nor ports in it.
+func updateState(containerID string, f func(*ContainerState)) error {
+	db, err := store.open()
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		old, err := getState(tx, containerID)
+		if err != nil && err != ErrStateNotFound {
+			return err
+		}
+		state := &ContainerState{ContainerID: containerID}
+		if old != nil {
+			copied := *old
+			state = &copied
+		}
+		f(state)
+		return putState(tx, old, state)
+	})
+}
+
+// LoadState returns the state of a container or ErrStateNotFound
+func LoadState(containerID string) (*ContainerState, error) {
+	db, err := store.open()
+	if err != nil {
+		return nil, err
+	}
+	var state *ContainerState
+	err = db.View(func(tx *bolt.Tx) error {
+		state, err = getState(tx, containerID)
+		return err
+	})
+	return state, err
+}
+
+// ListStates returns states of all containers, states which fail to decode are skipped
+func ListStates() ([]*ContainerState, error) {
+	db, err := store.open()
+	if err != nil {
+		return nil, err
+	}
+	var states []*ContainerState
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(containersBucket).ForEach(func(k, v []byte) error {
+			state, err := decodeState(v)
+			if err != nil {
+				glog.Warningf("failed to decode state of %s: %v", string(k), err)
+				return nil
+			}
+			states = append(states, state)
+			return nil
+		})
+	})
+	return states, err
+}
+
+// PodContainerIDs returns ids of containers of a pod which have states
+func PodContainerIDs(podUID string) ([]string, error) {
+	db, err := store.open()
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	prefix := []byte(podUID + "/")
+	err = db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(podsBucket).Cursor()
+		for k, _ := c.Seek(prefix); k != nil && strings.HasPrefix(string(k), string(prefix)); k, _ = c.Next() {
+			ids = append(ids, string(k[len(prefix):]))
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// DeleteState deletes the state of a container
+func DeleteState(containerID string) error {
+	return updateState(containerID, func(state *ContainerState) {
+		state.Networks, state.Ports = nil, nil
+	})
+}
+
+// SavePorts saves port mappings of a container
+func SavePorts(containerID string, ports []k8s.Port) error {
+	return updateState(containerID, func(state *ContainerState) {
+		state.Ports = ports
+	})
+}
+
+// LoadPorts returns port mappings of a container, or ErrStateNotFound if the container has no state
+func LoadPorts(containerID string) ([]k8s.Port, error) {
+	state, err := LoadState(containerID)
+	if err != nil {
+		return nil, err
+	}
+	return state.Ports, nil
+}
+
+// DeletePorts deletes port mappings of a container
+func DeletePorts(containerID string) error {
+	return updateState(containerID, func(state *ContainerState) {
+		state.Ports = nil
+	})
+}
+
+// migrateLegacyStates moves network infos and ports saved as files by earlier versions into the db. Files are
+// removed after the transaction commits, a file whose container already has a state in the db is not migrated again.
+func migrateLegacyStates(db *bolt.DB) error {
+	var migrated []string
+	if err := db.Update(func(tx *bolt.Tx) error {
+		states := map[string]*ContainerState{}
+		if err := readLegacyFiles(legacyStateDir, &migrated, func(containerID string, data []byte) error {
+			var infos []*NetworkInfo
+			if err := json.Unmarshal(data, &infos); err != nil {
+				return err
+			}
+			states[containerID] = &ContainerState{ContainerID: containerID, Networks: infos}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := readLegacyFiles(legacyPortDir, &migrated, func(containerID string, data []byte) error {
+			var ports []k8s.Port
+			if len(data) != 0 {
+				if err := json.Unmarshal(data, &ports); err != nil {
+					return err
+				}
+			}
+			if _, ok := states[containerID]; !ok {
+				states[containerID] = &ContainerState{ContainerID: containerID}
+			}
+			states[containerID].Ports = ports
+			return nil
+		}); err != nil {
+			return err
+		}
+		for containerID, state := range states {
+			if _, err := getState(tx, containerID); err == nil {
+				continue
+			}
+			if err := putState(tx, nil, state); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	for _, file := range migrated {
+		if err := os.Remove(file); err != nil {
+			glog.Warningf("failed to remove migrated state file %s: %v", file, err)
+		}
+	}
+	if len(migrated) > 0 {
+		glog.Infof("migrated %d legacy state files into %s", len(migrated), stateDBPath)
+	}
+	return nil
+}
+
+// readLegacyFiles calls f with each file in dir whose name is a container id, files are appended to migrated if f
+// succeeds
+func readLegacyFiles(dir string, migrated *[]string, f func(containerID string, data []byte) error) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		data, err := ioutil.ReadFile(path)
+		if err == nil {
+			err = f(file.Name(), data)
+		}
+		if err != nil {
+			glog.Warningf("failed to migrate legacy state file %s: %v", path, err)
+			continue
+		}
+		*migrated = append(*migrated, path)
+	}
+	return nil
+}
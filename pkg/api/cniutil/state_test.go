@@ -0,0 +1,179 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package cniutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+	"tkestack.io/galaxy/pkg/api/k8s"
+)
+
+// useTempStateStore points the state store and legacy state dirs to dir
+func useTempStateStore(t *testing.T, dir string) {
+	oldDBPath, oldStateDir, oldPortDir := stateDBPath, legacyStateDir, legacyPortDir
+	stateDBPath = filepath.Join(dir, "galaxy.db")
+	legacyStateDir = filepath.Join(dir, "galaxy")
+	legacyPortDir = filepath.Join(dir, "galaxy", "port")
+	t.Cleanup(func() {
+		if err := store.close(); err != nil {
+			t.Error(err)
+		}
+		stateDBPath, legacyStateDir, legacyPortDir = oldDBPath, oldStateDir, oldPortDir
+	})
+}
+
+// #lizard forgives
+func TestStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestStateStore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	useTempStateStore(t, dir)
+	if _, err := LoadState("c1"); err != ErrStateNotFound {
+		t.Fatalf("expect ErrStateNotFound, got %v", err)
+	}
+	pod := PodInfo{UID: "uid1", Name: "pod1", Namespace: "ns1"}
+	info := NewNetworkInfo("galaxy-flannel", map[string]interface{}{"type": "galaxy-flannel"}, "eth0")
+	if err := updateState("c1", func(state *ContainerState) {
+		state.Pod, state.Networks = pod, []*NetworkInfo{info}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ports := []k8s.Port{{HostPort: 30001, ContainerPort: 80, Protocol: "TCP", PodName: "pod1"}}
+	if err := SavePorts("c1", ports); err != nil {
+		t.Fatal(err)
+	}
+	state, err := LoadState("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.SchemaVersion != stateSchemaVersion || state.Pod != pod || len(state.Networks) != 1 ||
+		state.Networks[0].NetworkType != "galaxy-flannel" || !reflect.DeepEqual(state.Ports, ports) {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	// reads are not destructive
+	if _, err := LoadState("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := PodContainerIDs("uid1"); err != nil || !reflect.DeepEqual(ids, []string{"c1"}) {
+		t.Fatalf("expect [c1], got %v, %v", ids, err)
+	}
+	if states, err := ListStates(); err != nil || len(states) != 1 || states[0].ContainerID != "c1" {
+		t.Fatalf("unexpected states %v, %v", states, err)
+	}
+
+	// the state is kept until both networks and ports are deleted
+	if err := updateState("c1", func(state *ContainerState) { state.Networks = nil }); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := LoadPorts("c1"); err != nil || !reflect.DeepEqual(got, ports) {
+		t.Fatalf("expect ports %v, got %v, %v", ports, got, err)
+	}
+	if err := DeletePorts("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState("c1"); err != ErrStateNotFound {
+		t.Fatalf("expect state is deleted, got %v", err)
+	}
+	if ids, err := PodContainerIDs("uid1"); err != nil || len(ids) != 0 {
+		t.Fatalf("expect pod index is deleted, got %v, %v", ids, err)
+	}
+
+	// states of a newer schema version written by a newer galaxy are not understood
+	db, err := store.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(containersBucket).Put([]byte("c2"), []byte(`{"schemaVersion":2,"containerID":"c2"}`))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState("c2"); err == nil {
+		t.Fatal("expect error of a newer schema version")
+	}
+}
+
+func TestMigrateLegacyStates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMigrateLegacyStates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	useTempStateStore(t, dir)
+	if err := os.MkdirAll(legacyPortDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for file, content := range map[string]string{
+		filepath.Join(legacyStateDir, "c1"): `[{"NetworkType":"galaxy-flannel","Args":{},"Conf":{"type":"galaxy-flannel"},"IfName":"eth0"}]`,
+		filepath.Join(legacyPortDir, "c1"):  `[{"hostPort":30001,"containerPort":80,"protocol":"TCP","podName":"pod1"}]`,
+		// a container which has only ports
+		filepath.Join(legacyPortDir, "c2"):  `[{"hostPort":30002,"containerPort":80,"protocol":"TCP","podName":"pod2"}]`,
+		filepath.Join(legacyStateDir, "c3"): `[{`,
+	} {
+		if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := OpenStateStore(); err != nil {
+		t.Fatal(err)
+	}
+	state, err := LoadState("c1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Networks) != 1 || state.Networks[0].IfName != "eth0" || len(state.Ports) != 1 ||
+		state.Ports[0].HostPort != 30001 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	if ports, err := LoadPorts("c2"); err != nil || len(ports) != 1 || ports[0].HostPort != 30002 {
+		t.Fatalf("unexpected ports %v, %v", ports, err)
+	}
+	for _, file := range []string{filepath.Join(legacyStateDir, "c1"), filepath.Join(legacyPortDir, "c1"),
+		filepath.Join(legacyPortDir, "c2")} {
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Fatalf("expect %s is removed, got %v", file, err)
+		}
+	}
+	// a bad file is left for gc
+	if _, err := os.Stat(filepath.Join(legacyStateDir, "c3")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadState("c3"); err != ErrStateNotFound {
+		t.Fatalf("expect no state of the bad file, got %v", err)
+	}
+
+	// a legacy file left by a crash after migration doesn't override the state in the db
+	if err := DeletePorts("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(legacyPortDir, "c1"), []byte(`[{"hostPort":30001}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if ports, err := LoadPorts("c1"); err != nil || len(ports) != 0 {
+		t.Fatalf("expect no ports, got %v, %v", ports, err)
+	}
+}
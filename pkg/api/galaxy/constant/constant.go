@@ -20,6 +20,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"strconv"
+	"strings"
 
 	"tkestack.io/galaxy/pkg/utils/nets"
 )
@@ -58,6 +60,47 @@ const (
 	Never                   = "never"     // Never Release IP
 )
 
+const (
+	// ReservedIPsAnnotation is written back to statefulsets by galaxy-ipam, its value is the comma separated ips
+	// reserved for the statefulset pods in the order of pod index
+	ReservedIPsAnnotation = "k8s.v1.cni.galaxy.io/reserved-ips"
+
+	// GangSizeAnnotation is the pod annotation to reserve the given number of ips for its parent workload in a
+	// single node subnet all at once before allocating ip for any pod of it
+	GangSizeAnnotation = "k8s.v1.cni.galaxy.io/gang-size"
+)
+
+const (
+	// StaticIPAnnotation is the pod annotation to allocate the given ip to the pod
+	StaticIPAnnotation = "k8s.v1.cni.galaxy.io/ip"
+)
+
+// ParseStaticIP returns the static ip of the annotations, or nil if there is no static ip annotation
+func ParseStaticIP(annotations map[string]string) (net.IP, error) {
+	str := annotations[StaticIPAnnotation]
+	if str == "" {
+		return nil, nil
+	}
+	ip := net.ParseIP(str)
+	if ip == nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid %s annotation value %q", StaticIPAnnotation, str)
+	}
+	return ip.To4(), nil
+}
+
+// ParseGangSize returns the gang size of the annotations, or 0 if there is no gang size annotation
+func ParseGangSize(annotations map[string]string) (int, error) {
+	str, ok := annotations[GangSizeAnnotation]
+	if !ok || str == "" {
+		return 0, nil
+	}
+	size, err := strconv.Atoi(str)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid %s annotation value %q", GangSizeAnnotation, str)
+	}
+	return size, nil
+}
+
 func ConvertReleasePolicy(policyStr string) ReleasePolicy {
 	switch policyStr {
 	case Never:
@@ -115,3 +158,39 @@ func MarshalCniArgs(ipInfos []IPInfo) (string, error) {
 	}
 	return string(data), nil
 }
+
+// NetworkPoolRef is the galaxy extension of a JSON format element of MultusCNIAnnotation. It refers to a floating ip
+// pool by pool name or pod subnet from which an ip is allocated for the network.
+type NetworkPoolRef struct {
+	// Name is the network name
+	Name string `json:"name"`
+	// Pool is the name of floating ip pools
+	Pool string `json:"pool,omitempty"`
+	// Subnet is the pod subnet of floating ip pools, it is ignored if Pool is not empty
+	Subnet string `json:"subnet,omitempty"`
+}
+
+// ReferPool returns true if the network refers to a floating ip pool
+func (ref *NetworkPoolRef) ReferPool() bool {
+	return ref.Pool != "" || ref.Subnet != ""
+}
+
+// ParseNetworkPoolRefs returns networks of MultusCNIAnnotation which refer to floating ip pools in order. Only JSON
+// format annotation value is able to refer to pools, it returns nil for other formats.
+func ParseNetworkPoolRefs(annotations map[string]string) ([]NetworkPoolRef, error) {
+	str := annotations[MultusCNIAnnotation]
+	if strings.IndexAny(str, "[{\"") < 0 {
+		return nil, nil
+	}
+	var networks []NetworkPoolRef
+	if err := json.Unmarshal([]byte(str), &networks); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s annotation %s: %v", MultusCNIAnnotation, str, err)
+	}
+	var refs []NetworkPoolRef
+	for i := range networks {
+		if networks[i].ReferPool() {
+			refs = append(refs, networks[i])
+		}
+	}
+	return refs, nil
+}
@@ -0,0 +1,47 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package constant
+
+import "strings"
+
+// PoolPrefixKey is the key prefix of ips of pools. Pools may be shared by namespaces, so namespace is left empty,
+// e.g. pool__poolName_ for ips held by the pool and pool__poolName_dp_namespace_deploymentName_podName for ips used
+// by pods.
+const PoolPrefixKey = "pool__"
+
+// PoolKey returns the key of ips held by the pool but not used by any pod
+func PoolKey(poolName string) string {
+	return PoolPrefixKey + poolName + "_"
+}
+
+// ParsePoolName returns the pool name of the key or empty if the key is not a key of pools
+func ParsePoolName(key string) string {
+	if !strings.HasPrefix(key, PoolPrefixKey) {
+		return ""
+	}
+	parts := strings.SplitN(key[len(PoolPrefixKey):], "_", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return parts[0]
+}
+
+// IsPrefixKey returns true if the key is the key prefix of a workload, e.g. dp_namespace_deploymentName_ or
+// pool__poolName_, which may hold several ips, while pod keys end with pod names.
+func IsPrefixKey(key string) bool {
+	return strings.HasSuffix(key, "_")
+}
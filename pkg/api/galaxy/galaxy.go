@@ -80,6 +80,10 @@ func CniRequestToPodRequest(data []byte) (*PodRequest, error) {
 			StdinData: cr.Config,
 		},
 	}
+	if cmd == cniutil.COMMAND_VERSION {
+		// VERSION doesn't require any other variables
+		return req, nil
+	}
 
 	req.ContainerID, ok = cr.Env[cniutil.CNI_CONTAINERID]
 	if !ok {
@@ -37,3 +37,13 @@ func TestCniRequestToPodRequest(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestCniRequestToPodRequestVersion(t *testing.T) {
+	req, err := CniRequestToPodRequest([]byte(`{"env": {"CNI_COMMAND": "VERSION"}, "config": "e30="}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Command != "VERSION" {
+		t.Fatal(req.Command)
+	}
+}
@@ -0,0 +1,49 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package private
+
+import (
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"tkestack.io/galaxy/pkg/api/k8s"
+)
+
+// ContainerInfo is a container which galaxy has set up networks for. It is returned by the read only introspection
+// API on GalaxySocketPath, GET /v1/pods lists all containers and GET /v1/pods/{namespace}/{name} returns the
+// containers of a pod with details.
+type ContainerInfo struct {
+	ContainerID  string          `json:"containerID"`
+	PodUID       string          `json:"podUID,omitempty"`
+	PodName      string          `json:"podName,omitempty"`
+	PodNamespace string          `json:"podNamespace,omitempty"`
+	Networks     []NetworkStatus `json:"networks"`
+	Ports        []k8s.Port      `json:"ports,omitempty"`
+	// PolicyChains are the iptables chains of network policies, the first one is the pod chain
+	PolicyChains []string `json:"policyChains,omitempty"`
+}
+
+// NetworkStatus is a network of a container
+type NetworkStatus struct {
+	Name   string   `json:"name"`
+	IfName string   `json:"ifName"`
+	IPs    []string `json:"ips,omitempty"`
+	Vlan   uint16   `json:"vlan,omitempty"`
+	// The following are only returned by the pod detail view
+	Args    map[string]string        `json:"args,omitempty"`
+	Conf    map[string]interface{}   `json:"conf,omitempty"`
+	Plugins []map[string]interface{} `json:"plugins,omitempty"`
+	Result  *types100.Result         `json:"result,omitempty"`
+}
@@ -0,0 +1,89 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package eventhandler
+
+import (
+	appv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/tools/cache"
+	glog "k8s.io/klog"
+)
+
+type StatefulSetWatcher interface {
+	AddStatefulSet(ss *appv1.StatefulSet) error
+	UpdateStatefulSet(oldSS, newSS *appv1.StatefulSet) error
+	DeleteStatefulSet(ss *appv1.StatefulSet) error
+}
+
+var (
+	_ = cache.ResourceEventHandler(&StatefulSetEventHandler{})
+)
+
+type StatefulSetEventHandler struct {
+	watcher StatefulSetWatcher
+}
+
+func NewStatefulSetEventHandler(watcher StatefulSetWatcher) *StatefulSetEventHandler {
+	return &StatefulSetEventHandler{watcher: watcher}
+}
+
+func (e *StatefulSetEventHandler) OnAdd(obj interface{}) {
+	ss, ok := obj.(*appv1.StatefulSet)
+	if !ok {
+		glog.Errorf("cannot convert newObj to *appv1.StatefulSet: %v", obj)
+		return
+	}
+	glog.V(5).Infof("Add statefulset %s_%s", ss.Name, ss.Namespace)
+	if err := e.watcher.AddStatefulSet(ss); err != nil {
+		glog.Errorf("AddStatefulSet failed: %v", err)
+	}
+}
+
+func (e *StatefulSetEventHandler) OnUpdate(oldObj, newObj interface{}) {
+	oldSS, ok := oldObj.(*appv1.StatefulSet)
+	if !ok {
+		glog.Errorf("cannot convert oldObj to *appv1.StatefulSet: %v", oldObj)
+		return
+	}
+	newSS, ok := newObj.(*appv1.StatefulSet)
+	if !ok {
+		glog.Errorf("cannot convert newObj to *appv1.StatefulSet: %v", newObj)
+		return
+	}
+	glog.V(5).Infof("Update statefulset %s_%s", newSS.Name, newSS.Namespace)
+	if err := e.watcher.UpdateStatefulSet(oldSS, newSS); err != nil {
+		glog.Errorf("UpdateStatefulSet failed: %v", err)
+	}
+}
+
+func (e *StatefulSetEventHandler) OnDelete(obj interface{}) {
+	ss, ok := obj.(*appv1.StatefulSet)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			glog.Errorf("cannot convert obj to *appv1.StatefulSet: %v", obj)
+			return
+		}
+		if ss, ok = tombstone.Obj.(*appv1.StatefulSet); !ok {
+			glog.Errorf("cannot convert tombstone obj to *appv1.StatefulSet: %v", tombstone.Obj)
+			return
+		}
+	}
+	glog.V(5).Infof("Delete statefulset %s_%s", ss.Name, ss.Namespace)
+	if err := e.watcher.DeleteStatefulSet(ss); err != nil {
+		glog.Errorf("DeleteStatefulSet failed: %v", err)
+	}
+}
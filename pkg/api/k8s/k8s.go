@@ -20,9 +20,7 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 
@@ -42,8 +40,6 @@ const (
 	K8S_POD_NAMESPACE          = "K8S_POD_NAMESPACE"
 	K8S_POD_NAME               = "K8S_POD_NAME"
 	K8S_POD_INFRA_CONTAINER_ID = "K8S_POD_INFRA_CONTAINER_ID"
-
-	stateDir                   = "/var/lib/cni/galaxy/port"
 	PortMappingPortsAnnotation = "tkestack.io/portmapping"
 )
 
@@ -63,34 +59,6 @@ type Port struct {
 	PodIP string `json:"podIP"`
 }
 
-func SavePort(containerID string, data []byte) error {
-	if err := os.MkdirAll(stateDir, 0700); err != nil {
-		return err
-	}
-	path := filepath.Join(stateDir, containerID)
-	return ioutil.WriteFile(path, data, 0600)
-}
-
-func RemovePortFile(containerID string) error {
-	return os.Remove(filepath.Join(stateDir, containerID))
-}
-
-func ConsumePort(containerID string) ([]Port, error) {
-	path := filepath.Join(stateDir, containerID)
-	data, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	if len(data) == 0 {
-		return nil, nil
-	}
-	var ports []Port
-	if err := json.Unmarshal(data, &ports); err != nil {
-		return nil, err
-	}
-	return ports, nil
-}
-
 // GetPodFullName returns a name that uniquely identifies a pod.
 func GetPodFullName(podName, namespace string) string {
 	return podName + "_" + namespace
@@ -143,6 +111,17 @@ type NetworkSelectionElement struct {
 	// InterfaceRequest contains an optional requested name for the
 	// network interface this attachment will create in the container
 	InterfaceRequest string `json:"interface,omitempty"`
+	// Pool is the galaxy extension which refers to floating ip pools by name to allocate an ip for this network
+	// attachment
+	Pool string `json:"pool,omitempty"`
+	// Subnet is the galaxy extension which refers to floating ip pools by pod subnet to allocate an ip for this
+	// network attachment
+	Subnet string `json:"subnet,omitempty"`
+}
+
+// ReferPool returns true if the network attachment refers to floating ip pools
+func (n *NetworkSelectionElement) ReferPool() bool {
+	return n.Pool != "" || n.Subnet != ""
 }
 
 func ParsePodNetworkAnnotation(podNetworks string) ([]*NetworkSelectionElement, error) {
@@ -0,0 +1,184 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/cniutil"
+	"tkestack.io/galaxy/pkg/api/k8s"
+)
+
+// configReloadInterval is the interval of checking if json config or network configs in NetworkConfDir changes
+var configReloadInterval = 10 * time.Second
+
+// config is a snapshot of json config and network configs in NetworkConfDir. It's never modified once loaded, a new
+// config is swapped in as a whole, so that each request sees a consistent config.
+type config struct {
+	JsonConf
+	// network configs of json config by network name
+	netConf map[string]map[string]interface{}
+	// network configs of NetworkConfDir by network name
+	dirConf map[string]map[string]interface{}
+}
+
+// getNetworkConf returns the network config of json config and, in the absence of it, the .conflist or .conf file
+// on-disk whose JSON "name" key matches networkName
+func (c *config) getNetworkConf(networkName string) map[string]interface{} {
+	if netConf, ok := c.netConf[networkName]; ok {
+		return netConf
+	}
+	return c.dirConf[networkName]
+}
+
+func (g *Galaxy) currentConfig() *config {
+	return g.config.Load().(*config)
+}
+
+// loadConfig loads json config and network configs in NetworkConfDir. If strict is false, bad files in
+// NetworkConfDir and default networks which are not configured are only logged which is the behavior of starting
+// up. Otherwise they fail the loading.
+func (g *Galaxy) loadConfig(strict bool) (*config, error) {
+	if g.JsonConfigPath == "" {
+		return nil, fmt.Errorf("json config is required")
+	}
+	data, err := ioutil.ReadFile(g.JsonConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("read json config: %v", err)
+	}
+	c := &config{dirConf: map[string]map[string]interface{}{}}
+	if err := json.Unmarshal(data, &c.JsonConf); err != nil {
+		return nil, fmt.Errorf("bad config %s: %v", string(data), err)
+	}
+	glog.Infof("Json Config: %s", string(data))
+	if c.netConf, err = checkNetworkConf(c.NetworkConf); err != nil {
+		return nil, err
+	}
+	confs, err := cniutil.LoadNetworkConfigs(g.NetworkConfDir)
+	if err != nil {
+		if strict {
+			return nil, fmt.Errorf("bad network config in %s: %v", g.NetworkConfDir, err)
+		}
+		glog.Warningf("failed to load network configs from confdir %s: %v", g.NetworkConfDir, err)
+	}
+	for name, data := range confs {
+		var m map[string]interface{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			if strict {
+				return nil, fmt.Errorf("bad network config %s: %v", string(data), err)
+			}
+			glog.Warningf("failed to unmarshal networkinfo %s: %v", string(data), err)
+			continue
+		}
+		// kubeconfig of host filesystem won't be reachable for galaxy.
+		// Since galaxy is running in pod, it can talk to apiserver via secret token
+		delete(m, "kubeconfig")
+		c.dirConf[name] = m
+	}
+	defaultNetworks := c.DefaultNetworks
+	if c.ENIIPNetwork != "" {
+		defaultNetworks = append([]string{c.ENIIPNetwork}, defaultNetworks...)
+	}
+	for _, name := range defaultNetworks {
+		if c.getNetworkConf(name) != nil {
+			continue
+		}
+		if strict {
+			return nil, fmt.Errorf("default network %s is not configured", name)
+		}
+		glog.Warningf("default network %s is not configured", name)
+	}
+	return c, nil
+}
+
+// configFingerprint returns a digest of json config and files in NetworkConfDir to tell if any of them changes
+func (g *Galaxy) configFingerprint() (string, error) {
+	h := sha256.New()
+	data, err := ioutil.ReadFile(g.JsonConfigPath)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data) // nolint: errcheck
+	files, err := cniutil.NetworkConfigFiles(g.NetworkConfDir)
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		// separate files by name so that moving content between files is also a change
+		h.Write([]byte("\x00" + file + "\x00")) // nolint: errcheck
+		h.Write(data)                           // nolint: errcheck
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// reloadConfig swaps in the config if json config or network configs in NetworkConfDir changes and the new config is
+// valid. A bad config is rejected with an event and the current config keeps in use. Requests in flight are not
+// affected either way since they have taken their own snapshot.
+func (g *Galaxy) reloadConfig() {
+	fingerprint, err := g.configFingerprint()
+	if err != nil {
+		glog.Warningf("failed to check config changes: %v", err)
+		return
+	}
+	if fingerprint == g.configFingerprintSeen {
+		return
+	}
+	// remember rejected configs too to avoid sending an event on each check
+	g.configFingerprintSeen = fingerprint
+	c, err := g.loadConfig(true)
+	if err != nil {
+		glog.Errorf("rejected new config, keep using the current one: %v", err)
+		g.recordNodeEvent(corev1.EventTypeWarning, "ConfigRejected", "rejected new config: %v", err)
+		return
+	}
+	g.config.Store(c)
+	glog.Infof("reloaded config")
+	g.recordNodeEvent(corev1.EventTypeNormal, "ConfigReloaded", "reloaded config")
+}
+
+func (g *Galaxy) recordNodeEvent(eventType, reason, messageFmt string, args ...interface{}) {
+	if g.recorder == nil {
+		return
+	}
+	nodeName := k8s.GetHostname()
+	ref := &corev1.ObjectReference{Kind: "Node", Name: nodeName, UID: types.UID(nodeName)}
+	g.recorder.Eventf(ref, eventType, reason, messageFmt, args...)
+}
+
+func newRecorder(client kubernetes.Interface) record.EventRecorder {
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(glog.Infof)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "galaxy",
+		Host: k8s.GetHostname()})
+}
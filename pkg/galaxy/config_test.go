@@ -0,0 +1,140 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+)
+
+func newTestGalaxy(t *testing.T, jsonConf string) (*Galaxy, *record.FakeRecorder) {
+	dir, err := ioutil.TempDir("", "galaxy-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) }) // nolint: errcheck
+	g := NewGalaxy()
+	g.JsonConfigPath = filepath.Join(dir, "galaxy.json")
+	g.NetworkConfDir = filepath.Join(dir, "net.d")
+	if err := os.Mkdir(g.NetworkConfDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, g.JsonConfigPath, jsonConf)
+	c, err := g.loadConfig(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.config.Store(c)
+	if g.configFingerprintSeen, err = g.configFingerprint(); err != nil {
+		t.Fatal(err)
+	}
+	recorder := record.NewFakeRecorder(10)
+	g.recorder = recorder
+	return g, recorder
+}
+
+func writeFile(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectEvent(t *testing.T, recorder *record.FakeRecorder, reason string) {
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, reason) {
+			t.Fatalf("expect event %s, got %s", reason, event)
+		}
+	default:
+		if reason != "" {
+			t.Fatalf("expect event %s, got none", reason)
+		}
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	g, recorder := newTestGalaxy(t, `{"NetworkConf":[{"name":"n1","type":"t1"}],"DefaultNetworks":["n1"]}`)
+	old := g.currentConfig()
+
+	// nothing changes
+	g.reloadConfig()
+	expectEvent(t, recorder, "")
+	if g.currentConfig() != old {
+		t.Fatal("expect config unchanged")
+	}
+
+	// add a network to conf dir and make it the default
+	writeFile(t, filepath.Join(g.NetworkConfDir, "n2.conf"), `{"name":"n2","type":"t2","kubeconfig":"/a"}`)
+	writeFile(t, g.JsonConfigPath, `{"NetworkConf":[{"name":"n1","type":"t1"}],"DefaultNetworks":["n2"]}`)
+	g.reloadConfig()
+	expectEvent(t, recorder, "ConfigReloaded")
+	c := g.currentConfig()
+	if len(c.DefaultNetworks) != 1 || c.DefaultNetworks[0] != "n2" {
+		t.Fatalf("expect default networks [n2], got %v", c.DefaultNetworks)
+	}
+	if conf := c.getNetworkConf("n2"); conf == nil || conf["type"] != "t2" || conf["kubeconfig"] != nil {
+		t.Fatalf("unexpected network config %v", conf)
+	}
+	// the snapshot taken before reloading is untouched
+	if len(old.DefaultNetworks) != 1 || old.DefaultNetworks[0] != "n1" || old.getNetworkConf("n2") != nil {
+		t.Fatalf("old config changed: %v", old)
+	}
+}
+
+func TestReloadConfigRejected(t *testing.T) {
+	g, recorder := newTestGalaxy(t, `{"NetworkConf":[{"name":"n1","type":"t1"}],"DefaultNetworks":["n1"]}`)
+	old := g.currentConfig()
+	for i, bad := range []struct {
+		jsonConf, confFile string
+	}{
+		// bad json
+		{jsonConf: `{"NetworkConf":[`},
+		// type is missing
+		{jsonConf: `{"NetworkConf":[{"name":"n1"}],"DefaultNetworks":["n1"]}`},
+		// default network is not configured
+		{jsonConf: `{"NetworkConf":[{"name":"n1","type":"t1"}],"DefaultNetworks":["n3"]}`},
+		// bad file in conf dir
+		{jsonConf: `{"NetworkConf":[{"name":"n1","type":"t1"}],"DefaultNetworks":["n1"]}`,
+			confFile: `{"name":"n2"`},
+	} {
+		writeFile(t, g.JsonConfigPath, bad.jsonConf)
+		if bad.confFile != "" {
+			writeFile(t, filepath.Join(g.NetworkConfDir, "n2.conf"), bad.confFile)
+		}
+		g.reloadConfig()
+		expectEvent(t, recorder, "ConfigRejected")
+		if g.currentConfig() != old {
+			t.Fatalf("case %d: expect bad config is rejected", i)
+		}
+		// a rejected config is reported only once
+		g.reloadConfig()
+		expectEvent(t, recorder, "")
+	}
+
+	// fixing the config swaps it in
+	writeFile(t, filepath.Join(g.NetworkConfDir, "n2.conf"), `{"name":"n2","type":"t2"}`)
+	g.reloadConfig()
+	expectEvent(t, recorder, "ConfigReloaded")
+	if g.currentConfig().getNetworkConf("n2") == nil {
+		t.Fatal("expect n2 is configured")
+	}
+}
@@ -17,15 +17,16 @@
 package galaxy
 
 import (
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"sync/atomic"
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/cniutil"
 	"tkestack.io/galaxy/pkg/api/docker"
 	"tkestack.io/galaxy/pkg/galaxy/options"
 	"tkestack.io/galaxy/pkg/gc"
@@ -36,14 +37,17 @@ import (
 )
 
 type Galaxy struct {
-	JsonConf
 	*options.ServerRunOptions
 	quitChan  chan struct{}
 	dockerCli *docker.DockerInterface
-	netConf   map[string]map[string]interface{}
-	pmhandler *portmapping.PortMappingHandler
-	client    kubernetes.Interface
-	pm        *policy.PolicyManager
+	// config holds a *config which is swapped in as a whole on reloading
+	config                atomic.Value
+	configFingerprintSeen string
+	pmhandler             *portmapping.PortMappingHandler
+	client                kubernetes.Interface
+	recorder              record.EventRecorder
+	pm                    *policy.PolicyManager
+	health                *health
 }
 
 type JsonConf struct {
@@ -58,24 +62,23 @@ func NewGalaxy() *Galaxy {
 	g := &Galaxy{
 		ServerRunOptions: options.NewServerRunOptions(),
 		quitChan:         make(chan struct{}),
-		netConf:          map[string]map[string]interface{}{},
+		health:           newHealth(),
 	}
 	return g
 }
 
 func (g *Galaxy) Init() error {
-	if g.JsonConfigPath == "" {
-		return fmt.Errorf("json config is required")
-	}
-	data, err := ioutil.ReadFile(g.JsonConfigPath)
+	fingerprint, err := g.configFingerprint()
 	if err != nil {
-		return fmt.Errorf("read json config: %v", err)
+		glog.Warningf("failed to get config fingerprint: %v", err)
 	}
-	if err := json.Unmarshal(data, &g.JsonConf); err != nil {
-		return fmt.Errorf("bad config %s: %v", string(data), err)
+	c, err := g.loadConfig(false)
+	if err != nil {
+		return err
 	}
-	glog.Infof("Json Config: %s", string(data))
-	if err := g.checkNetworkConf(); err != nil {
+	g.config.Store(c)
+	g.configFingerprintSeen = fingerprint
+	if err := cniutil.OpenStateStore(); err != nil {
 		return err
 	}
 	dockerClient, err := docker.NewDockerInterface()
@@ -87,23 +90,35 @@ func (g *Galaxy) Init() error {
 	return nil
 }
 
-func (g *Galaxy) checkNetworkConf() error {
-	for i := range g.NetworkConf {
-		netConf := g.NetworkConf[i]
-		// check if type is set and valid first
-		typeVal, ok := netConf["type"]
-		if !ok {
-			return fmt.Errorf("bad network config %v, type is missing", netConf)
-		}
-		netType, ok := typeVal.(string)
-		if !ok {
-			return fmt.Errorf("bad network config %v, type is not string", netConf)
+// checkNetworkConf checks network configs of json config and returns them by network name
+func checkNetworkConf(networkConf []map[string]interface{}) (map[string]map[string]interface{}, error) {
+	netConfs := map[string]map[string]interface{}{}
+	for i := range networkConf {
+		netConf := networkConf[i]
+		var netType string
+		if plugins, ok := netConf["plugins"]; ok {
+			// a conflist which is set up by its plugin chain
+			if err := checkPlugins(plugins); err != nil {
+				return nil, fmt.Errorf("bad network config %v, %v", netConf, err)
+			}
+			if _, ok := netConf["name"]; !ok {
+				return nil, fmt.Errorf("bad network config %v, name is missing", netConf)
+			}
+		} else {
+			// check if type is set and valid first
+			typeVal, ok := netConf["type"]
+			if !ok {
+				return nil, fmt.Errorf("bad network config %v, type is missing", netConf)
+			}
+			if netType, ok = typeVal.(string); !ok {
+				return nil, fmt.Errorf("bad network config %v, type is not string", netConf)
+			}
 		}
 		var key string
 		// using name as key
 		if val, ok := netConf["name"]; ok {
 			if name, ok := val.(string); !ok {
-				return fmt.Errorf("bad network config %v, name is not string", netConf)
+				return nil, fmt.Errorf("bad network config %v, name is not string", netConf)
 			} else {
 				key = name
 			}
@@ -111,10 +126,28 @@ func (g *Galaxy) checkNetworkConf() error {
 			// name empty, assume type name is network name
 			key = netType
 		}
-		if _, ok := g.netConf[key]; ok {
-			return fmt.Errorf("multiple network configuration with name %s", key)
+		if _, ok := netConfs[key]; ok {
+			return nil, fmt.Errorf("multiple network configuration with name %s", key)
+		}
+		netConfs[key] = netConf
+	}
+	return netConfs, nil
+}
+
+// checkPlugins checks that plugins of a conflist is a non empty list of plugin configs with type
+func checkPlugins(plugins interface{}) error {
+	list, ok := plugins.([]interface{})
+	if !ok || len(list) == 0 {
+		return fmt.Errorf("plugins is not a non empty list")
+	}
+	for i := range list {
+		plugin, ok := list[i].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("plugin %v is not an object", list[i])
+		}
+		if _, ok := plugin["type"].(string); !ok {
+			return fmt.Errorf("type of plugin %v is missing or not string", plugin)
 		}
-		g.netConf[key] = g.NetworkConf[i]
 	}
 	return nil
 }
@@ -124,6 +157,12 @@ func (g *Galaxy) Start() error {
 		return err
 	}
 	g.initk8sClient()
+	g.recorder = newRecorder(g.client)
+	go wait.Until(g.reloadConfig, configReloadInterval, g.quitChan)
+	go wait.Until(g.checkAPIServer, apiServerCheckInterval, g.quitChan)
+	if g.MetricsAddress != "" {
+		g.startMetricsServer()
+	}
 	gc.NewFlannelGC(g.dockerCli, g.quitChan, g.cleanIPtables).Run()
 	kernel.BridgeNFCallIptables(g.quitChan, g.BridgeNFCallIptables)
 	kernel.IPForward(g.quitChan, g.IPForward)
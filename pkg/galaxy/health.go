@@ -0,0 +1,125 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/cniutil"
+	"tkestack.io/galaxy/pkg/galaxy/metrics"
+)
+
+const (
+	checkAPIServer = "apiserver"
+	checkIPTables  = "iptables"
+
+	apiServerCheckInterval = 10 * time.Second
+	apiServerCheckTimeout  = 5 * time.Second
+)
+
+// health caches results of health checks which run in background, so that probes don't hit apiserver or iptables
+type health struct {
+	sync.RWMutex
+	// results holds the error of the last run of each check, nil if it succeeded
+	results map[string]error
+}
+
+func newHealth() *health {
+	return &health{results: map[string]error{}}
+}
+
+func (h *health) set(check string, err error) {
+	h.Lock()
+	defer h.Unlock()
+	if err != nil && h.results[check] == nil {
+		glog.Warningf("health check %s failed: %v", check, err)
+	}
+	h.results[check] = err
+}
+
+// handler returns a handler which responds 200 if all checks succeeded in their last run. Checks which haven't run
+// yet fail if required is true and are ignored otherwise.
+func (h *health) handler(required bool, checks ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.RLock()
+		defer h.RUnlock()
+		healthy := true
+		var body string
+		for _, check := range checks {
+			err, ok := h.results[check]
+			if !ok {
+				if !required {
+					body += fmt.Sprintf("[+]%s pending\n", check)
+					continue
+				}
+				err = fmt.Errorf("not checked yet")
+			}
+			if err != nil {
+				healthy = false
+				body += fmt.Sprintf("[-]%s failed: %v\n", check, err)
+			} else {
+				body += fmt.Sprintf("[+]%s ok\n", check)
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprint(w, body) // nolint: errcheck
+	}
+}
+
+// checkAPIServer checks the connectivity to apiserver
+func (g *Galaxy) checkAPIServer() {
+	err := g.client.Discovery().RESTClient().Get().AbsPath("/healthz").Timeout(apiServerCheckTimeout).Do().Error()
+	g.health.set(checkAPIServer, err)
+}
+
+// managedPods returns the number of pods whose networks are set up by galaxy
+func managedPods() float64 {
+	states, err := cniutil.ListStates()
+	if err != nil {
+		glog.Warningf("failed to list container states: %v", err)
+	}
+	var count int
+	for _, state := range states {
+		if len(state.Networks) > 0 {
+			count++
+		}
+	}
+	return float64(count)
+}
+
+// startMetricsServer serves prometheus metrics, /healthz and /readyz on MetricsAddress. /healthz fails if galaxy
+// failed to ensure its iptables rules which restarting galaxy recovers, /readyz also requires apiserver connectivity.
+func (g *Galaxy) startMetricsServer() {
+	cniutil.SetObserver(metrics.CNIObserver{})
+	metrics.MustRegister(managedPods)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/healthz", g.health.handler(false, checkIPTables))
+	mux.Handle("/readyz", g.health.handler(true, checkAPIServer, checkIPTables))
+	go func() {
+		glog.Infof("serving metrics and health checks on %s", g.MetricsAddress)
+		glog.Fatal(http.ListenAndServe(g.MetricsAddress, mux))
+	}()
+}
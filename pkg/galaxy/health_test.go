@@ -0,0 +1,54 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealthHandler(t *testing.T) {
+	h := newHealth()
+	healthz := h.handler(false, checkIPTables)
+	readyz := h.handler(true, checkAPIServer, checkIPTables)
+	check := func(handler http.HandlerFunc, expectCode int, expectBody string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != expectCode || !strings.Contains(w.Body.String(), expectBody) {
+			t.Fatalf("expect %d %q, got %d %q", expectCode, expectBody, w.Code, w.Body.String())
+		}
+	}
+	// checks which haven't run are ignored by healthz but fail readyz
+	check(healthz, http.StatusOK, "[+]iptables pending")
+	check(readyz, http.StatusServiceUnavailable, "[-]apiserver failed: not checked yet")
+
+	h.set(checkIPTables, nil)
+	h.set(checkAPIServer, fmt.Errorf("connection refused"))
+	check(healthz, http.StatusOK, "[+]iptables ok")
+	check(readyz, http.StatusServiceUnavailable, "[-]apiserver failed: connection refused")
+
+	h.set(checkAPIServer, nil)
+	check(readyz, http.StatusOK, "[+]apiserver ok\n[+]iptables ok")
+
+	h.set(checkIPTables, fmt.Errorf("iptables lock"))
+	check(healthz, http.StatusServiceUnavailable, "[-]iptables failed: iptables lock")
+	check(readyz, http.StatusServiceUnavailable, "[-]iptables failed: iptables lock")
+}
@@ -0,0 +1,120 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/emicklei/go-restful"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/cniutil"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/api/galaxy/private"
+	"tkestack.io/galaxy/pkg/api/k8s"
+)
+
+// listPods lists containers which galaxy has set up networks for
+func (g *Galaxy) listPods(r *restful.Request, w *restful.Response) {
+	containers, err := g.containerInfos(func(*private.ContainerInfo) bool { return true }, false)
+	if err != nil {
+		_ = w.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	_ = w.WriteEntity(containers)
+}
+
+// getPodInfo returns containers of a pod with details of their networks
+func (g *Galaxy) getPodInfo(r *restful.Request, w *restful.Response) {
+	namespace, name := r.PathParameter("namespace"), r.PathParameter("name")
+	containers, err := g.containerInfos(func(c *private.ContainerInfo) bool {
+		return c.PodNamespace == namespace && c.PodName == name
+	}, true)
+	if err != nil {
+		_ = w.WriteError(http.StatusInternalServerError, err)
+		return
+	}
+	if len(containers) == 0 {
+		_ = w.WriteError(http.StatusNotFound, fmt.Errorf("pod %s has no networks set up by galaxy on this node",
+			k8s.GetPodFullName(name, namespace)))
+		return
+	}
+	_ = w.WriteEntity(containers)
+}
+
+// containerInfos returns containers with saved states which match filter, sorted by pod and container id
+func (g *Galaxy) containerInfos(filter func(*private.ContainerInfo) bool,
+	detail bool) ([]private.ContainerInfo, error) {
+	states, err := cniutil.ListStates()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list container states: %v", err)
+	}
+	containers := []private.ContainerInfo{}
+	for _, state := range states {
+		c := newContainerInfo(state, detail)
+		if !filter(&c) {
+			continue
+		}
+		if g.pm != nil && c.PodName != "" {
+			if c.PolicyChains, err = g.pm.PodChains(c.PodNamespace, c.PodName); err != nil {
+				glog.V(4).Infof("failed to get policy chains of %s: %v",
+					k8s.GetPodFullName(c.PodName, c.PodNamespace), err)
+			}
+		}
+		containers = append(containers, c)
+	}
+	sort.Slice(containers, func(i, j int) bool {
+		if containers[i].PodNamespace != containers[j].PodNamespace {
+			return containers[i].PodNamespace < containers[j].PodNamespace
+		}
+		if containers[i].PodName != containers[j].PodName {
+			return containers[i].PodName < containers[j].PodName
+		}
+		return containers[i].ContainerID < containers[j].ContainerID
+	})
+	return containers, nil
+}
+
+// newContainerInfo converts the saved state of a container. Configs, args and results are included if detail is
+// true.
+func newContainerInfo(state *cniutil.ContainerState, detail bool) private.ContainerInfo {
+	c := private.ContainerInfo{ContainerID: state.ContainerID, PodUID: state.Pod.UID, PodName: state.Pod.Name,
+		PodNamespace: state.Pod.Namespace, Networks: []private.NetworkStatus{}, Ports: state.Ports}
+	for _, info := range state.Networks {
+		status := private.NetworkStatus{Name: info.NetworkType, IfName: info.IfName}
+		if info.Result != nil {
+			for _, ip := range info.Result.IPs {
+				status.IPs = append(status.IPs, ip.Address.String())
+			}
+		}
+		if data, ok := info.Args[constant.IPInfosKey]; ok {
+			var ipInfos []constant.IPInfo
+			if err := json.Unmarshal([]byte(data), &ipInfos); err != nil {
+				glog.Warningf("failed to unmarshal ipinfos %s of %s: %v", data, state.ContainerID, err)
+			} else if len(ipInfos) > 0 {
+				status.Vlan = ipInfos[0].Vlan
+			}
+		}
+		if detail {
+			status.Args, status.Conf, status.Plugins, status.Result = info.Args, info.Conf, info.Plugins, info.Result
+		}
+		c.Networks = append(c.Networks, status)
+	}
+	return c
+}
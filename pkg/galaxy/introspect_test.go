@@ -0,0 +1,65 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package galaxy
+
+import (
+	"net"
+	"testing"
+
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"tkestack.io/galaxy/pkg/api/cniutil"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/api/k8s"
+)
+
+func TestNewContainerInfo(t *testing.T) {
+	_, ipNet, _ := net.ParseCIDR("10.0.80.0/24")
+	ipNet.IP = net.ParseIP("10.0.80.2")
+	vlan := cniutil.NewNetworkInfo("galaxy-k8s-vlan", map[string]interface{}{"type": "galaxy-k8s-vlan"}, "eth0")
+	vlan.Args[constant.IPInfosKey] = `[{"ip":"10.0.80.2/24","vlan":10,"gateway":"10.0.80.1"}]`
+	vlan.Result = &types100.Result{IPs: []*types100.IPConfig{{Address: *ipNet}}}
+	flannel := cniutil.NewNetworkInfo("galaxy-flannel", map[string]interface{}{"type": "galaxy-flannel"}, "eth1")
+	state := &cniutil.ContainerState{
+		ContainerID: "c1",
+		Pod:         cniutil.PodInfo{UID: "uid1", Name: "pod1", Namespace: "ns1"},
+		Networks:    []*cniutil.NetworkInfo{vlan, flannel},
+		Ports:       []k8s.Port{{HostPort: 30001, ContainerPort: 80, Protocol: "TCP"}},
+	}
+
+	c := newContainerInfo(state, false)
+	if c.ContainerID != "c1" || c.PodUID != "uid1" || c.PodName != "pod1" || c.PodNamespace != "ns1" ||
+		len(c.Networks) != 2 || len(c.Ports) != 1 {
+		t.Fatalf("unexpected container info %+v", c)
+	}
+	n := c.Networks[0]
+	if n.Name != "galaxy-k8s-vlan" || n.IfName != "eth0" || n.Vlan != 10 || len(n.IPs) != 1 ||
+		n.IPs[0] != "10.0.80.2/24" {
+		t.Fatalf("unexpected network %+v", n)
+	}
+	if n.Conf != nil || n.Args != nil || n.Result != nil {
+		t.Fatalf("expect no details, got %+v", n)
+	}
+	if n := c.Networks[1]; n.Name != "galaxy-flannel" || n.IfName != "eth1" || n.Vlan != 0 || len(n.IPs) != 0 {
+		t.Fatalf("unexpected network %+v", n)
+	}
+
+	c = newContainerInfo(state, true)
+	if n := c.Networks[0]; n.Conf["type"] != "galaxy-k8s-vlan" || n.Result == nil ||
+		n.Args[constant.IPInfosKey] == "" {
+		t.Fatalf("expect details, got %+v", n)
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+// Package metrics defines prometheus metrics of galaxy node daemon
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// CNILatency is the duration of executing a cni command of all plugins of a network, command is ADD, DEL or
+	// CHECK and network_type is the network name
+	CNILatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "galaxy_cni_duration_seconds",
+			Help:    "Duration in seconds of executing cni commands by command and network type",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+		}, []string{"command", "network_type"})
+
+	CNIFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "galaxy_cni_failures_total",
+			Help: "Number of failed cni commands by command and network type",
+		}, []string{"command", "network_type"})
+
+	// DelegateLatency is the duration of executing a delegate cni plugin, result is success or failure
+	DelegateLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "galaxy_cni_delegate_duration_seconds",
+			Help:    "Duration in seconds of executing delegate cni plugins by command, plugin and result",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"command", "plugin", "result"})
+
+	// PortMappingLatency is the duration of setting up or cleaning up port mappings of a pod, op is setup or
+	// cleanup and result is success or failure
+	PortMappingLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "galaxy_portmapping_duration_seconds",
+			Help:    "Duration in seconds of setting up or cleaning up port mappings by op and result",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"op", "result"})
+
+	// PolicySyncLatency is the duration of syncing network policies, type is full for syncing all policies and pods,
+	// or pod for syncing chains of a pod
+	PolicySyncLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "galaxy_policy_sync_duration_seconds",
+			Help:    "Duration in seconds of syncing network policy ipsets and iptables by type",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 12),
+		}, []string{"type"})
+
+	// GCCleanupCount is the number of leaked resources cleaned up by gc, type is ip_file, state_file or veth
+	GCCleanupCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "galaxy_gc_cleanup_total",
+			Help: "Number of leaked resources of exited containers cleaned up by gc by type",
+		}, []string{"type"})
+)
+
+// MustRegister registers all metrics and the gauge of the number of pods whose networks are managed by galaxy
+func MustRegister(managedPods func() float64) {
+	prometheus.MustRegister(CNILatency, CNIFailures, DelegateLatency, PortMappingLatency, PolicySyncLatency,
+		GCCleanupCount, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "galaxy_managed_pods",
+			Help: "Number of pods whose networks are set up by galaxy on the node",
+		}, managedPods))
+}
+
+// Result returns the result label of err
+func Result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// CNIObserver collects metrics of executions of networks and delegate plugins
+type CNIObserver struct{}
+
+func (CNIObserver) ObserveNetwork(command, networkType string, duration time.Duration, err error) {
+	CNILatency.WithLabelValues(command, networkType).Observe(duration.Seconds())
+	if err != nil {
+		CNIFailures.WithLabelValues(command, networkType).Inc()
+	}
+}
+
+func (CNIObserver) ObserveDelegate(command, pluginType string, duration time.Duration, err error) {
+	DelegateLatency.WithLabelValues(command, pluginType, Result(err)).Observe(duration.Seconds())
+}
@@ -34,6 +34,8 @@ type ServerRunOptions struct {
 	// To support dynamic changing network config or node specific network config
 	NetworkConfDir string
 	CNIPaths       []string
+	// The address to serve prometheus metrics, /healthz and /readyz, disabled if empty
+	MetricsAddress string
 }
 
 func NewServerRunOptions() *ServerRunOptions {
@@ -65,4 +67,6 @@ func (s *ServerRunOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.NetworkConfDir, "network-conf-dir", s.NetworkConfDir,
 		"Directory to additional network configs apart from those in json config")
 	fs.StringSliceVar(&s.CNIPaths, "cni-paths", s.CNIPaths, "Additional cni paths apart from those received from kubelet")
+	fs.StringVar(&s.MetricsAddress, "metrics-address", s.MetricsAddress, "The address to serve prometheus "+
+		"metrics, /healthz and /readyz, e.g. :9099. Disabled if empty")
 }
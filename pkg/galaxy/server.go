@@ -17,6 +17,7 @@
 package galaxy
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -28,7 +29,8 @@ import (
 	"time"
 
 	"github.com/containernetworking/cni/pkg/types"
-	t020 "github.com/containernetworking/cni/pkg/types/020"
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/version"
 	"github.com/emicklei/go-restful"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -43,6 +45,7 @@ import (
 	"tkestack.io/galaxy/pkg/api/galaxy/private"
 	"tkestack.io/galaxy/pkg/api/k8s"
 	k8sutil "tkestack.io/galaxy/pkg/api/k8s/utils"
+	"tkestack.io/galaxy/pkg/galaxy/metrics"
 )
 
 // StartServer will start galaxy server.
@@ -78,6 +81,8 @@ func (g *Galaxy) installHandlers() {
 	ws := new(restful.WebService)
 	ws.Route(ws.GET("/cni").To(g.cni))
 	ws.Route(ws.POST("/cni").To(g.cni))
+	ws.Route(ws.GET("/v1/pods").To(g.listPods).Produces(restful.MIME_JSON))
+	ws.Route(ws.GET("/v1/pods/{namespace}/{name}").To(g.getPodInfo).Produces(restful.MIME_JSON))
 	restful.Add(ws)
 }
 
@@ -126,20 +131,20 @@ func (g *Galaxy) requestFunc(req *galaxyapi.PodRequest) (data []byte, err error)
 			err = err1
 			return
 		} else {
-			result020, err2 := convertResult(result)
+			ip4, err2 := cniutil.PrimaryIPv4(result)
 			if err2 != nil {
 				err = err2
 			} else {
-				data, err = json.Marshal(result)
+				data, err = marshalResult(result, req.StdinData)
 				if err != nil {
 					return
 				}
-				err = g.setupPortMapping(req, req.ContainerID, result020, pod)
+				err = g.setupPortMapping(req, req.ContainerID, ip4.Address.IP, pod)
 				if err != nil {
 					g.cleanupPortMapping(req)
 					return
 				}
-				pod.Status.PodIP = result020.IP4.IP.IP.String()
+				pod.Status.PodIP = ip4.Address.IP.String()
 				if g.pm != nil {
 					if err := g.pm.SyncPodChains(pod); err != nil {
 						glog.Warning(err)
@@ -154,6 +159,15 @@ func (g *Galaxy) requestFunc(req *galaxyapi.PodRequest) (data []byte, err error)
 		if err == nil {
 			err = g.cleanupPortMapping(req)
 		}
+	} else if req.Command == cniutil.COMMAND_CHECK {
+		defer func() {
+			glog.Infof("%v err %v, %s-", req, err, start.Format(time.StampMicro))
+		}()
+		err = cmdCheck(req)
+	} else if req.Command == cniutil.COMMAND_VERSION {
+		var buf bytes.Buffer
+		err = version.All.Encode(&buf)
+		data = buf.Bytes()
 	} else {
 		err = fmt.Errorf("unknown command %s", req.Command)
 	}
@@ -184,13 +198,17 @@ func parsePorts(pod *corev1.Pod) []k8s.Port {
 // #lizard forgives
 func (g *Galaxy) resolveNetworks(req *galaxyapi.PodRequest, pod *corev1.Pod) ([]*cniutil.NetworkInfo, error) {
 	var networkInfos []*cniutil.NetworkInfo
+	// referPool[i] is true if networkInfos[i] refers to floating ip pools and owns a distinct ip
+	var referPool []bool
+	// take a snapshot so that a reloaded config takes effect on the next request
+	c := g.currentConfig()
 	if pod.Annotations == nil || pod.Annotations[constant.MultusCNIAnnotation] == "" {
-		if utils.WantENIIP(&pod.Spec) && g.ENIIPNetwork != "" {
-			networkInfos = append(networkInfos, cniutil.NewNetworkInfo(g.ENIIPNetwork, g.getNetworkConf(g.ENIIPNetwork),
+		if utils.WantENIIP(&pod.Spec) && c.ENIIPNetwork != "" {
+			networkInfos = append(networkInfos, cniutil.NewNetworkInfo(c.ENIIPNetwork, c.getNetworkConf(c.ENIIPNetwork),
 				req.IfName))
 		} else {
-			for i, netName := range g.DefaultNetworks {
-				networkInfos = append(networkInfos, cniutil.NewNetworkInfo(netName, g.getNetworkConf(netName),
+			for i, netName := range c.DefaultNetworks {
+				networkInfos = append(networkInfos, cniutil.NewNetworkInfo(netName, c.getNetworkConf(netName),
 					setNetInterface("", i, req.IfName)))
 			}
 		}
@@ -203,7 +221,7 @@ func (g *Galaxy) resolveNetworks(req *galaxyapi.PodRequest, pod *corev1.Pod) ([]
 		}
 		//init networkInfo
 		for idx, network := range networks {
-			netConf := g.getNetworkConf(network.Name)
+			netConf := c.getNetworkConf(network.Name)
 			if netConf == nil {
 				return nil, fmt.Errorf("pod %s_%s requires network %s which is not configured", pod.Name,
 					pod.Namespace, network.Name)
@@ -211,6 +229,7 @@ func (g *Galaxy) resolveNetworks(req *galaxyapi.PodRequest, pod *corev1.Pod) ([]
 			networkInfo := cniutil.NewNetworkInfo(network.Name, netConf,
 				setNetInterface(network.InterfaceRequest, idx, req.CmdArgs.IfName))
 			networkInfos = append(networkInfos, networkInfo)
+			referPool = append(referPool, network.ReferPool())
 		}
 	}
 	extendedCNIArgs, err := parseExtendedCNIArgs(pod)
@@ -222,42 +241,77 @@ func (g *Galaxy) resolveNetworks(req *galaxyapi.PodRequest, pod *corev1.Pod) ([]
 			networkInfos[i].Args[k] = string(v)
 		}
 	}
+	if err := assignNetworkIPInfos(networkInfos, referPool, extendedCNIArgs); err != nil {
+		return nil, fmt.Errorf("pod %s_%s: %v", pod.Name, pod.Namespace, err)
+	}
 	glog.V(4).Infof("pod %s_%s networkInfo %v", pod.Name, pod.Namespace, networkInfos)
 	return networkInfos, nil
 }
 
-func (g *Galaxy) getNetworkConf(networkName string) map[string]interface{} {
-	if netConf, ok := g.netConf[networkName]; ok {
-		return netConf
-	}
-	// In the absence of existing network config from json
-	// config, load and execute a CNI .configlist
-	// or .config (in that order) file on-disk whose JSON
-	// “name” key matches this Network object’s name.
-	data, err := cniutil.GetNetworkConfig(networkName, g.NetworkConfDir)
-	if err != nil {
-		glog.Warningf("failed to load network config %s from confdir %s with error %v", networkName, g.NetworkConfDir, err)
-		return nil
+// assignNetworkIPInfos passes each network which refers to floating ip pools only its own ip info. Galaxy-ipam
+// allocates ips for these networks in order, other networks don't get any ip info.
+func assignNetworkIPInfos(networkInfos []*cniutil.NetworkInfo, referPool []bool,
+	extendedCNIArgs map[string]json.RawMessage) error {
+	var refCount int
+	for i := range referPool {
+		if referPool[i] {
+			refCount++
+		}
 	}
-	var m map[string]interface{}
-	if err := json.Unmarshal(data, &m); err != nil {
-		glog.Warningf("failed to unmarshal networkinfo %s: %v", string(data), err)
+	if refCount == 0 {
 		return nil
 	}
-	// kubeconfig of host filesystem won't be reachable for galaxy.
-	// Since galaxy is running in pod, it can talk to apiserver via secret token
-	if m["kubeconfig"] != "" {
-		delete(m, "kubeconfig")
+	var ipInfos []constant.IPInfo
+	if data, ok := extendedCNIArgs[constant.IPInfosKey]; ok {
+		if err := json.Unmarshal(data, &ipInfos); err != nil {
+			return fmt.Errorf("failed to unmarshal ipinfos %s: %v", string(data), err)
+		}
+	}
+	if len(ipInfos) != refCount {
+		return fmt.Errorf("%d networks refer to pools, but got %d ipinfos", refCount, len(ipInfos))
 	}
-	return m
+	var j int
+	for i := range networkInfos {
+		if !referPool[i] {
+			delete(networkInfos[i].Args, constant.IPInfosKey)
+			continue
+		}
+		data, err := json.Marshal([]constant.IPInfo{ipInfos[j]})
+		if err != nil {
+			return err
+		}
+		networkInfos[i].Args[constant.IPInfosKey] = string(data)
+		j++
+	}
+	return nil
 }
 
-func (g *Galaxy) cmdAdd(req *galaxyapi.PodRequest, pod *corev1.Pod) (types.Result, error) {
+func (g *Galaxy) cmdAdd(req *galaxyapi.PodRequest, pod *corev1.Pod) (*types100.Result, error) {
 	networkInfos, err := g.resolveNetworks(req, pod)
 	if err != nil {
 		return nil, err
 	}
-	return cniutil.CmdAdd(req.CmdArgs, networkInfos)
+	return cniutil.CmdAdd(req.CmdArgs, cniutil.PodInfo{UID: string(pod.UID), Name: pod.Name,
+		Namespace: pod.Namespace}, networkInfos)
+}
+
+// cmdCheck checks pod network against prevResult in the config which is required for CHECK
+func cmdCheck(req *galaxyapi.PodRequest) error {
+	conf := &types.NetConf{}
+	if err := json.Unmarshal(req.StdinData, conf); err != nil {
+		return fmt.Errorf("failed to unmarshal config %s: %v", string(req.StdinData), err)
+	}
+	if err := version.ParsePrevResult(conf); err != nil {
+		return err
+	}
+	if conf.PrevResult == nil {
+		return fmt.Errorf("prevResult is required for %s", cniutil.COMMAND_CHECK)
+	}
+	prevResult, err := types100.NewResultFromResult(conf.PrevResult)
+	if err != nil {
+		return err
+	}
+	return cniutil.CmdCheck(req.CmdArgs, prevResult)
 }
 
 // parseExtendedCNIArgs parses extended cni args from pod's annotation
@@ -313,27 +367,34 @@ func (g *Galaxy) setupIPtables() error {
 	}
 	// sync all iptables on start
 	if err := g.pmhandler.SetupPortMappingForAllPods(allPorts); err != nil {
+		g.health.set(checkIPTables, err)
 		return fmt.Errorf("failed to setup portmappings for all pods, ports %+v: %v", allPorts, err)
 	}
+	g.health.set(checkIPTables, nil)
 	go wait.Until(func() {
 		glog.V(4).Infof("starting to ensure iptables rules")
 		defer glog.V(4).Infof("ensure iptables rules complete")
-		if err := g.pmhandler.EnsureBasicRule(); err != nil {
-			glog.Warningf("failed to ensure iptables rules")
+		err := g.pmhandler.EnsureBasicRule()
+		if err != nil {
+			glog.Warningf("failed to ensure iptables rules: %v", err)
 		}
+		g.health.set(checkIPTables, err)
 	}, 1*time.Minute, make(chan struct{}))
 	return nil
 }
 
-func (g *Galaxy) setupPortMapping(req *galaxyapi.PodRequest, containerID string, result *t020.Result,
-	pod *corev1.Pod) error {
+func (g *Galaxy) setupPortMapping(req *galaxyapi.PodRequest, containerID string, podIP net.IP,
+	pod *corev1.Pod) (err error) {
 	_, portMappingOn := pod.Annotations[k8s.PortMappingPortsAnnotation]
 	req.Ports = parsePorts(pod)
 	if len(req.Ports) == 0 {
 		return nil
 	}
+	defer func(start time.Time) {
+		metrics.PortMappingLatency.WithLabelValues("setup", metrics.Result(err)).Observe(time.Since(start).Seconds())
+	}(time.Now())
 	for i := range req.Ports {
-		req.Ports[i].PodIP = result.IP4.IP.IP.To4().String()
+		req.Ports[i].PodIP = podIP.To4().String()
 		req.Ports[i].PodName = req.PodName
 	}
 	if err := g.pmhandler.OpenHostports(k8s.GetPodFullName(req.PodName, req.PodNamespace), portMappingOn,
@@ -344,7 +405,7 @@ func (g *Galaxy) setupPortMapping(req *galaxyapi.PodRequest, containerID string,
 	if err != nil {
 		return fmt.Errorf("failed to marshal ports: %v", err)
 	}
-	if err := k8s.SavePort(containerID, data); err != nil {
+	if err := cniutil.SavePorts(containerID, req.Ports); err != nil {
 		return fmt.Errorf("failed to save ports %v", err)
 	}
 	if err := g.pmhandler.SetupPortMapping(req.Ports); err != nil {
@@ -381,15 +442,18 @@ func (g *Galaxy) updatePortMappingAnnotation(req *galaxyapi.PodRequest, data []b
 	})
 }
 
-func (g *Galaxy) cleanupPortMapping(req *galaxyapi.PodRequest) error {
+func (g *Galaxy) cleanupPortMapping(req *galaxyapi.PodRequest) (err error) {
+	defer func(start time.Time) {
+		metrics.PortMappingLatency.WithLabelValues("cleanup", metrics.Result(err)).Observe(time.Since(start).Seconds())
+	}(time.Now())
 	g.pmhandler.CloseHostports(k8s.GetPodFullName(req.PodName, req.PodNamespace))
 	return g.cleanIPtables(req.ContainerID)
 }
 
 func (g *Galaxy) cleanIPtables(containerID string) error {
-	ports, err := k8s.ConsumePort(containerID)
+	ports, err := cniutil.LoadPorts(containerID)
 	if err != nil {
-		if os.IsNotExist(err) {
+		if err == cniutil.ErrStateNotFound {
 			return nil
 		}
 		return fmt.Errorf("failed to read ports %v", err)
@@ -398,8 +462,8 @@ func (g *Galaxy) cleanIPtables(containerID string) error {
 		if err := g.pmhandler.CleanPortMapping(ports); err != nil {
 			return err
 		}
-		if err := k8s.RemovePortFile(containerID); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("delete port file for %s: %v", containerID, err)
+		if err := cniutil.DeletePorts(containerID); err != nil {
+			return fmt.Errorf("delete ports of %s: %v", containerID, err)
 		}
 	}
 	return nil
@@ -427,22 +491,17 @@ func (g *Galaxy) getPod(name, namespace string) (*corev1.Pod, error) {
 	return pod, nil
 }
 
-func convertResult(result types.Result) (*t020.Result, error) {
-	if result == nil {
-		return nil, fmt.Errorf("result is nil")
-	}
-	result020, ok := result.(*t020.Result)
-	if !ok {
-		return nil, fmt.Errorf("faild to convert result to 020 result")
-	}
-	if result020.IP4 == nil {
-		return nil, fmt.Errorf("CNI plugin reported no IPv4 address")
+// marshalResult marshals result in the version of config
+func marshalResult(result *types100.Result, conf []byte) ([]byte, error) {
+	confVersion, err := cniutil.ConfVersion(conf)
+	if err != nil {
+		return nil, err
 	}
-	ip4 := result020.IP4.IP.IP.To4()
-	if ip4 == nil {
-		return nil, fmt.Errorf("CNI plugin reported an invalid IPv4 address: %+v.", result020.IP4)
+	r, err := result.GetAsVersion(confVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert result to %s: %v", confVersion, err)
 	}
-	return result020, nil
+	return json.Marshal(r)
 }
 
 func setNetInterface(netIf string, idx int, argIf string) string {
@@ -17,10 +17,14 @@
 package galaxy
 
 import (
+	"encoding/json"
+	"net"
 	"testing"
 
+	types100 "github.com/containernetworking/cni/pkg/types/100"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"tkestack.io/galaxy/pkg/api/cniutil"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 )
 
@@ -37,3 +41,55 @@ func TestParseExtendedCNIArgs(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestAssignNetworkIPInfos(t *testing.T) {
+	extendedCNIArgs := map[string]json.RawMessage{
+		"ipinfos": json.RawMessage(`[{"ip":"10.0.80.2/24","vlan":10,"gateway":"10.0.80.1"},` +
+			`{"ip":"10.0.81.2/24","vlan":20,"gateway":"10.0.81.1"}]`),
+	}
+	var networkInfos []*cniutil.NetworkInfo
+	for _, ifName := range []string{"eth0", "eth1", "eth2"} {
+		networkInfo := cniutil.NewNetworkInfo("galaxy-k8s-vlan", nil, ifName)
+		networkInfo.Args["ipinfos"] = string(extendedCNIArgs["ipinfos"])
+		networkInfos = append(networkInfos, networkInfo)
+	}
+	if err := assignNetworkIPInfos(networkInfos, []bool{true, false, true}, extendedCNIArgs); err != nil {
+		t.Fatal(err)
+	}
+	for i, expect := range []string{`[{"ip":"10.0.80.2/24","vlan":10,"gateway":"10.0.80.1"}]`, "",
+		`[{"ip":"10.0.81.2/24","vlan":20,"gateway":"10.0.81.1"}]`} {
+		if networkInfos[i].Args["ipinfos"] != expect {
+			t.Fatalf("network %d: expect ipinfos %s, got %s", i, expect, networkInfos[i].Args["ipinfos"])
+		}
+	}
+	// number of ipinfos mismatches networks referring to pools
+	if err := assignNetworkIPInfos(networkInfos, []bool{true, true, true}, extendedCNIArgs); err == nil {
+		t.Fatal("expect an error")
+	}
+}
+
+func TestMarshalResult(t *testing.T) {
+	result := &types100.Result{
+		CNIVersion: types100.ImplementedSpecVersion,
+		Interfaces: []*types100.Interface{{Name: "eth0", Sandbox: "/var/run/netns/ctn"}},
+		IPs: []*types100.IPConfig{{Address: net.IPNet{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(24, 32)},
+			Gateway: net.ParseIP("10.0.0.1"), Interface: types100.Int(0)}},
+	}
+	for conf, expect := range map[string]string{
+		`{"name":"n1","type":"galaxy-sdn"}`: `{"cniVersion":"0.1.0","ip4":{"ip":"10.0.0.2/24","gateway":"10.0.0.1"},` +
+			`"dns":{}}`,
+		`{"cniVersion":"0.2.0","name":"n1","type":"galaxy-sdn"}`: `{"cniVersion":"0.2.0","ip4":{"ip":"10.0.0.2/24",` +
+			`"gateway":"10.0.0.1"},"dns":{}}`,
+		`{"cniVersion":"1.0.0","name":"n1","type":"galaxy-sdn"}`: `{"cniVersion":"1.0.0","interfaces":[{"name":"eth0",` +
+			`"sandbox":"/var/run/netns/ctn"}],"ips":[{"interface":0,"address":"10.0.0.2/24","gateway":"10.0.0.1"}],` +
+			`"dns":{}}`,
+	} {
+		data, err := marshalResult(result, []byte(conf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expect {
+			t.Fatalf("conf %s, expect %s, got %s", conf, expect, string(data))
+		}
+	}
+}
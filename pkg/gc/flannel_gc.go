@@ -29,7 +29,9 @@ import (
 	"github.com/vishvananda/netlink"
 	"k8s.io/apimachinery/pkg/util/wait"
 	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/cniutil"
 	"tkestack.io/galaxy/pkg/api/docker"
+	"tkestack.io/galaxy/pkg/galaxy/metrics"
 )
 
 const (
@@ -42,13 +44,15 @@ var (
 		"network gc")
 	flagAllocatedIPDir = flag.String("flannel_allocated_ip_dir", "/var/lib/cni/networks,/var/lib/cni/networks/galaxy-flannel",
 		"IP storage directory of flannel cni plugin")
-	// /var/lib/cni/galaxy/$containerid stores network type, it's like {"galaxy-flannel":{}}
+	// /var/lib/cni/galaxy/$containerid stored network type in earlier versions, it's like {"galaxy-flannel":{}}
 	// /var/lib/cni/flannel/$containerid stores flannel cni plugin chain,
 	// it's like {"forceAddress":true,"ipMasq":false,"ipam":{"routes":[{"dst":"172.16.0.0/13"}],"subnet":
 	// "172.16.24.0/24","type":"host-local"},"isDefaultGateway":true,"mtu":1480,"name":"","routeSrc":"172.16.24.0",
 	// "type":"galaxy-veth"}
-	// /var/lib/cni/galaxy/port/$containerid stores port infos, it's like [{"hostPort":52701,"containerPort":19998,
-	// "protocol":"tcp","podName":"loader-server-seanyulei-1","podIP":"172.16.24.119"}]
+	// /var/lib/cni/galaxy/port/$containerid stored port infos in earlier versions, it's like [{"hostPort":52701,
+	// "containerPort":19998,"protocol":"tcp","podName":"loader-server-seanyulei-1","podIP":"172.16.24.119"}]
+	// Network infos and ports are now saved in the state store and cleaned up by cleanupStates, the legacy dirs are
+	// still cleaned up in case of files failing to migrate.
 	flagGCDirs = flag.String("gc_dirs", "/var/lib/cni/flannel,/var/lib/cni/galaxy,/var/lib/cni/galaxy/port", "Comma "+
 		"separated configure storage directory of cni plugin, the file names in this directory are container ids")
 )
@@ -88,6 +92,9 @@ func (gc *flannelGC) Run() {
 		if err := gc.cleanupGCDirs(); err != nil {
 			glog.Errorf("Error executing cleanup gc_dirs %v", err)
 		}
+		if err := gc.cleanupStates(); err != nil {
+			glog.Errorf("Error executing cleanup container states %v", err)
+		}
 	}, *flagFlannelGCInterval, gc.quit)
 
 	go wait.Until(func() {
@@ -152,6 +159,30 @@ func (gc *flannelGC) cleanupGCDirs() error {
 	return nil
 }
 
+// cleanupStates removes states of exited containers from the state store after cleaning up their port mappings
+func (gc *flannelGC) cleanupStates() error {
+	glog.V(4).Infof("cleanup container states...")
+	states, err := cniutil.ListStates()
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		if !gc.shouldCleanup(state.ContainerID) {
+			continue
+		}
+		if err := gc.cleanPortFunc(state.ContainerID); err != nil {
+			glog.Warningf("failed to clean port of container %s: %v", state.ContainerID, err)
+		}
+		if err := cniutil.DeleteState(state.ContainerID); err != nil {
+			glog.Warningf("Error deleting state of container %s: %v", state.ContainerID, err)
+			continue
+		}
+		metrics.GCCleanupCount.WithLabelValues("state").Inc()
+		glog.Infof("Deleted state of container %s", state.ContainerID)
+	}
+	return nil
+}
+
 func (gc *flannelGC) cleanupVeth() error {
 	links, err := netlink.LinkList()
 	if err != nil {
@@ -175,7 +206,9 @@ func (gc *flannelGC) cleanupVeth() error {
 		if gc.shouldCleanup(cid) {
 			if err = netlink.LinkDel(link); err != nil {
 				glog.Warningf("failed remove link %s: %v; try next time", link.Attrs().Name, err)
+				continue
 			}
+			metrics.GCCleanupCount.WithLabelValues("veth").Inc()
 			glog.Infof("removed link %s for container %s", link.Attrs().Name, cid)
 		}
 	}
@@ -204,6 +237,7 @@ func removeLeakyIPFile(ipFile, containerId string) {
 		glog.Warningf("Error deleting leaky ip file %s container %s: %v", ipFile, containerId, err)
 	} else {
 		if err == nil {
+			metrics.GCCleanupCount.WithLabelValues("ip_file").Inc()
 			glog.Infof("Deleted leaky ip file %s container %s", ipFile, containerId)
 		}
 	}
@@ -217,6 +251,7 @@ func (gc *flannelGC) removeLeakyStateFile(file string) {
 		glog.Warningf("Error deleting file %s: %v", file, err)
 	} else {
 		if err == nil {
+			metrics.GCCleanupCount.WithLabelValues("state_file").Inc()
 			glog.Infof("Deleted file %s", file)
 		}
 	}
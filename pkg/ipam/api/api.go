@@ -38,13 +38,16 @@ import (
 type Controller struct {
 	ipam      floatingip.IPAM
 	podLister v1.PodLister
+	// watcher lists allocated ips consistent with the resource version of watch events if not nil
+	watcher *Watcher
 }
 
 // NewController construct a controller object
-func NewController(ipam floatingip.IPAM, lister v1.PodLister) *Controller {
+func NewController(ipam floatingip.IPAM, lister v1.PodLister, watcher *Watcher) *Controller {
 	return &Controller{
 		ipam:      ipam,
 		podLister: lister,
+		watcher:   watcher,
 	}
 }
 
@@ -60,6 +63,9 @@ type FloatingIP struct {
 	UpdateTime time.Time         `json:"updateTime,omitempty"`
 	Status     string            `json:"status,omitempty"`
 	Releasable bool              `json:"releasable,omitempty"`
+	NodeName   string            `json:"nodeName,omitempty"`
+	PodUid     string            `json:"podUid,omitempty"`
+	Static     bool              `json:"static,omitempty"`
 	labels     map[string]string `json:"-"`
 }
 
@@ -75,6 +81,9 @@ func (FloatingIP) SwaggerDoc() map[string]string {
 		"updateTime": "last allocate or release time of this ip",
 		"status":     "pod status if exists",
 		"releasable": "if the ip is releasable. An ip is releasable if it isn't belong to any pod",
+		"nodeName":   "node name of the pod the ip is assigned to",
+		"podUid":     "uid of the pod the ip is allocated to",
+		"static":     "if the ip is allocated by static ip annotation of the pod",
 	}
 }
 
@@ -82,6 +91,8 @@ func (FloatingIP) SwaggerDoc() map[string]string {
 type ListIPResp struct {
 	pageutil.Page
 	Content []FloatingIP `json:"content,omitempty"`
+	// ResourceVersion is the version of the last watch event the ips are consistent with
+	ResourceVersion string `json:"resourceVersion,omitempty"`
 }
 
 // ListIPs lists floating ips
@@ -108,12 +119,37 @@ func (c *Controller) ListIPs(req *restful.Request, resp *restful.Response) {
 		}
 		key = util.NewKeyObj(appTypePrefix, namespace, appName, podName, poolName).KeyInDB
 	}
-	glog.V(4).Infof("list ips by %s, fuzzyQuery %v", key, fuzzyQuery)
-	fips, err := listIPs(key, c.ipam, fuzzyQuery)
+	var fips []FloatingIP
+	var resourceVersion string
+	var err error
+	if ipStr := req.QueryParameter("ip"); ipStr != "" {
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			httputil.BadRequest(resp, fmt.Errorf("%q is not a valid ip", ipStr))
+			return
+		}
+		if c.watcher == nil {
+			fips, err = listIPsByIP(ip, c.ipam)
+		} else {
+			fips, resourceVersion, err = c.watcher.listIPsByIP(ip, c.ipam)
+		}
+	} else {
+		glog.V(4).Infof("list ips by %s, fuzzyQuery %v", key, fuzzyQuery)
+		if c.watcher == nil {
+			fips, err = listIPs(key, c.ipam, fuzzyQuery)
+		} else {
+			fips, resourceVersion = c.watcher.listIPs(key, fuzzyQuery)
+		}
+	}
 	if err != nil {
 		httputil.InternalError(resp, err)
 		return
 	}
+	// ip, keyword or pool name matches ips of all namespaces, while requests are authorized against the namespace
+	// parameter
+	if namespace := req.QueryParameter("namespace"); namespace != "" {
+		fips = filterByNamespace(fips, namespace)
+	}
 	sortParam, page, size := pageutil.PagingParams(req)
 	sort.Sort(bySortParam{array: fips, lessFunc: sortFunc(sortParam)})
 	start, end, pagin := pageutil.Pagination(page, size, len(fips))
@@ -122,7 +158,7 @@ func (c *Controller) ListIPs(req *restful.Request, resp *restful.Response) {
 		httputil.InternalError(resp, err)
 		return
 	}
-	resp.WriteEntity(ListIPResp{Page: *pagin, Content: pagedFips}) // nolint: errcheck
+	resp.WriteEntity(ListIPResp{Page: *pagin, Content: pagedFips, ResourceVersion: resourceVersion}) // nolint: errcheck
 }
 
 // fillReleasableAndStatus fills status and releasable field
@@ -292,6 +328,112 @@ func (c *Controller) ReleaseIPs(req *restful.Request, resp *restful.Response) {
 	resp.WriteHeaderAndEntity(res.Code, res)
 }
 
+// ImportIPReq is the request to import allocated ips
+type ImportIPReq struct {
+	IPs []FloatingIP `json:"ips"`
+}
+
+// ImportKey returns the key which the ip is imported to. App type defaults to statefulset if it is empty.
+func (f *FloatingIP) ImportKey() (string, error) {
+	appTypePrefix := util.StatefulsetPrefixKey
+	if f.AppType != "" {
+		appTypePrefix = util.GetAppTypePrefix(f.AppType)
+	}
+	if appTypePrefix == "" {
+		return "", fmt.Errorf("unknown app type %q", f.AppType)
+	}
+	key := util.NewKeyObj(appTypePrefix, f.Namespace, f.AppName, f.PodName, f.PoolName).KeyInDB
+	if key == "" {
+		return "", fmt.Errorf("key of %s is empty", f.IP)
+	}
+	return key, nil
+}
+
+// ImportIPResp is the response of import ips
+type ImportIPResp struct {
+	httputil.Resp
+	Imported   []string          `json:"imported,omitempty"`
+	Unimported map[string]string `json:"unimported,omitempty"`
+}
+
+// SwaggerDoc generates swagger doc for import ip response
+func (ImportIPResp) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"imported":   "imported ips, including ips which have already been allocated to the same key",
+		"unimported": "unimported ips and reasons, allocated to other keys or not within valid range",
+	}
+}
+
+// ImportIPs allocates ips to their keys with release policies and attributes of the request, e.g. to restore
+// allocated ips exported by listing ips. Imported ips are normal allocated ips rather than manually reserved ips.
+func (c *Controller) ImportIPs(req *restful.Request, resp *restful.Response) {
+	var importIPReq ImportIPReq
+	if err := req.ReadEntity(&importIPReq); err != nil {
+		httputil.BadRequest(resp, err)
+		return
+	}
+	ips := make([]net.IP, len(importIPReq.IPs))
+	keys := make([]string, len(importIPReq.IPs))
+	for i := range importIPReq.IPs {
+		fip := &importIPReq.IPs[i]
+		if ips[i] = net.ParseIP(fip.IP); ips[i] == nil {
+			httputil.BadRequest(resp, fmt.Errorf("%q is not a valid ip", fip.IP))
+			return
+		}
+		switch constant.ReleasePolicy(fip.Policy) {
+		case constant.ReleasePolicyPodDelete, constant.ReleasePolicyImmutable, constant.ReleasePolicyNever:
+		default:
+			httputil.BadRequest(resp, fmt.Errorf("invalid policy %d of %s", fip.Policy, fip.IP))
+			return
+		}
+		var err error
+		if keys[i], err = fip.ImportKey(); err != nil {
+			httputil.BadRequest(resp, err)
+			return
+		}
+	}
+	res := ImportIPResp{Unimported: map[string]string{}}
+	for i := range importIPReq.IPs {
+		fip := &importIPReq.IPs[i]
+		attr := floatingip.Attr{Policy: constant.ReleasePolicy(fip.Policy), NodeName: fip.NodeName, Uid: fip.PodUid,
+			Static: fip.Static}
+		if err := importIP(c.ipam, keys[i], ips[i], attr); err != nil {
+			glog.Warningf("failed to import %s to %s: %v", fip.IP, keys[i], err)
+			res.Unimported[fip.IP] = err.Error()
+			continue
+		}
+		res.Imported = append(res.Imported, fip.IP)
+	}
+	if len(res.Imported) > 0 {
+		glog.Infof("imported ips %v", res.Imported)
+	}
+	if len(res.Unimported) > 0 {
+		res.Resp = httputil.NewResp(http.StatusAccepted, "Unimported ips have been allocated to other keys, "+
+			"or are not within valid range")
+	} else {
+		res.Resp = httputil.NewResp(http.StatusOK, "")
+	}
+	resp.WriteHeaderAndEntity(res.Code, res)
+}
+
+// importIP allocates the ip to the key unless it has already been allocated to the key
+func importIP(ipam floatingip.IPAM, key string, ip net.IP, attr floatingip.Attr) error {
+	fip, err := ipam.ByIP(ip)
+	if err != nil {
+		return err
+	}
+	if fip.IP == nil {
+		return fmt.Errorf("not within any floating ip pool")
+	}
+	if fip.Key == key {
+		return nil
+	}
+	if fip.Key != "" {
+		return fmt.Errorf("allocated to %s", fip.Key)
+	}
+	return ipam.AllocateSpecificIP(key, ip, attr)
+}
+
 // listIPs lists ips from ipams
 func listIPs(keyword string, ipam floatingip.IPAM, fuzzyQuery bool) ([]FloatingIP, error) {
 	var result []FloatingIP
@@ -315,6 +457,26 @@ func listIPs(keyword string, ipam floatingip.IPAM, fuzzyQuery bool) ([]FloatingI
 	return result, nil
 }
 
+// filterByNamespace returns ips of the namespace
+func filterByNamespace(fips []FloatingIP, namespace string) []FloatingIP {
+	var result []FloatingIP
+	for i := range fips {
+		if fips[i].Namespace == namespace {
+			result = append(result, fips[i])
+		}
+	}
+	return result
+}
+
+// listIPsByIP returns the floating ip of the given ip if it is within any floating ip pool
+func listIPsByIP(ip net.IP, ipam floatingip.IPAM) ([]FloatingIP, error) {
+	fip, err := ipam.ByIP(ip)
+	if err != nil || fip.IP == nil {
+		return nil, err
+	}
+	return []FloatingIP{convert(&fip)}, nil
+}
+
 // convert converts `floatingip.FloatingIP` to `FloatingIP`
 func convert(fip *floatingip.FloatingIP) FloatingIP {
 	keyObj := util.ParseKey(fip.Key)
@@ -326,6 +488,9 @@ func convert(fip *floatingip.FloatingIP) FloatingIP {
 		AppType:    util.GetAppType(keyObj.AppTypePrefix),
 		Policy:     fip.Policy,
 		UpdateTime: fip.UpdatedAt,
+		NodeName:   fip.NodeName,
+		PodUid:     fip.PodUid,
+		Static:     fip.Static,
 		labels:     fip.Labels}
 }
 
@@ -17,9 +17,20 @@
 package api
 
 import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/emicklei/go-restful"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1lister "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
 )
 
@@ -27,9 +38,51 @@ type fakeIPAM struct {
 	floatingip.IPAM
 	allocatedIPs   map[string]string
 	unallocatedIPs map[string]string
+	pools          []*floatingip.FloatingIPPool
 	err            error
 }
 
+func (ipam fakeIPAM) Pools() []*floatingip.FloatingIPPool {
+	return ipam.pools
+}
+
+func (ipam fakeIPAM) ByKeyword(keyword string) ([]floatingip.FloatingIP, error) {
+	var fips []floatingip.FloatingIP
+	for ip, k := range ipam.allocatedIPs {
+		if strings.Contains(k, keyword) {
+			fips = append(fips, floatingip.FloatingIP{IP: net.ParseIP(ip), Key: k})
+		}
+	}
+	return fips, nil
+}
+
+func (ipam fakeIPAM) ByPrefix(prefix string) ([]*floatingip.FloatingIPInfo, error) {
+	var fips []*floatingip.FloatingIPInfo
+	for ip, k := range ipam.allocatedIPs {
+		if strings.HasPrefix(k, prefix) {
+			fips = append(fips, &floatingip.FloatingIPInfo{FloatingIP: floatingip.FloatingIP{IP: net.ParseIP(ip),
+				Key: k}, NodeSubnets: sets.NewString("10.49.27.0/24")})
+		}
+	}
+	return fips, nil
+}
+
+func (ipam fakeIPAM) ByIP(ip net.IP) (floatingip.FloatingIP, error) {
+	if k, ok := ipam.allocatedIPs[ip.String()]; ok {
+		return floatingip.FloatingIP{IP: ip, Key: k}, nil
+	}
+	if _, ok := ipam.unallocatedIPs[ip.String()]; ok {
+		return floatingip.FloatingIP{IP: ip}, nil
+	}
+	return floatingip.FloatingIP{}, nil
+}
+
+func (ipam fakeIPAM) AllocateSpecificIP(key string, ip net.IP, attr floatingip.Attr) error {
+	delete(ipam.unallocatedIPs, ip.String())
+	ipam.allocatedIPs[ip.String()] = key
+	return nil
+}
+
 func (ipam fakeIPAM) ReleaseIPs(ipToKey map[string]string) (map[string]string, map[string]string, error) {
 	if ipam.err != nil {
 		return nil, ipToKey, ipam.err
@@ -67,3 +120,190 @@ func TestBatchReleaseIPs(t *testing.T) {
 		t.Fatal(unreleased)
 	}
 }
+
+func createPodLister(t *testing.T, pods ...*corev1.Pod) corev1lister.PodLister {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, pod := range pods {
+		if err := indexer.Add(pod); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return corev1lister.NewPodLister(indexer)
+}
+
+func TestListSubnets(t *testing.T) {
+	var pool1, pool2 floatingip.FloatingIPPool
+	if err := json.Unmarshal([]byte(`{"name":"pool1","nodeSubnets":["10.49.27.0/24"],`+
+		`"ips":["10.0.70.2~10.0.70.5"],"subnet":"10.0.70.0/24","gateway":"10.0.70.1","vlan":2}`), &pool1); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"nodeSubnets":["10.49.28.0/24"],"ips":["10.0.80.2~10.0.80.3"],`+
+		`"subnet":"10.0.80.0/24","gateway":"10.0.80.1"}`), &pool2); err != nil {
+		t.Fatal(err)
+	}
+	ipam := fakeIPAM{pools: []*floatingip.FloatingIPPool{&pool1, &pool2}, allocatedIPs: map[string]string{
+		"10.0.70.2": "sts_ns1_sts_sts-0", "10.0.70.3": "sts_ns1_sts_sts-1", "10.0.80.2": "dp_ns1_dp_"}}
+	lister := createPodLister(t, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "sts-0", Namespace: "ns1"},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning}})
+	subnets, err := listSubnets(ipam, lister)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Subnet{{Name: "pool1", Subnet: "10.0.70.0/24", Gateway: "10.0.70.1", Vlan: 2,
+		IPRanges: []string{"10.0.70.2~10.0.70.5"}, NodeSubnets: []string{"10.49.27.0/24"},
+		Usage: Usage{Allocated: 1, Reserved: 1, Free: 2}}, {Subnet: "10.0.80.0/24", Gateway: "10.0.80.1",
+		IPRanges: []string{"10.0.80.2~10.0.80.3"}, NodeSubnets: []string{"10.49.28.0/24"},
+		Usage: Usage{Allocated: 0, Reserved: 1, Free: 1}}}
+	if !reflect.DeepEqual(expect, subnets) {
+		t.Fatalf("expect %+v, got %+v", expect, subnets)
+	}
+}
+
+func TestListPools(t *testing.T) {
+	var named, unnamed floatingip.FloatingIPPool
+	if err := json.Unmarshal([]byte(`{"name":"pool1","nodeSubnets":["10.49.27.0/24"],`+
+		`"ips":["10.0.80.2~10.0.80.5"],"subnet":"10.0.80.0/24","gateway":"10.0.80.1","vlan":3}`), &named); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"nodeSubnets":["10.49.27.0/24"],"ips":["10.0.70.2~10.0.70.5"],`+
+		`"subnet":"10.0.70.0/24","gateway":"10.0.70.1","vlan":2}`), &unnamed); err != nil {
+		t.Fatal(err)
+	}
+	ipam := fakeIPAM{pools: []*floatingip.FloatingIPPool{&unnamed, &named}, allocatedIPs: map[string]string{
+		"10.0.70.2": "pool__pool1_dp_ns1_dp_dp-xx-yy", "10.0.70.3": "pool__pool1_", "10.0.70.4": "pool__pool2_",
+		"10.0.70.5": "dp_ns1_dp_"}}
+	lister := createPodLister(t, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "dp-xx-yy", Namespace: "ns1"},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning}})
+	c := &PoolController{IPAM: ipam, PodLister: lister}
+	pools, err := c.listPools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("expect 2 pools, got %+v", pools)
+	}
+	less := poolLessFunc("name")
+	if less(&pools[1], &pools[0]) {
+		pools[0], pools[1] = pools[1], pools[0]
+	}
+	// ip ranges of pool1 come from the floating ip pool of the same name, while those of pool2 come from the
+	// floating ip pool of its ips
+	expect := []PoolInfo{
+		{Pool: Pool{Name: "pool1"}, IPRanges: []string{"10.0.80.2~10.0.80.5"}, Gateway: "10.0.80.1", Vlan: 3,
+			NodeSubnets: []string{"10.49.27.0/24"}, Usage: Usage{Allocated: 1, Reserved: 1}},
+		{Pool: Pool{Name: "pool2"}, IPRanges: []string{"10.0.70.2~10.0.70.5"}, Gateway: "10.0.70.1", Vlan: 2,
+			NodeSubnets: []string{"10.49.27.0/24"}, Usage: Usage{Reserved: 1}},
+	}
+	if !reflect.DeepEqual(expect, pools) {
+		t.Fatalf("expect %+v, got %+v", expect, pools)
+	}
+}
+
+func TestListIPsOfNamespace(t *testing.T) {
+	ipam := fakeIPAM{allocatedIPs: map[string]string{"10.0.70.2": "sts_ns1_app_app-0",
+		"10.0.70.3": "sts_ns2_app_app-0", "10.0.70.4": "dp_ns2_app_", "10.0.70.5": "pool__p1_sts_ns2_app_app-1"}}
+	c := NewController(ipam, createPodLister(t), nil)
+	ws := new(restful.WebService)
+	ws.Route(ws.GET("/ip").To(c.ListIPs).Produces(restful.MIME_JSON))
+	container := restful.NewContainer()
+	container.Add(ws)
+	for query, expect := range map[string][]string{
+		// ip, keyword and pool name match ips of all namespaces unless the namespace is specified
+		"keyword=app":               {"10.0.70.2", "10.0.70.3", "10.0.70.4", "10.0.70.5"},
+		"keyword=app&namespace=ns1": {"10.0.70.2"},
+		"namespace=ns2&appName=app": {"10.0.70.3"},
+		"poolName=p1":               {"10.0.70.5"},
+		"poolName=p1&namespace=ns1": nil,
+		"poolName=p1&namespace=ns2": {"10.0.70.5"},
+	} {
+		recorder := httptest.NewRecorder()
+		container.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/ip?"+query, nil))
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("query %s: expect 200, got %d %s", query, recorder.Code, recorder.Body.String())
+		}
+		var resp ListIPResp
+		if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		var ips []string
+		for _, fip := range resp.Content {
+			ips = append(ips, fip.IP)
+		}
+		if !reflect.DeepEqual(expect, ips) {
+			t.Fatalf("query %s: expect %v, got %v", query, expect, ips)
+		}
+	}
+}
+
+func TestImportIPs(t *testing.T) {
+	ipam := fakeIPAM{allocatedIPs: map[string]string{"10.0.70.2": "sts_ns1_sts_sts-0",
+		"10.0.70.3": "dp_ns1_dp_"}, unallocatedIPs: map[string]string{"10.0.70.4": "", "10.0.70.5": ""}}
+	c := NewController(ipam, createPodLister(t), nil)
+	ws := new(restful.WebService)
+	ws.Route(ws.POST("/ip/import").To(c.ImportIPs).Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON))
+	container := restful.NewContainer()
+	container.Add(ws)
+	body := `{"ips":[{"ip":"10.0.70.2","namespace":"ns1","appName":"sts","podName":"sts-0","policy":2},` +
+		`{"ip":"10.0.70.3","namespace":"ns1","appName":"dp2","appType":"deployment"},` +
+		`{"ip":"10.0.70.4","namespace":"ns1","appName":"sts","podName":"sts-1","policy":2,"podUid":"uid1"},` +
+		`{"ip":"10.0.70.6","namespace":"ns1","appName":"sts","podName":"sts-2"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/ip/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", restful.MIME_JSON)
+	recorder := httptest.NewRecorder()
+	container.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("expect 202, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	var resp ImportIPResp
+	if err := json.Unmarshal(recorder.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	// ips allocated to the same key are imported, while ips allocated to other keys or not in pools are not
+	if !reflect.DeepEqual([]string{"10.0.70.2", "10.0.70.4"}, resp.Imported) {
+		t.Fatalf("unexpected imported ips %v", resp.Imported)
+	}
+	if len(resp.Unimported) != 2 || resp.Unimported["10.0.70.3"] == "" || resp.Unimported["10.0.70.6"] == "" {
+		t.Fatalf("unexpected unimported ips %v", resp.Unimported)
+	}
+	if ipam.allocatedIPs["10.0.70.4"] != "sts_ns1_sts_sts-1" || ipam.allocatedIPs["10.0.70.3"] != "dp_ns1_dp_" {
+		t.Fatalf("unexpected allocated ips %v", ipam.allocatedIPs)
+	}
+}
+
+func TestImportIPsInvalidPolicy(t *testing.T) {
+	ipam := fakeIPAM{allocatedIPs: map[string]string{}, unallocatedIPs: map[string]string{"10.0.70.4": ""}}
+	c := NewController(ipam, createPodLister(t), nil)
+	ws := new(restful.WebService)
+	ws.Route(ws.POST("/ip/import").To(c.ImportIPs).Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON))
+	container := restful.NewContainer()
+	container.Add(ws)
+	body := `{"ips":[{"ip":"10.0.70.4","namespace":"ns1","appName":"sts","podName":"sts-1","policy":3}]}`
+	req := httptest.NewRequest(http.MethodPost, "/ip/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", restful.MIME_JSON)
+	recorder := httptest.NewRecorder()
+	container.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expect 400, got %d %s", recorder.Code, recorder.Body.String())
+	}
+	if len(ipam.allocatedIPs) != 0 {
+		t.Fatalf("unexpected allocated ips %v", ipam.allocatedIPs)
+	}
+}
+
+func TestImportKey(t *testing.T) {
+	for _, c := range []struct {
+		fip    FloatingIP
+		expect string
+	}{
+		// app type defaults to statefulset
+		{fip: FloatingIP{IP: "10.0.70.4", Namespace: "ns1", AppName: "sts", PodName: "sts-1"},
+			expect: "sts_ns1_sts_sts-1"},
+		{fip: FloatingIP{IP: "10.0.70.4", Namespace: "ns1", AppName: "dp", AppType: "deployment"},
+			expect: "dp_ns1_dp_"},
+	} {
+		key, err := c.fip.ImportKey()
+		if err != nil || key != c.expect {
+			t.Fatalf("expect key %q, got %q, err %v", c.expect, key, err)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/kubernetes"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+)
+
+const (
+	// ResourceFloatingIPs is the resource name of floating ips for authorization
+	ResourceFloatingIPs = "floatingips"
+	// ResourcePools is the resource name of pools for authorization
+	ResourcePools = "pools"
+	// ResourceCloudProviderOperations is the resource name of cloud provider operations for authorization
+	ResourceCloudProviderOperations = "cloudprovideroperations"
+
+	// cache results of reviews for a while to avoid requesting apiserver for each API request
+	reviewCacheTTL  = 10 * time.Second
+	reviewCacheSize = 1024
+)
+
+// NamespaceFunc returns namespaces of the resources a request accesses. An empty namespace means all namespaces.
+type NamespaceFunc func(req *restful.Request) ([]string, error)
+
+// Authorizer authenticates API requests by bearer token via TokenReview and authorizes them via
+// SubjectAccessReview against floatingips and pools resources of galaxy.k8s.io group
+type Authorizer struct {
+	client      kubernetes.Interface
+	tokenCache  *cache.LRUExpireCache
+	accessCache *cache.LRUExpireCache
+}
+
+// NewAuthorizer creates an Authorizer
+func NewAuthorizer(client kubernetes.Interface) *Authorizer {
+	return &Authorizer{
+		client:      client,
+		tokenCache:  cache.NewLRUExpireCache(reviewCacheSize),
+		accessCache: cache.NewLRUExpireCache(reviewCacheSize),
+	}
+}
+
+// Filter returns a route filter which allows a request only if its user is allowed to verb the resource in all
+// namespaces returned by namespaceFunc, or all namespaces if namespaceFunc is nil. A nil Authorizer allows all
+// requests.
+func (a *Authorizer) Filter(verb, resource string, namespaceFunc NamespaceFunc) restful.FilterFunction {
+	return func(req *restful.Request, resp *restful.Response, chain *restful.FilterChain) {
+		if a == nil {
+			chain.ProcessFilter(req, resp)
+			return
+		}
+		user, err := a.authenticate(req.Request)
+		if err != nil {
+			httputil.Unauthorized(resp, err)
+			return
+		}
+		namespaces := []string{""}
+		if namespaceFunc != nil {
+			if namespaces, err = namespaceFunc(req); err != nil {
+				httputil.BadRequest(resp, err)
+				return
+			}
+		}
+		for _, namespace := range namespaces {
+			allowed, err := a.authorize(user, verb, resource, namespace)
+			if err != nil {
+				httputil.InternalError(resp, err)
+				return
+			}
+			if !allowed {
+				glog.Infof("user %s is not allowed to %s %s in namespace %q", user.Username, verb, resource,
+					namespace)
+				httputil.Forbidden(resp, fmt.Errorf("user %s is not allowed to %s %s in namespace %q",
+					user.Username, verb, resource, namespace))
+				return
+			}
+		}
+		chain.ProcessFilter(req, resp)
+	}
+}
+
+// authenticate reviews the bearer token of the request and returns its user
+func (a *Authorizer) authenticate(req *http.Request) (*authenticationv1.UserInfo, error) {
+	auth := strings.TrimSpace(req.Header.Get("Authorization"))
+	parts := strings.SplitN(auth, " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" || strings.TrimSpace(parts[1]) == "" {
+		return nil, fmt.Errorf("bearer token is required")
+	}
+	token := strings.TrimSpace(parts[1])
+	key := fmt.Sprintf("%x", sha256.Sum256([]byte(token)))
+	if user, ok := a.tokenCache.Get(key); ok {
+		return user.(*authenticationv1.UserInfo), nil
+	}
+	review, err := a.client.AuthenticationV1().TokenReviews().Create(&authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to review token: %v", err)
+	}
+	if !review.Status.Authenticated {
+		return nil, fmt.Errorf("invalid bearer token %s", review.Status.Error)
+	}
+	user := review.Status.User
+	a.tokenCache.Add(key, &user, reviewCacheTTL)
+	return &user, nil
+}
+
+// authorize checks if the user is allowed to verb the resource in the namespace
+func (a *Authorizer) authorize(user *authenticationv1.UserInfo, verb, resource, namespace string) (bool, error) {
+	key := strings.Join([]string{user.UID, user.Username, verb, resource, namespace}, "/")
+	if allowed, ok := a.accessCache.Get(key); ok {
+		return allowed.(bool), nil
+	}
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review, err := a.client.AuthorizationV1().SubjectAccessReviews().Create(&authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: namespace,
+				Verb:      verb,
+				Group:     galaxy.GroupName,
+				Resource:  resource,
+			},
+		}})
+	if err != nil {
+		return false, fmt.Errorf("failed to review subject access: %v", err)
+	}
+	a.accessCache.Add(key, review.Status.Allowed, reviewCacheTTL)
+	return review.Status.Allowed, nil
+}
+
+// StaticNamespace returns a NamespaceFunc which always returns the namespace
+func StaticNamespace(namespace string) NamespaceFunc {
+	return func(req *restful.Request) ([]string, error) {
+		return []string{namespace}, nil
+	}
+}
+
+// QueryNamespace returns the namespace query parameter of the request
+func QueryNamespace(req *restful.Request) ([]string, error) {
+	return []string{req.QueryParameter("namespace")}, nil
+}
+
+// ReleaseIPNamespaces returns namespaces of ips to be released
+func ReleaseIPNamespaces(req *restful.Request) ([]string, error) {
+	var releaseIPReq ReleaseIPReq
+	if err := peekEntity(req, &releaseIPReq); err != nil {
+		return nil, err
+	}
+	namespaces := sets.NewString()
+	for i := range releaseIPReq.IPs {
+		namespaces.Insert(releaseIPReq.IPs[i].Namespace)
+	}
+	return namespaces.List(), nil
+}
+
+// ImportIPNamespaces returns namespaces of ips to be imported
+func ImportIPNamespaces(req *restful.Request) ([]string, error) {
+	var importIPReq ImportIPReq
+	if err := peekEntity(req, &importIPReq); err != nil {
+		return nil, err
+	}
+	namespaces := sets.NewString()
+	for i := range importIPReq.IPs {
+		namespaces.Insert(importIPReq.IPs[i].Namespace)
+	}
+	return namespaces.List(), nil
+}
+
+// TransferNamespaces returns namespaces of the source and target workloads of a transfer
+func TransferNamespaces(req *restful.Request) ([]string, error) {
+	var transferReq TransferRequest
+	if err := peekEntity(req, &transferReq); err != nil {
+		return nil, err
+	}
+	return sets.NewString(transferReq.From.Namespace, transferReq.To.Namespace).List(), nil
+}
+
+// GangNamespace returns the namespace of a gang reservation
+func GangNamespace(req *restful.Request) ([]string, error) {
+	var gang Gang
+	if err := peekEntity(req, &gang); err != nil {
+		return nil, err
+	}
+	return []string{gang.Namespace}, nil
+}
+
+// peekEntity decodes the json request body into v and leaves the body readable for handlers
+func peekEntity(req *restful.Request, v interface{}) error {
+	data, err := ioutil.ReadAll(req.Request.Body)
+	if err != nil {
+		return err
+	}
+	req.Request.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return json.Unmarshal(data, v)
+}
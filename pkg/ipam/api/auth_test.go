@@ -0,0 +1,95 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// #lizard forgives
+func TestAuthorizerFilter(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "token1" {
+			review.Status = authenticationv1.TokenReviewStatus{Authenticated: true,
+				User: authenticationv1.UserInfo{Username: "user1", UID: "1"}}
+		}
+		return true, review, nil
+	})
+	// user1 is allowed to delete floatingips of ns1 only
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object,
+		error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attr := review.Spec.ResourceAttributes
+		review.Status.Allowed = review.Spec.User == "user1" && attr.Group == "galaxy.k8s.io" &&
+			attr.Resource == ResourceFloatingIPs && attr.Verb == "delete" && attr.Namespace == "ns1"
+		return true, review, nil
+	})
+	var body string
+	ws := new(restful.WebService)
+	ws.Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
+	ws.Route(ws.POST("/ip").To(func(req *restful.Request, resp *restful.Response) {
+		var releaseIPReq ReleaseIPReq
+		if err := req.ReadEntity(&releaseIPReq); err != nil {
+			t.Fatal(err)
+		}
+		body = releaseIPReq.IPs[0].IP
+	}).Filter(NewAuthorizer(client).Filter("delete", ResourceFloatingIPs, ReleaseIPNamespaces)))
+	container := restful.NewContainer()
+	container.Add(ws)
+	for i, c := range []struct {
+		token      string
+		namespaces []string
+		expectCode int
+	}{
+		{token: "", namespaces: []string{"ns1"}, expectCode: http.StatusUnauthorized},
+		{token: "token2", namespaces: []string{"ns1"}, expectCode: http.StatusUnauthorized},
+		{token: "token1", namespaces: []string{"ns1", "ns2"}, expectCode: http.StatusForbidden},
+		{token: "token1", namespaces: []string{"ns1", "ns1"}, expectCode: http.StatusOK},
+	} {
+		body = ""
+		var ips []string
+		for _, ns := range c.namespaces {
+			ips = append(ips, `{"ip":"10.0.0.2","namespace":"`+ns+`"}`)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/ip", strings.NewReader(`{"ips":[`+strings.Join(ips, ",")+`]}`))
+		req.Header.Set("Content-Type", restful.MIME_JSON)
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		recorder := httptest.NewRecorder()
+		container.ServeHTTP(recorder, req)
+		if recorder.Code != c.expectCode {
+			t.Fatalf("case %d: expect code %d, got %d: %s", i, c.expectCode, recorder.Code, recorder.Body.String())
+		}
+		// the handler should still be able to read the request body
+		if c.expectCode == http.StatusOK && body != "10.0.0.2" {
+			t.Fatalf("case %d: expect handler reads request body, got %q", i, body)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/ipam/client/clientset/versioned"
+	list "tkestack.io/galaxy/pkg/ipam/client/listers/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+)
+
+// CloudProviderController is the API controller of pending cloud provider operations
+type CloudProviderController struct {
+	Client versioned.Interface
+	Lister list.CloudProviderOperationLister
+}
+
+// Operation is a pending cloud provider operation of an ip
+type Operation struct {
+	IP              string    `json:"ip"`
+	UnAssignNodes   []string  `json:"unassignNodes,omitempty"`
+	AssignNode      string    `json:"assignNode,omitempty"`
+	Attempts        int       `json:"attempts"`
+	LastError       string    `json:"lastError,omitempty"`
+	LastAttemptTime time.Time `json:"lastAttemptTime,omitempty"`
+	DeadLetter      bool      `json:"deadLetter"`
+}
+
+// SwaggerDoc generates swagger doc for cloud provider operation
+func (Operation) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"ip":              "ip",
+		"unassignNodes":   "nodes to unassign the ip from",
+		"assignNode":      "node to assign the ip to after unassigning",
+		"attempts":        "number of failed attempts",
+		"lastError":       "error of the last attempt",
+		"lastAttemptTime": "time of the last attempt",
+		"deadLetter":      "true if the operation is not retried any more after too many failed attempts",
+	}
+}
+
+// ListOperationResp is the response of listing cloud provider operations
+type ListOperationResp struct {
+	httputil.Resp
+	Operations []Operation `json:"operations"`
+}
+
+// ListOperations lists pending cloud provider operations, or only dead letters if deadLetter query param is true
+func (c *CloudProviderController) ListOperations(req *restful.Request, resp *restful.Response) {
+	var deadLetterOnly bool
+	if val := req.QueryParameter("deadLetter"); val != "" {
+		var err error
+		if deadLetterOnly, err = strconv.ParseBool(val); err != nil {
+			httputil.BadRequest(resp, fmt.Errorf("invalid deadLetter %q: %v", val, err))
+			return
+		}
+	}
+	ops, err := c.Lister.List(labels.Everything())
+	if err != nil {
+		httputil.InternalError(resp, err)
+		return
+	}
+	ret := ListOperationResp{Resp: httputil.NewResp(http.StatusOK, ""), Operations: []Operation{}}
+	for _, op := range ops {
+		if deadLetterOnly && !op.Status.DeadLetter {
+			continue
+		}
+		ret.Operations = append(ret.Operations, toOperation(op))
+	}
+	sort.Slice(ret.Operations, func(i, j int) bool {
+		return ret.Operations[i].IP < ret.Operations[j].IP
+	})
+	resp.WriteEntity(ret) // nolint: errcheck
+}
+
+// RetryOperation resets attempts of an operation, so that a dead letter is retried again
+func (c *CloudProviderController) RetryOperation(req *restful.Request, resp *restful.Response) {
+	ip := req.PathParameter("ip")
+	client := c.Client.GalaxyV1alpha1().CloudProviderOperations()
+	op, err := client.Get(ip, v1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			httputil.ItemNotFound(resp, fmt.Errorf("cloud provider operation of ip %s", ip))
+			return
+		}
+		httputil.InternalError(resp, err)
+		return
+	}
+	op.Status = v1alpha1.CloudProviderOperationStatus{LastError: op.Status.LastError}
+	if _, err := client.Update(op); err != nil {
+		httputil.InternalError(resp, err)
+		return
+	}
+	httputil.Ok(resp)
+}
+
+// DeleteOperation gives up an operation
+func (c *CloudProviderController) DeleteOperation(req *restful.Request, resp *restful.Response) {
+	ip := req.PathParameter("ip")
+	if err := c.Client.GalaxyV1alpha1().CloudProviderOperations().Delete(ip, &v1.DeleteOptions{}); err != nil {
+		if errors.IsNotFound(err) {
+			httputil.ItemNotFound(resp, fmt.Errorf("cloud provider operation of ip %s", ip))
+			return
+		}
+		httputil.InternalError(resp, err)
+		return
+	}
+	httputil.Ok(resp)
+}
+
+func toOperation(op *v1alpha1.CloudProviderOperation) Operation {
+	return Operation{
+		IP:              op.Name,
+		UnAssignNodes:   op.Spec.UnAssignNodes,
+		AssignNode:      op.Spec.AssignNode,
+		Attempts:        op.Status.Attempts,
+		LastError:       op.Status.LastError,
+		LastAttemptTime: op.Status.LastAttemptTime.Time,
+		DeadLetter:      op.Status.DeadLetter,
+	}
+}
@@ -0,0 +1,111 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+)
+
+// GangController is the API controller of gang reservation
+type GangController struct {
+	// ReserveGangFunc reserves ips for the workload all at once in a single node subnet
+	ReserveGangFunc func(keyObj *util.KeyObj, size int, policy constant.ReleasePolicy) (
+		[]*floatingip.FloatingIPInfo, sets.String, error)
+}
+
+// Gang is the gang reservation request of a workload
+type Gang struct {
+	Namespace string `json:"namespace"`
+	AppName   string `json:"appName"`
+	AppType   string `json:"appType,omitempty"`
+	Size      int    `json:"size"`
+	Policy    string `json:"policy,omitempty"`
+}
+
+// SwaggerDoc generates swagger doc for gang reservation request
+func (Gang) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"namespace": "namespace",
+		"appName":   "deployment or statefulset name",
+		"appType":   "deployment, statefulset or tapp, default statefulset",
+		"size":      "number of ips to reserve",
+		"policy":    "ip release policy, immutable or never, default immutable",
+	}
+}
+
+// GangResp is the response of gang reservation
+type GangResp struct {
+	httputil.Resp
+	IPs         []string `json:"ips,omitempty"`
+	NodeSubnets []string `json:"nodeSubnets,omitempty"`
+}
+
+// SwaggerDoc generates swagger doc for gang reservation response
+func (GangResp) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"ips":         "all ips reserved or allocated for the workload",
+		"nodeSubnets": "node subnets of the reserved ips, pods of the workload will be scheduled to these subnets",
+	}
+}
+
+// Reserve reserves ips for a workload all at once in a single node subnet
+func (c *GangController) Reserve(req *restful.Request, resp *restful.Response) {
+	var gang Gang
+	if err := req.ReadEntity(&gang); err != nil {
+		httputil.BadRequest(resp, err)
+		return
+	}
+	if gang.Namespace == "" || gang.AppName == "" {
+		httputil.BadRequest(resp, fmt.Errorf("namespace or appName is empty"))
+		return
+	}
+	if gang.Size <= 0 {
+		httputil.BadRequest(resp, fmt.Errorf("invalid size %d", gang.Size))
+		return
+	}
+	appTypePrefix := util.StatefulsetPrefixKey
+	if gang.AppType != "" {
+		appTypePrefix = util.GetAppTypePrefix(gang.AppType)
+	}
+	policy := constant.ReleasePolicyImmutable
+	if gang.Policy != "" {
+		if policy = constant.ConvertReleasePolicy(gang.Policy); policy == constant.ReleasePolicyPodDelete {
+			httputil.BadRequest(resp, fmt.Errorf("invalid policy %q", gang.Policy))
+			return
+		}
+	}
+	keyObj := util.NewKeyObj(appTypePrefix, gang.Namespace, gang.AppName, "", "")
+	fips, subnets, err := c.ReserveGangFunc(keyObj, gang.Size, policy)
+	if err != nil {
+		httputil.InternalError(resp, err)
+		return
+	}
+	ips := make([]string, len(fips))
+	for i := range fips {
+		ips[i] = fips[i].IP.String()
+	}
+	resp.WriteEntity(GangResp{Resp: httputil.NewResp(http.StatusOK, ""), IPs: ips, // nolint: errcheck
+		NodeSubnets: subnets.List()})
+}
@@ -20,10 +20,14 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sort"
 
 	"github.com/emicklei/go-restful"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1lister "k8s.io/client-go/listers/core/v1"
 	glog "k8s.io/klog"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
@@ -32,6 +36,7 @@ import (
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
 	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
 	"tkestack.io/galaxy/pkg/utils/httputil"
+	pageutil "tkestack.io/galaxy/pkg/utils/page"
 )
 
 type PoolController struct {
@@ -39,6 +44,7 @@ type PoolController struct {
 	PoolLister   list.PoolLister
 	LockPoolFunc func(poolName string) func() // returns unlock func
 	IPAM         floatingip.IPAM
+	PodLister    corev1lister.PodLister
 }
 
 type Pool struct {
@@ -79,6 +85,169 @@ func (c *PoolController) Get(req *restful.Request, resp *restful.Response) {
 		Name: pool.Name, Size: pool.Size, PreAllocateIP: pool.PreAllocateIP}})
 }
 
+// PoolInfo is a pool with its utilization
+type PoolInfo struct {
+	Pool
+	IPRanges    []string `json:"ipRanges"`
+	Gateway     string   `json:"gateway,omitempty"`
+	Vlan        uint16   `json:"vlan"`
+	NodeSubnets []string `json:"nodeSubnets"`
+	Usage
+}
+
+// SwaggerDoc is to generate Swagger docs
+func (PoolInfo) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"ipRanges": "ip ranges of floating ip pools of the configmap with the same name, or floating ip pools " +
+			"of ips allocated to the pool if there is no such floating ip pool",
+		"gateway":     "gateway of the first floating ip pool of ipRanges",
+		"vlan":        "vlan id of the first floating ip pool of ipRanges",
+		"nodeSubnets": "node subnets of ips allocated to the pool",
+	}
+}
+
+// ListPoolResp is the List response
+type ListPoolResp struct {
+	pageutil.Page
+	Content []PoolInfo `json:"content,omitempty"`
+}
+
+// List lists pools created by API or CRD and pools which have been allocated ips
+func (c *PoolController) List(req *restful.Request, resp *restful.Response) {
+	pools, err := c.listPools()
+	if err != nil {
+		httputil.InternalError(resp, err)
+		return
+	}
+	sortParam, page, size := pageutil.PagingParams(req)
+	field, desc := parseSortParam(sortParam, "name")
+	less := poolLessFunc(field)
+	sort.SliceStable(pools, func(i, j int) bool {
+		if desc {
+			return less(&pools[j], &pools[i])
+		}
+		return less(&pools[i], &pools[j])
+	})
+	start, end, pagin := pageutil.Pagination(page, size, len(pools))
+	resp.WriteEntity(ListPoolResp{Page: *pagin, Content: pools[start:end]}) // nolint: errcheck
+}
+
+func (c *PoolController) listPools() ([]PoolInfo, error) {
+	poolMap := map[string]*PoolInfo{}
+	if c.PoolLister != nil {
+		pools, err := c.PoolLister.Pools("kube-system").List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		for _, pool := range pools {
+			poolMap[pool.Name] = &PoolInfo{Pool: Pool{Name: pool.Name, Size: pool.Size,
+				PreAllocateIP: pool.PreAllocateIP}}
+		}
+	}
+	// pools are not necessarily created before allocating ips, so find pools from all ips
+	fips, err := c.IPAM.ByPrefix("")
+	if err != nil {
+		return nil, err
+	}
+	poolIPs := map[string][]FloatingIP{}
+	poolNodeSubnets := map[string]sets.String{}
+	for i := range fips {
+		fip := convert(&fips[i].FloatingIP)
+		if fip.PoolName == "" {
+			continue
+		}
+		poolIPs[fip.PoolName] = append(poolIPs[fip.PoolName], fip)
+		if _, ok := poolNodeSubnets[fip.PoolName]; !ok {
+			poolNodeSubnets[fip.PoolName] = sets.NewString()
+		}
+		poolNodeSubnets[fip.PoolName].Insert(fips[i].NodeSubnets.UnsortedList()...)
+	}
+	result := make([]PoolInfo, 0, len(poolMap))
+	for name := range poolIPs {
+		if _, ok := poolMap[name]; !ok {
+			poolMap[name] = &PoolInfo{Pool: Pool{Name: name}}
+		}
+	}
+	for name, pool := range poolMap {
+		ips := poolIPs[name]
+		if err := fillReleasableAndStatus(c.PodLister, ips); err != nil {
+			return nil, err
+		}
+		pool.Usage = countUsage(ips)
+		// pools without size are able to allocate any free ip, so only count free ips within pool size
+		if pool.Size > len(ips) {
+			pool.Free = pool.Size - len(ips)
+		}
+		pool.NodeSubnets = []string{}
+		if subnets, ok := poolNodeSubnets[name]; ok {
+			pool.NodeSubnets = subnets.List()
+		}
+		fillPoolConfig(pool, c.IPAM.Pools(), ips)
+		result = append(result, *pool)
+	}
+	return result, nil
+}
+
+// fillPoolConfig fills ip ranges, gateway and vlan of the pool from floating ip pools of the same name, or floating
+// ip pools of ips allocated to the pool if there is no such floating ip pool
+func fillPoolConfig(pool *PoolInfo, configs []*floatingip.FloatingIPPool, ips []FloatingIP) {
+	var matched []*floatingip.FloatingIPPool
+	for _, config := range configs {
+		if config.Name == pool.Name {
+			matched = append(matched, config)
+		}
+	}
+	if len(matched) == 0 {
+		for _, config := range configs {
+			config.RLock()
+			for i := range ips {
+				if config.Contains(net.ParseIP(ips[i].IP)) {
+					matched = append(matched, config)
+					break
+				}
+			}
+			config.RUnlock()
+		}
+	}
+	pool.IPRanges = []string{}
+	for i, config := range matched {
+		config.RLock()
+		if i == 0 {
+			pool.Gateway, pool.Vlan = config.Gateway.String(), config.Vlan
+		}
+		for _, ipr := range config.IPRanges {
+			pool.IPRanges = append(pool.IPRanges, ipr.String())
+		}
+		config.RUnlock()
+	}
+}
+
+// poolLessFunc returns the less func of the sort field
+func poolLessFunc(field string) func(a, b *PoolInfo) bool {
+	switch field {
+	case "size":
+		return func(a, b *PoolInfo) bool {
+			return a.Size < b.Size
+		}
+	case "allocated":
+		return func(a, b *PoolInfo) bool {
+			return a.Allocated < b.Allocated
+		}
+	case "reserved":
+		return func(a, b *PoolInfo) bool {
+			return a.Reserved < b.Reserved
+		}
+	case "free":
+		return func(a, b *PoolInfo) bool {
+			return a.Free < b.Free
+		}
+	default:
+		return func(a, b *PoolInfo) bool {
+			return a.Name < b.Name
+		}
+	}
+}
+
 type UpdatePoolResp struct {
 	httputil.Resp
 	RealPoolSize int `json:"realPoolSize"`
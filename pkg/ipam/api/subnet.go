@@ -0,0 +1,177 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+	"k8s.io/client-go/listers/core/v1"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+	pageutil "tkestack.io/galaxy/pkg/utils/page"
+)
+
+// Usage is the utilization of ips
+type Usage struct {
+	Allocated int `json:"allocated"`
+	Reserved  int `json:"reserved"`
+	Free      int `json:"free"`
+}
+
+// SwaggerDoc is to generate Swagger docs
+func (Usage) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"allocated": "number of ips allocated to existing pods",
+		"reserved":  "number of ips reserved for deleted pods or workloads",
+		"free":      "number of ips available for allocating",
+	}
+}
+
+// Subnet is a floating ip pool of the configmap
+type Subnet struct {
+	Name        string   `json:"name,omitempty"`
+	Subnet      string   `json:"subnet"`
+	Gateway     string   `json:"gateway"`
+	Vlan        uint16   `json:"vlan"`
+	IPRanges    []string `json:"ipRanges"`
+	NodeSubnets []string `json:"nodeSubnets"`
+	Usage
+}
+
+// SwaggerDoc is to generate Swagger docs
+func (Subnet) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"name":        "pool name",
+		"subnet":      "pod subnet",
+		"gateway":     "gateway of pod subnet",
+		"vlan":        "vlan id",
+		"ipRanges":    "ip ranges of the pool",
+		"nodeSubnets": "subnets of nodes which are able to allocate ips of the pool",
+	}
+}
+
+// ListSubnetResp is the ListSubnets response
+type ListSubnetResp struct {
+	pageutil.Page
+	Content []Subnet `json:"content,omitempty"`
+}
+
+// ListSubnets lists floating ip pools of the configmap with their utilization
+func (c *Controller) ListSubnets(req *restful.Request, resp *restful.Response) {
+	subnets, err := listSubnets(c.ipam, c.podLister)
+	if err != nil {
+		httputil.InternalError(resp, err)
+		return
+	}
+	sortParam, page, size := pageutil.PagingParams(req)
+	field, desc := parseSortParam(sortParam, "subnet")
+	less := subnetLessFunc(field)
+	sort.SliceStable(subnets, func(i, j int) bool {
+		if desc {
+			return less(&subnets[j], &subnets[i])
+		}
+		return less(&subnets[i], &subnets[j])
+	})
+	start, end, pagin := pageutil.Pagination(page, size, len(subnets))
+	resp.WriteEntity(ListSubnetResp{Page: *pagin, Content: subnets[start:end]}) // nolint: errcheck
+}
+
+// listSubnets converts all floating ip pools to subnets and counts their allocated and reserved ips
+func listSubnets(ipam floatingip.IPAM, lister v1.PodLister) ([]Subnet, error) {
+	fips, err := listIPs("", ipam, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := fillReleasableAndStatus(lister, fips); err != nil {
+		return nil, err
+	}
+	pools := ipam.Pools()
+	subnets := make([]Subnet, len(pools))
+	for i, pool := range pools {
+		pool.RLock()
+		subnet := Subnet{Name: pool.Name, Subnet: pool.IPNet().String(), Gateway: pool.Gateway.String(),
+			Vlan: pool.Vlan, IPRanges: []string{}, NodeSubnets: []string{}}
+		for _, ipr := range pool.IPRanges {
+			subnet.IPRanges = append(subnet.IPRanges, ipr.String())
+		}
+		for _, nodeSubnet := range pool.NodeSubnets {
+			subnet.NodeSubnets = append(subnet.NodeSubnets, nodeSubnet.String())
+		}
+		var poolIPs []FloatingIP
+		for j := range fips {
+			if pool.Contains(net.ParseIP(fips[j].IP)) {
+				poolIPs = append(poolIPs, fips[j])
+			}
+		}
+		subnet.Usage = countUsage(poolIPs)
+		subnet.Free = int(pool.Size()) - subnet.Allocated - subnet.Reserved
+		pool.RUnlock()
+		subnets[i] = subnet
+	}
+	return subnets, nil
+}
+
+// countUsage counts allocated and reserved ips of ips whose status have been filled
+func countUsage(fips []FloatingIP) Usage {
+	var usage Usage
+	for i := range fips {
+		if fips[i].Status == "" || fips[i].Status == "Deleted" {
+			usage.Reserved++
+		} else {
+			usage.Allocated++
+		}
+	}
+	return usage
+}
+
+// parseSortParam parses a sort param like "free desc" to the lower case field and whether it is in desc order
+func parseSortParam(sortParam, defaultField string) (string, bool) {
+	parts := strings.Fields(strings.ToLower(sortParam))
+	if len(parts) == 0 {
+		return defaultField, false
+	}
+	return parts[0], len(parts) > 1 && parts[1] == "desc"
+}
+
+// subnetLessFunc returns the less func of the sort field
+func subnetLessFunc(field string) func(a, b *Subnet) bool {
+	switch field {
+	case "name":
+		return func(a, b *Subnet) bool {
+			return a.Name < b.Name
+		}
+	case "allocated":
+		return func(a, b *Subnet) bool {
+			return a.Allocated < b.Allocated
+		}
+	case "reserved":
+		return func(a, b *Subnet) bool {
+			return a.Reserved < b.Reserved
+		}
+	case "free":
+		return func(a, b *Subnet) bool {
+			return a.Free < b.Free
+		}
+	default:
+		return func(a, b *Subnet) bool {
+			return a.Subnet < b.Subnet
+		}
+	}
+}
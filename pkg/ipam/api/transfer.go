@@ -0,0 +1,130 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/emicklei/go-restful"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+)
+
+// TransferController is the API controller of transferring ips between workloads
+type TransferController struct {
+	// TransferFunc moves all ips of the source workload to the target workload and returns moved ips and their keys
+	TransferFunc func(from, to *util.KeyObj) (map[string]string, error)
+	Recorder     record.EventRecorder
+}
+
+// App is a workload which owns ips
+type App struct {
+	Namespace string `json:"namespace"`
+	AppName   string `json:"appName"`
+	AppType   string `json:"appType,omitempty"`
+}
+
+// SwaggerDoc generates swagger doc for workload
+func (App) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"namespace": "namespace",
+		"appName":   "deployment or statefulset name",
+		"appType":   "deployment, statefulset or tapp, default statefulset",
+	}
+}
+
+func (a *App) keyObj() (*util.KeyObj, error) {
+	if a.Namespace == "" || a.AppName == "" {
+		return nil, fmt.Errorf("namespace or appName is empty")
+	}
+	appTypePrefix := util.StatefulsetPrefixKey
+	if a.AppType != "" {
+		appTypePrefix = util.GetAppTypePrefix(a.AppType)
+	}
+	return util.NewKeyObj(appTypePrefix, a.Namespace, a.AppName, "", ""), nil
+}
+
+// TransferRequest is the request of transferring ips between workloads
+type TransferRequest struct {
+	From App `json:"from"`
+	To   App `json:"to"`
+}
+
+// SwaggerDoc generates swagger doc for transfer request
+func (TransferRequest) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"from": "the source workload whose ips are moved",
+		"to":   "the target workload which must not have any reserved ip",
+	}
+}
+
+// TransferResp is the response of transferring ips between workloads
+type TransferResp struct {
+	httputil.Resp
+	Transferred []FloatingIP `json:"transferred,omitempty"`
+}
+
+// SwaggerDoc generates swagger doc for transfer response
+func (TransferResp) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"transferred": "transferred ips and their new owners",
+	}
+}
+
+// Transfer moves all ips of a workload to another workload
+func (c *TransferController) Transfer(req *restful.Request, resp *restful.Response) {
+	var transfer TransferRequest
+	if err := req.ReadEntity(&transfer); err != nil {
+		httputil.BadRequest(resp, err)
+		return
+	}
+	from, err := transfer.From.keyObj()
+	if err != nil {
+		httputil.BadRequest(resp, fmt.Errorf("from: %v", err))
+		return
+	}
+	to, err := transfer.To.keyObj()
+	if err != nil {
+		httputil.BadRequest(resp, fmt.Errorf("to: %v", err))
+		return
+	}
+	transferred, err := c.TransferFunc(from, to)
+	if err != nil {
+		httputil.InternalError(resp, err)
+		return
+	}
+	ret := TransferResp{Resp: httputil.NewResp(http.StatusOK, "")}
+	for ip, key := range transferred {
+		keyObj := util.ParseKey(key)
+		ret.Transferred = append(ret.Transferred, FloatingIP{IP: ip, Namespace: keyObj.Namespace,
+			AppName: keyObj.AppName, PodName: keyObj.PodName, AppType: util.GetAppType(keyObj.AppTypePrefix)})
+		if c.Recorder != nil {
+			c.Recorder.Eventf(&corev1.ObjectReference{Kind: constant.ResourceKind, APIVersion: constant.ApiVersion,
+				Name: ip}, corev1.EventTypeNormal, "Transferred", "ip %s transferred from %s to %s", ip,
+				from.PoolPrefix(), key)
+		}
+	}
+	sort.Slice(ret.Transferred, func(i, j int) bool {
+		return ret.Transferred[i].IP < ret.Transferred[j].IP
+	})
+	resp.WriteEntity(ret) // nolint: errcheck
+}
@@ -0,0 +1,328 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"k8s.io/client-go/tools/cache"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+	"tkestack.io/galaxy/pkg/utils/httputil"
+)
+
+// Types of watch events
+const (
+	EventAllocate = "allocate"
+	EventReserve  = "reserve"
+	EventRelease  = "release"
+	EventUpdate   = "update"
+
+	// the max number of recent events kept for watchers to resume from
+	maxHistoryEvents = 1000
+	// the max number of pending events of a watcher before it is closed
+	watcherBufferSize = 100
+)
+
+// WatchEvent is a change of a floating ip
+type WatchEvent struct {
+	Type            string     `json:"type"`
+	ResourceVersion string     `json:"resourceVersion"`
+	IP              FloatingIP `json:"ip"`
+	NodeName        string     `json:"nodeName,omitempty"`
+	PodUid          string     `json:"podUid,omitempty"`
+}
+
+// SwaggerDoc is to generate Swagger docs
+func (WatchEvent) SwaggerDoc() map[string]string {
+	return map[string]string{
+		"type":            "allocate, reserve, release or update",
+		"resourceVersion": "version of the event on the replica serving the watch, which can be used to resume watching",
+		"nodeName":        "node name of the pod the ip allocated to",
+		"podUid":          "uid of the pod the ip allocated to",
+	}
+}
+
+// Watcher converts floatingip informer events to watch events and streams them to API clients. Events are versioned
+// by a sequence number of the watcher, prefixed with the start time of the watcher, since resource versions of
+// floatingip objects don't order release events and the history is only kept in memory of each replica.
+type Watcher struct {
+	lock  sync.Mutex
+	epoch int64
+	// sequence number of the last event
+	seq uint64
+	// recent events, oldest first
+	history []WatchEvent
+	// allocated ips as of the last event, used to list ips consistent with the version of the last event
+	ips         map[string]watchedIP
+	subscribers map[chan WatchEvent]struct{}
+}
+
+type watchedIP struct {
+	key string
+	ip  FloatingIP
+}
+
+// NewWatcher creates a Watcher which should be added as an event handler of floatingip informer
+func NewWatcher() *Watcher {
+	return &Watcher{
+		epoch:       time.Now().UnixNano(),
+		ips:         map[string]watchedIP{},
+		subscribers: map[chan WatchEvent]struct{}{},
+	}
+}
+
+// OnAdd implements cache.ResourceEventHandler
+func (w *Watcher) OnAdd(obj interface{}) {
+	if fip, ok := obj.(*v1alpha1.FloatingIP); ok {
+		w.emit(newWatchEvent(EventAllocate, fip), fip.Spec.Key)
+	}
+}
+
+// OnUpdate implements cache.ResourceEventHandler
+func (w *Watcher) OnUpdate(oldObj, newObj interface{}) {
+	oldFip, ok1 := oldObj.(*v1alpha1.FloatingIP)
+	newFip, ok2 := newObj.(*v1alpha1.FloatingIP)
+	if !ok1 || !ok2 || oldFip.ResourceVersion == newFip.ResourceVersion {
+		// ignore periodic resync
+		return
+	}
+	oldEvent, event := newWatchEvent(EventUpdate, oldFip), newWatchEvent(EventUpdate, newFip)
+	if oldFip.Spec.Key != newFip.Spec.Key {
+		if event.IP.PodName == "" {
+			// reserved for a deployment or pool
+			event.Type = EventReserve
+		} else {
+			event.Type = EventAllocate
+		}
+	} else if oldEvent.PodUid != "" && event.PodUid == "" {
+		// reserved for a pod of the same name
+		event.Type = EventReserve
+	}
+	w.emit(event, newFip.Spec.Key)
+}
+
+// OnDelete implements cache.ResourceEventHandler
+func (w *Watcher) OnDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	if fip, ok := obj.(*v1alpha1.FloatingIP); ok {
+		w.emit(newWatchEvent(EventRelease, fip), "")
+	}
+}
+
+func newWatchEvent(eventType string, fip *v1alpha1.FloatingIP) WatchEvent {
+	var attr floatingip.Attr
+	if fip.Spec.Attribute != "" {
+		if err := json.Unmarshal([]byte(fip.Spec.Attribute), &attr); err != nil {
+			glog.Warningf("invalid attribute of floatingip %s: %v", fip.Name, err)
+		}
+	}
+	keyObj := util.ParseKey(fip.Spec.Key)
+	return WatchEvent{
+		Type: eventType,
+		IP: FloatingIP{
+			IP:         fip.Name,
+			Namespace:  keyObj.Namespace,
+			AppName:    keyObj.AppName,
+			PodName:    keyObj.PodName,
+			PoolName:   keyObj.PoolName,
+			AppType:    util.GetAppType(keyObj.AppTypePrefix),
+			Policy:     uint16(fip.Spec.Policy),
+			UpdateTime: fip.Spec.UpdateTime.Time,
+			NodeName:   attr.NodeName,
+			PodUid:     attr.Uid,
+			Static:     attr.Static,
+			labels:     fip.Labels,
+		},
+		NodeName: attr.NodeName,
+		PodUid:   attr.Uid,
+	}
+}
+
+func (w *Watcher) emit(event WatchEvent, key string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.seq++
+	event.ResourceVersion = w.version(w.seq)
+	if event.Type == EventRelease {
+		delete(w.ips, event.IP.IP)
+	} else {
+		w.ips[event.IP.IP] = watchedIP{key: key, ip: event.IP}
+	}
+	w.history = append(w.history, event)
+	if len(w.history) > maxHistoryEvents {
+		w.history = append([]WatchEvent(nil), w.history[len(w.history)-maxHistoryEvents:]...)
+	}
+	for ch := range w.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// close slow watchers, they can resume from the last received resource version
+			glog.Warningf("closing a slow watcher")
+			delete(w.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (w *Watcher) version(seq uint64) string {
+	return fmt.Sprintf("%d-%d", w.epoch, seq)
+}
+
+// list returns allocated ips whose ip and key match and the resource version they are consistent with
+func (w *Watcher) list(match func(ip, key string) bool) ([]FloatingIP, string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var result []FloatingIP
+	for ip, v := range w.ips {
+		if match(ip, v.key) {
+			result = append(result, v.ip)
+		}
+	}
+	return result, w.version(w.seq)
+}
+
+// listIPs lists allocated ips the same as the package level listIPs but from the ips of the watcher, since unallocated
+// ips never match a key of an app or pool
+func (w *Watcher) listIPs(keyword string, fuzzyQuery bool) ([]FloatingIP, string) {
+	return w.list(func(_, key string) bool {
+		if fuzzyQuery {
+			return strings.Contains(key, keyword)
+		}
+		return strings.HasPrefix(key, keyword)
+	})
+}
+
+// listIPsByIP returns the ip from the ips of the watcher, or from ipam if it is unallocated
+func (w *Watcher) listIPsByIP(ip net.IP, ipam floatingip.IPAM) ([]FloatingIP, string, error) {
+	ipStr := ip.String()
+	fips, resourceVersion := w.list(func(fip, _ string) bool {
+		return fip == ipStr
+	})
+	if len(fips) > 0 {
+		return fips, resourceVersion, nil
+	}
+	fip, err := ipam.ByIP(ip)
+	if err != nil || fip.IP == nil {
+		return nil, resourceVersion, err
+	}
+	// the ip may be allocated in ipam before the watcher receives its event
+	return []FloatingIP{{IP: ipStr, Policy: fip.Policy}}, resourceVersion, nil
+}
+
+// subscribe returns a channel of new events and history events after the given resource version. It returns an
+// error if the resource version is not in the history of this watcher, e.g. it is too old or from another replica.
+func (w *Watcher) subscribe(resourceVersion string) (chan WatchEvent, []WatchEvent, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var history []WatchEvent
+	if resourceVersion != "" {
+		seq, err := w.parseVersion(resourceVersion)
+		if err != nil {
+			return nil, nil, err
+		}
+		// sequence number of the event before the oldest event of history
+		first := w.seq - uint64(len(w.history))
+		if seq < first || seq > w.seq {
+			return nil, nil, fmt.Errorf("too old resource version %s, please list ips and watch again",
+				resourceVersion)
+		}
+		history = append(history, w.history[seq-first:]...)
+	}
+	ch := make(chan WatchEvent, watcherBufferSize)
+	w.subscribers[ch] = struct{}{}
+	return ch, history, nil
+}
+
+func (w *Watcher) parseVersion(resourceVersion string) (uint64, error) {
+	parts := strings.Split(resourceVersion, "-")
+	if len(parts) == 2 && parts[0] == strconv.FormatInt(w.epoch, 10) {
+		if seq, err := strconv.ParseUint(parts[1], 10, 64); err == nil {
+			return seq, nil
+		}
+	}
+	return 0, fmt.Errorf("resource version %s is not from this server, please list ips and watch again",
+		resourceVersion)
+}
+
+func (w *Watcher) unsubscribe(ch chan WatchEvent) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if _, ok := w.subscribers[ch]; ok {
+		delete(w.subscribers, ch)
+		close(ch)
+	}
+}
+
+// Watch streams watch events as chunked json, one event per line
+func (w *Watcher) Watch(req *restful.Request, resp *restful.Response) {
+	namespace := req.QueryParameter("namespace")
+	ch, history, err := w.subscribe(req.QueryParameter("resourceVersion"))
+	if err != nil {
+		resp.WriteHeaderAndEntity(http.StatusGone, httputil.NewResp(http.StatusGone, err.Error())) // nolint: errcheck
+		return
+	}
+	defer w.unsubscribe(ch)
+	flusher, _ := resp.ResponseWriter.(http.Flusher)
+	resp.Header().Set("Content-Type", restful.MIME_JSON)
+	resp.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(resp)
+	send := func(event *WatchEvent) bool {
+		if namespace != "" && event.IP.Namespace != namespace {
+			return true
+		}
+		if err := encoder.Encode(event); err != nil {
+			glog.V(3).Infof("failed to send watch event: %v", err)
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+	for i := range history {
+		if !send(&history[i]) {
+			return
+		}
+	}
+	if flusher != nil {
+		// send header to clients even if there are no events
+		flusher.Flush()
+	}
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok || !send(&event) {
+				return
+			}
+		case <-req.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+)
+
+func createFipCrd(ip, key, rv, attr string) *v1alpha1.FloatingIP {
+	return &v1alpha1.FloatingIP{ObjectMeta: metav1.ObjectMeta{Name: ip, ResourceVersion: rv},
+		Spec: v1alpha1.FloatingIPSpec{Key: key, Attribute: attr}}
+}
+
+// #lizard forgives
+func TestWatcher(t *testing.T) {
+	w := NewWatcher()
+	bound := createFipCrd("10.0.0.2", "sts_ns1_sts_sts-0", "1", `{"NodeName":"node1","Uid":"uid1"}`)
+	reserved := createFipCrd("10.0.0.2", "sts_ns1_sts_sts-0", "2", `{"NodeName":"","Uid":""}`)
+	w.OnAdd(bound)
+	w.OnUpdate(bound, bound) // resync
+	w.OnUpdate(bound, reserved)
+	w.OnAdd(createFipCrd("10.0.0.3", "sts_ns2_sts_sts-0", "3", ""))
+	w.OnDelete(reserved)
+	var types []string
+	for _, event := range w.history {
+		types = append(types, event.Type+"/"+seqOf(event.ResourceVersion))
+	}
+	if expect := "[allocate/1 reserve/2 allocate/3 release/4]"; expect != fmt.Sprint(types) {
+		t.Fatalf("expect events %s, got %s", expect, fmt.Sprint(types))
+	}
+	if w.history[0].NodeName != "node1" || w.history[0].PodUid != "uid1" || w.history[0].IP.PodName != "sts-0" {
+		t.Fatalf("unexpected event %+v", w.history[0])
+	}
+
+	ws := new(restful.WebService)
+	ws.Route(ws.GET("/ip/watch").To(w.Watch).Produces(restful.MIME_JSON))
+	container := restful.NewContainer()
+	container.Add(ws)
+	server := httptest.NewServer(container)
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/ip/watch?resourceVersion=" + w.version(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	w.OnAdd(createFipCrd("10.0.0.4", "sts_ns1_sts_sts-1", "4", ""))
+	reader := bufio.NewReader(resp.Body)
+	// events after resource version 2
+	for _, expect := range []string{"allocate/3", "release/4", "allocate/5"} {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		var event WatchEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			t.Fatal(err)
+		}
+		if got := event.Type + "/" + seqOf(event.ResourceVersion); got != expect {
+			t.Fatalf("expect event %s, got %s", expect, got)
+		}
+	}
+	// resuming from resource versions of another replica or unknown ones gets 410
+	for _, rv := range []string{"100", fmt.Sprintf("%d-2", w.epoch+1), w.version(6)} {
+		resp2, err := http.Get(server.URL + "/ip/watch?resourceVersion=" + rv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp2.Body.Close() // nolint: errcheck
+		if resp2.StatusCode != http.StatusGone {
+			t.Fatalf("expect code 410 for resource version %s, got %d", rv, resp2.StatusCode)
+		}
+	}
+}
+
+func seqOf(resourceVersion string) string {
+	return resourceVersion[strings.Index(resourceVersion, "-")+1:]
+}
+
+func TestWatcherListIPs(t *testing.T) {
+	w := NewWatcher()
+	bound := createFipCrd("10.0.0.2", "sts_ns1_sts_sts-0", "1", `{"NodeName":"node1","Uid":"uid1"}`)
+	w.OnAdd(bound)
+	w.OnAdd(createFipCrd("10.0.0.3", "sts_ns2_sts_sts-0", "2", ""))
+	w.OnDelete(bound)
+	w.OnAdd(createFipCrd("10.0.0.4", "sts_ns1_sts_sts-1", "3", `{"NodeName":"node2","Uid":"uid2"}`))
+	fips, rv := w.listIPs("sts_ns1_", false)
+	if len(fips) != 1 || fips[0].IP != "10.0.0.4" || fips[0].NodeName != "node2" {
+		t.Fatalf("unexpected ips %+v", fips)
+	}
+	if rv != w.version(4) {
+		t.Fatalf("expect resource version %s, got %s", w.version(4), rv)
+	}
+	if fips, _ := w.listIPs("ns2", true); len(fips) != 1 || fips[0].IP != "10.0.0.3" {
+		t.Fatalf("unexpected ips %+v", fips)
+	}
+	// watching from the version of the list gets events after the list only
+	ch, history, err := w.subscribe(rv)
+	if err != nil || len(history) != 0 {
+		t.Fatalf("expect no history events, got %v, err %v", history, err)
+	}
+	defer w.unsubscribe(ch)
+	w.OnDelete(createFipCrd("10.0.0.4", "sts_ns1_sts_sts-1", "3", ""))
+	if event := <-ch; event.Type != EventRelease || event.ResourceVersion != w.version(5) {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
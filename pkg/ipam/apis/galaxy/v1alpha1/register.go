@@ -67,6 +67,8 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 		&FloatingIPList{},
 		&Pool{},
 		&PoolList{},
+		&CloudProviderOperation{},
+		&CloudProviderOperationList{},
 	)
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
 	return nil
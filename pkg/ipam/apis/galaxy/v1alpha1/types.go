@@ -96,3 +96,48 @@ type PoolList struct {
 
 	Items []Pool `json:"items"`
 }
+
+// +genclient
+// +genclient:noStatus
+// +genclient:nonNamespaced
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CloudProviderOperation is a pending cloud provider request which failed and is being retried. It is named by the ip,
+// so requests for the same ip are merged into one operation.
+type CloudProviderOperation struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CloudProviderOperationSpec   `json:"spec"`
+	Status CloudProviderOperationStatus `json:"status,omitempty"`
+}
+
+// CloudProviderOperationSpec is spec of CloudProviderOperation.
+type CloudProviderOperationSpec struct {
+	// UnAssignNodes are nodes the ip should be unassigned from
+	UnAssignNodes []string `json:"unassignNodes,omitempty"`
+	// AssignNode is the node the ip should be assigned to after unassigning, empty if it shouldn't be assigned
+	AssignNode string `json:"assignNode,omitempty"`
+}
+
+// CloudProviderOperationStatus is status of CloudProviderOperation.
+type CloudProviderOperationStatus struct {
+	// Attempts is the number of failed attempts
+	Attempts int `json:"attempts"`
+	// LastError is the error of the last attempt
+	LastError string `json:"lastError,omitempty"`
+	// LastAttemptTime is the time of the last attempt
+	LastAttemptTime metav1.Time `json:"lastAttemptTime,omitempty"`
+	// DeadLetter is true if the operation is not retried any more after too many failed attempts
+	DeadLetter bool `json:"deadLetter,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// CloudProviderOperationList is list of CloudProviderOperation.
+type CloudProviderOperationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []CloudProviderOperation `json:"items"`
+}
@@ -24,6 +24,105 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudProviderOperation) DeepCopyInto(out *CloudProviderOperation) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudProviderOperation.
+func (in *CloudProviderOperation) DeepCopy() *CloudProviderOperation {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudProviderOperation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CloudProviderOperation) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudProviderOperationList) DeepCopyInto(out *CloudProviderOperationList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CloudProviderOperation, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudProviderOperationList.
+func (in *CloudProviderOperationList) DeepCopy() *CloudProviderOperationList {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudProviderOperationList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CloudProviderOperationList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudProviderOperationSpec) DeepCopyInto(out *CloudProviderOperationSpec) {
+	*out = *in
+	if in.UnAssignNodes != nil {
+		in, out := &in.UnAssignNodes, &out.UnAssignNodes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudProviderOperationSpec.
+func (in *CloudProviderOperationSpec) DeepCopy() *CloudProviderOperationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudProviderOperationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloudProviderOperationStatus) DeepCopyInto(out *CloudProviderOperationStatus) {
+	*out = *in
+	in.LastAttemptTime.DeepCopyInto(&out.LastAttemptTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloudProviderOperationStatus.
+func (in *CloudProviderOperationStatus) DeepCopy() *CloudProviderOperationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudProviderOperationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FloatingIP) DeepCopyInto(out *FloatingIP) {
 	*out = *in
@@ -0,0 +1,164 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+	v1alpha1 "tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	scheme "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned/scheme"
+)
+
+// CloudProviderOperationsGetter has a method to return a CloudProviderOperationInterface.
+// A group's client should implement this interface.
+type CloudProviderOperationsGetter interface {
+	CloudProviderOperations() CloudProviderOperationInterface
+}
+
+// CloudProviderOperationInterface has methods to work with CloudProviderOperation resources.
+type CloudProviderOperationInterface interface {
+	Create(*v1alpha1.CloudProviderOperation) (*v1alpha1.CloudProviderOperation, error)
+	Update(*v1alpha1.CloudProviderOperation) (*v1alpha1.CloudProviderOperation, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1alpha1.CloudProviderOperation, error)
+	List(opts v1.ListOptions) (*v1alpha1.CloudProviderOperationList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.CloudProviderOperation, err error)
+	CloudProviderOperationExpansion
+}
+
+// cloudProviderOperations implements CloudProviderOperationInterface
+type cloudProviderOperations struct {
+	client rest.Interface
+}
+
+// newCloudProviderOperations returns a CloudProviderOperations
+func newCloudProviderOperations(c *GalaxyV1alpha1Client) *cloudProviderOperations {
+	return &cloudProviderOperations{
+		client: c.RESTClient(),
+	}
+}
+
+// Get takes name of the cloudProviderOperation, and returns the corresponding cloudProviderOperation object, and an error if there is any.
+func (c *cloudProviderOperations) Get(name string, options v1.GetOptions) (result *v1alpha1.CloudProviderOperation, err error) {
+	result = &v1alpha1.CloudProviderOperation{}
+	err = c.client.Get().
+		Resource("cloudprovideroperations").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of CloudProviderOperations that match those selectors.
+func (c *cloudProviderOperations) List(opts v1.ListOptions) (result *v1alpha1.CloudProviderOperationList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.CloudProviderOperationList{}
+	err = c.client.Get().
+		Resource("cloudprovideroperations").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested cloudProviderOperations.
+func (c *cloudProviderOperations) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Resource("cloudprovideroperations").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch()
+}
+
+// Create takes the representation of a cloudProviderOperation and creates it.  Returns the server's representation of the cloudProviderOperation, and an error, if there is any.
+func (c *cloudProviderOperations) Create(cloudProviderOperation *v1alpha1.CloudProviderOperation) (result *v1alpha1.CloudProviderOperation, err error) {
+	result = &v1alpha1.CloudProviderOperation{}
+	err = c.client.Post().
+		Resource("cloudprovideroperations").
+		Body(cloudProviderOperation).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a cloudProviderOperation and updates it. Returns the server's representation of the cloudProviderOperation, and an error, if there is any.
+func (c *cloudProviderOperations) Update(cloudProviderOperation *v1alpha1.CloudProviderOperation) (result *v1alpha1.CloudProviderOperation, err error) {
+	result = &v1alpha1.CloudProviderOperation{}
+	err = c.client.Put().
+		Resource("cloudprovideroperations").
+		Name(cloudProviderOperation.Name).
+		Body(cloudProviderOperation).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the cloudProviderOperation and deletes it. Returns an error if one occurs.
+func (c *cloudProviderOperations) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Resource("cloudprovideroperations").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *cloudProviderOperations) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	var timeout time.Duration
+	if listOptions.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOptions.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Resource("cloudprovideroperations").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched cloudProviderOperation.
+func (c *cloudProviderOperations) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.CloudProviderOperation, err error) {
+	result = &v1alpha1.CloudProviderOperation{}
+	err = c.client.Patch(pt).
+		Resource("cloudprovideroperations").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
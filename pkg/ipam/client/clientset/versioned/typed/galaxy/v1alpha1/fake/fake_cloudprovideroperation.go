@@ -0,0 +1,120 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+	v1alpha1 "tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+)
+
+// FakeCloudProviderOperations implements CloudProviderOperationInterface
+type FakeCloudProviderOperations struct {
+	Fake *FakeGalaxyV1alpha1
+}
+
+var cloudprovideroperationsResource = schema.GroupVersionResource{Group: "galaxy.k8s.io", Version: "v1alpha1", Resource: "cloudprovideroperations"}
+
+var cloudprovideroperationsKind = schema.GroupVersionKind{Group: "galaxy.k8s.io", Version: "v1alpha1", Kind: "CloudProviderOperation"}
+
+// Get takes name of the cloudProviderOperation, and returns the corresponding cloudProviderOperation object, and an error if there is any.
+func (c *FakeCloudProviderOperations) Get(name string, options v1.GetOptions) (result *v1alpha1.CloudProviderOperation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(cloudprovideroperationsResource, name), &v1alpha1.CloudProviderOperation{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CloudProviderOperation), err
+}
+
+// List takes label and field selectors, and returns the list of CloudProviderOperations that match those selectors.
+func (c *FakeCloudProviderOperations) List(opts v1.ListOptions) (result *v1alpha1.CloudProviderOperationList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(cloudprovideroperationsResource, cloudprovideroperationsKind, opts), &v1alpha1.CloudProviderOperationList{})
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.CloudProviderOperationList{ListMeta: obj.(*v1alpha1.CloudProviderOperationList).ListMeta}
+	for _, item := range obj.(*v1alpha1.CloudProviderOperationList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested cloudProviderOperations.
+func (c *FakeCloudProviderOperations) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(cloudprovideroperationsResource, opts))
+}
+
+// Create takes the representation of a cloudProviderOperation and creates it.  Returns the server's representation of the cloudProviderOperation, and an error, if there is any.
+func (c *FakeCloudProviderOperations) Create(cloudProviderOperation *v1alpha1.CloudProviderOperation) (result *v1alpha1.CloudProviderOperation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(cloudprovideroperationsResource, cloudProviderOperation), &v1alpha1.CloudProviderOperation{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CloudProviderOperation), err
+}
+
+// Update takes the representation of a cloudProviderOperation and updates it. Returns the server's representation of the cloudProviderOperation, and an error, if there is any.
+func (c *FakeCloudProviderOperations) Update(cloudProviderOperation *v1alpha1.CloudProviderOperation) (result *v1alpha1.CloudProviderOperation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(cloudprovideroperationsResource, cloudProviderOperation), &v1alpha1.CloudProviderOperation{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CloudProviderOperation), err
+}
+
+// Delete takes name of the cloudProviderOperation and deletes it. Returns an error if one occurs.
+func (c *FakeCloudProviderOperations) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteAction(cloudprovideroperationsResource, name), &v1alpha1.CloudProviderOperation{})
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeCloudProviderOperations) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(cloudprovideroperationsResource, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.CloudProviderOperationList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched cloudProviderOperation.
+func (c *FakeCloudProviderOperations) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.CloudProviderOperation, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(cloudprovideroperationsResource, name, pt, data, subresources...), &v1alpha1.CloudProviderOperation{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.CloudProviderOperation), err
+}
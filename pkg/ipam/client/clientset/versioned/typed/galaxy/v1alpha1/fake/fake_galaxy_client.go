@@ -28,6 +28,10 @@ type FakeGalaxyV1alpha1 struct {
 	*testing.Fake
 }
 
+func (c *FakeGalaxyV1alpha1) CloudProviderOperations() v1alpha1.CloudProviderOperationInterface {
+	return &FakeCloudProviderOperations{c}
+}
+
 func (c *FakeGalaxyV1alpha1) FloatingIPs() v1alpha1.FloatingIPInterface {
 	return &FakeFloatingIPs{c}
 }
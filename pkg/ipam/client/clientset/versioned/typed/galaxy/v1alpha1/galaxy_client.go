@@ -26,6 +26,7 @@ import (
 
 type GalaxyV1alpha1Interface interface {
 	RESTClient() rest.Interface
+	CloudProviderOperationsGetter
 	FloatingIPsGetter
 	PoolsGetter
 }
@@ -35,6 +36,10 @@ type GalaxyV1alpha1Client struct {
 	restClient rest.Interface
 }
 
+func (c *GalaxyV1alpha1Client) CloudProviderOperations() CloudProviderOperationInterface {
+	return newCloudProviderOperations(c)
+}
+
 func (c *GalaxyV1alpha1Client) FloatingIPs() FloatingIPInterface {
 	return newFloatingIPs(c)
 }
@@ -18,6 +18,8 @@ limitations under the License.
 
 package v1alpha1
 
+type CloudProviderOperationExpansion interface{}
+
 type FloatingIPExpansion interface{}
 
 type PoolExpansion interface{}
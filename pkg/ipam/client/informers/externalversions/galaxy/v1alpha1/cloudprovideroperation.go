@@ -0,0 +1,88 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by informer-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	time "time"
+
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	watch "k8s.io/apimachinery/pkg/watch"
+	cache "k8s.io/client-go/tools/cache"
+	galaxyv1alpha1 "tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	versioned "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned"
+	internalinterfaces "tkestack.io/galaxy/pkg/ipam/client/informers/externalversions/internalinterfaces"
+	v1alpha1 "tkestack.io/galaxy/pkg/ipam/client/listers/galaxy/v1alpha1"
+)
+
+// CloudProviderOperationInformer provides access to a shared informer and lister for
+// CloudProviderOperations.
+type CloudProviderOperationInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() v1alpha1.CloudProviderOperationLister
+}
+
+type cloudProviderOperationInformer struct {
+	factory          internalinterfaces.SharedInformerFactory
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+}
+
+// NewCloudProviderOperationInformer constructs a new informer for CloudProviderOperation type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewCloudProviderOperationInformer(client versioned.Interface, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return NewFilteredCloudProviderOperationInformer(client, resyncPeriod, indexers, nil)
+}
+
+// NewFilteredCloudProviderOperationInformer constructs a new informer for CloudProviderOperation type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewFilteredCloudProviderOperationInformer(client versioned.Interface, resyncPeriod time.Duration, indexers cache.Indexers, tweakListOptions internalinterfaces.TweakListOptionsFunc) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.GalaxyV1alpha1().CloudProviderOperations().List(options)
+			},
+			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.GalaxyV1alpha1().CloudProviderOperations().Watch(options)
+			},
+		},
+		&galaxyv1alpha1.CloudProviderOperation{},
+		resyncPeriod,
+		indexers,
+	)
+}
+
+func (f *cloudProviderOperationInformer) defaultInformer(client versioned.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return NewFilteredCloudProviderOperationInformer(client, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, f.tweakListOptions)
+}
+
+func (f *cloudProviderOperationInformer) Informer() cache.SharedIndexInformer {
+	return f.factory.InformerFor(&galaxyv1alpha1.CloudProviderOperation{}, f.defaultInformer)
+}
+
+func (f *cloudProviderOperationInformer) Lister() v1alpha1.CloudProviderOperationLister {
+	return v1alpha1.NewCloudProviderOperationLister(f.Informer().GetIndexer())
+}
@@ -24,6 +24,8 @@ import (
 
 // Interface provides access to all the informers in this group version.
 type Interface interface {
+	// CloudProviderOperations returns a CloudProviderOperationInformer.
+	CloudProviderOperations() CloudProviderOperationInformer
 	// FloatingIPs returns a FloatingIPInformer.
 	FloatingIPs() FloatingIPInformer
 	// Pools returns a PoolInformer.
@@ -41,6 +43,11 @@ func New(f internalinterfaces.SharedInformerFactory, namespace string, tweakList
 	return &version{factory: f, namespace: namespace, tweakListOptions: tweakListOptions}
 }
 
+// CloudProviderOperations returns a CloudProviderOperationInformer.
+func (v *version) CloudProviderOperations() CloudProviderOperationInformer {
+	return &cloudProviderOperationInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
+}
+
 // FloatingIPs returns a FloatingIPInformer.
 func (v *version) FloatingIPs() FloatingIPInformer {
 	return &floatingIPInformer{factory: v.factory, tweakListOptions: v.tweakListOptions}
@@ -53,6 +53,8 @@ func (f *genericInformer) Lister() cache.GenericLister {
 func (f *sharedInformerFactory) ForResource(resource schema.GroupVersionResource) (GenericInformer, error) {
 	switch resource {
 	// Group=galaxy.k8s.io, Version=v1alpha1
+	case v1alpha1.SchemeGroupVersion.WithResource("cloudprovideroperations"):
+		return &genericInformer{resource: resource.GroupResource(), informer: f.Galaxy().V1alpha1().CloudProviderOperations().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("floatingips"):
 		return &genericInformer{resource: resource.GroupResource(), informer: f.Galaxy().V1alpha1().FloatingIPs().Informer()}, nil
 	case v1alpha1.SchemeGroupVersion.WithResource("pools"):
@@ -0,0 +1,65 @@
+/*
+Copyright The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	v1alpha1 "tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+)
+
+// CloudProviderOperationLister helps list CloudProviderOperations.
+type CloudProviderOperationLister interface {
+	// List lists all CloudProviderOperations in the indexer.
+	List(selector labels.Selector) (ret []*v1alpha1.CloudProviderOperation, err error)
+	// Get retrieves the CloudProviderOperation from the index for a given name.
+	Get(name string) (*v1alpha1.CloudProviderOperation, error)
+	CloudProviderOperationListerExpansion
+}
+
+// cloudProviderOperationLister implements the CloudProviderOperationLister interface.
+type cloudProviderOperationLister struct {
+	indexer cache.Indexer
+}
+
+// NewCloudProviderOperationLister returns a new CloudProviderOperationLister.
+func NewCloudProviderOperationLister(indexer cache.Indexer) CloudProviderOperationLister {
+	return &cloudProviderOperationLister{indexer: indexer}
+}
+
+// List lists all CloudProviderOperations in the indexer.
+func (s *cloudProviderOperationLister) List(selector labels.Selector) (ret []*v1alpha1.CloudProviderOperation, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.CloudProviderOperation))
+	})
+	return ret, err
+}
+
+// Get retrieves the CloudProviderOperation from the index for a given name.
+func (s *cloudProviderOperationLister) Get(name string) (*v1alpha1.CloudProviderOperation, error) {
+	obj, exists, err := s.indexer.GetByKey(name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1alpha1.Resource("cloudprovideroperation"), name)
+	}
+	return obj.(*v1alpha1.CloudProviderOperation), nil
+}
@@ -18,6 +18,10 @@ limitations under the License.
 
 package v1alpha1
 
+// CloudProviderOperationListerExpansion allows custom methods to be added to
+// CloudProviderOperationLister.
+type CloudProviderOperationListerExpansion interface{}
+
 // FloatingIPListerExpansion allows custom methods to be added to
 // FloatingIPLister.
 type FloatingIPListerExpansion interface{}
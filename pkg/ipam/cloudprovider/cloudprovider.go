@@ -18,17 +18,35 @@ package cloudprovider
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 	glog "k8s.io/klog"
 	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
 )
 
+// IPProviderServiceV2 is the service name cloud providers report health status for if they implement
+// rpc.IPProviderServiceV2
+const IPProviderServiceV2 = "rpc.IPProviderServiceV2"
+
+// ErrNotSupported is returned if the cloud provider doesn't support the operation
+var ErrNotSupported = errors.New("operation not supported by cloud provider")
+
 var kacp = keepalive.ClientParameters{
 	Time:                2 * time.Minute, // send pings every 2 minutes if there is no activity
 	Timeout:             time.Minute,     // wait 1 minute for ping ack before considering the connection dead
@@ -39,44 +57,264 @@ var kacp = keepalive.ClientParameters{
 type CloudProvider interface {
 	AssignIP(in *rpc.AssignIPRequest) (*rpc.AssignIPReply, error)
 	UnAssignIP(in *rpc.UnAssignIPRequest) (*rpc.UnAssignIPReply, error)
+	// BatchAssignIP returns a reply for each request in the same order. The error is not nil only if the whole
+	// batch failed, callers should check Success of each reply.
+	BatchAssignIP(in *rpc.BatchAssignIPRequest) (*rpc.BatchAssignIPReply, error)
+	// BatchUnAssignIP returns a reply for each request in the same order. The error is not nil only if the whole
+	// batch failed, callers should check Success of each reply.
+	BatchUnAssignIP(in *rpc.BatchUnAssignIPRequest) (*rpc.BatchUnAssignIPReply, error)
+	// ListAssignedIPs lists ips assigned to the node or to all nodes if node name is empty. It returns
+	// ErrNotSupported if the cloud provider doesn't support it.
+	ListAssignedIPs(in *rpc.ListAssignedIPsRequest) (*rpc.ListAssignedIPsReply, error)
+}
+
+// ReadyChecker is implemented by cloud providers which connect to a remote server
+type ReadyChecker interface {
+	// Ready returns an error if the cloud provider is not usable
+	Ready() error
+}
+
+// TLSConfig is the tls config to connect to the cloud provider. Client certificate is optional.
+type TLSConfig struct {
+	CAFile     string `json:"caFile"`
+	CertFile   string `json:"certFile"`
+	KeyFile    string `json:"keyFile"`
+	ServerName string `json:"serverName"`
+}
+
+func (c *TLSConfig) load() (*tls.Config, error) {
+	config := &tls.Config{ServerName: c.ServerName}
+	if c.CAFile != "" {
+		data, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in %s", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// tokenCredentials sends the token read from the file as a bearer token of each request. The file is read every
+// time so that the token can be rotated.
+type tokenCredentials struct {
+	tokenFile  string
+	requireTLS bool
+}
+
+func (c *tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(c.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cloud provider token: %v", err)
+	}
+	return map[string]string{"authorization": "Bearer " + strings.TrimSpace(string(data))}, nil
+}
+
+func (c *tokenCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
 }
 
 type grpcCloudProvider struct {
-	init              sync.Once
 	cloudProviderAddr string
-	client            rpc.IPProviderServiceClient
-	timeout           time.Duration
+	tlsConfig         *TLSConfig
+	tokenFile         string
+
+	connLock sync.Mutex
+	conn     *grpc.ClientConn
+
+	client           rpc.IPProviderServiceClient
+	clientV2         rpc.IPProviderServiceV2Client
+	healthClient     healthpb.HealthClient
+	timeout          time.Duration
+	negotiateTimeout time.Duration
+
+	lock       sync.Mutex
+	negotiated bool // whether the protocol version of the cloud provider is known
+	v2         bool // whether the cloud provider serves IPProviderServiceV2
+	// negotiating is true while a call is checking the version, other calls use v1 meanwhile
+	negotiating bool
+	// backoff of retrying negotiation after a failed check, and the time to retry
+	negotiateBackoff time.Duration
+	nextNegotiate    time.Time
 }
 
-// NewGRPCCloudProvider creates a grpcCloudProvider
+const (
+	minNegotiateBackoff = time.Second
+	maxNegotiateBackoff = 5 * time.Minute
+)
+
+// NewGRPCCloudProvider creates a grpcCloudProvider which connects to the cloud provider insecurely
 func NewGRPCCloudProvider(cloudProviderAddr string) CloudProvider {
+	return NewGRPCCloudProviderWithAuth(cloudProviderAddr, nil, "")
+}
+
+// NewGRPCCloudProviderWithAuth creates a grpcCloudProvider which connects to the cloud provider with tls if
+// tlsConfig is not nil, and sends the token in tokenFile with each request if tokenFile is not empty
+func NewGRPCCloudProviderWithAuth(cloudProviderAddr string, tlsConfig *TLSConfig, tokenFile string) CloudProvider {
+	if tlsConfig == nil && tokenFile != "" {
+		glog.Warningf("cloud provider token is sent over insecure connection to %s", cloudProviderAddr)
+	}
 	return &grpcCloudProvider{
 		timeout:           time.Second * 60,
+		negotiateTimeout:  time.Second * 10,
 		cloudProviderAddr: cloudProviderAddr,
+		tlsConfig:         tlsConfig,
+		tokenFile:         tokenFile,
 	}
 }
 
-func (p *grpcCloudProvider) connect() {
-	p.init.Do(func() {
-		glog.V(3).Infof("dial cloud provider with address %s", p.cloudProviderAddr)
-		conn, err := grpc.Dial(p.cloudProviderAddr, grpc.WithDialer(
-			func(addr string, timeout time.Duration) (net.Conn, error) {
-				return net.DialTimeout("tcp", addr, timeout)
-			}), grpc.WithInsecure(), grpc.WithKeepaliveParams(kacp))
+// connect creates the connection on the first call. Dialing doesn't wait for the connection to be established,
+// grpc reconnects with backoff in background. If dialing fails, e.g. certificates are not mounted yet, it is
+// retried on the next call.
+func (p *grpcCloudProvider) connect() error {
+	p.connLock.Lock()
+	defer p.connLock.Unlock()
+	if p.conn != nil {
+		return nil
+	}
+	glog.V(3).Infof("dial cloud provider with address %s", p.cloudProviderAddr)
+	opts := []grpc.DialOption{grpc.WithDialer(
+		func(addr string, timeout time.Duration) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, timeout)
+		}), grpc.WithKeepaliveParams(kacp)}
+	if p.tlsConfig != nil {
+		config, err := p.tlsConfig.load()
 		if err != nil {
-			glog.Fatalf("failed to connect to cloud provider %s: %v", p.cloudProviderAddr, err)
+			return fmt.Errorf("failed to load tls config of cloud provider %s: %v", p.cloudProviderAddr, err)
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+	if p.tokenFile != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(&tokenCredentials{
+			tokenFile: p.tokenFile, requireTLS: p.tlsConfig != nil}))
+	}
+	conn, err := grpc.Dial(p.cloudProviderAddr, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to cloud provider %s: %v", p.cloudProviderAddr, err)
+	}
+	p.conn = conn
+	p.client = rpc.NewIPProviderServiceClient(conn)
+	p.clientV2 = rpc.NewIPProviderServiceV2Client(conn)
+	p.healthClient = healthpb.NewHealthClient(conn)
+	go watchConnectionState(conn)
+	return nil
+}
+
+var connectionStates = []connectivity.State{connectivity.Idle, connectivity.Connecting, connectivity.Ready,
+	connectivity.TransientFailure, connectivity.Shutdown}
+
+// watchConnectionState exports the connection state as metrics until the connection is closed
+func watchConnectionState(conn *grpc.ClientConn) {
+	for {
+		state := conn.GetState()
+		for _, s := range connectionStates {
+			var value float64
+			if s == state {
+				value = 1
+			}
+			metrics.CloudProviderConnectionState.WithLabelValues(s.String()).Set(value)
+		}
+		if state == connectivity.Shutdown || !conn.WaitForStateChange(context.Background(), state) {
+			return
 		}
-		p.client = rpc.NewIPProviderServiceClient(conn)
-	})
+	}
+}
+
+// Ready returns an error if the connection can't be created or is failing. An idle connection is considered
+// ready since it connects on demand.
+func (p *grpcCloudProvider) Ready() error {
+	if err := p.connect(); err != nil {
+		return err
+	}
+	switch state := p.conn.GetState(); state {
+	case connectivity.Idle, connectivity.Ready:
+		return nil
+	default:
+		return fmt.Errorf("connection to cloud provider %s is %s", p.cloudProviderAddr, state)
+	}
+}
+
+// supportV2 negotiates the protocol version via the standard grpc health check. Cloud providers which don't
+// implement the health service or don't know IPProviderServiceV2 are considered as v1 and are never checked
+// again. If the check fails for other reasons, v1 is used until the check is retried with exponential backoff.
+// The check is done without holding the lock, so that calls during the check use v1 instead of waiting for it.
+func (p *grpcCloudProvider) supportV2() (bool, error) {
+	if err := p.connect(); err != nil {
+		return false, err
+	}
+	p.lock.Lock()
+	if p.negotiated || p.negotiating || time.Now().Before(p.nextNegotiate) {
+		v2 := p.v2
+		p.lock.Unlock()
+		return v2, nil
+	}
+	p.negotiating = true
+	p.lock.Unlock()
+	negotiated, v2 := p.checkV2()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.negotiating = false
+	if negotiated {
+		p.negotiated, p.v2 = true, v2
+		return v2, nil
+	}
+	if p.negotiateBackoff < minNegotiateBackoff {
+		p.negotiateBackoff = minNegotiateBackoff
+	} else if p.negotiateBackoff *= 2; p.negotiateBackoff > maxNegotiateBackoff {
+		p.negotiateBackoff = maxNegotiateBackoff
+	}
+	p.nextNegotiate = time.Now().Add(p.negotiateBackoff)
+	return false, nil
+}
+
+// checkV2 runs the health check of IPProviderServiceV2, it returns whether the version is known and if it is v2
+func (p *grpcCloudProvider) checkV2() (negotiated bool, v2 bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.negotiateTimeout)
+	defer cancel()
+	resp, err := p.healthClient.Check(ctx, &healthpb.HealthCheckRequest{Service: IPProviderServiceV2})
+	if err != nil {
+		if code := status.Code(err); code == codes.Unimplemented || code == codes.NotFound {
+			glog.Infof("cloud provider %s doesn't support %s, fallback to v1 protocol: %v", p.cloudProviderAddr,
+				IPProviderServiceV2, err)
+			return true, false
+		}
+		glog.Warningf("failed to check health of cloud provider %s, will retry: %v", p.cloudProviderAddr, err)
+		return false, false
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		glog.Warningf("cloud provider %s reports %s status %s, will retry", p.cloudProviderAddr,
+			IPProviderServiceV2, resp.Status)
+		return false, false
+	}
+	glog.Infof("cloud provider %s supports %s", p.cloudProviderAddr, IPProviderServiceV2)
+	return true, true
 }
 
 func (p *grpcCloudProvider) AssignIP(in *rpc.AssignIPRequest) (reply *rpc.AssignIPReply, err error) {
-	p.connect()
+	v2, err := p.supportV2()
+	if err != nil {
+		return nil, fmt.Errorf("AssignIP for %v failed: %v", in, err)
+	}
 	glog.V(5).Infof("AssignIP %v", in)
 
 	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
 	defer cancel()
-	reply, err = p.client.AssignIP(ctx, in)
+	if v2 {
+		reply, err = p.clientV2.AssignIP(ctx, in)
+	} else {
+		reply, err = p.client.AssignIP(ctx, in)
+	}
 	glog.V(5).Infof("request %v, reply %v, err %v", in, reply, err)
 	if err != nil || reply == nil || !reply.Success {
 		err = fmt.Errorf("AssignIP for %v failed: reply %v, err %v", in, reply, err)
@@ -86,12 +324,19 @@ func (p *grpcCloudProvider) AssignIP(in *rpc.AssignIPRequest) (reply *rpc.Assign
 }
 
 func (p *grpcCloudProvider) UnAssignIP(in *rpc.UnAssignIPRequest) (reply *rpc.UnAssignIPReply, err error) {
-	p.connect()
+	v2, err := p.supportV2()
+	if err != nil {
+		return nil, fmt.Errorf("UnAssignIP for %v failed: %v", in, err)
+	}
 	glog.V(5).Infof("UnAssignIP %v", in)
 
 	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
 	defer cancel()
-	reply, err = p.client.UnAssignIP(ctx, in)
+	if v2 {
+		reply, err = p.clientV2.UnAssignIP(ctx, in)
+	} else {
+		reply, err = p.client.UnAssignIP(ctx, in)
+	}
 	glog.V(5).Infof("request %v, reply %v, err %v", in, reply, err)
 	if err != nil || reply == nil || !reply.Success {
 		err = fmt.Errorf("UnAssignIP for %v failed: reply %v, err %v", in, reply, err)
@@ -99,3 +344,101 @@ func (p *grpcCloudProvider) UnAssignIP(in *rpc.UnAssignIPRequest) (reply *rpc.Un
 	}
 	return
 }
+
+func (p *grpcCloudProvider) BatchAssignIP(in *rpc.BatchAssignIPRequest) (*rpc.BatchAssignIPReply, error) {
+	v2, err := p.supportV2()
+	if err != nil {
+		return nil, fmt.Errorf("BatchAssignIP failed: %v", err)
+	}
+	if !v2 {
+		return BatchAssignIPOneByOne(p.AssignIP, in)
+	}
+	glog.V(5).Infof("BatchAssignIP %v", in)
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	reply, err := p.clientV2.BatchAssignIP(ctx, in)
+	glog.V(5).Infof("request %v, reply %v, err %v", in, reply, err)
+	if err == nil && (reply == nil || len(reply.Replies) != len(in.Requests)) {
+		err = fmt.Errorf("expect %d replies, got reply %v", len(in.Requests), reply)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("BatchAssignIP failed: %v", err)
+	}
+	return reply, nil
+}
+
+func (p *grpcCloudProvider) BatchUnAssignIP(in *rpc.BatchUnAssignIPRequest) (*rpc.BatchUnAssignIPReply, error) {
+	v2, err := p.supportV2()
+	if err != nil {
+		return nil, fmt.Errorf("BatchUnAssignIP failed: %v", err)
+	}
+	if !v2 {
+		return BatchUnAssignIPOneByOne(p.UnAssignIP, in)
+	}
+	glog.V(5).Infof("BatchUnAssignIP %v", in)
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	reply, err := p.clientV2.BatchUnAssignIP(ctx, in)
+	glog.V(5).Infof("request %v, reply %v, err %v", in, reply, err)
+	if err == nil && (reply == nil || len(reply.Replies) != len(in.Requests)) {
+		err = fmt.Errorf("expect %d replies, got reply %v", len(in.Requests), reply)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("BatchUnAssignIP failed: %v", err)
+	}
+	return reply, nil
+}
+
+func (p *grpcCloudProvider) ListAssignedIPs(in *rpc.ListAssignedIPsRequest) (*rpc.ListAssignedIPsReply, error) {
+	v2, err := p.supportV2()
+	if err != nil {
+		return nil, fmt.Errorf("ListAssignedIPs for %v failed: %v", in, err)
+	}
+	if !v2 {
+		return nil, ErrNotSupported
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	reply, err := p.clientV2.ListAssignedIPs(ctx, in)
+	if err != nil {
+		return nil, fmt.Errorf("ListAssignedIPs for %v failed: %v", in, err)
+	}
+	glog.V(5).Infof("request %v, %d ips assigned", in, len(reply.Ips))
+	return reply, nil
+}
+
+// BatchAssignIPOneByOne implements BatchAssignIP by calling assign for each request. It is used for cloud providers
+// which don't support batch operations.
+func BatchAssignIPOneByOne(assign func(*rpc.AssignIPRequest) (*rpc.AssignIPReply, error),
+	in *rpc.BatchAssignIPRequest) (*rpc.BatchAssignIPReply, error) {
+	if in == nil {
+		return nil, fmt.Errorf("nil request")
+	}
+	reply := &rpc.BatchAssignIPReply{Replies: make([]*rpc.AssignIPReply, len(in.Requests))}
+	for i, req := range in.Requests {
+		r, err := assign(req)
+		if err != nil {
+			r = &rpc.AssignIPReply{Success: false, Msg: err.Error()}
+		}
+		reply.Replies[i] = r
+	}
+	return reply, nil
+}
+
+// BatchUnAssignIPOneByOne implements BatchUnAssignIP by calling unassign for each request. It is used for cloud
+// providers which don't support batch operations.
+func BatchUnAssignIPOneByOne(unassign func(*rpc.UnAssignIPRequest) (*rpc.UnAssignIPReply, error),
+	in *rpc.BatchUnAssignIPRequest) (*rpc.BatchUnAssignIPReply, error) {
+	if in == nil {
+		return nil, fmt.Errorf("nil request")
+	}
+	reply := &rpc.BatchUnAssignIPReply{Replies: make([]*rpc.UnAssignIPReply, len(in.Requests))}
+	for i, req := range in.Requests {
+		r, err := unassign(req)
+		if err != nil {
+			r = &rpc.UnAssignIPReply{Success: false, Msg: err.Error()}
+		}
+		reply.Replies[i] = r
+	}
+	return reply, nil
+}
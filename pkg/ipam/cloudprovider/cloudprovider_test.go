@@ -0,0 +1,195 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package cloudprovider
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+)
+
+// fakeServer implements both rpc.IPProviderServiceServer and rpc.IPProviderServiceV2Server
+type fakeServer struct {
+	sync.Mutex
+	assigned   map[string]string
+	batchCalls int
+}
+
+func (s *fakeServer) AssignIP(ctx context.Context, in *rpc.AssignIPRequest) (*rpc.AssignIPReply, error) {
+	s.Lock()
+	defer s.Unlock()
+	if in.NodeName == "" {
+		return &rpc.AssignIPReply{Msg: "empty node name"}, nil
+	}
+	s.assigned[in.IPAddress] = in.NodeName
+	return &rpc.AssignIPReply{Success: true}, nil
+}
+
+func (s *fakeServer) UnAssignIP(ctx context.Context, in *rpc.UnAssignIPRequest) (*rpc.UnAssignIPReply, error) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.assigned, in.IPAddress)
+	return &rpc.UnAssignIPReply{Success: true}, nil
+}
+
+func (s *fakeServer) BatchAssignIP(ctx context.Context, in *rpc.BatchAssignIPRequest) (*rpc.BatchAssignIPReply, error) {
+	s.Lock()
+	s.batchCalls++
+	s.Unlock()
+	reply := &rpc.BatchAssignIPReply{}
+	for _, req := range in.Requests {
+		r, _ := s.AssignIP(ctx, req)
+		reply.Replies = append(reply.Replies, r)
+	}
+	return reply, nil
+}
+
+func (s *fakeServer) BatchUnAssignIP(ctx context.Context,
+	in *rpc.BatchUnAssignIPRequest) (*rpc.BatchUnAssignIPReply, error) {
+	s.Lock()
+	s.batchCalls++
+	s.Unlock()
+	reply := &rpc.BatchUnAssignIPReply{}
+	for _, req := range in.Requests {
+		r, _ := s.UnAssignIP(ctx, req)
+		reply.Replies = append(reply.Replies, r)
+	}
+	return reply, nil
+}
+
+func (s *fakeServer) ListAssignedIPs(ctx context.Context,
+	in *rpc.ListAssignedIPsRequest) (*rpc.ListAssignedIPsReply, error) {
+	s.Lock()
+	defer s.Unlock()
+	reply := &rpc.ListAssignedIPsReply{}
+	for ip, node := range s.assigned {
+		if in.NodeName == "" || in.NodeName == node {
+			reply.Ips = append(reply.Ips, &rpc.AssignedIP{NodeName: node, IPAddress: ip})
+		}
+	}
+	return reply, nil
+}
+
+// startServer starts a cloud provider server which serves v2 protocol if v2 is true, otherwise v1 protocol
+// without health service
+func startServer(t *testing.T, v2 bool) (*fakeServer, *grpc.Server, string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{assigned: map[string]string{}}
+	server := grpc.NewServer()
+	if v2 {
+		rpc.RegisterIPProviderServiceV2Server(server, s)
+		healthServer := health.NewServer()
+		healthServer.SetServingStatus(IPProviderServiceV2, healthpb.HealthCheckResponse_SERVING)
+		healthpb.RegisterHealthServer(server, healthServer)
+	} else {
+		rpc.RegisterIPProviderServiceServer(server, s)
+	}
+	go server.Serve(lis) // nolint: errcheck
+	return s, server, lis.Addr().String()
+}
+
+func TestGRPCCloudProvider(t *testing.T) {
+	for _, v2 := range []bool{true, false} {
+		s, server, addr := startServer(t, v2)
+		cp := NewGRPCCloudProvider(addr)
+		if _, err := cp.AssignIP(&rpc.AssignIPRequest{NodeName: "node1", IPAddress: "10.0.0.1"}); err != nil {
+			t.Fatalf("v2 %v: %v", v2, err)
+		}
+		if cp.(*grpcCloudProvider).v2 != v2 {
+			t.Fatalf("v2 %v: negotiated wrong version", v2)
+		}
+		reply, err := cp.BatchAssignIP(&rpc.BatchAssignIPRequest{Requests: []*rpc.AssignIPRequest{
+			{NodeName: "node1", IPAddress: "10.0.0.2"},
+			{NodeName: "", IPAddress: "10.0.0.3"},
+			{NodeName: "node2", IPAddress: "10.0.0.4"},
+		}})
+		if err != nil {
+			t.Fatalf("v2 %v: %v", v2, err)
+		}
+		if len(reply.Replies) != 3 || !reply.Replies[0].Success || reply.Replies[1].Success ||
+			!reply.Replies[2].Success {
+			t.Fatalf("v2 %v: unexpected reply %v", v2, reply)
+		}
+		if _, err := cp.BatchUnAssignIP(&rpc.BatchUnAssignIPRequest{Requests: []*rpc.UnAssignIPRequest{
+			{NodeName: "node1", IPAddress: "10.0.0.1"},
+		}}); err != nil {
+			t.Fatalf("v2 %v: %v", v2, err)
+		}
+		if len(s.assigned) != 2 || s.assigned["10.0.0.2"] != "node1" || s.assigned["10.0.0.4"] != "node2" {
+			t.Fatalf("v2 %v: unexpected assigned ips %v", v2, s.assigned)
+		}
+		expectBatchCalls := 0
+		if v2 {
+			expectBatchCalls = 2
+		}
+		if s.batchCalls != expectBatchCalls {
+			t.Fatalf("v2 %v: expect %d batch calls, real %d", v2, expectBatchCalls, s.batchCalls)
+		}
+		list, err := cp.ListAssignedIPs(&rpc.ListAssignedIPsRequest{NodeName: "node2"})
+		if v2 {
+			if err != nil || len(list.Ips) != 1 || list.Ips[0].IPAddress != "10.0.0.4" {
+				t.Fatalf("unexpected list reply %v, err %v", list, err)
+			}
+		} else if err != ErrNotSupported {
+			t.Fatalf("expect ErrNotSupported, real %v", err)
+		}
+		server.Stop()
+	}
+}
+
+func TestNegotiateBackoff(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{assigned: map[string]string{}}
+	server := grpc.NewServer()
+	defer server.Stop()
+	rpc.RegisterIPProviderServiceServer(server, s)
+	rpc.RegisterIPProviderServiceV2Server(server, s)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(IPProviderServiceV2, healthpb.HealthCheckResponse_NOT_SERVING)
+	healthpb.RegisterHealthServer(server, healthServer)
+	go server.Serve(lis) // nolint: errcheck
+	cp := NewGRPCCloudProvider(lis.Addr().String()).(*grpcCloudProvider)
+	if v2, err := cp.supportV2(); err != nil || v2 {
+		t.Fatalf("expect v1 while v2 is not serving, got v2 %v, err %v", v2, err)
+	}
+	if cp.negotiated || cp.negotiateBackoff != minNegotiateBackoff {
+		t.Fatalf("expect retrying negotiation after %v, got negotiated %v, backoff %v", minNegotiateBackoff,
+			cp.negotiated, cp.negotiateBackoff)
+	}
+	healthServer.SetServingStatus(IPProviderServiceV2, healthpb.HealthCheckResponse_SERVING)
+	// not checked again until backoff expires
+	if v2, _ := cp.supportV2(); v2 || cp.negotiated {
+		t.Fatalf("expect v1 during backoff")
+	}
+	cp.nextNegotiate = time.Now()
+	if v2, err := cp.supportV2(); err != nil || !v2 || !cp.negotiated {
+		t.Fatalf("expect v2 after backoff, got v2 %v, err %v", v2, err)
+	}
+}
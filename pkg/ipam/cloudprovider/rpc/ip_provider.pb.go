@@ -19,13 +19,14 @@
 
 package rpc
 
-import proto "github.com/golang/protobuf/proto"
-import fmt "fmt"
-import math "math"
-
 import (
-	context "golang.org/x/net/context"
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
 	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
 )
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -37,7 +38,7 @@ var _ = math.Inf
 // is compatible with the proto package it is being compiled against.
 // A compilation error at this line likely means your copy of the
 // proto package needs to be updated.
-const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
 type AssignIPRequest struct {
 	NodeName             string   `protobuf:"bytes,1,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
@@ -51,16 +52,17 @@ func (m *AssignIPRequest) Reset()         { *m = AssignIPRequest{} }
 func (m *AssignIPRequest) String() string { return proto.CompactTextString(m) }
 func (*AssignIPRequest) ProtoMessage()    {}
 func (*AssignIPRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ip_provider_defe85ad8c429650, []int{0}
+	return fileDescriptor_f6d34b830dfda1ae, []int{0}
 }
+
 func (m *AssignIPRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_AssignIPRequest.Unmarshal(m, b)
 }
 func (m *AssignIPRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_AssignIPRequest.Marshal(b, m, deterministic)
 }
-func (dst *AssignIPRequest) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_AssignIPRequest.Merge(dst, src)
+func (m *AssignIPRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AssignIPRequest.Merge(m, src)
 }
 func (m *AssignIPRequest) XXX_Size() int {
 	return xxx_messageInfo_AssignIPRequest.Size(m)
@@ -97,16 +99,17 @@ func (m *AssignIPReply) Reset()         { *m = AssignIPReply{} }
 func (m *AssignIPReply) String() string { return proto.CompactTextString(m) }
 func (*AssignIPReply) ProtoMessage()    {}
 func (*AssignIPReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ip_provider_defe85ad8c429650, []int{1}
+	return fileDescriptor_f6d34b830dfda1ae, []int{1}
 }
+
 func (m *AssignIPReply) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_AssignIPReply.Unmarshal(m, b)
 }
 func (m *AssignIPReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_AssignIPReply.Marshal(b, m, deterministic)
 }
-func (dst *AssignIPReply) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_AssignIPReply.Merge(dst, src)
+func (m *AssignIPReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AssignIPReply.Merge(m, src)
 }
 func (m *AssignIPReply) XXX_Size() int {
 	return xxx_messageInfo_AssignIPReply.Size(m)
@@ -143,16 +146,17 @@ func (m *UnAssignIPRequest) Reset()         { *m = UnAssignIPRequest{} }
 func (m *UnAssignIPRequest) String() string { return proto.CompactTextString(m) }
 func (*UnAssignIPRequest) ProtoMessage()    {}
 func (*UnAssignIPRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ip_provider_defe85ad8c429650, []int{2}
+	return fileDescriptor_f6d34b830dfda1ae, []int{2}
 }
+
 func (m *UnAssignIPRequest) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_UnAssignIPRequest.Unmarshal(m, b)
 }
 func (m *UnAssignIPRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_UnAssignIPRequest.Marshal(b, m, deterministic)
 }
-func (dst *UnAssignIPRequest) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_UnAssignIPRequest.Merge(dst, src)
+func (m *UnAssignIPRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UnAssignIPRequest.Merge(m, src)
 }
 func (m *UnAssignIPRequest) XXX_Size() int {
 	return xxx_messageInfo_UnAssignIPRequest.Size(m)
@@ -189,16 +193,17 @@ func (m *UnAssignIPReply) Reset()         { *m = UnAssignIPReply{} }
 func (m *UnAssignIPReply) String() string { return proto.CompactTextString(m) }
 func (*UnAssignIPReply) ProtoMessage()    {}
 func (*UnAssignIPReply) Descriptor() ([]byte, []int) {
-	return fileDescriptor_ip_provider_defe85ad8c429650, []int{3}
+	return fileDescriptor_f6d34b830dfda1ae, []int{3}
 }
+
 func (m *UnAssignIPReply) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_UnAssignIPReply.Unmarshal(m, b)
 }
 func (m *UnAssignIPReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
 	return xxx_messageInfo_UnAssignIPReply.Marshal(b, m, deterministic)
 }
-func (dst *UnAssignIPReply) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_UnAssignIPReply.Merge(dst, src)
+func (m *UnAssignIPReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_UnAssignIPReply.Merge(m, src)
 }
 func (m *UnAssignIPReply) XXX_Size() int {
 	return xxx_messageInfo_UnAssignIPReply.Size(m)
@@ -223,11 +228,331 @@ func (m *UnAssignIPReply) GetMsg() string {
 	return ""
 }
 
+type BatchAssignIPRequest struct {
+	Requests             []*AssignIPRequest `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *BatchAssignIPRequest) Reset()         { *m = BatchAssignIPRequest{} }
+func (m *BatchAssignIPRequest) String() string { return proto.CompactTextString(m) }
+func (*BatchAssignIPRequest) ProtoMessage()    {}
+func (*BatchAssignIPRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f6d34b830dfda1ae, []int{4}
+}
+
+func (m *BatchAssignIPRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchAssignIPRequest.Unmarshal(m, b)
+}
+func (m *BatchAssignIPRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchAssignIPRequest.Marshal(b, m, deterministic)
+}
+func (m *BatchAssignIPRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchAssignIPRequest.Merge(m, src)
+}
+func (m *BatchAssignIPRequest) XXX_Size() int {
+	return xxx_messageInfo_BatchAssignIPRequest.Size(m)
+}
+func (m *BatchAssignIPRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchAssignIPRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchAssignIPRequest proto.InternalMessageInfo
+
+func (m *BatchAssignIPRequest) GetRequests() []*AssignIPRequest {
+	if m != nil {
+		return m.Requests
+	}
+	return nil
+}
+
+type BatchAssignIPReply struct {
+	Replies              []*AssignIPReply `protobuf:"bytes,1,rep,name=replies,proto3" json:"replies,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *BatchAssignIPReply) Reset()         { *m = BatchAssignIPReply{} }
+func (m *BatchAssignIPReply) String() string { return proto.CompactTextString(m) }
+func (*BatchAssignIPReply) ProtoMessage()    {}
+func (*BatchAssignIPReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f6d34b830dfda1ae, []int{5}
+}
+
+func (m *BatchAssignIPReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchAssignIPReply.Unmarshal(m, b)
+}
+func (m *BatchAssignIPReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchAssignIPReply.Marshal(b, m, deterministic)
+}
+func (m *BatchAssignIPReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchAssignIPReply.Merge(m, src)
+}
+func (m *BatchAssignIPReply) XXX_Size() int {
+	return xxx_messageInfo_BatchAssignIPReply.Size(m)
+}
+func (m *BatchAssignIPReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchAssignIPReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchAssignIPReply proto.InternalMessageInfo
+
+func (m *BatchAssignIPReply) GetReplies() []*AssignIPReply {
+	if m != nil {
+		return m.Replies
+	}
+	return nil
+}
+
+type BatchUnAssignIPRequest struct {
+	Requests             []*UnAssignIPRequest `protobuf:"bytes,1,rep,name=requests,proto3" json:"requests,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
+}
+
+func (m *BatchUnAssignIPRequest) Reset()         { *m = BatchUnAssignIPRequest{} }
+func (m *BatchUnAssignIPRequest) String() string { return proto.CompactTextString(m) }
+func (*BatchUnAssignIPRequest) ProtoMessage()    {}
+func (*BatchUnAssignIPRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f6d34b830dfda1ae, []int{6}
+}
+
+func (m *BatchUnAssignIPRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchUnAssignIPRequest.Unmarshal(m, b)
+}
+func (m *BatchUnAssignIPRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchUnAssignIPRequest.Marshal(b, m, deterministic)
+}
+func (m *BatchUnAssignIPRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchUnAssignIPRequest.Merge(m, src)
+}
+func (m *BatchUnAssignIPRequest) XXX_Size() int {
+	return xxx_messageInfo_BatchUnAssignIPRequest.Size(m)
+}
+func (m *BatchUnAssignIPRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchUnAssignIPRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchUnAssignIPRequest proto.InternalMessageInfo
+
+func (m *BatchUnAssignIPRequest) GetRequests() []*UnAssignIPRequest {
+	if m != nil {
+		return m.Requests
+	}
+	return nil
+}
+
+type BatchUnAssignIPReply struct {
+	Replies              []*UnAssignIPReply `protobuf:"bytes,1,rep,name=replies,proto3" json:"replies,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *BatchUnAssignIPReply) Reset()         { *m = BatchUnAssignIPReply{} }
+func (m *BatchUnAssignIPReply) String() string { return proto.CompactTextString(m) }
+func (*BatchUnAssignIPReply) ProtoMessage()    {}
+func (*BatchUnAssignIPReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f6d34b830dfda1ae, []int{7}
+}
+
+func (m *BatchUnAssignIPReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BatchUnAssignIPReply.Unmarshal(m, b)
+}
+func (m *BatchUnAssignIPReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BatchUnAssignIPReply.Marshal(b, m, deterministic)
+}
+func (m *BatchUnAssignIPReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BatchUnAssignIPReply.Merge(m, src)
+}
+func (m *BatchUnAssignIPReply) XXX_Size() int {
+	return xxx_messageInfo_BatchUnAssignIPReply.Size(m)
+}
+func (m *BatchUnAssignIPReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_BatchUnAssignIPReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BatchUnAssignIPReply proto.InternalMessageInfo
+
+func (m *BatchUnAssignIPReply) GetReplies() []*UnAssignIPReply {
+	if m != nil {
+		return m.Replies
+	}
+	return nil
+}
+
+type ListAssignedIPsRequest struct {
+	NodeName             string   `protobuf:"bytes,1,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListAssignedIPsRequest) Reset()         { *m = ListAssignedIPsRequest{} }
+func (m *ListAssignedIPsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListAssignedIPsRequest) ProtoMessage()    {}
+func (*ListAssignedIPsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f6d34b830dfda1ae, []int{8}
+}
+
+func (m *ListAssignedIPsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListAssignedIPsRequest.Unmarshal(m, b)
+}
+func (m *ListAssignedIPsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListAssignedIPsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListAssignedIPsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListAssignedIPsRequest.Merge(m, src)
+}
+func (m *ListAssignedIPsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListAssignedIPsRequest.Size(m)
+}
+func (m *ListAssignedIPsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListAssignedIPsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListAssignedIPsRequest proto.InternalMessageInfo
+
+func (m *ListAssignedIPsRequest) GetNodeName() string {
+	if m != nil {
+		return m.NodeName
+	}
+	return ""
+}
+
+type AssignedIP struct {
+	NodeName             string   `protobuf:"bytes,1,opt,name=node_name,json=nodeName,proto3" json:"node_name,omitempty"`
+	IPAddress            string   `protobuf:"bytes,2,opt,name=IP_address,json=IPAddress,proto3" json:"IP_address,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AssignedIP) Reset()         { *m = AssignedIP{} }
+func (m *AssignedIP) String() string { return proto.CompactTextString(m) }
+func (*AssignedIP) ProtoMessage()    {}
+func (*AssignedIP) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f6d34b830dfda1ae, []int{9}
+}
+
+func (m *AssignedIP) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AssignedIP.Unmarshal(m, b)
+}
+func (m *AssignedIP) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AssignedIP.Marshal(b, m, deterministic)
+}
+func (m *AssignedIP) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AssignedIP.Merge(m, src)
+}
+func (m *AssignedIP) XXX_Size() int {
+	return xxx_messageInfo_AssignedIP.Size(m)
+}
+func (m *AssignedIP) XXX_DiscardUnknown() {
+	xxx_messageInfo_AssignedIP.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AssignedIP proto.InternalMessageInfo
+
+func (m *AssignedIP) GetNodeName() string {
+	if m != nil {
+		return m.NodeName
+	}
+	return ""
+}
+
+func (m *AssignedIP) GetIPAddress() string {
+	if m != nil {
+		return m.IPAddress
+	}
+	return ""
+}
+
+type ListAssignedIPsReply struct {
+	Ips                  []*AssignedIP `protobuf:"bytes,1,rep,name=ips,proto3" json:"ips,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}      `json:"-"`
+	XXX_unrecognized     []byte        `json:"-"`
+	XXX_sizecache        int32         `json:"-"`
+}
+
+func (m *ListAssignedIPsReply) Reset()         { *m = ListAssignedIPsReply{} }
+func (m *ListAssignedIPsReply) String() string { return proto.CompactTextString(m) }
+func (*ListAssignedIPsReply) ProtoMessage()    {}
+func (*ListAssignedIPsReply) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f6d34b830dfda1ae, []int{10}
+}
+
+func (m *ListAssignedIPsReply) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListAssignedIPsReply.Unmarshal(m, b)
+}
+func (m *ListAssignedIPsReply) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListAssignedIPsReply.Marshal(b, m, deterministic)
+}
+func (m *ListAssignedIPsReply) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListAssignedIPsReply.Merge(m, src)
+}
+func (m *ListAssignedIPsReply) XXX_Size() int {
+	return xxx_messageInfo_ListAssignedIPsReply.Size(m)
+}
+func (m *ListAssignedIPsReply) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListAssignedIPsReply.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListAssignedIPsReply proto.InternalMessageInfo
+
+func (m *ListAssignedIPsReply) GetIps() []*AssignedIP {
+	if m != nil {
+		return m.Ips
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*AssignIPRequest)(nil), "rpc.AssignIPRequest")
 	proto.RegisterType((*AssignIPReply)(nil), "rpc.AssignIPReply")
 	proto.RegisterType((*UnAssignIPRequest)(nil), "rpc.UnAssignIPRequest")
 	proto.RegisterType((*UnAssignIPReply)(nil), "rpc.UnAssignIPReply")
+	proto.RegisterType((*BatchAssignIPRequest)(nil), "rpc.BatchAssignIPRequest")
+	proto.RegisterType((*BatchAssignIPReply)(nil), "rpc.BatchAssignIPReply")
+	proto.RegisterType((*BatchUnAssignIPRequest)(nil), "rpc.BatchUnAssignIPRequest")
+	proto.RegisterType((*BatchUnAssignIPReply)(nil), "rpc.BatchUnAssignIPReply")
+	proto.RegisterType((*ListAssignedIPsRequest)(nil), "rpc.ListAssignedIPsRequest")
+	proto.RegisterType((*AssignedIP)(nil), "rpc.AssignedIP")
+	proto.RegisterType((*ListAssignedIPsReply)(nil), "rpc.ListAssignedIPsReply")
+}
+
+func init() { proto.RegisterFile("ip_provider.proto", fileDescriptor_f6d34b830dfda1ae) }
+
+var fileDescriptor_f6d34b830dfda1ae = []byte{
+	// 415 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xc4, 0x94, 0xdf, 0x8a, 0xd3, 0x40,
+	0x14, 0xc6, 0xdb, 0x06, 0x6c, 0x7a, 0xa4, 0xc4, 0x8e, 0xa1, 0xb6, 0x29, 0x82, 0xce, 0x55, 0x2f,
+	0x24, 0x48, 0x44, 0x41, 0xd4, 0x8b, 0x16, 0x94, 0x06, 0xab, 0x86, 0x48, 0xbd, 0x2d, 0x31, 0x19,
+	0x6a, 0xa0, 0x4d, 0xc6, 0x99, 0xb4, 0xd0, 0x47, 0xf0, 0x5d, 0x7d, 0x88, 0x65, 0xf2, 0xa7, 0xd9,
+	0x4e, 0xa6, 0xb0, 0xec, 0x2e, 0xec, 0xdd, 0x74, 0xce, 0xd7, 0x1f, 0xdf, 0x39, 0xdf, 0x99, 0xc0,
+	0x20, 0xa6, 0x6b, 0xca, 0xd2, 0x43, 0x1c, 0x11, 0x66, 0x53, 0x96, 0x66, 0x29, 0xd2, 0x18, 0x0d,
+	0xf1, 0x37, 0x30, 0x66, 0x9c, 0xc7, 0x9b, 0xc4, 0xf5, 0x7c, 0xf2, 0x77, 0x4f, 0x78, 0x86, 0x26,
+	0xd0, 0x4b, 0xd2, 0x88, 0xac, 0x93, 0x60, 0x47, 0x46, 0xed, 0x17, 0xed, 0x69, 0xcf, 0xd7, 0xc5,
+	0xc5, 0xf7, 0x60, 0x47, 0xd0, 0x73, 0x00, 0xd7, 0x5b, 0x07, 0x51, 0xc4, 0x08, 0xe7, 0xa3, 0x4e,
+	0x5e, 0xed, 0xb9, 0xde, 0xac, 0xb8, 0xc0, 0x1f, 0xa0, 0x5f, 0xe3, 0xe8, 0xf6, 0x88, 0x46, 0xd0,
+	0xe5, 0xfb, 0x30, 0x14, 0x62, 0x81, 0xd2, 0xfd, 0xea, 0x27, 0x7a, 0x02, 0xda, 0x8e, 0x6f, 0x4a,
+	0x84, 0x38, 0xe2, 0x1f, 0x30, 0x58, 0x25, 0xf7, 0xe9, 0xe6, 0x13, 0x18, 0xab, 0xe4, 0xf6, 0x7e,
+	0x16, 0x60, 0xce, 0x83, 0x2c, 0xfc, 0x23, 0x5b, 0x7a, 0x0d, 0x3a, 0x2b, 0x8e, 0x02, 0xa2, 0x4d,
+	0x1f, 0x3b, 0xa6, 0xcd, 0x68, 0x68, 0x4b, 0x3a, 0xff, 0xa4, 0xc2, 0x73, 0x40, 0x12, 0x49, 0x78,
+	0x79, 0x05, 0x5d, 0x46, 0xe8, 0x36, 0x26, 0x15, 0x06, 0x49, 0x18, 0xba, 0x3d, 0xfa, 0x95, 0x04,
+	0x2f, 0x61, 0x98, 0x33, 0x9a, 0x23, 0x72, 0x1a, 0x7e, 0x86, 0x39, 0x68, 0x95, 0x5c, 0x76, 0xf4,
+	0xa5, 0xec, 0x4d, 0x9e, 0x8f, 0x2d, 0x7b, 0x32, 0x1b, 0xa8, 0x33, 0x57, 0x6f, 0x61, 0xb8, 0x8c,
+	0x79, 0x56, 0x54, 0x49, 0xe4, 0x7a, 0xfc, 0x26, 0xc1, 0xe1, 0x05, 0x40, 0xfd, 0x97, 0x3b, 0x65,
+	0xfc, 0x1e, 0xcc, 0x86, 0x01, 0xd1, 0xc8, 0x4b, 0xd0, 0x62, 0x5a, 0x35, 0x61, 0x5c, 0x1b, 0xac,
+	0xd0, 0xf8, 0xa2, 0xe6, 0xfc, 0x6b, 0xc3, 0xc0, 0xf5, 0xbc, 0xf2, 0x55, 0xfc, 0x24, 0xec, 0x10,
+	0x87, 0x04, 0xbd, 0x03, 0xbd, 0xea, 0x15, 0x29, 0x73, 0xb5, 0x14, 0x31, 0xe1, 0x16, 0xfa, 0x08,
+	0x50, 0x4f, 0x09, 0x5d, 0x48, 0xc0, 0x52, 0x8e, 0x13, 0xb7, 0x9c, 0xff, 0x1d, 0x78, 0xda, 0xf0,
+	0xf2, 0xcb, 0x79, 0x18, 0x37, 0xe8, 0x33, 0xf4, 0xcf, 0xf6, 0x15, 0x8d, 0x73, 0xa1, 0xea, 0x35,
+	0x58, 0xcf, 0x54, 0xa5, 0x02, 0xf3, 0x15, 0x0c, 0x69, 0xc9, 0xd0, 0xa4, 0x56, 0x37, 0xed, 0x8c,
+	0xd5, 0xc5, 0x13, 0x4c, 0x0a, 0xba, 0x84, 0xa9, 0xf7, 0xcf, 0x1a, 0xab, 0x8b, 0x39, 0xec, 0xf7,
+	0xa3, 0xfc, 0x13, 0xf8, 0xe6, 0x6a, 0x00, 0x6e, 0xdc, 0x0d, 0xde, 0x17, 0x05, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -278,6 +603,17 @@ type IPProviderServiceServer interface {
 	UnAssignIP(context.Context, *UnAssignIPRequest) (*UnAssignIPReply, error)
 }
 
+// UnimplementedIPProviderServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedIPProviderServiceServer struct {
+}
+
+func (*UnimplementedIPProviderServiceServer) AssignIP(ctx context.Context, req *AssignIPRequest) (*AssignIPReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AssignIP not implemented")
+}
+func (*UnimplementedIPProviderServiceServer) UnAssignIP(ctx context.Context, req *UnAssignIPRequest) (*UnAssignIPReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnAssignIP not implemented")
+}
+
 func RegisterIPProviderServiceServer(s *grpc.Server, srv IPProviderServiceServer) {
 	s.RegisterService(&_IPProviderService_serviceDesc, srv)
 }
@@ -335,23 +671,224 @@ var _IPProviderService_serviceDesc = grpc.ServiceDesc{
 	Metadata: "ip_provider.proto",
 }
 
-func init() { proto.RegisterFile("ip_provider.proto", fileDescriptor_ip_provider_defe85ad8c429650) }
-
-var fileDescriptor_ip_provider_defe85ad8c429650 = []byte{
-	// 236 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x12, 0xcc, 0x2c, 0x88, 0x2f,
-	0x28, 0xca, 0x2f, 0xcb, 0x4c, 0x49, 0x2d, 0xd2, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x2e,
-	0x2a, 0x48, 0x56, 0xf2, 0xe5, 0xe2, 0x77, 0x2c, 0x2e, 0xce, 0x4c, 0xcf, 0xf3, 0x0c, 0x08, 0x4a,
-	0x2d, 0x2c, 0x4d, 0x2d, 0x2e, 0x11, 0x92, 0xe6, 0xe2, 0xcc, 0xcb, 0x4f, 0x49, 0x8d, 0xcf, 0x4b,
-	0xcc, 0x4d, 0x95, 0x60, 0x54, 0x60, 0xd4, 0xe0, 0x0c, 0xe2, 0x00, 0x09, 0xf8, 0x25, 0xe6, 0xa6,
-	0x0a, 0xc9, 0x72, 0x71, 0x79, 0x06, 0xc4, 0x27, 0xa6, 0xa4, 0x14, 0xa5, 0x16, 0x17, 0x4b, 0x30,
-	0x81, 0x65, 0x39, 0x3d, 0x03, 0x1c, 0x21, 0x02, 0x4a, 0xd6, 0x5c, 0xbc, 0x08, 0xe3, 0x0a, 0x72,
-	0x2a, 0x85, 0x24, 0xb8, 0xd8, 0x8b, 0x4b, 0x93, 0x93, 0x41, 0x8a, 0x41, 0x46, 0x71, 0x04, 0xc1,
-	0xb8, 0x42, 0x02, 0x5c, 0xcc, 0xb9, 0xc5, 0xe9, 0x50, 0x23, 0x40, 0x4c, 0x25, 0x7f, 0x2e, 0xc1,
-	0xd0, 0x3c, 0x6a, 0xba, 0xc6, 0x96, 0x8b, 0x1f, 0xd9, 0x40, 0x12, 0xdd, 0x63, 0xd4, 0xc9, 0xc8,
-	0x25, 0xe8, 0x19, 0x10, 0x00, 0x0d, 0xb5, 0xe0, 0xd4, 0xa2, 0xb2, 0xcc, 0xe4, 0x54, 0x21, 0x33,
-	0x2e, 0x0e, 0x98, 0x91, 0x42, 0x22, 0x7a, 0x45, 0x05, 0xc9, 0x7a, 0x68, 0x4e, 0x96, 0x12, 0x42,
-	0x13, 0x2d, 0xc8, 0xa9, 0x54, 0x62, 0x10, 0xb2, 0xe1, 0xe2, 0x42, 0x38, 0x46, 0x48, 0x0c, 0xac,
-	0x06, 0xc3, 0xbb, 0x52, 0x22, 0x18, 0xe2, 0x60, 0xdd, 0x49, 0x6c, 0xe0, 0x38, 0x33, 0x06, 0x04,
-	0x00, 0x00, 0xff, 0xff, 0x6a, 0x5b, 0xc9, 0x86, 0xc8, 0x01, 0x00, 0x00,
+// IPProviderServiceV2Client is the client API for IPProviderServiceV2 service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type IPProviderServiceV2Client interface {
+	AssignIP(ctx context.Context, in *AssignIPRequest, opts ...grpc.CallOption) (*AssignIPReply, error)
+	UnAssignIP(ctx context.Context, in *UnAssignIPRequest, opts ...grpc.CallOption) (*UnAssignIPReply, error)
+	// BatchAssignIP replies the result of each request in the same order of requests
+	BatchAssignIP(ctx context.Context, in *BatchAssignIPRequest, opts ...grpc.CallOption) (*BatchAssignIPReply, error)
+	// BatchUnAssignIP replies the result of each request in the same order of requests
+	BatchUnAssignIP(ctx context.Context, in *BatchUnAssignIPRequest, opts ...grpc.CallOption) (*BatchUnAssignIPReply, error)
+	// ListAssignedIPs lists ips assigned to the node, or to all nodes if node_name is empty
+	ListAssignedIPs(ctx context.Context, in *ListAssignedIPsRequest, opts ...grpc.CallOption) (*ListAssignedIPsReply, error)
+}
+
+type iPProviderServiceV2Client struct {
+	cc *grpc.ClientConn
+}
+
+func NewIPProviderServiceV2Client(cc *grpc.ClientConn) IPProviderServiceV2Client {
+	return &iPProviderServiceV2Client{cc}
+}
+
+func (c *iPProviderServiceV2Client) AssignIP(ctx context.Context, in *AssignIPRequest, opts ...grpc.CallOption) (*AssignIPReply, error) {
+	out := new(AssignIPReply)
+	err := c.cc.Invoke(ctx, "/rpc.IPProviderServiceV2/AssignIP", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iPProviderServiceV2Client) UnAssignIP(ctx context.Context, in *UnAssignIPRequest, opts ...grpc.CallOption) (*UnAssignIPReply, error) {
+	out := new(UnAssignIPReply)
+	err := c.cc.Invoke(ctx, "/rpc.IPProviderServiceV2/UnAssignIP", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iPProviderServiceV2Client) BatchAssignIP(ctx context.Context, in *BatchAssignIPRequest, opts ...grpc.CallOption) (*BatchAssignIPReply, error) {
+	out := new(BatchAssignIPReply)
+	err := c.cc.Invoke(ctx, "/rpc.IPProviderServiceV2/BatchAssignIP", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iPProviderServiceV2Client) BatchUnAssignIP(ctx context.Context, in *BatchUnAssignIPRequest, opts ...grpc.CallOption) (*BatchUnAssignIPReply, error) {
+	out := new(BatchUnAssignIPReply)
+	err := c.cc.Invoke(ctx, "/rpc.IPProviderServiceV2/BatchUnAssignIP", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iPProviderServiceV2Client) ListAssignedIPs(ctx context.Context, in *ListAssignedIPsRequest, opts ...grpc.CallOption) (*ListAssignedIPsReply, error) {
+	out := new(ListAssignedIPsReply)
+	err := c.cc.Invoke(ctx, "/rpc.IPProviderServiceV2/ListAssignedIPs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// IPProviderServiceV2Server is the server API for IPProviderServiceV2 service.
+type IPProviderServiceV2Server interface {
+	AssignIP(context.Context, *AssignIPRequest) (*AssignIPReply, error)
+	UnAssignIP(context.Context, *UnAssignIPRequest) (*UnAssignIPReply, error)
+	// BatchAssignIP replies the result of each request in the same order of requests
+	BatchAssignIP(context.Context, *BatchAssignIPRequest) (*BatchAssignIPReply, error)
+	// BatchUnAssignIP replies the result of each request in the same order of requests
+	BatchUnAssignIP(context.Context, *BatchUnAssignIPRequest) (*BatchUnAssignIPReply, error)
+	// ListAssignedIPs lists ips assigned to the node, or to all nodes if node_name is empty
+	ListAssignedIPs(context.Context, *ListAssignedIPsRequest) (*ListAssignedIPsReply, error)
+}
+
+// UnimplementedIPProviderServiceV2Server can be embedded to have forward compatible implementations.
+type UnimplementedIPProviderServiceV2Server struct {
+}
+
+func (*UnimplementedIPProviderServiceV2Server) AssignIP(ctx context.Context, req *AssignIPRequest) (*AssignIPReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AssignIP not implemented")
+}
+func (*UnimplementedIPProviderServiceV2Server) UnAssignIP(ctx context.Context, req *UnAssignIPRequest) (*UnAssignIPReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UnAssignIP not implemented")
+}
+func (*UnimplementedIPProviderServiceV2Server) BatchAssignIP(ctx context.Context, req *BatchAssignIPRequest) (*BatchAssignIPReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchAssignIP not implemented")
+}
+func (*UnimplementedIPProviderServiceV2Server) BatchUnAssignIP(ctx context.Context, req *BatchUnAssignIPRequest) (*BatchUnAssignIPReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchUnAssignIP not implemented")
+}
+func (*UnimplementedIPProviderServiceV2Server) ListAssignedIPs(ctx context.Context, req *ListAssignedIPsRequest) (*ListAssignedIPsReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAssignedIPs not implemented")
+}
+
+func RegisterIPProviderServiceV2Server(s *grpc.Server, srv IPProviderServiceV2Server) {
+	s.RegisterService(&_IPProviderServiceV2_serviceDesc, srv)
+}
+
+func _IPProviderServiceV2_AssignIP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AssignIPRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IPProviderServiceV2Server).AssignIP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.IPProviderServiceV2/AssignIP",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IPProviderServiceV2Server).AssignIP(ctx, req.(*AssignIPRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IPProviderServiceV2_UnAssignIP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UnAssignIPRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IPProviderServiceV2Server).UnAssignIP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.IPProviderServiceV2/UnAssignIP",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IPProviderServiceV2Server).UnAssignIP(ctx, req.(*UnAssignIPRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IPProviderServiceV2_BatchAssignIP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchAssignIPRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IPProviderServiceV2Server).BatchAssignIP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.IPProviderServiceV2/BatchAssignIP",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IPProviderServiceV2Server).BatchAssignIP(ctx, req.(*BatchAssignIPRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IPProviderServiceV2_BatchUnAssignIP_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchUnAssignIPRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IPProviderServiceV2Server).BatchUnAssignIP(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.IPProviderServiceV2/BatchUnAssignIP",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IPProviderServiceV2Server).BatchUnAssignIP(ctx, req.(*BatchUnAssignIPRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IPProviderServiceV2_ListAssignedIPs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAssignedIPsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IPProviderServiceV2Server).ListAssignedIPs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.IPProviderServiceV2/ListAssignedIPs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IPProviderServiceV2Server).ListAssignedIPs(ctx, req.(*ListAssignedIPsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _IPProviderServiceV2_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "rpc.IPProviderServiceV2",
+	HandlerType: (*IPProviderServiceV2Server)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "AssignIP",
+			Handler:    _IPProviderServiceV2_AssignIP_Handler,
+		},
+		{
+			MethodName: "UnAssignIP",
+			Handler:    _IPProviderServiceV2_UnAssignIP_Handler,
+		},
+		{
+			MethodName: "BatchAssignIP",
+			Handler:    _IPProviderServiceV2_BatchAssignIP_Handler,
+		},
+		{
+			MethodName: "BatchUnAssignIP",
+			Handler:    _IPProviderServiceV2_BatchUnAssignIP_Handler,
+		},
+		{
+			MethodName: "ListAssignedIPs",
+			Handler:    _IPProviderServiceV2_ListAssignedIPs_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "ip_provider.proto",
 }
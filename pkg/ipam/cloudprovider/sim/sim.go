@@ -0,0 +1,272 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+// Package sim implements a cloud provider server which keeps ip bindings in memory or a file. It is used to run
+// galaxy-ipam without a real cloud, or to move ips between bare-metal hosts by a hook script.
+package sim
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+)
+
+// Options are options of the simulated cloud provider
+type Options struct {
+	// StateFile is the json file to persist bindings, bindings are kept in memory only if it is empty
+	StateFile string
+	// Latency is the delay of each request
+	Latency time.Duration
+	// FailureRate is the probability in [0, 1] of failing a request
+	FailureRate float64
+	// MaxIPsPerNode is the max number of ips assigned to a node, 0 means unlimited
+	MaxIPsPerNode int
+	// HookScript is executed as "<HookScript> assign|unassign <node> <ip>" before changing bindings, the request
+	// fails if it exits with non zero code
+	HookScript string
+	// V1Only serves only IPProviderService without health service, as cloud providers before v2
+	V1Only bool
+}
+
+// Server implements rpc.IPProviderServiceServer and rpc.IPProviderServiceV2Server
+type Server struct {
+	opts Options
+	lock sync.Mutex
+	// bindings is ip to node name
+	bindings map[string]string
+	rand     *rand.Rand
+}
+
+// NewServer creates a Server, loading bindings from the state file if it exists
+func NewServer(opts Options) (*Server, error) {
+	s := &Server{
+		opts:     opts,
+		bindings: map[string]string{},
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	if opts.FailureRate < 0 || opts.FailureRate > 1 {
+		return nil, fmt.Errorf("failure rate %v is not in [0, 1]", opts.FailureRate)
+	}
+	if opts.StateFile == "" {
+		return s, nil
+	}
+	data, err := ioutil.ReadFile(opts.StateFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.bindings); err != nil {
+		return nil, fmt.Errorf("failed to load state file %s: %v", opts.StateFile, err)
+	}
+	glog.Infof("loaded %d bindings from %s", len(s.bindings), opts.StateFile)
+	return s, nil
+}
+
+// Register registers services of the server to the grpc server
+func (s *Server) Register(gs *grpc.Server) {
+	rpc.RegisterIPProviderServiceServer(gs, s)
+	if s.opts.V1Only {
+		return
+	}
+	rpc.RegisterIPProviderServiceV2Server(gs, s)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus(cloudprovider.IPProviderServiceV2, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(gs, healthServer)
+}
+
+// inject delays the request and returns an error if the request should fail
+func (s *Server) inject(ctx context.Context) error {
+	if s.opts.Latency > 0 {
+		select {
+		case <-time.After(s.opts.Latency):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.lock.Lock()
+	fail := s.rand.Float64() < s.opts.FailureRate
+	s.lock.Unlock()
+	if fail {
+		return fmt.Errorf("injected failure")
+	}
+	return nil
+}
+
+func (s *Server) AssignIP(ctx context.Context, in *rpc.AssignIPRequest) (*rpc.AssignIPReply, error) {
+	if err := s.inject(ctx); err != nil {
+		return &rpc.AssignIPReply{Msg: err.Error()}, nil
+	}
+	if err := s.assign(in.NodeName, in.IPAddress); err != nil {
+		glog.Warningf("failed to assign ip %s to node %s: %v", in.IPAddress, in.NodeName, err)
+		return &rpc.AssignIPReply{Msg: err.Error()}, nil
+	}
+	return &rpc.AssignIPReply{Success: true}, nil
+}
+
+func (s *Server) UnAssignIP(ctx context.Context, in *rpc.UnAssignIPRequest) (*rpc.UnAssignIPReply, error) {
+	if err := s.inject(ctx); err != nil {
+		return &rpc.UnAssignIPReply{Msg: err.Error()}, nil
+	}
+	if err := s.unassign(in.NodeName, in.IPAddress); err != nil {
+		glog.Warningf("failed to unassign ip %s from node %s: %v", in.IPAddress, in.NodeName, err)
+		return &rpc.UnAssignIPReply{Msg: err.Error()}, nil
+	}
+	return &rpc.UnAssignIPReply{Success: true}, nil
+}
+
+func (s *Server) BatchAssignIP(ctx context.Context, in *rpc.BatchAssignIPRequest) (*rpc.BatchAssignIPReply, error) {
+	return cloudprovider.BatchAssignIPOneByOne(func(req *rpc.AssignIPRequest) (*rpc.AssignIPReply, error) {
+		return s.AssignIP(ctx, req)
+	}, in)
+}
+
+func (s *Server) BatchUnAssignIP(ctx context.Context,
+	in *rpc.BatchUnAssignIPRequest) (*rpc.BatchUnAssignIPReply, error) {
+	return cloudprovider.BatchUnAssignIPOneByOne(func(req *rpc.UnAssignIPRequest) (*rpc.UnAssignIPReply, error) {
+		return s.UnAssignIP(ctx, req)
+	}, in)
+}
+
+func (s *Server) ListAssignedIPs(ctx context.Context,
+	in *rpc.ListAssignedIPsRequest) (*rpc.ListAssignedIPsReply, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	reply := &rpc.ListAssignedIPsReply{}
+	for ip, node := range s.bindings {
+		if in.NodeName == "" || in.NodeName == node {
+			reply.Ips = append(reply.Ips, &rpc.AssignedIP{NodeName: node, IPAddress: ip})
+		}
+	}
+	sort.Slice(reply.Ips, func(i, j int) bool {
+		return reply.Ips[i].IPAddress < reply.Ips[j].IPAddress
+	})
+	return reply, nil
+}
+
+// assign binds the ip to the node. Like a real cloud, an ip assigned to another node should be unassigned first.
+func (s *Server) assign(node, ip string) error {
+	if err := validate(node, ip); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if current, ok := s.bindings[ip]; ok {
+		if current == node {
+			return nil
+		}
+		return fmt.Errorf("ip %s is assigned to node %s", ip, current)
+	}
+	if s.opts.MaxIPsPerNode > 0 {
+		var count int
+		for _, n := range s.bindings {
+			if n == node {
+				count++
+			}
+		}
+		if count >= s.opts.MaxIPsPerNode {
+			return fmt.Errorf("node %s has no capacity for more than %d ips", node, s.opts.MaxIPsPerNode)
+		}
+	}
+	if err := s.runHook("assign", node, ip); err != nil {
+		return err
+	}
+	s.bindings[ip] = node
+	glog.Infof("assigned ip %s to node %s", ip, node)
+	return s.save()
+}
+
+// unassign unbinds the ip from the node. It succeeds if the ip is not assigned to the node.
+func (s *Server) unassign(node, ip string) error {
+	if err := validate(node, ip); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if current, ok := s.bindings[ip]; !ok || current != node {
+		return nil
+	}
+	if err := s.runHook("unassign", node, ip); err != nil {
+		return err
+	}
+	delete(s.bindings, ip)
+	glog.Infof("unassigned ip %s from node %s", ip, node)
+	return s.save()
+}
+
+func (s *Server) runHook(action, node, ip string) error {
+	if s.opts.HookScript == "" {
+		return nil
+	}
+	out, err := exec.Command(s.opts.HookScript, action, node, ip).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("hook %s %s %s %s failed: %v, output: %s", s.opts.HookScript, action, node, ip, err,
+			strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// save writes bindings to the state file atomically
+func (s *Server) save() error {
+	if s.opts.StateFile == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.bindings, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.opts.StateFile), filepath.Base(s.opts.StateFile)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // nolint: errcheck
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close() // nolint: errcheck
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.opts.StateFile)
+}
+
+func validate(node, ip string) error {
+	if node == "" {
+		return fmt.Errorf("empty node name")
+	}
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid ip %q", ip)
+	}
+	return nil
+}
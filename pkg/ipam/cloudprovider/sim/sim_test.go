@@ -0,0 +1,194 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package sim
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+)
+
+func assign(t *testing.T, s *Server, node, ip string) *rpc.AssignIPReply {
+	reply, err := s.AssignIP(context.Background(), &rpc.AssignIPRequest{NodeName: node, IPAddress: ip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func unassign(t *testing.T, s *Server, node, ip string) *rpc.UnAssignIPReply {
+	reply, err := s.UnAssignIP(context.Background(), &rpc.UnAssignIPRequest{NodeName: node, IPAddress: ip})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reply
+}
+
+func TestAssignIP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	opts := Options{StateFile: filepath.Join(dir, "state.json"), MaxIPsPerNode: 2}
+	s, err := NewServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := assign(t, s, "node1", "10.0.0.1"); !reply.Success {
+		t.Fatalf("unexpected reply %v", reply)
+	}
+	// assigning the same ip to the same node is idempotent
+	if reply := assign(t, s, "node1", "10.0.0.1"); !reply.Success {
+		t.Fatalf("unexpected reply %v", reply)
+	}
+	if reply := assign(t, s, "node2", "10.0.0.1"); reply.Success {
+		t.Fatal("expect failure of assigning an ip bound to another node")
+	}
+	if reply := assign(t, s, "node1", "10.0.0.2"); !reply.Success {
+		t.Fatalf("unexpected reply %v", reply)
+	}
+	if reply := assign(t, s, "node1", "10.0.0.3"); reply.Success || !strings.Contains(reply.Msg, "capacity") {
+		t.Fatalf("expect capacity failure, real %v", reply)
+	}
+	if reply := assign(t, s, "", "10.0.0.4"); reply.Success {
+		t.Fatal("expect failure of empty node name")
+	}
+	// unassigning from a wrong node or an unassigned ip is idempotent
+	if reply := unassign(t, s, "node2", "10.0.0.1"); !reply.Success {
+		t.Fatalf("unexpected reply %v", reply)
+	}
+	if reply := unassign(t, s, "node1", "10.0.0.5"); !reply.Success {
+		t.Fatalf("unexpected reply %v", reply)
+	}
+	if reply := unassign(t, s, "node1", "10.0.0.2"); !reply.Success {
+		t.Fatalf("unexpected reply %v", reply)
+	}
+	// bindings are reloaded from the state file
+	s, err = NewServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := s.ListAssignedIPs(context.Background(), &rpc.ListAssignedIPsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Ips) != 1 || list.Ips[0].NodeName != "node1" || list.Ips[0].IPAddress != "10.0.0.1" {
+		t.Fatalf("unexpected list reply %v", list)
+	}
+}
+
+func TestFailureInjection(t *testing.T) {
+	if _, err := NewServer(Options{FailureRate: 2}); err == nil {
+		t.Fatal("expect error of invalid failure rate")
+	}
+	s, err := NewServer(Options{FailureRate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := assign(t, s, "node1", "10.0.0.1"); reply.Success || reply.Msg != "injected failure" {
+		t.Fatalf("expect injected failure, real %v", reply)
+	}
+	if len(s.bindings) != 0 {
+		t.Fatalf("unexpected bindings %v", s.bindings)
+	}
+}
+
+func TestHookScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sim")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	script := filepath.Join(dir, "hook.sh")
+	record := filepath.Join(dir, "record")
+	if err := ioutil.WriteFile(script, []byte(`#!/bin/sh
+if [ "$3" = "10.0.0.9" ]; then
+  echo "no route to $2"
+  exit 1
+fi
+echo "$1 $2 $3" >> `+record+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewServer(Options{HookScript: script})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := assign(t, s, "node1", "10.0.0.1"); !reply.Success {
+		t.Fatalf("unexpected reply %v", reply)
+	}
+	if reply := unassign(t, s, "node1", "10.0.0.1"); !reply.Success {
+		t.Fatalf("unexpected reply %v", reply)
+	}
+	if reply := assign(t, s, "node1", "10.0.0.9"); reply.Success || !strings.Contains(reply.Msg, "no route to node1") {
+		t.Fatalf("expect hook failure, real %v", reply)
+	}
+	data, err := ioutil.ReadFile(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "assign node1 10.0.0.1\nunassign node1 10.0.0.1\n" {
+		t.Fatalf("unexpected hook calls %q", string(data))
+	}
+	if len(s.bindings) != 0 {
+		t.Fatalf("unexpected bindings %v", s.bindings)
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	for _, v1Only := range []bool{false, true} {
+		s, err := NewServer(Options{V1Only: v1Only})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := grpc.NewServer()
+		s.Register(server)
+		go server.Serve(lis) // nolint: errcheck
+		cp := cloudprovider.NewGRPCCloudProvider(lis.Addr().String())
+		reply, err := cp.BatchAssignIP(&rpc.BatchAssignIPRequest{Requests: []*rpc.AssignIPRequest{
+			{NodeName: "node1", IPAddress: "10.0.0.1"},
+			{NodeName: "node2", IPAddress: "10.0.0.1"},
+		}})
+		if err != nil {
+			t.Fatalf("v1Only %v: %v", v1Only, err)
+		}
+		if len(reply.Replies) != 2 || !reply.Replies[0].Success || reply.Replies[1].Success {
+			t.Fatalf("v1Only %v: unexpected reply %v", v1Only, reply)
+		}
+		list, err := cp.ListAssignedIPs(&rpc.ListAssignedIPsRequest{NodeName: "node1"})
+		if v1Only {
+			if err != cloudprovider.ErrNotSupported {
+				t.Fatalf("expect ErrNotSupported, real %v", err)
+			}
+		} else if err != nil || len(list.Ips) != 1 || list.Ips[0].IPAddress != "10.0.0.1" {
+			t.Fatalf("unexpected list reply %v, err %v", list, err)
+		}
+		server.Stop()
+	}
+}
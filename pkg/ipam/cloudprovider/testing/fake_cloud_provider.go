@@ -18,6 +18,7 @@ package testing
 
 import (
 	"fmt"
+	"sort"
 
 	"tkestack.io/galaxy/pkg/ipam/cloudprovider"
 	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
@@ -50,3 +51,29 @@ func (f *FakeCloudProvider) UnAssignIP(in *rpc.UnAssignIPRequest) (*rpc.UnAssign
 	f.UnAssigned[in.IPAddress] = in.NodeName
 	return &rpc.UnAssignIPReply{Success: true}, nil
 }
+
+func (f *FakeCloudProvider) BatchAssignIP(in *rpc.BatchAssignIPRequest) (*rpc.BatchAssignIPReply, error) {
+	return cloudprovider.BatchAssignIPOneByOne(f.AssignIP, in)
+}
+
+func (f *FakeCloudProvider) BatchUnAssignIP(in *rpc.BatchUnAssignIPRequest) (*rpc.BatchUnAssignIPReply, error) {
+	return cloudprovider.BatchUnAssignIPOneByOne(f.UnAssignIP, in)
+}
+
+// ListAssignedIPs lists ips in Assigned which are not unassigned from the same node afterwards
+func (f *FakeCloudProvider) ListAssignedIPs(in *rpc.ListAssignedIPsRequest) (*rpc.ListAssignedIPsReply, error) {
+	if in == nil {
+		return nil, fmt.Errorf("nil request")
+	}
+	reply := &rpc.ListAssignedIPsReply{}
+	for ip, node := range f.Assigned {
+		if f.UnAssigned[ip] == node || (in.NodeName != "" && in.NodeName != node) {
+			continue
+		}
+		reply.Ips = append(reply.Ips, &rpc.AssignedIP{NodeName: node, IPAddress: ip})
+	}
+	sort.Slice(reply.Ips, func(i, j int) bool {
+		return reply.Ips[i].IPAddress < reply.Ips[j].IPAddress
+	})
+	return reply, nil
+}
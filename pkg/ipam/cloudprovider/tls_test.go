@@ -0,0 +1,166 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package cloudprovider
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
+)
+
+// newCert creates a certificate signed by parent, or a self signed ca certificate if parent is nil
+func newCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate,
+	*ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{cn},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		template.IsCA, template.BasicConstraintsValid = true, true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGRPCCloudProviderWithAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudprovider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+	ca, caKey, caPEM, _ := newCert(t, "ca", nil, nil)
+	_, _, serverCertPEM, serverKeyPEM := newCert(t, "cloudprovider", ca, caKey)
+	_, _, clientCertPEM, clientKeyPEM := newCert(t, "galaxy-ipam", ca, caKey)
+	serverCert, err := tls.X509KeyPair(serverCertPEM, serverKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	tlsConfig := &TLSConfig{
+		CAFile:     filepath.Join(dir, "ca.crt"),
+		CertFile:   filepath.Join(dir, "client.crt"),
+		KeyFile:    filepath.Join(dir, "client.key"),
+		ServerName: "cloudprovider",
+	}
+	tokenFile := filepath.Join(dir, "token")
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})), grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if auth := md.Get("authorization"); len(auth) != 1 || auth[0] != "Bearer token1" {
+			return nil, status.Errorf(codes.Unauthenticated, "bad token %v", auth)
+		}
+		return handler(ctx, req)
+	}))
+	rpc.RegisterIPProviderServiceServer(server, &fakeServer{assigned: map[string]string{}})
+	go server.Serve(lis) // nolint: errcheck
+	defer server.Stop()
+
+	cp := NewGRPCCloudProviderWithAuth(lis.Addr().String(), tlsConfig, tokenFile)
+	// certificates are not ready, requests fail without exiting and connecting is retried later
+	if err := cp.(ReadyChecker).Ready(); err == nil || !strings.Contains(err.Error(), "tls config") {
+		t.Fatalf("expect tls config error, real %v", err)
+	}
+	req := &rpc.AssignIPRequest{NodeName: "node1", IPAddress: "10.0.0.1"}
+	if _, err := cp.AssignIP(req); err == nil {
+		t.Fatal("expect error")
+	}
+	writeFile(t, tlsConfig.CAFile, caPEM)
+	writeFile(t, tlsConfig.CertFile, clientCertPEM)
+	writeFile(t, tlsConfig.KeyFile, clientKeyPEM)
+	writeFile(t, tokenFile, []byte("token2\n"))
+	if _, err := cp.AssignIP(req); err == nil || !strings.Contains(err.Error(), "bad token") {
+		t.Fatalf("expect bad token error, real %v", err)
+	}
+	// token is read again for each request
+	writeFile(t, tokenFile, []byte("token1\n"))
+	if _, err := cp.AssignIP(req); err != nil {
+		t.Fatal(err)
+	}
+	if err := cp.(ReadyChecker).Ready(); err != nil {
+		t.Fatal(err)
+	}
+	var value float64
+	for i := 0; i < 50; i++ {
+		if value = testutil.ToFloat64(metrics.CloudProviderConnectionState.WithLabelValues("READY")); value == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if value != 1 {
+		t.Fatalf("expect connection state metric READY to be 1, real %v", value)
+	}
+}
@@ -24,6 +24,7 @@ import (
 	extensionlister "k8s.io/apiextensions-apiserver/pkg/client/listers/apiextensions/v1beta1"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/informers"
+	appinformer "k8s.io/client-go/informers/apps/v1"
 	coreinformer "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
 	appv1 "k8s.io/client-go/listers/apps/v1"
@@ -46,9 +47,12 @@ type IPAMContext struct {
 	DeploymentLister  appv1.DeploymentLister
 	PoolLister        list.PoolLister
 	ExtensionLister   extensionlister.CustomResourceDefinitionLister
+	CPOLister         list.CloudProviderOperationLister
 
-	PodInformer coreinformer.PodInformer
-	FIPInformer galaxyinformer.FloatingIPInformer
+	PodInformer         coreinformer.PodInformer
+	StatefulSetInformer appinformer.StatefulSetInformer
+	FIPInformer         galaxyinformer.FloatingIPInformer
+	CPOInformer         galaxyinformer.CloudProviderOperationInformer
 
 	informerFactory    informers.SharedInformerFactory
 	crdInformerFactory crdInformer.SharedInformerFactory
@@ -66,19 +70,21 @@ func NewIPAMContext(client kubernetes.Interface, galaxyClient crd_clientset.Inte
 	}
 	ctx.informerFactory = informers.NewSharedInformerFactoryWithOptions(ctx.Client, time.Minute)
 	ctx.PodInformer = ctx.informerFactory.Core().V1().Pods()
-	statefulsetInformer := ctx.informerFactory.Apps().V1().StatefulSets()
+	ctx.StatefulSetInformer = ctx.informerFactory.Apps().V1().StatefulSets()
 	deploymentInformer := ctx.informerFactory.Apps().V1().Deployments()
 	ctx.crdInformerFactory = crdInformer.NewSharedInformerFactory(ctx.GalaxyClient, 0)
 	poolInformer := ctx.crdInformerFactory.Galaxy().V1alpha1().Pools()
 	ctx.FIPInformer = ctx.crdInformerFactory.Galaxy().V1alpha1().FloatingIPs()
+	ctx.CPOInformer = ctx.crdInformerFactory.Galaxy().V1alpha1().CloudProviderOperations()
 	ctx.extensionFactory = extensioninformer.NewSharedInformerFactory(ctx.ExtClient, 0)
 	extensionInformer := ctx.extensionFactory.Apiextensions().V1beta1().CustomResourceDefinitions()
 	extensionInformer.Informer() // call Informer to actually create an informer
 
 	ctx.PodLister = ctx.PodInformer.Lister()
-	ctx.StatefulSetLister = statefulsetInformer.Lister()
+	ctx.StatefulSetLister = ctx.StatefulSetInformer.Lister()
 	ctx.DeploymentLister = deploymentInformer.Lister()
 	ctx.PoolLister = poolInformer.Lister()
+	ctx.CPOLister = ctx.CPOInformer.Lister()
 
 	ctx.ExtensionLister = extensionInformer.Lister()
 	return ctx
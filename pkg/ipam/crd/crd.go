@@ -67,10 +67,31 @@ var poolCrd = &extensionsv1.CustomResourceDefinition{
 	},
 }
 
-// EnsureCRDCreated ensures floatingip and pool are created in apiserver
+// cloudProviderOperationCrd is the crd format of cloud provider operation
+var cloudProviderOperationCrd = &extensionsv1.CustomResourceDefinition{
+	ObjectMeta: metav1.ObjectMeta{
+		Name: "cloudprovideroperations.galaxy.k8s.io",
+	},
+	TypeMeta: metav1.TypeMeta{
+		Kind:       "CustomResourceDefinition",
+		APIVersion: "apiextensions.k8s.io/v1beta1",
+	},
+	Spec: extensionsv1.CustomResourceDefinitionSpec{
+		Group:   galaxy.GroupName,
+		Version: "v1alpha1",
+		Scope:   extensionsv1.ClusterScoped,
+		Names: extensionsv1.CustomResourceDefinitionNames{
+			Kind:       "CloudProviderOperation",
+			Plural:     "cloudprovideroperations",
+			ShortNames: []string{"cpo"},
+		},
+	},
+}
+
+// EnsureCRDCreated ensures floatingip, pool and cloudprovideroperation are created in apiserver
 func EnsureCRDCreated(client apiextensionsclient.Interface) error {
 	crdClient := client.ApiextensionsV1beta1().CustomResourceDefinitions()
-	crds := []*extensionsv1.CustomResourceDefinition{floatingipCrd, poolCrd}
+	crds := []*extensionsv1.CustomResourceDefinition{floatingipCrd, poolCrd, cloudProviderOperationCrd}
 	for i := range crds {
 		// try to create each crd and ignores already exist error
 		if _, err := crdClient.Create(crds[i]); err != nil && !apierrors.IsAlreadyExists(err) {
@@ -23,6 +23,8 @@ import (
 	"sync"
 	"time"
 
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 	"tkestack.io/galaxy/pkg/utils/nets"
@@ -37,7 +39,12 @@ type FloatingIP struct {
 	Policy    uint16
 	NodeName  string
 	PodUid    string
-	pool      *FloatingIPPool
+	BindPhase string
+	// Static is true if the ip is allocated to the key by static ip annotation of the pod
+	Static bool
+	pool   *FloatingIPPool
+	// resourceVersion is the resource version of the crd of the ip
+	resourceVersion string
 }
 
 func (f FloatingIP) String() string {
@@ -45,6 +52,12 @@ func (f FloatingIP) String() string {
 		f.IP.String(), f.Key, f.Policy, f.NodeName, f.PodUid)
 }
 
+// ResourceVersion returns the resource version of the crd of the ip, which changes on every update of the ip by any
+// replica
+func (f *FloatingIP) ResourceVersion() string {
+	return f.resourceVersion
+}
+
 // New creates a new FloatingIP
 func New(pool *FloatingIPPool, ip net.IP, key string, attr *Attr, updateAt time.Time) *FloatingIP {
 	fip := &FloatingIP{IP: ip, pool: pool}
@@ -54,35 +67,48 @@ func New(pool *FloatingIPPool, ip net.IP, key string, attr *Attr, updateAt time.
 
 // Assign updates key, attr, updatedAt of FloatingIP
 func (f *FloatingIP) Assign(key string, attr *Attr, updateAt time.Time) *FloatingIP {
+	// a static ip keeps static until it is allocated to another key
+	f.Static = attr.Static || (f.Static && f.Key == key)
 	f.Key = key
 	f.Policy = uint16(attr.Policy)
 	f.UpdatedAt = updateAt
 	f.NodeName = attr.NodeName
 	f.PodUid = attr.Uid
+	f.BindPhase = attr.BindPhase
 	return f
 }
 
 // CloneWith creates a new FloatingIP and updates key, attr, updatedAt
 func (f *FloatingIP) CloneWith(key string, attr *Attr, updateAt time.Time) *FloatingIP {
 	fip := &FloatingIP{
-		IP:   f.IP,
-		pool: f.pool,
+		Key:             f.Key,
+		IP:              f.IP,
+		Static:          f.Static,
+		pool:            f.pool,
+		resourceVersion: f.resourceVersion,
 	}
 	return fip.Assign(key, attr, updateAt)
 }
 
 // FloatingIPPool is FloatingIPPool structure.
 type FloatingIPPool struct {
+	Name        string       // the optional pool name which pod networks may refer to
 	NodeSubnets []*net.IPNet // the node subnets
+	// NodeSelector selects nodes of the pool by labels instead of node ip
+	NodeSelector *metav1.LabelSelector
 	nets.SparseSubnet
 	sync.RWMutex
-	nodeSubnets sets.String // the node subnets, string set format
-	index       int         // the index of []FloatingIPPool
+	nodeSubnets  sets.String     // the node subnets, string set format
+	nodeSelector labels.Selector // the parsed NodeSelector, nil if NodeSelector is nil
+	index        int             // the index of []FloatingIPPool
 }
 
 // FloatingIPPoolConf is FloatingIP config structure.
 type FloatingIPPoolConf struct {
-	NodeSubnets []*nets.IPNet `json:"nodeSubnets"` // the node subnets
+	Name        string        `json:"name,omitempty"` // the optional pool name
+	NodeSubnets []*nets.IPNet `json:"nodeSubnets"`    // the node subnets
+	// nodes matching the selector belong to the first node subnet regardless of their ips
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
 	// Deprecated, use NodeSubnets instead
 	RoutableSubnet *nets.IPNet `json:"routableSubnet,omitempty"` // the node subnet
 	IPs            []string    `json:"ips"`
@@ -93,10 +119,11 @@ type FloatingIPPoolConf struct {
 
 // MarshalJSON can marshal FloatingIPPoolConf to byte slice.
 func (fip *FloatingIPPool) MarshalJSON() ([]byte, error) {
-	conf := FloatingIPPoolConf{}
+	conf := FloatingIPPoolConf{Name: fip.Name}
 	for i := range fip.NodeSubnets {
 		conf.NodeSubnets = append(conf.NodeSubnets, nets.NetsIPNet(fip.NodeSubnets[i]))
 	}
+	conf.NodeSelector = fip.NodeSelector
 	conf.Subnet = nets.NetsIPNet(fip.IPNet())
 	conf.Gateway = fip.Gateway
 	conf.Vlan = fip.Vlan
@@ -116,6 +143,7 @@ func (fip *FloatingIPPool) UnmarshalJSON(data []byte) error {
 	if conf.RoutableSubnet == nil && len(conf.NodeSubnets) == 0 {
 		return fmt.Errorf("node subnet is empty")
 	}
+	fip.Name = conf.Name
 	fip.NodeSubnets = []*net.IPNet{}
 	if conf.RoutableSubnet != nil {
 		ipNet := conf.RoutableSubnet.ToIPNet()
@@ -131,6 +159,18 @@ func (fip *FloatingIPPool) UnmarshalJSON(data []byte) error {
 			}
 		}
 	}
+	fip.NodeSelector, fip.nodeSelector = nil, nil
+	if conf.NodeSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(conf.NodeSelector)
+		if err != nil {
+			return fmt.Errorf("invalid node selector: %v", err)
+		}
+		if selector.Empty() {
+			return fmt.Errorf("node selector is empty")
+		}
+		fip.NodeSelector = conf.NodeSelector
+		fip.nodeSelector = selector
+	}
 	if conf.Gateway != nil {
 		fip.Gateway = conf.Gateway
 	} else {
@@ -308,8 +348,22 @@ type Attr struct {
 	Uid string
 	// Release policy
 	Policy constant.ReleasePolicy `json:"-"`
+	// BindPhase is the progress of binding the pod to the node, it is empty if the ip is not being bound
+	BindPhase string `json:",omitempty"`
+	// Static is true if the ip is allocated by static ip annotation of the pod. It is kept by later updates of the
+	// same key.
+	Static bool `json:",omitempty"`
 }
 
+const (
+	// BindPhaseAllocated means ips are allocated to the pod being bound to the node
+	BindPhaseAllocated = "Allocated"
+	// BindPhaseAssigned means ips are assigned to the node by cloud provider
+	BindPhaseAssigned = "Assigned"
+	// BindPhaseBound means the pod is bound to the node with ips annotated
+	BindPhaseBound = "Bound"
+)
+
 func (a Attr) String() string {
 	return fmt.Sprintf("Attr{policy:%d nodeName:%s uid:%s}", a.Policy, a.NodeName, a.Uid)
 }
@@ -326,6 +380,8 @@ func (f *FloatingIP) unmarshalAttr(attrStr string) error {
 	} else {
 		f.NodeName = attr.NodeName
 		f.PodUid = attr.Uid
+		f.BindPhase = attr.BindPhase
+		f.Static = attr.Static
 	}
 	return nil
 }
@@ -20,6 +20,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"strings"
 	"testing"
 
 	"tkestack.io/galaxy/pkg/utils/nets"
@@ -91,6 +92,14 @@ func TestUnmarshalFloatingIPPool(t *testing.T) {
 	if fip.IPRanges[1].Last.String() != "10.173.14.208" {
 		t.Fatal()
 	}
+	if fip.NodeSelector != nil || fip.nodeSelector != nil {
+		t.Fatal()
+	}
+	if err := json.Unmarshal([]byte(`{"nodeSubnets":["10.1.0.0/24"],"nodeSelector":{"matchExpressions":`+
+		`[{"key":"rack","operator":"Bad"}]},"ips":["10.0.90.2"],"subnet":"10.0.90.0/24","gateway":"10.0.90.1"}`),
+		&fip); err == nil || !strings.HasPrefix(err.Error(), "invalid node selector") {
+		t.Fatal(err)
+	}
 	if err := json.Unmarshal([]byte(wrongStr), &fip); err == nil ||
 		err.Error() != "ip range 10.173.14.205 and 10.173.14.206~10.173.14.208 can be merge to one or has wrong order" {
 		t.Fatal(err)
@@ -46,11 +46,19 @@ type IPAM interface {
 	// AllocateInSubnetsAndIPRange allocates an ip for each ip range array of the input node subnet.
 	// It guarantees allocating all ips or no ips.
 	AllocateInSubnetsAndIPRange(string, *net.IPNet, [][]nets.IPRange, Attr) ([]net.IP, error)
+	// AllocateInSubnetWithKeys allocates an ip for each key of the input node subnet.
+	// It guarantees allocating all ips or no ips, and fails if any key already has an allocated ip unless it is the
+	// key prefix of a workload, e.g. dp_namespace_deploymentName_, which may hold several ips.
+	AllocateInSubnetWithKeys([]string, *net.IPNet, Attr) ([]net.IP, error)
 	// AllocateInSubnetWithKey allocate a floatingIP in given subnet and key.
 	AllocateInSubnetWithKey(oldK, newK, subnet string, attr Attr) error
 	// ReserveIP can reserve a IP entitled by a terminated pod. Attributes **expect policy attr** will be updated.
 	// Returns true if key or attr updated.
 	ReserveIP(oldK, newK string, attr Attr) (bool, error)
+	// TransferKeys changes keys of all ips allocated to each old key of the input map to its new key and clears
+	// their node name and pod uid. It guarantees transferring all ips or no ips, and fails if any new key already has
+	// an allocated ip. It returns transferred ips and their new keys.
+	TransferKeys(map[string]string) (map[string]string, error)
 	// UpdateAttr update floatingIP's release policy and attrs according to ip and key
 	UpdateAttr(string, net.IP, Attr) error
 	// Release release a given IP.
@@ -70,9 +78,20 @@ type IPAM interface {
 	ByKeyAndIPRanges(string, [][]nets.IPRange) ([]*FloatingIPInfo, error)
 	// NodeSubnets returns node's subnet.
 	NodeSubnet(net.IP) *net.IPNet
+	// NodeSubnetByLabels returns the first node subnet of the first pool whose node selector matches node labels.
+	// It returns nil if no pool selects the node.
+	NodeSubnetByLabels(map[string]string) *net.IPNet
+	// IPRangesByPool returns ip ranges of all pools of the given pool name if name is not empty, otherwise
+	// ip ranges of all pools of the given pod subnet.
+	IPRangesByPool(name, subnet string) []nets.IPRange
+	// Pools returns all configured floating ip pools. The returned pools should not be modified.
+	Pools() []*FloatingIPPool
 	// NodeSubnetsByIPRanges finds an unallocated ip for each []nets.IPRange, and returns their intersection
 	// node subnets.
 	NodeSubnetsByIPRanges(ipranges [][]nets.IPRange) (sets.String, error)
+	// SetLeader sets if it is the leader of replicas sharing crds. Only the leader deletes crds of ips removed from
+	// config.
+	SetLeader(bool)
 	// implements metrics Collector interface
 	prometheus.Collector
 }
@@ -25,10 +25,12 @@ import (
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/client-go/tools/cache"
 	glog "k8s.io/klog"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
 	crd_clientset "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned"
 	crdInformer "tkestack.io/galaxy/pkg/ipam/client/informers/externalversions/galaxy/v1alpha1"
 	"tkestack.io/galaxy/pkg/utils/nets"
@@ -60,20 +62,18 @@ type crdIpam struct {
 	allocatedFIPs   map[string]*FloatingIP
 	unallocatedFIPs map[string]*FloatingIP
 
-	ipCounterDesc *prometheus.Desc
+	// shared is true if crds are shared with other replicas
+	shared bool
+	// leader is true if it is allowed to delete crds of ips removed from config, it is protected by cacheLock
+	leader bool
+
+	ipCounterDesc     *prometheus.Desc
+	poolIPCounterDesc *prometheus.Desc
 }
 
 // NewCrdIPAM init IPAM struct.
 func NewCrdIPAM(fipClient crd_clientset.Interface, ipType Type, informer crdInformer.FloatingIPInformer) IPAM {
-	ipam := &crdIpam{
-		client:          fipClient,
-		ipType:          ipType,
-		cacheLock:       new(sync.RWMutex),
-		allocatedFIPs:   make(map[string]*FloatingIP),
-		unallocatedFIPs: make(map[string]*FloatingIP),
-		ipCounterDesc: prometheus.NewDesc("galaxy_ip_counter", "Galaxy floating ip counter",
-			[]string{"type", "subnet", "first_ip"}, nil),
-	}
+	ipam := newCrdIPAM(fipClient, ipType)
 	// manually creating and fip to reserve it
 	if informer != nil {
 		informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -92,8 +92,58 @@ func NewCrdIPAM(fipClient crd_clientset.Interface, ipType Type, informer crdInfo
 	return ipam
 }
 
+// NewSharedCrdIPAM creates an IPAM which shares FloatingIP crds with IPAMs of other replicas. It applies crd changes
+// of other replicas to its cache by watching crds, and writes crds with resource version checks and retries on
+// conflicts. It doesn't delete crds of ips removed from config until it becomes the leader.
+func NewSharedCrdIPAM(fipClient crd_clientset.Interface, ipType Type,
+	informer crdInformer.FloatingIPInformer) IPAM {
+	ipam := newCrdIPAM(fipClient, ipType)
+	ipam.shared = true
+	ipam.leader = false
+	informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			ipam.handleFIPEvent(obj, false)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			ipam.handleFIPEvent(newObj, false)
+		},
+		DeleteFunc: func(obj interface{}) {
+			ipam.handleFIPEvent(obj, true)
+		},
+	})
+	return ipam
+}
+
+func newCrdIPAM(fipClient crd_clientset.Interface, ipType Type) *crdIpam {
+	return &crdIpam{
+		client:          fipClient,
+		ipType:          ipType,
+		cacheLock:       new(sync.RWMutex),
+		allocatedFIPs:   make(map[string]*FloatingIP),
+		unallocatedFIPs: make(map[string]*FloatingIP),
+		ipCounterDesc: prometheus.NewDesc("galaxy_ip_counter", "Galaxy floating ip counter",
+			[]string{"type", "subnet", "first_ip"}, nil),
+		poolIPCounterDesc: prometheus.NewDesc("galaxy_pool_ip_counter", "Galaxy floating ip counter of pools",
+			[]string{"type", "pool"}, nil),
+		leader: true,
+	}
+}
+
+// SetLeader sets if it is the leader of replicas sharing crds
+func (ci *crdIpam) SetLeader(leader bool) {
+	ci.cacheLock.Lock()
+	defer ci.cacheLock.Unlock()
+	ci.leader = leader
+}
+
 // AllocateSpecificIP allocate pod a specific IP.
 func (ci *crdIpam) AllocateSpecificIP(key string, ip net.IP, attr Attr) error {
+	return ci.retryOnConflict(func() error {
+		return ci.allocateSpecificIP(key, ip, attr)
+	})
+}
+
+func (ci *crdIpam) allocateSpecificIP(key string, ip net.IP, attr Attr) error {
 	ipStr := ip.String()
 	ci.cacheLock.RLock()
 	spec, find := ci.unallocatedFIPs[ipStr]
@@ -114,6 +164,16 @@ func (ci *crdIpam) AllocateSpecificIP(key string, ip net.IP, attr Attr) error {
 
 // AllocateInSubnet allocate subnet of IPs.
 func (ci *crdIpam) AllocateInSubnet(key string, nodeSubnet *net.IPNet, attr Attr) (net.IP, error) {
+	var ip net.IP
+	err := ci.retryOnConflict(func() error {
+		var err error
+		ip, err = ci.allocateInSubnet(key, nodeSubnet, attr)
+		return err
+	})
+	return ip, err
+}
+
+func (ci *crdIpam) allocateInSubnet(key string, nodeSubnet *net.IPNet, attr Attr) (net.IP, error) {
 	if nodeSubnet == nil {
 		// this should never happen
 		return nil, fmt.Errorf("nil nodeSubnet")
@@ -145,6 +205,12 @@ func (ci *crdIpam) AllocateInSubnet(key string, nodeSubnet *net.IPNet, attr Attr
 
 // AllocateInSubnetWithKey allocate a floatingIP in given subnet and key.
 func (ci *crdIpam) AllocateInSubnetWithKey(oldK, newK, subnet string, attr Attr) error {
+	return ci.retryOnConflict(func() error {
+		return ci.allocateInSubnetWithKey(oldK, newK, subnet, attr)
+	})
+}
+
+func (ci *crdIpam) allocateInSubnetWithKey(oldK, newK, subnet string, attr Attr) error {
 	ci.cacheLock.Lock()
 	defer ci.cacheLock.Unlock()
 	var (
@@ -170,35 +236,112 @@ func (ci *crdIpam) AllocateInSubnetWithKey(oldK, newK, subnet string, attr Attr)
 		return err
 	}
 	latest.Assign(newK, &attr, date)
+	latest.resourceVersion = cloned.resourceVersion
 	return nil
 }
 
 // ReserveIP can reserve a IP entitled by a terminated pod.
 func (ci *crdIpam) ReserveIP(oldK, newK string, attr Attr) (bool, error) {
+	var reserved bool
+	err := ci.retryOnConflict(func() error {
+		return ci.reserveIP(oldK, newK, attr, &reserved)
+	})
+	if err != nil {
+		return false, err
+	}
+	return reserved, nil
+}
+
+// reserveIP sets reserved to true if any ip is updated
+func (ci *crdIpam) reserveIP(oldK, newK string, attr Attr, reserved *bool) error {
 	ci.cacheLock.Lock()
 	defer ci.cacheLock.Unlock()
 	date := time.Now()
-	var reserved bool
 	for k, v := range ci.allocatedFIPs {
 		if v.Key == oldK {
-			if oldK == newK && v.PodUid == attr.Uid && v.NodeName == attr.NodeName {
+			if oldK == newK && v.PodUid == attr.Uid && v.NodeName == attr.NodeName && v.BindPhase == attr.BindPhase {
 				// nothing changed
 				continue
 			}
 			attr.Policy = constant.ReleasePolicy(v.Policy)
-			if err := ci.updateFloatingIP(v.CloneWith(newK, &attr, date)); err != nil {
+			cloned := v.CloneWith(newK, &attr, date)
+			if err := ci.updateFloatingIP(cloned); err != nil {
 				glog.Errorf("failed to update floatingIP %s: %v", k, err)
-				return false, err
+				return err
 			}
 			v.Assign(newK, &attr, date)
-			reserved = true
+			v.resourceVersion = cloned.resourceVersion
+			*reserved = true
 		}
 	}
-	return reserved, nil
+	return nil
+}
+
+func (ci *crdIpam) TransferKeys(keys map[string]string) (map[string]string, error) {
+	var transferred map[string]string
+	err := ci.retryOnConflict(func() error {
+		var err error
+		transferred, err = ci.transferKeys(keys)
+		return err
+	})
+	return transferred, err
+}
+
+func (ci *crdIpam) transferKeys(keys map[string]string) (map[string]string, error) {
+	ci.cacheLock.Lock()
+	defer ci.cacheLock.Unlock()
+	var toTransfer []*FloatingIP
+	for ipStr, v := range ci.allocatedFIPs {
+		if _, ok := keys[v.Key]; ok {
+			toTransfer = append(toTransfer, v)
+		}
+		for oldK, newK := range keys {
+			if v.Key == newK && oldK != newK {
+				return nil, fmt.Errorf("%s has already been allocated to %s", ipStr, newK)
+			}
+		}
+	}
+	date := time.Now()
+	var updated []*FloatingIP
+	for _, v := range toTransfer {
+		cloned := v.CloneWith(keys[v.Key], &Attr{Policy: constant.ReleasePolicy(v.Policy)}, date)
+		if err := ci.updateFloatingIP(cloned); err != nil {
+			glog.Errorf("failed to update floatingIP %s: %v", v.IP.String(), err)
+			// rollback all transferred ips
+			for i := range updated {
+				origin := toTransfer[i]
+				rollback := origin.CloneWith(origin.Key, &Attr{Policy: constant.ReleasePolicy(origin.Policy),
+					NodeName: origin.NodeName, Uid: origin.PodUid, BindPhase: origin.BindPhase}, origin.UpdatedAt)
+				rollback.resourceVersion = updated[i].resourceVersion
+				if err := ci.updateFloatingIP(rollback); err != nil {
+					glog.Errorf("failed to rollback floatingIP %s: %v", updated[i].IP.String(), err)
+				} else {
+					origin.resourceVersion = rollback.resourceVersion
+				}
+			}
+			return nil, err
+		}
+		updated = append(updated, cloned)
+	}
+	// sync cache when crds updated
+	transferred := map[string]string{}
+	for i, v := range toTransfer {
+		newK := keys[v.Key]
+		v.Assign(newK, &Attr{Policy: constant.ReleasePolicy(v.Policy)}, date)
+		v.resourceVersion = updated[i].resourceVersion
+		transferred[v.IP.String()] = newK
+	}
+	return transferred, nil
 }
 
 // UpdateAttr update floatingIP's release policy and attr according to ip and key
 func (ci *crdIpam) UpdateAttr(key string, ip net.IP, attr Attr) error {
+	return ci.retryOnConflict(func() error {
+		return ci.updateAttr(key, ip, attr)
+	})
+}
+
+func (ci *crdIpam) updateAttr(key string, ip net.IP, attr Attr) error {
 	ipStr := ip.String()
 	ci.cacheLock.Lock()
 	defer ci.cacheLock.Unlock()
@@ -210,16 +353,24 @@ func (ci *crdIpam) UpdateAttr(key string, ip net.IP, attr Attr) error {
 		return fmt.Errorf("key for %s is %s, not %s", ipStr, v.Key, key)
 	}
 	date := time.Now()
-	if err := ci.updateFloatingIP(v.CloneWith(v.Key, &attr, date)); err != nil {
+	cloned := v.CloneWith(v.Key, &attr, date)
+	if err := ci.updateFloatingIP(cloned); err != nil {
 		glog.Errorf("failed to update floatingIP %s: %v", ipStr, err)
 		return err
 	}
 	v.Assign(v.Key, &attr, date)
+	v.resourceVersion = cloned.resourceVersion
 	return nil
 }
 
 // Release release a given IP.
 func (ci *crdIpam) Release(key string, ip net.IP) error {
+	return ci.retryOnConflict(func() error {
+		return ci.release(key, ip)
+	})
+}
+
+func (ci *crdIpam) release(key string, ip net.IP) error {
 	ipStr := ip.String()
 	ci.cacheLock.Lock()
 	defer ci.cacheLock.Unlock()
@@ -230,7 +381,7 @@ func (ci *crdIpam) Release(key string, ip net.IP) error {
 	if v.Key != key {
 		return fmt.Errorf("key for %s is %s, not %s", ipStr, v.Key, key)
 	}
-	if err := ci.deleteFloatingIP(ipStr); err != nil {
+	if err := ci.deleteFloatingIP(ipStr, v.resourceVersion); err != nil {
 		return err
 	}
 	ci.syncCacheAfterDel(v)
@@ -296,6 +447,40 @@ func (ci *crdIpam) NodeSubnet(nodeIP net.IP) *net.IPNet {
 	return nil
 }
 
+func (ci *crdIpam) NodeSubnetByLabels(nodeLabels map[string]string) *net.IPNet {
+	ci.cacheLock.RLock()
+	defer ci.cacheLock.RUnlock()
+	for j := range ci.FloatingIPs {
+		pool := ci.FloatingIPs[j]
+		if pool.nodeSelector != nil && len(pool.NodeSubnets) > 0 && pool.nodeSelector.Matches(labels.Set(nodeLabels)) {
+			return pool.NodeSubnets[0]
+		}
+	}
+	return nil
+}
+
+func (ci *crdIpam) IPRangesByPool(name, subnet string) []nets.IPRange {
+	ci.cacheLock.RLock()
+	defer ci.cacheLock.RUnlock()
+	var ipranges []nets.IPRange
+	for _, pool := range ci.FloatingIPs {
+		if (name != "" && pool.Name == name) || (name == "" && pool.IPNet().String() == subnet) {
+			pool.RLock()
+			ipranges = append(ipranges, pool.IPRanges...)
+			pool.RUnlock()
+		}
+	}
+	return ipranges
+}
+
+func (ci *crdIpam) Pools() []*FloatingIPPool {
+	ci.cacheLock.RLock()
+	defer ci.cacheLock.RUnlock()
+	pools := make([]*FloatingIPPool, len(ci.FloatingIPs))
+	copy(pools, ci.FloatingIPs)
+	return pools
+}
+
 func (ci *crdIpam) NodeSubnetsByIPRanges(ipranges [][]nets.IPRange) (sets.String, error) {
 	subnetSet := sets.NewString()
 	insertSubnet := func(poolIndexSet sets.Int, subnetSet sets.String) {
@@ -372,10 +557,11 @@ func (ci *crdIpam) ConfigurePool(floatIPs []*FloatingIPPool) error {
 		fipConf.nodeSubnets = subnetSet
 		fipConf.index = index
 	}
-	var deletingIPs []string
+	var deletingIPs []*v1alpha1.FloatingIP
 	tmpCacheAllocated := make(map[string]*FloatingIP)
 	//delete no longer available floating ips stored in etcd first
-	for _, ip := range ips.Items {
+	for i := range ips.Items {
+		ip := &ips.Items[i]
 		netIP := net.ParseIP(ip.Name)
 		found := false
 		for _, fipConf := range floatIPs {
@@ -386,12 +572,13 @@ func (ci *crdIpam) ConfigurePool(floatIPs []*FloatingIPPool) error {
 				if err := tmpFip.unmarshalAttr(ip.Spec.Attribute); err != nil {
 					glog.Error(err)
 				}
+				tmpFip.resourceVersion = ip.ResourceVersion
 				tmpCacheAllocated[ip.Name] = tmpFip
 				break
 			}
 		}
 		if !found {
-			deletingIPs = append(deletingIPs, ip.Name)
+			deletingIPs = append(deletingIPs, ip)
 		}
 	}
 	ci.cacheLock.Lock()
@@ -399,14 +586,23 @@ func (ci *crdIpam) ConfigurePool(floatIPs []*FloatingIPPool) error {
 	ci.FloatingIPs = floatIPs
 	ci.allocatedFIPs = tmpCacheAllocated
 	if len(deletingIPs) > 0 {
+		var deletingIPStrs []string
 		for _, ip := range deletingIPs {
-			if err := ci.deleteFloatingIP(ip); err != nil {
-				//if a FloatingIP crd in etcd can't be deleted, every freshCache will produce an error
-				//it won't return error when error happens in deletion
-				glog.Errorf("failed to delete ip %v: %v", ip, err)
+			deletingIPStrs = append(deletingIPStrs, ip.Name)
+		}
+		if ci.leader {
+			for _, ip := range deletingIPs {
+				if err := ci.deleteFloatingIP(ip.Name, ip.ResourceVersion); err != nil {
+					//if a FloatingIP crd in etcd can't be deleted, every freshCache will produce an error
+					//it won't return error when error happens in deletion
+					glog.Errorf("failed to delete ip %v: %v", ip.Name, err)
+				}
 			}
+			glog.Infof("expect to delete %d ips from %v", len(deletingIPs), deletingIPStrs)
+		} else {
+			// leave them to the leader which may have a newer config
+			glog.Infof("%d ips not in config %v, leave them to the leader", len(deletingIPs), deletingIPStrs)
 		}
-		glog.Infof("expect to delete %d ips from %v", len(deletingIPs), deletingIPs)
 	}
 	now := time.Now()
 	// fresh unallocated floatIP
@@ -416,6 +612,8 @@ func (ci *crdIpam) ConfigurePool(floatIPs []*FloatingIPPool) error {
 			ipStr := ip.String()
 			if _, contain := ci.allocatedFIPs[ipStr]; !contain {
 				tmpFip := New(fipConf, ip, "", &Attr{Policy: constant.ReleasePolicyPodDelete}, now)
+				// ignore events of crds deleted before listing
+				tmpFip.resourceVersion = ips.ResourceVersion
 				tmpCacheUnallocated[ipStr] = tmpFip
 			}
 			return false
@@ -462,51 +660,83 @@ func (ci *crdIpam) ByKeyword(keyword string) ([]FloatingIP, error) {
 // ReleaseIPs function release a map of ip to key
 func (ci *crdIpam) ReleaseIPs(ipToKey map[string]string) (map[string]string, map[string]string, error) {
 	deleted, undeleted := map[string]string{}, map[string]string{}
-	ci.cacheLock.Lock()
-	defer ci.cacheLock.Unlock()
 	for ipStr, key := range ipToKey {
 		undeleted[ipStr] = key
 	}
-	if len(ci.allocatedFIPs) == 0 {
+	ci.cacheLock.RLock()
+	noAllocated := len(ci.allocatedFIPs) == 0
+	ci.cacheLock.RUnlock()
+	if noAllocated {
 		return deleted, undeleted, nil
 	}
 	for ipStr, key := range ipToKey {
-		if v, find := ci.allocatedFIPs[ipStr]; find {
-			if v.Key == key {
-				if err := ci.deleteFloatingIP(ipStr); err != nil {
-					glog.Errorf("failed to delete %v", ipStr)
-					return deleted, undeleted, fmt.Errorf("failed to delete %v", ipStr)
+		if err := ci.retryOnConflict(func() error {
+			return ci.releaseIP(ipStr, key, deleted, undeleted)
+		}); err != nil {
+			return deleted, undeleted, err
+		}
+	}
+	return deleted, undeleted, nil
+}
+
+// releaseIP releases ip if its key matches and records the result into deleted and undeleted map
+func (ci *crdIpam) releaseIP(ipStr, key string, deleted, undeleted map[string]string) error {
+	ci.cacheLock.Lock()
+	defer ci.cacheLock.Unlock()
+	if v, find := ci.allocatedFIPs[ipStr]; find {
+		if v.Key == key {
+			if err := ci.deleteFloatingIP(ipStr, v.resourceVersion); err != nil {
+				glog.Errorf("failed to delete %v: %v", ipStr, err)
+				if _, ok := err.(*conflictError); ok {
+					return err
 				}
-				ci.syncCacheAfterDel(v)
-				glog.Infof("%v has been deleted", ipStr)
-				deleted[ipStr] = key
-				delete(undeleted, ipStr)
-			} else {
-				// update key
-				undeleted[ipStr] = v.Key
+				return fmt.Errorf("failed to delete %v", ipStr)
 			}
-		} else if _, find := ci.unallocatedFIPs[ipStr]; find {
-			undeleted[ipStr] = ""
+			ci.syncCacheAfterDel(v)
+			glog.Infof("%v has been deleted", ipStr)
+			deleted[ipStr] = key
+			delete(undeleted, ipStr)
+		} else {
+			// update key
+			undeleted[ipStr] = v.Key
 		}
+	} else if _, find := ci.unallocatedFIPs[ipStr]; find {
+		undeleted[ipStr] = ""
 	}
-	return deleted, undeleted, nil
+	return nil
 }
 
 // Describe sends metrics description to ch
 func (ci *crdIpam) Describe(ch chan<- *prometheus.Desc) {
 	ch <- ci.ipCounterDesc
+	ch <- ci.poolIPCounterDesc
 }
 
-// Collect sends metrics to ch
+// Collect sends metrics to ch. Reserved ips are allocated ips not used by any pod, including manually reserved ips
+// and ips retained for deployments, pools and statefulsets. Free ips of a pool are ips held by the pool itself which
+// can be used by any pod of the pool.
 func (ci *crdIpam) Collect(ch chan<- prometheus.Metric) {
-	allocated, unallocated := map[string]*FloatingIP{}, map[string]*FloatingIP{}
+	type ipState struct {
+		ip       net.IP
+		reserved bool
+	}
+	var allocated []ipState
+	poolAllocated, poolReserved, poolFree := map[string]float64{}, map[string]float64{}, map[string]float64{}
 	ci.cacheLock.RLock()
 	pools := make([]*FloatingIPPool, len(ci.FloatingIPs))
-	for ipStr, fip := range ci.allocatedFIPs {
-		allocated[ipStr] = fip
-	}
-	for ipStr, fip := range ci.unallocatedFIPs {
-		unallocated[ipStr] = fip
+	for _, fip := range ci.allocatedFIPs {
+		_, manual := fip.Labels[constant.ReserveFIPLabel]
+		state := ipState{ip: fip.IP, reserved: manual || fip.PodUid == ""}
+		allocated = append(allocated, state)
+		if poolName := constant.ParsePoolName(fip.Key); poolName != "" {
+			poolAllocated[poolName]++
+			if state.reserved {
+				poolReserved[poolName]++
+			}
+			if fip.Key == constant.PoolKey(poolName) {
+				poolFree[poolName]++
+			}
+		}
 	}
 	for i := range ci.FloatingIPs {
 		pools[i] = ci.FloatingIPs[i]
@@ -515,22 +745,41 @@ func (ci *crdIpam) Collect(ch chan<- prometheus.Metric) {
 	for _, pool := range pools {
 		subnetStr := pool.IPNet().String()
 		var firstIP string
-		var allocatedNum float64
+		var allocatedNum, reservedNum float64
 		for _, ipr := range pool.IPRanges {
 			firstIP = ipr.First.String()
 			break
 		}
-		for _, fip := range allocated {
-			if !pool.Contains(fip.IP) {
+		for _, state := range allocated {
+			if !pool.Contains(state.ip) {
 				continue
 			}
 			allocatedNum += 1
+			if state.reserved {
+				reservedNum += 1
+			}
 		}
 		// since subnetStr may be the same for different pools, add a first ip tag
-		ch <- prometheus.MustNewConstMetric(ci.ipCounterDesc, prometheus.GaugeValue, allocatedNum,
-			"allocated", subnetStr, firstIP)
-		ch <- prometheus.MustNewConstMetric(ci.ipCounterDesc, prometheus.GaugeValue, float64(pool.Size()),
-			"total", subnetStr, firstIP)
+		for _, m := range []struct {
+			typ   string
+			value float64
+		}{
+			{"allocated", allocatedNum},
+			{"reserved", reservedNum},
+			{"free", float64(pool.Size()) - allocatedNum},
+			{"total", float64(pool.Size())},
+		} {
+			ch <- prometheus.MustNewConstMetric(ci.ipCounterDesc, prometheus.GaugeValue, m.value, m.typ,
+				subnetStr, firstIP)
+		}
+	}
+	for poolName, num := range poolAllocated {
+		ch <- prometheus.MustNewConstMetric(ci.poolIPCounterDesc, prometheus.GaugeValue, num, "allocated",
+			poolName)
+		ch <- prometheus.MustNewConstMetric(ci.poolIPCounterDesc, prometheus.GaugeValue, poolReserved[poolName],
+			"reserved", poolName)
+		ch <- prometheus.MustNewConstMetric(ci.poolIPCounterDesc, prometheus.GaugeValue, poolFree[poolName],
+			"free", poolName)
 	}
 }
 
@@ -543,8 +792,19 @@ func (ci *crdIpam) AllocateInSubnetsAndIPRange(key string, nodeSubnet *net.IPNet
 		// this should never happen
 		return nil, fmt.Errorf("nil nodeSubnet")
 	}
+	var ips []net.IP
+	err := ci.retryOnConflict(func() error {
+		var err error
+		ips, err = ci.allocateInSubnetsAndIPRange(key, nodeSubnet, ipranges, attr)
+		return err
+	})
+	return ips, err
+}
+
+func (ci *crdIpam) allocateInSubnetsAndIPRange(key string, nodeSubnet *net.IPNet, ipranges [][]nets.IPRange,
+	attr Attr) ([]net.IP, error) {
 	if len(ipranges) == 0 {
-		ip, err := ci.AllocateInSubnet(key, nodeSubnet, attr)
+		ip, err := ci.allocateInSubnet(key, nodeSubnet, attr)
 		if err != nil {
 			return nil, err
 		}
@@ -575,22 +835,86 @@ func (ci *crdIpam) AllocateInSubnetsAndIPRange(key string, nodeSubnet *net.IPNet
 			return nil, ErrNoEnoughIP
 		}
 	}
+	keys := make([]string, len(allocatedIPStrs))
+	for i := range keys {
+		keys[i] = key
+	}
+	return ci.allocateAll(keys, allocatedIPStrs, attr)
+}
+
+// AllocateInSubnetWithKeys allocates an ip for each key of the input node subnet.
+// It guarantees allocating all ips or no ips, and fails if any key already has an allocated ip unless it is the
+// key prefix of a workload, e.g. dp_namespace_deploymentName_, which may hold several ips.
+func (ci *crdIpam) AllocateInSubnetWithKeys(keys []string, nodeSubnet *net.IPNet, attr Attr) ([]net.IP, error) {
+	if nodeSubnet == nil {
+		// this should never happen
+		return nil, fmt.Errorf("nil nodeSubnet")
+	}
+	var ips []net.IP
+	err := ci.retryOnConflict(func() error {
+		var err error
+		ips, err = ci.allocateInSubnetWithKeys(keys, nodeSubnet, attr)
+		return err
+	})
+	return ips, err
+}
+
+func (ci *crdIpam) allocateInSubnetWithKeys(keys []string, nodeSubnet *net.IPNet, attr Attr) ([]net.IP, error) {
+	ci.cacheLock.Lock()
+	defer ci.cacheLock.Unlock()
+	keySet := sets.NewString()
+	for _, k := range keys {
+		if !constant.IsPrefixKey(k) {
+			keySet.Insert(k)
+		}
+	}
+	for ipStr, fip := range ci.allocatedFIPs {
+		if keySet.Has(fip.Key) {
+			return nil, fmt.Errorf("%s already has an allocated ip %s", fip.Key, ipStr)
+		}
+	}
+	nodeSubnetStr := nodeSubnet.String()
+	var candidates []net.IP
+	for _, fip := range ci.unallocatedFIPs {
+		if fip.pool.nodeSubnets.Has(nodeSubnetStr) {
+			candidates = append(candidates, fip.IP)
+		}
+	}
+	if len(candidates) < len(keys) {
+		glog.V(3).Infof("no enough ips to allocate for %d keys in node subnet %s, %d left", len(keys),
+			nodeSubnetStr, len(candidates))
+		return nil, ErrNoEnoughIP
+	}
+	// hand out the lowest ips in order so that keys sorted by pod index get increasing ips
+	sort.Slice(candidates, func(i, j int) bool {
+		return nets.IPToInt(candidates[i]) < nets.IPToInt(candidates[j])
+	})
+	allocatedIPStrs := make([]string, len(keys))
+	for i := range keys {
+		allocatedIPStrs[i] = candidates[i].String()
+	}
+	return ci.allocateAll(keys, allocatedIPStrs, attr)
+}
+
+// allocateAll creates a FloatingIP crd for each ip with the key of the same index, and rolls back all created
+// crds if any creation fails. Make sure cacheLock is held when calling it.
+func (ci *crdIpam) allocateAll(keys, ipStrs []string, attr Attr) ([]net.IP, error) {
 	var allocatedIPs []net.IP
 	var allocatedFips []*FloatingIP
 	// allocate all ips in crd before sync cache in memory
-	for i, allocatedIPStr := range allocatedIPStrs {
+	for i, allocatedIPStr := range ipStrs {
 		v := ci.unallocatedFIPs[allocatedIPStr]
 		// we never updates ip or subnet object, it's ok to share these objs.
-		allocated := New(v.pool, v.IP, key, &attr, time.Now())
+		allocated := New(v.pool, v.IP, keys[i], &attr, time.Now())
 		if err := ci.createFloatingIP(allocated); err != nil {
 			glog.Errorf("failed to create floatingIP %s: %v", allocatedIPStr, err)
 			// rollback all allocated ips
-			for j := range allocatedIPStrs {
+			for j := range ipStrs {
 				if j == i {
 					break
 				}
-				if err := ci.deleteFloatingIP(allocatedIPStrs[j]); err != nil {
-					glog.Errorf("failed to delete floatingIP %s: %v", allocatedIPStrs[j], err)
+				if err := ci.deleteFloatingIP(ipStrs[j], allocatedFips[j].resourceVersion); err != nil {
+					glog.Errorf("failed to delete floatingIP %s: %v", ipStrs[j], err)
 				}
 			}
 			return nil, err
@@ -21,9 +21,11 @@ import (
 	"fmt"
 	"net"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -215,6 +217,40 @@ func TestReserveIP(t *testing.T) {
 	}
 }
 
+func TestTransferKeys(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	attr := Attr{Policy: constant.ReleasePolicyNever, NodeName: "node1", Uid: "xx1"}
+	for ip, key := range map[string]string{"10.49.27.205": "pod1", "10.49.27.216": "pod2", "10.49.27.217": "pod3"} {
+		if err := ipam.AllocateSpecificIP(key, net.ParseIP(ip), attr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// pod3 has already been allocated an ip, nothing should be transferred
+	if _, err := ipam.TransferKeys(map[string]string{"pod1": "p1", "pod2": "pod3"}); err == nil {
+		t.Fatal("expect an error")
+	}
+	if err := checkIPKeyAttr(ipam, "10.49.27.205", "pod1", &attr); err != nil {
+		t.Fatal(err)
+	}
+	transferred, err := ipam.TransferKeys(map[string]string{"pod1": "p1", "pod2": "p2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(transferred, map[string]string{"10.49.27.205": "p1", "10.49.27.216": "p2"}) {
+		t.Fatalf("unexpected transferred ips %v", transferred)
+	}
+	// node name and pod uid are cleared while policy is kept
+	for ip, key := range map[string]string{"10.49.27.205": "p1", "10.49.27.216": "p2", "10.49.27.217": "pod3"} {
+		expectAttr := &Attr{Policy: constant.ReleasePolicyNever}
+		if key == "pod3" {
+			expectAttr = &attr
+		}
+		if err := checkIPKeyAttr(ipam, ip, key, expectAttr); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestRelease(t *testing.T) {
 	ipam := createTestCrdIPAM(t)
 	testRelease(t, ipam)
@@ -486,6 +522,37 @@ func TestNodeSubnet(t *testing.T) {
 	}
 }
 
+func TestNodeSubnetByLabels(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	var rackPool FloatingIPPool
+	if err := json.Unmarshal([]byte(`{"nodeSubnets":["10.1.0.0/24"],"nodeSelector":{"matchLabels":`+
+		`{"rack":"r1"}},"ips":["10.0.90.2~10.0.90.3"],"subnet":"10.0.90.0/24","gateway":"10.0.90.1"}`),
+		&rackPool); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam.ConfigurePool(append(ipam.FloatingIPs, &rackPool)); err != nil {
+		t.Fatal(err)
+	}
+	if subnet := ipam.NodeSubnetByLabels(map[string]string{"rack": "r1", "zone": "z1"}); subnet == nil ||
+		subnet.String() != "10.1.0.0/24" {
+		t.Fatalf("expect node subnet 10.1.0.0/24, got %v", subnet)
+	}
+	for _, nodeLabels := range []map[string]string{nil, {"rack": "r2"}} {
+		if subnet := ipam.NodeSubnetByLabels(nodeLabels); subnet != nil {
+			t.Fatalf("expect nil node subnet for labels %v, got %v", nodeLabels, subnet)
+		}
+	}
+	// node selected by labels is able to allocate ips of the pool regardless of its ip
+	ip, err := ipam.AllocateInSubnet("pod1", ipam.NodeSubnetByLabels(map[string]string{"rack": "r1"}),
+		Attr{Policy: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ip.Mask(mask24).String() != "10.0.90.0" {
+		t.Fatalf("expect ip of 10.0.90.0/24, got %v", ip)
+	}
+}
+
 func TestAllocateInMultipleSubnet(t *testing.T) {
 	ipam := createTestCrdIPAM(t)
 	nodeSubnets := sets.NewString()
@@ -686,3 +753,79 @@ func TestNodeSubnetsByKeyAndIPRanges(t *testing.T) {
 		}
 	}
 }
+
+func TestAllocateInSubnetWithKeys(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	// node1IPNet has 4 ips, check if AllocateInSubnetWithKeys allocates all ips or nothing
+	ips, err := ipam.AllocateInSubnetWithKeys([]string{"p0", "p1", "p2", "p3", "p4"}, node1IPNet, Attr{})
+	if err != ErrNoEnoughIP || len(ips) != 0 {
+		t.Fatalf("%v, %v", ips, err)
+	}
+	if len(ipam.allocatedFIPs) != 0 {
+		t.Fatal(ipam.allocatedFIPs)
+	}
+	ips, err = ipam.AllocateInSubnetWithKeys([]string{"p0", "p1", "p2"}, node1IPNet,
+		Attr{Policy: constant.ReleasePolicyImmutable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expect := range []string{"10.49.27.205", "10.49.27.216", "10.49.27.217"} {
+		if ips[i].String() != expect {
+			t.Fatalf("expect %s, got %v", expect, ips)
+		}
+		if err := checkIPKeyAttr(ipam, expect, fmt.Sprintf("p%d", i),
+			&Attr{Policy: constant.ReleasePolicyImmutable}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// keys which already have allocated ips are not allowed
+	if _, err := ipam.AllocateInSubnetWithKeys([]string{"p2"}, node1IPNet, Attr{}); err == nil {
+		t.Fatal("expect an error for key p2 which already has an allocated ip")
+	}
+}
+
+func TestCollect(t *testing.T) {
+	ipam := createTestCrdIPAM(t)
+	for ip, key := range map[string]string{
+		"10.49.27.205": "pod1",
+		"10.49.27.216": "pool__pool1_",
+		"10.49.27.217": "pool__pool1_dp_ns1_app_app-1",
+	} {
+		attr := Attr{Policy: policy, NodeName: "node1", Uid: "uid-" + ip}
+		if key == "pool__pool1_" {
+			attr = Attr{Policy: policy}
+		}
+		if err := ipam.AllocateSpecificIP(key, net.ParseIP(ip), attr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(ipam)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]float64{}
+	for _, family := range families {
+		for _, m := range family.Metric {
+			var labels []string
+			for _, label := range m.Label {
+				labels = append(labels, label.GetName()+"="+label.GetValue())
+			}
+			values[family.GetName()+"{"+strings.Join(labels, ",")+"}"] = m.GetGauge().GetValue()
+		}
+	}
+	for name, expect := range map[string]float64{
+		"galaxy_ip_counter{first_ip=10.49.27.205,subnet=10.49.27.0/24,type=allocated}": 3,
+		"galaxy_ip_counter{first_ip=10.49.27.205,subnet=10.49.27.0/24,type=reserved}":  1,
+		"galaxy_ip_counter{first_ip=10.49.27.205,subnet=10.49.27.0/24,type=free}":      1,
+		"galaxy_ip_counter{first_ip=10.49.27.205,subnet=10.49.27.0/24,type=total}":     4,
+		"galaxy_pool_ip_counter{pool=pool1,type=allocated}":                            2,
+		"galaxy_pool_ip_counter{pool=pool1,type=reserved}":                             1,
+		"galaxy_pool_ip_counter{pool=pool1,type=free}":                                 1,
+	} {
+		if value, ok := values[name]; !ok || value != expect {
+			t.Errorf("expect %s %v, real %v (exists %v)", name, expect, value, ok)
+		}
+	}
+}
@@ -18,13 +18,17 @@ package floatingip
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
 	glog "k8s.io/klog"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
 )
 
 func (ci *crdIpam) listFloatingIPs() (*v1alpha1.FloatingIPList, error) {
@@ -48,36 +52,75 @@ func (ci *crdIpam) createFloatingIP(allocated *FloatingIP) error {
 	if err := assign(fip, allocated); err != nil {
 		return err
 	}
-	if _, err := ci.client.GalaxyV1alpha1().FloatingIPs().Create(fip); err != nil {
-		return err
+	start := time.Now()
+	created, err := ci.client.GalaxyV1alpha1().FloatingIPs().Create(fip)
+	observeWrite("create", start, err)
+	if err != nil {
+		return ci.wrapConflict(fip.Name, err)
 	}
+	allocated.resourceVersion = created.ResourceVersion
 	return nil
 }
 
-func (ci *crdIpam) deleteFloatingIP(name string) error {
+// deleteFloatingIP deletes the crd of the given name. If ipam is shared with other replicas, it deletes the crd only
+// if its resource version is still the given one.
+func (ci *crdIpam) deleteFloatingIP(name, resourceVersion string) error {
 	glog.V(4).Infof("delete floatingIP name %s", name)
-	return ci.client.GalaxyV1alpha1().FloatingIPs().Delete(name, &metav1.DeleteOptions{})
+	opts := &metav1.DeleteOptions{}
+	if ci.shared && resourceVersion != "" {
+		opts.Preconditions = &metav1.Preconditions{ResourceVersion: &resourceVersion}
+	}
+	start := time.Now()
+	err := ci.client.GalaxyV1alpha1().FloatingIPs().Delete(name, opts)
+	observeWrite("delete", start, err)
+	return ci.wrapConflict(name, err)
 }
 
+// updateFloatingIP updates the crd of toUpdate. If ipam is shared with other replicas, it fails with a conflict
+// error if the crd has been changed since toUpdate was cached.
 func (ci *crdIpam) updateFloatingIP(toUpdate *FloatingIP) error {
 	glog.V(4).Infof("update floatingIP %v", *toUpdate)
-	fip, err := ci.client.GalaxyV1alpha1().FloatingIPs().Get(toUpdate.IP.String(), metav1.GetOptions{})
+	name := toUpdate.IP.String()
+	fip, err := ci.client.GalaxyV1alpha1().FloatingIPs().Get(name, metav1.GetOptions{})
 	if err != nil {
-		return err
+		return ci.wrapConflict(name, err)
+	}
+	if ci.shared && toUpdate.resourceVersion != "" && fip.ResourceVersion != toUpdate.resourceVersion {
+		return &conflictError{ip: name, err: fmt.Errorf("floatingip %s has been changed from resource version %s "+
+			"to %s", name, toUpdate.resourceVersion, fip.ResourceVersion)}
 	}
 	if err := assign(fip, toUpdate); err != nil {
 		return err
 	}
-	_, err = ci.client.GalaxyV1alpha1().FloatingIPs().Update(fip)
-	return err
+	start := time.Now()
+	updated, err := ci.client.GalaxyV1alpha1().FloatingIPs().Update(fip)
+	observeWrite("update", start, err)
+	if err != nil {
+		return ci.wrapConflict(name, err)
+	}
+	toUpdate.resourceVersion = updated.ResourceVersion
+	return nil
+}
+
+// observeWrite records the latency of writing a FloatingIP CRD
+func observeWrite(verb string, start time.Time, err error) {
+	result := "success"
+	if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) {
+		result = "conflict"
+	} else if err != nil {
+		result = "failure"
+	}
+	metrics.FloatingIPWriteLatency.WithLabelValues(verb, result).Observe(time.Since(start).Seconds())
 }
 
 func assign(spec *v1alpha1.FloatingIP, f *FloatingIP) error {
 	spec.Spec.Key = f.Key
 	spec.Spec.Policy = constant.ReleasePolicy(f.Policy)
 	data, err := json.Marshal(Attr{
-		NodeName: f.NodeName,
-		Uid:      f.PodUid,
+		NodeName:  f.NodeName,
+		Uid:       f.PodUid,
+		BindPhase: f.BindPhase,
+		Static:    f.Static,
 	})
 	if err != nil {
 		return err
@@ -145,6 +188,126 @@ func checkForReserved(obj interface{}) (*v1alpha1.FloatingIP, error) {
 	return fip, nil
 }
 
+// maxConflictRetries is the max times of retrying an operation failed by conflicts with other replicas
+const maxConflictRetries = 5
+
+// conflictError means the cache of ip is out of date because other replicas have changed its crd
+type conflictError struct {
+	ip  string
+	err error
+}
+
+func (e *conflictError) Error() string {
+	return e.err.Error()
+}
+
+func (e *conflictError) Unwrap() error {
+	return e.err
+}
+
+// wrapConflict wraps errors caused by writing crds changed by other replicas as conflictError
+func (ci *crdIpam) wrapConflict(name string, err error) error {
+	if err == nil || !ci.shared {
+		return err
+	}
+	if apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err) || apierrors.IsNotFound(err) {
+		return &conflictError{ip: name, err: err}
+	}
+	return err
+}
+
+// retryOnConflict calls f and retries it after refreshing the cache of the conflicting ip if it fails because of
+// conflicts with other replicas. Make sure cacheLock is not held when calling it.
+func (ci *crdIpam) retryOnConflict(f func() error) error {
+	var err error
+	for i := 0; i < maxConflictRetries; i++ {
+		if err = f(); err == nil {
+			return nil
+		}
+		var conflict *conflictError
+		if !errors.As(err, &conflict) {
+			return err
+		}
+		glog.V(3).Infof("conflict on floatingip %s, refreshing and retrying: %v", conflict.ip, err)
+		if err := ci.refresh(conflict.ip); err != nil {
+			return fmt.Errorf("failed to refresh floatingip %s: %v", conflict.ip, err)
+		}
+	}
+	return err
+}
+
+// refresh updates the cache of the ip from apiserver
+func (ci *crdIpam) refresh(ipStr string) error {
+	fip, err := ci.client.GalaxyV1alpha1().FloatingIPs().Get(ipStr, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	ci.cacheLock.Lock()
+	defer ci.cacheLock.Unlock()
+	if err != nil {
+		if allocated, ok := ci.allocatedFIPs[ipStr]; ok {
+			ci.syncCacheAfterDel(allocated)
+		}
+		return nil
+	}
+	ci.syncCacheFromCRD(fip, false)
+	return nil
+}
+
+// handleFIPEvent applies crd changes made by other replicas to cache if ipam is shared with other replicas
+func (ci *crdIpam) handleFIPEvent(obj interface{}, deleted bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	fip, ok := obj.(*v1alpha1.FloatingIP)
+	if !ok {
+		return
+	}
+	ipType, _ := ci.ipType.String()
+	if fip.Labels[constant.IpType] != ipType {
+		return
+	}
+	ci.cacheLock.Lock()
+	defer ci.cacheLock.Unlock()
+	ci.syncCacheFromCRD(fip, deleted)
+}
+
+// syncCacheFromCRD updates the cache of the ip with its crd unless the cache already has the same resource version.
+// Resource versions are opaque, so events are not ordered against the cache. An event older than the cache is
+// applied too, the cache converges on the following events of the informer, and writes based on the stale cache fail
+// with conflicts which re-read the crd. Make sure cacheLock is held when calling it.
+func (ci *crdIpam) syncCacheFromCRD(fip *v1alpha1.FloatingIP, deleted bool) {
+	ipStr := fip.Name
+	cached, allocated := ci.allocatedFIPs[ipStr]
+	if !allocated {
+		var ok bool
+		if cached, ok = ci.unallocatedFIPs[ipStr]; !ok {
+			// not in config
+			return
+		}
+	}
+	if deleted {
+		if allocated {
+			ci.syncCacheAfterDel(cached)
+			glog.V(3).Infof("synced released ip %s", ipStr)
+		}
+		return
+	}
+	if allocated && fip.ResourceVersion == cached.resourceVersion {
+		return
+	}
+	synced := New(cached.pool, cached.IP, fip.Spec.Key, &Attr{Policy: fip.Spec.Policy}, fip.Spec.UpdateTime.Time)
+	if err := synced.unmarshalAttr(fip.Spec.Attribute); err != nil {
+		glog.Error(err)
+	}
+	if _, ok := fip.Labels[constant.ReserveFIPLabel]; ok {
+		synced.Labels = map[string]string{constant.ReserveFIPLabel: ""}
+	}
+	synced.resourceVersion = fip.ResourceVersion
+	ci.syncCacheAfterCreate(synced)
+	glog.V(3).Infof("synced allocated ip %s", synced)
+}
+
 func (ci *crdIpam) newFIPCrd(name string) *v1alpha1.FloatingIP {
 	ipType, _ := ci.ipType.String()
 	crd := newFIPCrd(name)
@@ -17,15 +17,25 @@
 package floatingip
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	k8stesting "k8s.io/client-go/testing"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	fakeGalaxyCli "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned/fake"
+	crdInformer "tkestack.io/galaxy/pkg/ipam/client/informers/externalversions"
+	"tkestack.io/galaxy/pkg/ipam/utils"
 )
 
 func TestAddFloatingIPEventByUser(t *testing.T) {
@@ -131,3 +141,197 @@ func TestDeleteFloatingIPEvent(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// enforceResourceVersion makes fake clientset assign increasing resource versions to floatingips and reject updates
+// of stale resource versions like apiserver
+func enforceResourceVersion(cli *fakeGalaxyCli.Clientset) {
+	var (
+		lock sync.Mutex
+		rv   uint64
+	)
+	gvr := v1alpha1.SchemeGroupVersion.WithResource("floatingips")
+	cli.PrependReactor("create", "floatingips", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		fip := action.(k8stesting.CreateAction).GetObject().(*v1alpha1.FloatingIP).DeepCopy()
+		rv++
+		fip.ResourceVersion = strconv.FormatUint(rv, 10)
+		if err := cli.Tracker().Create(gvr, fip, ""); err != nil {
+			return true, nil, err
+		}
+		return true, fip, nil
+	})
+	cli.PrependReactor("update", "floatingips", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		fip := action.(k8stesting.UpdateAction).GetObject().(*v1alpha1.FloatingIP).DeepCopy()
+		existing, err := cli.Tracker().Get(gvr, "", fip.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		if existing.(*v1alpha1.FloatingIP).ResourceVersion != fip.ResourceVersion {
+			return true, nil, apierrors.NewConflict(gvr.GroupResource(), fip.Name,
+				fmt.Errorf("resource version %s is stale", fip.ResourceVersion))
+		}
+		rv++
+		fip.ResourceVersion = strconv.FormatUint(rv, 10)
+		if err := cli.Tracker().Update(gvr, fip, ""); err != nil {
+			return true, nil, err
+		}
+		return true, fip, nil
+	})
+}
+
+// createSharedIPAMs creates ipams of replicas sharing the same crds
+func createSharedIPAMs(t *testing.T, replicas int) ([]*crdIpam, crdInformer.SharedInformerFactory) {
+	galaxyCli := fakeGalaxyCli.NewSimpleClientset()
+	enforceResourceVersion(galaxyCli)
+	factory := crdInformer.NewSharedInformerFactory(galaxyCli, 0)
+	var ipams []*crdIpam
+	for i := 0; i < replicas; i++ {
+		var conf struct {
+			Floatingips []*FloatingIPPool `json:"floatingips"`
+		}
+		if err := json.Unmarshal([]byte(utils.TestConfig), &conf); err != nil {
+			t.Fatal(err)
+		}
+		ipam := NewSharedCrdIPAM(galaxyCli, InternalIp, factory.Galaxy().V1alpha1().FloatingIPs()).(*crdIpam)
+		if err := ipam.ConfigurePool(conf.Floatingips); err != nil {
+			t.Fatal(err)
+		}
+		ipams = append(ipams, ipam)
+	}
+	return ipams, factory
+}
+
+func TestSharedIPAMConflict(t *testing.T) {
+	// informers are not started, so each ipam only knows its own allocations until conflicts happen
+	ipams, _ := createSharedIPAMs(t, 2)
+	ipam1, ipam2 := ipams[0], ipams[1]
+	// node1 subnet has 4 ips
+	allocated := map[string]bool{}
+	for i := 0; i < 3; i++ {
+		ip, err := ipam1.AllocateInSubnet(fmt.Sprintf("pod%d", i), node1IPNet, Attr{Policy: policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		allocated[ip.String()] = true
+	}
+	ip, err := ipam2.AllocateInSubnet("pod3", node1IPNet, Attr{Policy: policy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocated[ip.String()] {
+		t.Fatalf("%s allocated twice", ip.String())
+	}
+	if _, err := ipam2.AllocateInSubnet("pod4", node1IPNet, Attr{Policy: policy}); err != ErrNoEnoughIP {
+		t.Fatalf("expect %v, got %v", ErrNoEnoughIP, err)
+	}
+	if err := ipam1.AllocateSpecificIP("pod4", ip, Attr{Policy: policy}); err == nil ||
+		!strings.Contains(err.Error(), "failed to find floating ip") {
+		t.Fatalf("expect allocated by others, got %v", err)
+	}
+	if err := checkIPKey(ipam1, ip.String(), "pod3"); err != nil {
+		t.Fatal(err)
+	}
+
+	// both replicas update the same ip, the later one retries with the latest resource version
+	if err := ipam2.UpdateAttr("pod3", ip, Attr{Policy: policy, NodeName: "node1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam1.UpdateAttr("pod3", ip, Attr{Policy: policy, NodeName: "node2"}); err != nil {
+		t.Fatal(err)
+	}
+	fip, err := ipam1.client.GalaxyV1alpha1().FloatingIPs().Get(ip.String(), v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fip.Spec.Attribute, "node2") {
+		t.Fatal(fip.Spec.Attribute)
+	}
+	// ipam2 is stale now, it fails to reserve ip for a key which doesn't own it
+	if reserved, err := ipam1.ReserveIP("pod3", "pod5", Attr{}); err != nil || !reserved {
+		t.Fatalf("reserved %v, err %v", reserved, err)
+	}
+	if err := ipam2.UpdateAttr("pod3", ip, Attr{Policy: policy}); err == nil ||
+		!strings.Contains(err.Error(), "not pod3") {
+		t.Fatalf("expect key changed, got %v", err)
+	}
+}
+
+func TestSharedIPAMSyncEvents(t *testing.T) {
+	ipams, factory := createSharedIPAMs(t, 2)
+	ipam1, ipam2 := ipams[0], ipams[1]
+	stop := make(chan struct{})
+	defer close(stop)
+	factory.Start(stop)
+	factory.WaitForCacheSync(stop)
+	ip := net.ParseIP("10.49.27.205")
+	if err := ipam1.AllocateSpecificIP("pod1", ip, Attr{Policy: policy, NodeName: "node1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitFor(ipam2, ip, "pod1", false, node1IPNet.String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPKeyAttr(ipam2, ip.String(), "pod1", &Attr{Policy: policy, NodeName: "node1"}); err != nil {
+		t.Fatal(err)
+	}
+	// ipam2 updates with the resource version synced from event
+	if err := ipam2.UpdateAttr("pod1", ip, Attr{Policy: policy, NodeName: "node2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ipam2.Release("pod1", ip); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitFor(ipam1, ip, "", false, node1IPNet.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	// events of the cached resource version are ignored, others are applied even if they are stale
+	if err := ipam1.AllocateSpecificIP("pod2", ip, Attr{Policy: policy, NodeName: "node1"}); err != nil {
+		t.Fatal(err)
+	}
+	ipam1.cacheLock.Lock()
+	event := ipam1.newFIPCrd(ip.String())
+	event.Spec.Key = "pod1"
+	event.ResourceVersion = ipam1.allocatedFIPs[ip.String()].resourceVersion
+	ipam1.syncCacheFromCRD(event, false)
+	if key := ipam1.allocatedFIPs[ip.String()].Key; key != "pod2" {
+		ipam1.cacheLock.Unlock()
+		t.Fatalf("event of the cached resource version applied, key %s", key)
+	}
+	event.ResourceVersion = "1"
+	ipam1.syncCacheFromCRD(event, false)
+	ipam1.cacheLock.Unlock()
+	// writes based on the stale cache conflict and re-read the crd
+	if err := ipam1.UpdateAttr("pod1", ip, Attr{Policy: policy, NodeName: "node2"}); err == nil {
+		t.Fatal("updated ip by stale cache")
+	}
+	if err := checkIPKeyAttr(ipam1, ip.String(), "pod2", &Attr{Policy: policy, NodeName: "node1"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedIPAMConfigurePool(t *testing.T) {
+	ipams, _ := createSharedIPAMs(t, 1)
+	ipam := ipams[0]
+	ip := net.ParseIP("10.49.27.205")
+	if err := ipam.AllocateSpecificIP("pod1", ip, Attr{Policy: policy}); err != nil {
+		t.Fatal(err)
+	}
+	// followers don't delete crds of ips not in config
+	if err := ipam.ConfigurePool(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipam.client.GalaxyV1alpha1().FloatingIPs().Get(ip.String(), v1.GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	ipam.SetLeader(true)
+	if err := ipam.ConfigurePool(nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ipam.client.GalaxyV1alpha1().FloatingIPs().Get(ip.String(), v1.GetOptions{}); !apierrors.IsNotFound(
+		err) {
+		t.Fatalf("expect not found, got %v", err)
+	}
+}
@@ -18,9 +18,105 @@ var (
 			Help:    "Galaxy cloud provider latency in seconds",
 			Buckets: prometheus.ExponentialBuckets(0.1, 2, 7),
 		}, []string{"func"})
+
+	// CloudProviderDrift is the number of ip bindings which differ between floatingips and the cloud provider
+	// found by the last reconciliation. type is stale for bindings the cloud provider has but floatingips don't,
+	// and missing for bindings floatingips have but the cloud provider doesn't.
+	CloudProviderDrift = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "galaxy_cloud_provider_drift",
+			Help: "Number of ip bindings differing between galaxy and cloud provider found by the last reconciliation",
+		}, []string{"type"})
+
+	CloudProviderReconcileCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "galaxy_cloud_provider_reconcile_total",
+			Help: "Number of ip bindings galaxy tried to fix during reconciliation with cloud provider",
+		}, []string{"type", "result"})
+
+	// CloudProviderConnectionState is 1 for the current grpc connection state to the cloud provider and 0 for others
+	CloudProviderConnectionState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "galaxy_cloud_provider_connection_state",
+			Help: "Grpc connection state to cloud provider, the current state is 1",
+		}, []string{"state"})
+
+	IPAllocationAttempts = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "galaxy_ip_allocation_attempts_total",
+			Help: "Number of attempts to allocate ips for pods during binding",
+		})
+
+	// IPAllocationFailures is the number of failed allocations by reason, which is one of no_node_subnet,
+	// no_ip_left, uid_mismatch, pending_unassign, cloud_provider and other
+	IPAllocationFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "galaxy_ip_allocation_failures_total",
+			Help: "Number of failed attempts to allocate ips for pods during binding by reason",
+		}, []string{"reason"})
+
+	IPReleaseCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "galaxy_ip_release_total",
+			Help: "Number of ips released by release policy",
+		}, []string{"policy"})
+
+	ResyncLatency = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "galaxy_resync_duration_seconds",
+			Help:    "Duration in seconds of resyncing allocated ips with pods",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 8),
+		})
+
+	// ResyncRepairCount is the number of ips of not running pods which are unassigned, reserved or released
+	// during resync
+	ResyncRepairCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "galaxy_resync_repair_total",
+			Help: "Number of ips of not running pods repaired during resync",
+		}, []string{"result"})
+
+	// ConfigMapReloadCount is the number of floatingip configmap reloads, result is updated, unchanged or failure
+	ConfigMapReloadCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "galaxy_configmap_reload_total",
+			Help: "Number of floatingip configmap reloads by result",
+		}, []string{"result"})
+
+	FloatingIPWriteLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "galaxy_floatingip_write_latency",
+			Help:    "Latency in seconds of writing FloatingIP CRDs to apiserver",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 10),
+		}, []string{"verb", "result"})
+
+	ReleaseQueueLength = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "galaxy_release_queue_length",
+			Help: "Number of keys waiting in the queue to release or resync their ips",
+		})
+
+	// ReleaseQueueCount is the number of keys processed by the release queue, result is success, retry or abort.
+	// Keys are aborted after too many retries and left to the full resync.
+	ReleaseQueueCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "galaxy_release_queue_process_total",
+			Help: "Number of keys processed by the release queue by result",
+		}, []string{"result"})
+
+	// BindRecoveryCount is the number of interrupted binds recovered by the leader, result is rolled_forward,
+	// rolled_back or failure
+	BindRecoveryCount = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "galaxy_bind_recovery_total",
+			Help: "Number of interrupted binds rolled forward or back by result",
+		}, []string{"result"})
 )
 
 // MustRegister registers all metrics
 func MustRegister() {
-	prometheus.MustRegister(ScheduleLatency, CloudProviderLatency)
+	prometheus.MustRegister(ScheduleLatency, CloudProviderLatency, CloudProviderDrift, CloudProviderReconcileCount,
+		CloudProviderConnectionState, IPAllocationAttempts, IPAllocationFailures, IPReleaseCount, ResyncLatency,
+		ResyncRepairCount, ConfigMapReloadCount, FloatingIPWriteLatency, ReleaseQueueLength, ReleaseQueueCount,
+		BindRecoveryCount)
 }
@@ -18,6 +18,7 @@ package schedulerplugin
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -53,8 +54,10 @@ func (p *FloatingIPPlugin) Bind(args *schedulerapi.ExtenderBindingArgs) error {
 	if err != nil {
 		return err
 	}
+	metrics.IPAllocationAttempts.Inc()
 	cniArgs, err := p.allocateIP(keyObj.KeyInDB, args.Node, pod)
 	if err != nil {
+		metrics.IPAllocationFailures.WithLabelValues(allocateFailureReason(err)).Inc()
 		return err
 	}
 	data, err := json.Marshal(cniArgs)
@@ -84,19 +87,24 @@ func (p *FloatingIPPlugin) Bind(args *schedulerapi.ExtenderBindingArgs) error {
 		return true, nil
 	}); err != nil {
 		if apierrors.IsNotFound(err1) {
-			glog.Infof("binding returns not found for pod %s, putting it into unreleased chan", keyObj.KeyInDB)
-			// attach ip annotation
-			p.unreleased <- &releaseEvent{pod: pod}
+			glog.Infof("binding returns not found for pod %s, putting it into release queue", keyObj.KeyInDB)
+			p.enqueueRelease(pod)
 		}
 		// If fails to update, depending on resync to update
 		return fmt.Errorf("update pod %s: %w", keyObj.KeyInDB, err1)
 	}
+	// the pod has been bound with its annotation, a failure of recording it will be rolled forward by recoverBinds
+	attr := floatingip.Attr{Policy: parseReleasePolicy(&pod.ObjectMeta), NodeName: args.Node, Uid: string(pod.UID),
+		BindPhase: floatingip.BindPhaseBound}
+	if err := p.updateBindPhase(keyObj.KeyInDB, cniArgs.Common.IPInfos, attr); err != nil {
+		glog.Warning(err)
+	}
 	metrics.ScheduleLatency.WithLabelValues("bind").Observe(time.Since(start).Seconds())
 	return nil
 }
 
 func (p *FloatingIPPlugin) allocateIP(key string, nodeName string, pod *corev1.Pod) (*constant.CniArgs, error) {
-	cniArgs, err := getPodCniArgs(pod)
+	cniArgs, err := p.getPodCniArgs(pod)
 	if err != nil {
 		return nil, err
 	}
@@ -119,18 +127,21 @@ func (p *FloatingIPPlugin) allocateIP(key string, nodeName string, pod *corev1.P
 		}
 	}
 	policy := parseReleasePolicy(&pod.ObjectMeta)
-	attr := floatingip.Attr{Policy: policy, NodeName: nodeName, Uid: string(pod.UID)}
+	// record the intent of binding before calling cloud provider, so that an interrupted bind can be recovered
+	attr := floatingip.Attr{Policy: policy, NodeName: nodeName, Uid: string(pod.UID),
+		BindPhase: floatingip.BindPhaseAllocated}
 	for _, ipInfo := range ipInfos {
 		// check if uid missmatch, if we delete a statfulset/tapp and creates a same name statfulset/tapp immediately,
 		// galaxy-ipam may receive bind event for new pod early than deleting event for old pod
 		if ipInfo != nil && ipInfo.PodUid != "" && ipInfo.PodUid != string(pod.GetUID()) {
-			return nil, fmt.Errorf("waiting for delete event of %s before reuse this ip", key)
+			return nil, &allocateError{reason: "uid_mismatch",
+				err: fmt.Errorf("waiting for delete event of %s before reuse this ip", key)}
 		}
 	}
 	if len(unallocatedIPRange) > 0 || len(ipInfos) == 0 {
 		subnet, err := p.queryNodeSubnet(nodeName)
 		if err != nil {
-			return nil, err
+			return nil, &allocateError{reason: "no_node_subnet", err: err}
 		}
 		if _, err := p.ipam.AllocateInSubnetsAndIPRange(key, subnet, unallocatedIPRange, attr); err != nil {
 			return nil, err
@@ -141,14 +152,6 @@ func (p *FloatingIPPlugin) allocateIP(key string, nodeName string, pod *corev1.P
 		}
 	}
 	for _, ipInfo := range ipInfos {
-		glog.Infof("AssignIP nodeName %s, ip %s, key %s", nodeName, ipInfo.IPInfo.IP.IP.String(), key)
-		if err := p.cloudProviderAssignIP(&rpc.AssignIPRequest{
-			NodeName:  nodeName,
-			IPAddress: ipInfo.IPInfo.IP.IP.String(),
-		}); err != nil {
-			// do not rollback allocated ip
-			return nil, fmt.Errorf("failed to assign ip %s to %s: %v", ipInfo.IPInfo.IP.IP.String(), key, err)
-		}
 		if reservedIPs.Has(ipInfo.IP.String()) {
 			glog.Infof("%s reused %s, updating attr to %v", key, ipInfo.IPInfo.IP.String(), attr)
 			if err := p.ipam.UpdateAttr(key, ipInfo.IPInfo.IP.IP, attr); err != nil {
@@ -156,6 +159,29 @@ func (p *FloatingIPPlugin) allocateIP(key string, nodeName string, pod *corev1.P
 			}
 		}
 	}
+	// assign all ips of the pod in one call
+	var assignReqs []*rpc.AssignIPRequest
+	for _, ipInfo := range ipInfos {
+		if p.cloudProvider != nil {
+			if err := p.flushUnAssignIP(ipInfo.IPInfo.IP.IP.String(), nodeName); err != nil {
+				// do not rollback allocated ip, the pod will retry binding the same ip
+				return nil, &allocateError{reason: "pending_unassign", err: err}
+			}
+		}
+		glog.Infof("AssignIP nodeName %s, ip %s, key %s", nodeName, ipInfo.IPInfo.IP.IP.String(), key)
+		assignReqs = append(assignReqs, &rpc.AssignIPRequest{
+			NodeName:  nodeName,
+			IPAddress: ipInfo.IPInfo.IP.IP.String(),
+		})
+	}
+	if err := p.cloudProviderBatchAssignIP(assignReqs); err != nil {
+		// do not rollback allocated ip
+		return nil, &allocateError{reason: "cloud_provider", err: fmt.Errorf("failed to assign ips to %s: %v",
+			key, err)}
+	}
+	for _, ipInfo := range ipInfos {
+		p.cancelUnAssignIP(ipInfo.IPInfo.IP.IP.String(), nodeName)
+	}
 	var allocatedIPs []string
 	var ret []constant.IPInfo
 	for _, ipInfo := range ipInfos {
@@ -164,11 +190,43 @@ func (p *FloatingIPPlugin) allocateIP(key string, nodeName string, pod *corev1.P
 		}
 		ret = append(ret, ipInfo.IPInfo)
 	}
+	if p.cloudProvider != nil {
+		attr.BindPhase = floatingip.BindPhaseAssigned
+		if err := p.updateBindPhase(key, ret, attr); err != nil {
+			return nil, err
+		}
+	}
 	glog.Infof("%s reused ips %v, allocated ips %v, attr %v", key, reservedIPs.List(), allocatedIPs, attr)
 	cniArgs.Common.IPInfos = ret
 	return &cniArgs, nil
 }
 
+// allocateError is an error of allocating ips with the reason reported by metrics
+type allocateError struct {
+	reason string
+	err    error
+}
+
+func (e *allocateError) Error() string {
+	return e.err.Error()
+}
+
+func (e *allocateError) Unwrap() error {
+	return e.err
+}
+
+// allocateFailureReason returns the reason of allocation failure reported by metrics
+func allocateFailureReason(err error) string {
+	var allocateErr *allocateError
+	if errors.As(err, &allocateErr) {
+		return allocateErr.reason
+	}
+	if errors.Is(err, floatingip.ErrNoEnoughIP) {
+		return "no_ip_left"
+	}
+	return "other"
+}
+
 // unbind release ip from pod
 func (p *FloatingIPPlugin) unbind(pod *corev1.Pod) error {
 	defer p.lockPod(pod.Name, pod.Namespace)()
@@ -186,11 +244,12 @@ func (p *FloatingIPPlugin) unbind(pod *corev1.Pod) error {
 		for _, ipInfo := range ipInfos {
 			ipStr := ipInfo.IPInfo.IP.IP.String()
 			glog.Infof("UnAssignIP nodeName %s, ip %s, key %s", ipInfo.NodeName, ipStr, key)
-			if err = p.cloudProviderUnAssignIP(&rpc.UnAssignIPRequest{
-				NodeName:  ipInfo.NodeName,
-				IPAddress: ipStr,
-			}); err != nil {
-				return fmt.Errorf("failed to unassign ip %s from %s: %v", ipStr, key, err)
+			req := &rpc.UnAssignIPRequest{NodeName: ipInfo.NodeName, IPAddress: ipStr}
+			if err = p.cloudProviderUnAssignIP(req); err != nil {
+				// persist the request to retry it later instead of blocking releasing ip
+				if err := p.enqueueUnAssignIP(req, err); err != nil {
+					return fmt.Errorf("failed to unassign ip %s from %s: %v", ipStr, key, err)
+				}
 			}
 		}
 	}
@@ -198,5 +257,8 @@ func (p *FloatingIPPlugin) unbind(pod *corev1.Pod) error {
 	if keyObj.Deployment() {
 		return p.unbindDpPod(keyObj, policy, "during unbinding pod")
 	}
+	if p.keepStaticIP(keyObj, policy, pod.Annotations[constant.StaticIPAnnotation] != "") {
+		return p.reserveIP(key, key, "release policy of static ip during unbinding pod")
+	}
 	return p.unbindNoneDpPod(keyObj, policy, "during unbinding pod")
 }
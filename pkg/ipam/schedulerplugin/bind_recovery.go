@@ -0,0 +1,160 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
+)
+
+// bindRecoveryInterval is the interval of checking interrupted binds
+const bindRecoveryInterval = time.Minute
+
+// bindRecoveryTimeout is how long a bind may stay unfinished before it is considered interrupted. A bind may call
+// cloud provider several times sequentially, e.g. unassigning pending ips and assigning ips, each of which may take
+// up to the 1 minute rpc timeout, so it is several times longer than the worst case of a bind.
+var bindRecoveryTimeout = 10 * time.Minute
+
+// updateBindPhase records the bind phase of each ip in attr
+func (p *FloatingIPPlugin) updateBindPhase(key string, ipInfos []constant.IPInfo, attr floatingip.Attr) error {
+	for i := range ipInfos {
+		if err := p.ipam.UpdateAttr(key, ipInfos[i].IP.IP, attr); err != nil {
+			return fmt.Errorf("failed to update bind phase of %s to %s: %v", ipInfos[i].IP.IP.String(),
+				attr.BindPhase, err)
+		}
+	}
+	return nil
+}
+
+// recoverBinds rolls forward or back binds interrupted by failures or crashes in the middle of Bind according to the
+// bind phase recorded on floatingips. A bind is rolled forward if the pod has been bound to the node, otherwise the
+// ip is unassigned from the node and left reserved for the pod, resync releases it if the pod no longer exists.
+// Since binds may be served by other replicas if active-active, a bind is recovered only if the resource version of
+// its floatingip hasn't changed since the last check, i.e. for at least bindRecoveryInterval.
+func (p *FloatingIPPlugin) recoverBinds() {
+	all, err := p.ipam.ByPrefix("")
+	if err != nil {
+		glog.Warningf("failed to list floatingips to recover binds: %v", err)
+		return
+	}
+	interrupted := map[string]string{}
+	// recoverBinds is run by a single goroutine, so bindRecoveryVersions is not locked
+	defer func() { p.bindRecoveryVersions = interrupted }()
+	for i := range all {
+		if !bindInterrupted(&all[i].FloatingIP) {
+			continue
+		}
+		ipStr, resourceVersion := all[i].IP.String(), all[i].ResourceVersion()
+		interrupted[ipStr] = resourceVersion
+		if last, ok := p.bindRecoveryVersions[ipStr]; !ok || last != resourceVersion {
+			glog.V(3).Infof("wait for floatingip %s of resource version %s to settle before recovering its bind",
+				ipStr, resourceVersion)
+			continue
+		}
+		obj, ok := newResyncObj(&all[i].FloatingIP)
+		if !ok {
+			continue
+		}
+		result, err := p.recoverBind(obj)
+		if err != nil {
+			glog.Warningf("failed to recover bind of %s with ip %s: %v", obj.keyObj.KeyInDB,
+				obj.fip.IP.String(), err)
+			result = "failure"
+		}
+		if result != "" {
+			metrics.BindRecoveryCount.WithLabelValues(result).Inc()
+		}
+	}
+}
+
+// bindInterrupted returns true if the bind of the ip hasn't finished within bindRecoveryTimeout
+func bindInterrupted(fip *floatingip.FloatingIP) bool {
+	if fip.Key == "" {
+		return false
+	}
+	if fip.BindPhase != floatingip.BindPhaseAllocated && fip.BindPhase != floatingip.BindPhaseAssigned {
+		return false
+	}
+	return time.Since(fip.UpdatedAt) >= bindRecoveryTimeout
+}
+
+// recoverBind returns rolled_forward or rolled_back if it recovers the bind, or an empty result if the ip has been
+// changed by others
+func (p *FloatingIPPlugin) recoverBind(obj resyncObj) (string, error) {
+	key := obj.keyObj.KeyInDB
+	defer p.lockPod(obj.keyObj.PodName, obj.keyObj.Namespace)()
+	// we are holding the pod's lock, query again in case a retried bind has changed the ip
+	fip, err := p.ipam.ByIP(obj.fip.IP)
+	if err != nil {
+		return "", err
+	}
+	if fip.Key != key || fip.BindPhase != obj.fip.BindPhase || !fip.UpdatedAt.Equal(obj.fip.UpdatedAt) ||
+		fip.ResourceVersion() != obj.fip.ResourceVersion() {
+		return "", nil
+	}
+	ipStr := fip.IP.String()
+	// query apiserver since the pod lister may not have seen the binding yet
+	pod, err := p.Client.CoreV1().Pods(obj.keyObj.Namespace).Get(obj.keyObj.PodName, v1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	podGone := apierrors.IsNotFound(err) || string(pod.UID) != fip.PodUid
+	if !podGone && fip.NodeName != "" && pod.Spec.NodeName == fip.NodeName {
+		if fip.BindPhase == floatingip.BindPhaseAllocated {
+			// assigning ip is idempotent, it's safe to assign it again if it has been assigned before crash
+			if err := p.cloudProviderAssignIP(&rpc.AssignIPRequest{NodeName: fip.NodeName,
+				IPAddress: ipStr}); err != nil {
+				return "", fmt.Errorf("failed to assign ip %s to %s: %v", ipStr, key, err)
+			}
+			p.cancelUnAssignIP(ipStr, fip.NodeName)
+		}
+		if err := p.ipam.UpdateAttr(key, fip.IP, floatingip.Attr{Policy: constant.ReleasePolicy(fip.Policy),
+			NodeName: fip.NodeName, Uid: fip.PodUid, BindPhase: floatingip.BindPhaseBound}); err != nil {
+			return "", err
+		}
+		glog.Infof("rolled forward bind of %s to %s with ip %s", key, fip.NodeName, ipStr)
+		return "rolled_forward", nil
+	}
+	if fip.NodeName != "" {
+		req := &rpc.UnAssignIPRequest{NodeName: fip.NodeName, IPAddress: ipStr}
+		if err := p.cloudProviderUnAssignIP(req); err != nil {
+			if err := p.enqueueUnAssignIP(req, err); err != nil {
+				return "", fmt.Errorf("failed to unassign ip %s from %s: %v", ipStr, key, err)
+			}
+		}
+	}
+	// keep the ip for the pod's next bind, node and uid are cleared to let it be reused by a new pod of the same name
+	if err := p.ipam.UpdateAttr(key, fip.IP,
+		floatingip.Attr{Policy: constant.ReleasePolicy(fip.Policy)}); err != nil {
+		return "", err
+	}
+	glog.Infof("rolled back bind of %s to %s with ip %s", key, fip.NodeName, ipStr)
+	if podGone {
+		// the pod is gone, release its ip according to release policy
+		p.releaseQueue.Add(key)
+		metrics.ReleaseQueueLength.Set(float64(p.releaseQueue.Len()))
+	}
+	return "rolled_back", nil
+}
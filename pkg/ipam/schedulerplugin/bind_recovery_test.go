@@ -0,0 +1,221 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8stesting "k8s.io/client-go/testing"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/api/k8s/schedulerapi"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	fakeGalaxyCli "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned/fake"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+	. "tkestack.io/galaxy/pkg/ipam/cloudprovider/testing"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
+	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+// assignFailingCloudProvider fails assign requests if fail is true
+type assignFailingCloudProvider struct {
+	*FakeCloudProvider
+	fail bool
+}
+
+func (f *assignFailingCloudProvider) AssignIP(in *rpc.AssignIPRequest) (*rpc.AssignIPReply, error) {
+	if f.fail {
+		return nil, fmt.Errorf("timeout")
+	}
+	return f.FakeCloudProvider.AssignIP(in)
+}
+
+func bindArgs(pod *corev1.Pod, nodeName string) *schedulerapi.ExtenderBindingArgs {
+	return &schedulerapi.ExtenderBindingArgs{PodName: pod.Name, PodNamespace: pod.Namespace, PodUID: pod.UID,
+		Node: nodeName}
+}
+
+func checkBindPhase(ipam floatingip.IPAM, key, expectPhase, expectNode string) (*floatingip.FloatingIPInfo, error) {
+	fip, err := ipam.First(key)
+	if err != nil {
+		return nil, err
+	}
+	if fip == nil {
+		return nil, fmt.Errorf("no ip allocated for %s", key)
+	}
+	if fip.BindPhase != expectPhase || fip.NodeName != expectNode {
+		return nil, fmt.Errorf("expect phase %q node %q, got phase %q node %q", expectPhase, expectNode,
+			fip.BindPhase, fip.NodeName)
+	}
+	return fip, nil
+}
+
+func TestBindPhase(t *testing.T) {
+	pod := CreateStatefulSetPod("pod1-0", "ns1", nil)
+	keyObj, _ := util.FormatKey(pod)
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, pod)
+	defer func() { stopChan <- struct{}{} }()
+	fipPlugin.cloudProvider = NewFakeCloudProvider()
+	if err := fipPlugin.Bind(bindArgs(pod, node3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkBindPhase(fipPlugin.ipam, keyObj.KeyInDB, floatingip.BindPhaseBound, node3); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// #lizard forgives
+func TestBindRecoveryRollBack(t *testing.T) {
+	defer func(timeout time.Duration) { bindRecoveryTimeout = timeout }(bindRecoveryTimeout)
+	bindRecoveryTimeout = 0
+	pod := CreateStatefulSetPod("pod1-0", "ns1", nil)
+	keyObj, _ := util.FormatKey(pod)
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, pod)
+	defer func() { stopChan <- struct{}{} }()
+	cp := &assignFailingCloudProvider{FakeCloudProvider: NewFakeCloudProvider(), fail: true}
+	fipPlugin.cloudProvider = cp
+	// cloud provider fails after the ip is allocated
+	if err := fipPlugin.Bind(bindArgs(pod, node3)); err == nil {
+		t.Fatal("expect bind error")
+	}
+	fip, err := checkBindPhase(fipPlugin.ipam, keyObj.KeyInDB, floatingip.BindPhaseAllocated, node3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rolledBack := testutil.ToFloat64(metrics.BindRecoveryCount.WithLabelValues("rolled_back"))
+	// the first check only records the resource version in case the bind is still going on by another replica
+	fipPlugin.recoverBinds()
+	if _, err := checkBindPhase(fipPlugin.ipam, keyObj.KeyInDB, floatingip.BindPhaseAllocated, node3); err != nil {
+		t.Fatal(err)
+	}
+	// the pod is still pending, so the bind is rolled back and the ip is kept for the pod
+	fipPlugin.recoverBinds()
+	if _, err := checkBindPhase(fipPlugin.ipam, keyObj.KeyInDB, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if node := cp.UnAssigned[fip.IP.String()]; node != node3 {
+		t.Fatalf("expect ip unassigned from %s, got %q", node3, node)
+	}
+	if v := testutil.ToFloat64(metrics.BindRecoveryCount.WithLabelValues("rolled_back")); v != rolledBack+1 {
+		t.Fatalf("expect rolled back count %v, got %v", rolledBack+1, v)
+	}
+	// the next bind reuses the ip
+	cp.fail = false
+	if err := fipPlugin.Bind(bindArgs(pod, node3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPKey(fipPlugin.ipam, fip.IP.String(), keyObj.KeyInDB); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkBindPhase(fipPlugin.ipam, keyObj.KeyInDB, floatingip.BindPhaseBound, node3); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// #lizard forgives
+func TestBindRecoveryRollForward(t *testing.T) {
+	defer func(timeout time.Duration) { bindRecoveryTimeout = timeout }(bindRecoveryTimeout)
+	bindRecoveryTimeout = 0
+	pod := CreateStatefulSetPod("pod1-0", "ns1", nil)
+	keyObj, _ := util.FormatKey(pod)
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, pod)
+	defer func() { stopChan <- struct{}{} }()
+	fipPlugin.cloudProvider = NewFakeCloudProvider()
+	// apiserver fails after binding the pod
+	fail := true
+	fipPlugin.GalaxyClient.(*fakeGalaxyCli.Clientset).PrependReactor("update", "floatingips",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			fip := action.(k8stesting.UpdateAction).GetObject().(*v1alpha1.FloatingIP)
+			if fail && strings.Contains(fip.Spec.Attribute, floatingip.BindPhaseBound) {
+				return true, nil, fmt.Errorf("apiserver unavailable")
+			}
+			return false, nil, nil
+		})
+	if err := fipPlugin.Bind(bindArgs(pod, node3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkBindPhase(fipPlugin.ipam, keyObj.KeyInDB, floatingip.BindPhaseAssigned, node3); err != nil {
+		t.Fatal(err)
+	}
+	fail = false
+	// fake client doesn't bind pods, update it as apiserver does
+	pod.Spec.NodeName = node3
+	if _, err := fipPlugin.Client.CoreV1().Pods(pod.Namespace).Update(pod); err != nil {
+		t.Fatal(err)
+	}
+	rolledForward := testutil.ToFloat64(metrics.BindRecoveryCount.WithLabelValues("rolled_forward"))
+	fipPlugin.recoverBinds()
+	fipPlugin.recoverBinds()
+	if _, err := checkBindPhase(fipPlugin.ipam, keyObj.KeyInDB, floatingip.BindPhaseBound, node3); err != nil {
+		t.Fatal(err)
+	}
+	if v := testutil.ToFloat64(metrics.BindRecoveryCount.WithLabelValues("rolled_forward")); v != rolledForward+1 {
+		t.Fatalf("expect rolled forward count %v, got %v", rolledForward+1, v)
+	}
+}
+
+// #lizard forgives
+func TestBindRecoveryPodDeleted(t *testing.T) {
+	defer func(timeout time.Duration) { bindRecoveryTimeout = timeout }(bindRecoveryTimeout)
+	bindRecoveryTimeout = 0
+	pod := CreateStatefulSetPod("pod1-0", "ns1", nil)
+	keyObj, _ := util.FormatKey(pod)
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, pod)
+	defer func() { stopChan <- struct{}{} }()
+	cp := NewFakeCloudProvider()
+	fipPlugin.cloudProvider = cp
+	// leader crashes after recording the intent of binding and the pod is deleted before a new leader starts
+	ip := "10.49.27.205"
+	if err := fipPlugin.ipam.AllocateSpecificIP(keyObj.KeyInDB, net.ParseIP(ip), floatingip.Attr{
+		Policy: constant.ReleasePolicyPodDelete, NodeName: node3, Uid: string(pod.UID),
+		BindPhase: floatingip.BindPhaseAllocated}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.Client.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &v1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	fipPlugin.recoverBinds()
+	fipPlugin.recoverBinds()
+	if cp.UnAssigned[ip] != node3 {
+		t.Fatalf("expect ip unassigned from %s, got %q", node3, cp.UnAssigned[ip])
+	}
+	// the ip is released through release queue
+	if fipPlugin.releaseQueue.Len() != 1 {
+		t.Fatalf("expect a key in release queue, got %d", fipPlugin.releaseQueue.Len())
+	}
+	if err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		_, err := fipPlugin.PodLister.Pods(pod.Namespace).Get(pod.Name)
+		return apierrors.IsNotFound(err), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	fipPlugin.processNextRelease()
+	if err := checkIPKey(fipPlugin.ipam, ip, ""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -24,15 +24,20 @@ import (
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	fakeV1 "k8s.io/client-go/kubernetes/typed/core/v1/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 	"tkestack.io/galaxy/pkg/api/k8s/schedulerapi"
+	fakeGalaxyCli "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned/fake"
 	. "tkestack.io/galaxy/pkg/ipam/cloudprovider/testing"
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
 	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
 	schedulerplugin_util "tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
 	"tkestack.io/galaxy/pkg/utils/nets"
@@ -398,3 +403,100 @@ func checkByKeyAndIPRanges(fipPlugin *FloatingIPPlugin, key string, ipranges [][
 	}
 	return fipInfos, nil
 }
+
+func TestAllocateIPForNetworkPoolRefs(t *testing.T) {
+	node := CreateNode("node6", nil, "10.49.28.3")
+	pod := CreateSimplePod("pod1", "ns1", map[string]string{constant.MultusCNIAnnotation: `[` +
+		`{"name":"galaxy-k8s-vlan","subnet":"10.0.80.0/24"},{"name":"flannel","interface":"eth1"},` +
+		`{"name":"galaxy-k8s-vlan","interface":"eth2","subnet":"10.0.81.0/24"}]`})
+	fipPlugin, stopChan, nodes := createPluginTestNodes(t, pod, &node)
+	defer func() { stopChan <- struct{}{} }()
+	cniArgs, err := fipPlugin.getPodCniArgs(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprintf("%v", cniArgs.RequestIPRange) != "[[10.0.80.2~10.0.80.4] [10.0.81.2~10.0.81.4]]" {
+		t.Fatalf("unexpected request ip range %v", cniArgs.RequestIPRange)
+	}
+	// only node6 is able to allocate ips from both pools
+	if err := checkFilterCase(fipPlugin, filterCase{
+		testPod: pod, expectFiltererd: []string{"node6"}, expectFailed: []string{drainedNode, nodeHasNoIP, node3,
+			node4},
+	}, nodes); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fipPlugin.allocateIP("pod1_ns1_pod1", "node6", pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Common.IPInfos) != 2 || got.Common.IPInfos[0].IP.IP.Mask(net.CIDRMask(24, 32)).String() !=
+		"10.0.80.0" || got.Common.IPInfos[1].IP.IP.Mask(net.CIDRMask(24, 32)).String() != "10.0.81.0" {
+		t.Fatalf("expect ips of 10.0.80.0/24 and 10.0.81.0/24 in order, got %v", got.Common.IPInfos)
+	}
+	// a network refers to an unknown subnet
+	pod.Annotations[constant.MultusCNIAnnotation] = `[{"name":"galaxy-k8s-vlan","subnet":"10.0.82.0/24"}]`
+	if _, err := fipPlugin.getPodCniArgs(pod); err == nil {
+		t.Fatal("expect an error for unknown subnet")
+	}
+}
+
+// #lizard forgives
+func TestAllocationMetrics(t *testing.T) {
+	pod1 := CreateStatefulSetPod("pod1-0", "demo", map[string]string{})
+	pod1.SetUID("uid1")
+	pod2 := CreateStatefulSetPod("pod2-0", "demo", map[string]string{})
+	keyObj, _ := schedulerplugin_util.FormatKey(pod1)
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, pod1, pod2)
+	defer func() { stopChan <- struct{}{} }()
+	attempts := testutil.ToFloat64(metrics.IPAllocationAttempts)
+	failures := func(reason string) float64 {
+		return testutil.ToFloat64(metrics.IPAllocationFailures.WithLabelValues(reason))
+	}
+	noNodeSubnet, uidMismatch, other := failures("no_node_subnet"), failures("uid_mismatch"), failures("other")
+	if err := fipPlugin.Bind(&schedulerapi.ExtenderBindingArgs{PodName: pod1.Name, PodNamespace: pod1.Namespace,
+		Node: "unknown-node"}); err == nil {
+		t.Fatal("expect error")
+	}
+	if err := fipPlugin.ipam.AllocateSpecificIP(keyObj.KeyInDB, net.ParseIP("10.49.27.205"),
+		floatingip.Attr{Policy: constant.ReleasePolicyPodDelete, NodeName: node3, Uid: "uid0"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.Bind(&schedulerapi.ExtenderBindingArgs{PodName: pod1.Name, PodNamespace: pod1.Namespace,
+		Node: node3}); err == nil {
+		t.Fatal("expect error")
+	}
+	// errors of ipam are counted as other
+	fipPlugin.GalaxyClient.(*fakeGalaxyCli.Clientset).PrependReactor("create", "floatingips",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("apiserver unavailable")
+		})
+	if err := fipPlugin.Bind(&schedulerapi.ExtenderBindingArgs{PodName: pod2.Name, PodNamespace: pod2.Namespace,
+		Node: node3}); err == nil {
+		t.Fatal("expect error")
+	}
+	if value := testutil.ToFloat64(metrics.IPAllocationAttempts); value != attempts+3 {
+		t.Fatalf("expect %v attempts, real %v", attempts+3, value)
+	}
+	if value := failures("no_node_subnet"); value != noNodeSubnet+1 {
+		t.Fatalf("expect %v no_node_subnet failures, real %v", noNodeSubnet+1, value)
+	}
+	if value := failures("uid_mismatch"); value != uidMismatch+1 {
+		t.Fatalf("expect %v uid_mismatch failures, real %v", uidMismatch+1, value)
+	}
+	if value := failures("other"); value != other+1 {
+		t.Fatalf("expect %v other failures, real %v", other+1, value)
+	}
+	if reason := allocateFailureReason(fmt.Errorf("wrapped: %w", floatingip.ErrNoEnoughIP)); reason != "no_ip_left" {
+		t.Fatal(reason)
+	}
+	if reason := allocateFailureReason(fmt.Errorf("unknown")); reason != "other" {
+		t.Fatal(reason)
+	}
+	released := testutil.ToFloat64(metrics.IPReleaseCount.WithLabelValues("podDelete"))
+	if err := fipPlugin.releaseIP(keyObj.KeyInDB, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if value := testutil.ToFloat64(metrics.IPReleaseCount.WithLabelValues("podDelete")); value != released+1 {
+		t.Fatalf("expect %v released ips, real %v", released+1, value)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider"
 	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
 	"tkestack.io/galaxy/pkg/ipam/metrics"
 )
@@ -46,6 +47,33 @@ func (p *FloatingIPPlugin) cloudProviderAssignIP(req *rpc.AssignIPRequest) error
 	return nil
 }
 
+// cloudProviderBatchAssignIP sends assign ip reqs to cloud provider in one call, it returns an error of the first
+// failed req
+func (p *FloatingIPPlugin) cloudProviderBatchAssignIP(reqs []*rpc.AssignIPRequest) error {
+	if p.cloudProvider == nil || len(reqs) == 0 {
+		return nil
+	}
+	if len(reqs) == 1 {
+		return p.cloudProviderAssignIP(reqs[0])
+	}
+	start := time.Now()
+	reply, err := p.cloudProvider.BatchAssignIP(&rpc.BatchAssignIPRequest{Requests: reqs})
+	metrics.CloudProviderLatency.WithLabelValues("batch_assign").Observe(time.Since(start).Seconds())
+	if err != nil {
+		return fmt.Errorf("cloud provider BatchAssignIP reply err %v", err)
+	}
+	if reply == nil || len(reply.Replies) != len(reqs) {
+		return fmt.Errorf("cloud provider BatchAssignIP expect %d replies, got %v", len(reqs), reply)
+	}
+	for i, r := range reply.Replies {
+		if r == nil || !r.Success {
+			return fmt.Errorf("cloud provider AssignIP %v reply failed, reply %v", reqs[i], r)
+		}
+	}
+	glog.Infof("BatchAssignIP %v success", reqs)
+	return nil
+}
+
 // cloudProviderUnAssignIP send unassign ip req to cloud provider
 func (p *FloatingIPPlugin) cloudProviderUnAssignIP(req *rpc.UnAssignIPRequest) error {
 	if p.cloudProvider == nil {
@@ -66,3 +94,11 @@ func (p *FloatingIPPlugin) cloudProviderUnAssignIP(req *rpc.UnAssignIPRequest) e
 	glog.Infof("UnAssignIP %v success", req)
 	return nil
 }
+
+// CloudProviderReady returns an error if the cloud provider is configured but not usable
+func (p *FloatingIPPlugin) CloudProviderReady() error {
+	if checker, ok := p.cloudProvider.(cloudprovider.ReadyChecker); ok {
+		return checker.Ready()
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/retry"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+)
+
+const (
+	// maxCloudProviderAttempts is the number of failed attempts before an operation becomes a dead letter
+	maxCloudProviderAttempts = 10
+	minCloudProviderBackoff  = 5 * time.Second
+	maxCloudProviderBackoff  = 10 * time.Minute
+)
+
+// cloudProviderBackoff returns the time to wait before the next attempt after attempts failures
+func cloudProviderBackoff(attempts int) time.Duration {
+	backoff := minCloudProviderBackoff
+	for i := 1; i < attempts && backoff < maxCloudProviderBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxCloudProviderBackoff {
+		backoff = maxCloudProviderBackoff
+	}
+	return backoff
+}
+
+// cloudProviderOperationHandler enqueues ips of CloudProviderOperations if it is the leader which drains the queue.
+// Updates of status only are skipped since the worker writes status and requeues operations itself, except dead letters
+// being retried.
+func (p *FloatingIPPlugin) cloudProviderOperationHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if op, ok := obj.(*v1alpha1.CloudProviderOperation); ok && p.isLeader() {
+				p.cpQueue.Add(op.Name)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldOp, ok1 := oldObj.(*v1alpha1.CloudProviderOperation)
+			newOp, ok2 := newObj.(*v1alpha1.CloudProviderOperation)
+			if !ok1 || !ok2 || !p.isLeader() {
+				return
+			}
+			if oldOp.Status.DeadLetter && !newOp.Status.DeadLetter {
+				p.cpQueue.Add(newOp.Name)
+			} else if !reflect.DeepEqual(oldOp.Spec, newOp.Spec) {
+				p.cpQueue.AddRateLimited(newOp.Name)
+			}
+		},
+	}
+}
+
+// enqueueUnAssignIP persists a failed unassign request to retry it later. Requests of the same ip are merged.
+func (p *FloatingIPPlugin) enqueueUnAssignIP(req *rpc.UnAssignIPRequest, cause error) error {
+	glog.Warningf("retry unassigning ip %s from node %s later: %v", req.IPAddress, req.NodeName, cause)
+	if err := p.updateCloudProviderOperation(req.IPAddress, func(spec *v1alpha1.CloudProviderOperationSpec) {
+		if !sets.NewString(spec.UnAssignNodes...).Has(req.NodeName) {
+			spec.UnAssignNodes = append(spec.UnAssignNodes, req.NodeName)
+		}
+		if spec.AssignNode == req.NodeName {
+			spec.AssignNode = ""
+		}
+	}, cause.Error()); err != nil {
+		return fmt.Errorf("%v, and failed to persist it for retrying: %v", cause, err)
+	}
+	return nil
+}
+
+// enqueueAssignIP persists a failed assign request to retry it later. Requests of the same ip are merged.
+func (p *FloatingIPPlugin) enqueueAssignIP(req *rpc.AssignIPRequest, cause error) error {
+	glog.Warningf("retry assigning ip %s to node %s later: %v", req.IPAddress, req.NodeName, cause)
+	if err := p.updateCloudProviderOperation(req.IPAddress, func(spec *v1alpha1.CloudProviderOperationSpec) {
+		spec.UnAssignNodes = sets.NewString(spec.UnAssignNodes...).Delete(req.NodeName).List()
+		spec.AssignNode = req.NodeName
+	}, cause.Error()); err != nil {
+		return fmt.Errorf("%v, and failed to persist it for retrying: %v", cause, err)
+	}
+	return nil
+}
+
+// cancelUnAssignIP removes the node from pending unassign requests of the ip after the ip is assigned to the node
+// again, e.g. a statefulset pod is recreated on the same node
+func (p *FloatingIPPlugin) cancelUnAssignIP(ip, nodeName string) {
+	if p.CPOLister == nil {
+		return
+	}
+	op, err := p.CPOLister.Get(ip)
+	if err != nil || !sets.NewString(op.Spec.UnAssignNodes...).Has(nodeName) {
+		return
+	}
+	if err := p.updateCloudProviderOperation(ip, func(spec *v1alpha1.CloudProviderOperationSpec) {
+		spec.UnAssignNodes = sets.NewString(spec.UnAssignNodes...).Delete(nodeName).List()
+	}, ""); err != nil {
+		glog.Warningf("failed to cancel unassigning ip %s from node %s: %v", ip, nodeName, err)
+	}
+}
+
+// flushUnAssignIP retries pending unassign requests of the ip from nodes other than nodeName before assigning it to
+// nodeName, so that an ip released or reserved after a failed unassign request is never assigned to two nodes. It
+// returns an error if any of them still fails. The operation is queried from apiserver as it may be just created.
+func (p *FloatingIPPlugin) flushUnAssignIP(ip, nodeName string) error {
+	if p.CPOLister == nil {
+		return nil
+	}
+	op, err := p.GalaxyClient.GalaxyV1alpha1().CloudProviderOperations().Get(ip, v1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	var unassigned []string
+	var lastErr error
+	for _, node := range op.Spec.UnAssignNodes {
+		if node == nodeName {
+			// canceled after assigning
+			continue
+		}
+		if err := p.cloudProviderUnAssignIP(&rpc.UnAssignIPRequest{NodeName: node, IPAddress: ip}); err != nil {
+			lastErr = fmt.Errorf("ip %s is pending unassigning from %s: %v", ip, node, err)
+			break
+		}
+		unassigned = append(unassigned, node)
+	}
+	if len(unassigned) > 0 {
+		var lastError string
+		if lastErr != nil {
+			lastError = lastErr.Error()
+		}
+		if err := p.updateCloudProviderOperation(ip, func(spec *v1alpha1.CloudProviderOperationSpec) {
+			spec.UnAssignNodes = sets.NewString(spec.UnAssignNodes...).Delete(unassigned...).List()
+		}, lastError); err != nil {
+			glog.Warningf("failed to update cloud provider operation of ip %s: %v", ip, err)
+		}
+	}
+	return lastErr
+}
+
+// updateCloudProviderOperation creates or updates the CloudProviderOperation of the ip, resetting its attempts as
+// the request changes
+func (p *FloatingIPPlugin) updateCloudProviderOperation(ip string, mutate func(*v1alpha1.CloudProviderOperationSpec),
+	lastError string) error {
+	client := p.GalaxyClient.GalaxyV1alpha1().CloudProviderOperations()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		op, err := client.Get(ip, v1.GetOptions{})
+		if err != nil {
+			if !apierrors.IsNotFound(err) {
+				return err
+			}
+			op = &v1alpha1.CloudProviderOperation{ObjectMeta: v1.ObjectMeta{Name: ip}}
+			mutate(&op.Spec)
+			op.Status.LastError = lastError
+			_, err = client.Create(op)
+			return err
+		}
+		mutate(&op.Spec)
+		if len(op.Spec.UnAssignNodes) == 0 && op.Spec.AssignNode == "" {
+			return client.Delete(ip, &v1.DeleteOptions{})
+		}
+		op.Status = v1alpha1.CloudProviderOperationStatus{LastError: lastError}
+		_, err = client.Update(op)
+		return err
+	})
+}
+
+// runCloudProviderWorker processes CloudProviderOperations until the queue is shut down
+func (p *FloatingIPPlugin) runCloudProviderWorker() {
+	for p.processCloudProviderOperation() {
+	}
+}
+
+func (p *FloatingIPPlugin) processCloudProviderOperation() bool {
+	key, quit := p.cpQueue.Get()
+	if quit {
+		return false
+	}
+	defer p.cpQueue.Done(key)
+	retryAfter, err := p.syncCloudProviderOperation(key.(string))
+	if err != nil {
+		glog.Warningf("failed to sync cloud provider operation %s: %v", key, err)
+		p.cpQueue.AddRateLimited(key)
+		return true
+	}
+	p.cpQueue.Forget(key)
+	if retryAfter > 0 {
+		p.cpQueue.AddAfter(key, retryAfter)
+	}
+	return true
+}
+
+// #lizard forgives
+// syncCloudProviderOperation executes the CloudProviderOperation of the ip. It returns the duration to wait before
+// the next attempt if the operation should be retried. Backoff is computed from the persisted attempts so that it is
+// kept after leader failover.
+func (p *FloatingIPPlugin) syncCloudProviderOperation(ip string) (time.Duration, error) {
+	op, err := p.CPOLister.Get(ip)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if op.Status.DeadLetter {
+		return 0, nil
+	}
+	if op.Status.Attempts > 0 {
+		next := op.Status.LastAttemptTime.Add(cloudProviderBackoff(op.Status.Attempts))
+		if wait := time.Until(next); wait > 0 {
+			return wait, nil
+		}
+	}
+	fip, err := p.ipam.ByIP(net.ParseIP(ip))
+	if err != nil {
+		return 0, err
+	}
+	op = op.DeepCopy()
+	var lastErr error
+	var remaining []string
+	for _, node := range op.Spec.UnAssignNodes {
+		if lastErr != nil {
+			remaining = append(remaining, node)
+			continue
+		}
+		if fip.Key != "" && fip.NodeName == node {
+			// the ip is assigned to the node again
+			continue
+		}
+		if err := p.cloudProviderUnAssignIP(&rpc.UnAssignIPRequest{NodeName: node, IPAddress: ip}); err != nil {
+			lastErr = fmt.Errorf("unassign from %s: %v", node, err)
+			remaining = append(remaining, node)
+		}
+	}
+	op.Spec.UnAssignNodes = remaining
+	if lastErr == nil && op.Spec.AssignNode != "" {
+		if fip.Key != "" && fip.NodeName == op.Spec.AssignNode {
+			if err := p.cloudProviderAssignIP(&rpc.AssignIPRequest{NodeName: op.Spec.AssignNode,
+				IPAddress: ip}); err != nil {
+				lastErr = fmt.Errorf("assign to %s: %v", op.Spec.AssignNode, err)
+			} else {
+				op.Spec.AssignNode = ""
+			}
+		} else {
+			// the ip is not allocated on the node any more
+			op.Spec.AssignNode = ""
+		}
+	}
+	client := p.GalaxyClient.GalaxyV1alpha1().CloudProviderOperations()
+	if lastErr == nil {
+		glog.Infof("cloud provider operation of ip %s is done", ip)
+		if err := client.Delete(ip, &v1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return 0, err
+		}
+		return 0, nil
+	}
+	op.Status.Attempts++
+	op.Status.LastError = lastErr.Error()
+	op.Status.LastAttemptTime = v1.Now()
+	op.Status.DeadLetter = op.Status.Attempts >= maxCloudProviderAttempts
+	if op.Status.DeadLetter {
+		glog.Errorf("give up cloud provider operation of ip %s after %d attempts: %v", ip, op.Status.Attempts,
+			lastErr)
+	} else {
+		glog.Warningf("cloud provider operation of ip %s failed %d times: %v", ip, op.Status.Attempts, lastErr)
+	}
+	if _, err := client.Update(op); err != nil {
+		return 0, err
+	}
+	if op.Status.DeadLetter {
+		return 0, nil
+	}
+	return cloudProviderBackoff(op.Status.Attempts), nil
+}
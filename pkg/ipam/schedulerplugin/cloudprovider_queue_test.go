@@ -0,0 +1,243 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+	. "tkestack.io/galaxy/pkg/ipam/cloudprovider/testing"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+// failingCloudProvider fails unassign requests if fail is true
+type failingCloudProvider struct {
+	*FakeCloudProvider
+	fail bool
+}
+
+func (f *failingCloudProvider) UnAssignIP(in *rpc.UnAssignIPRequest) (*rpc.UnAssignIPReply, error) {
+	if f.fail {
+		return nil, fmt.Errorf("timeout")
+	}
+	return f.FakeCloudProvider.UnAssignIP(in)
+}
+
+// waitForOperation waits until the lister observes the operation of the ip satisfying the condition
+func waitForOperation(p *FloatingIPPlugin, ip string,
+	condition func(*v1alpha1.CloudProviderOperation) bool) (*v1alpha1.CloudProviderOperation, error) {
+	var op *v1alpha1.CloudProviderOperation
+	err := wait.PollImmediate(10*time.Millisecond, 5*time.Second, func() (bool, error) {
+		var err error
+		op, err = p.CPOLister.Get(ip)
+		if errors.IsNotFound(err) {
+			return condition(nil), nil
+		}
+		return err == nil && condition(op), err
+	})
+	return op, err
+}
+
+// #lizard forgives
+func TestCloudProviderQueue(t *testing.T) {
+	pod := CreateStatefulSetPod("sts-0", "demo", nil)
+	keyObj, _ := util.FormatKey(pod)
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, pod)
+	defer func() { stopChan <- struct{}{} }()
+	cp := &failingCloudProvider{FakeCloudProvider: NewFakeCloudProvider(), fail: true}
+	fipPlugin.cloudProvider = cp
+	ip := "10.49.27.205"
+	if err := fipPlugin.ipam.AllocateSpecificIP(keyObj.KeyInDB, net.ParseIP(ip),
+		floatingip.Attr{NodeName: node3, Uid: string(pod.UID)}); err != nil {
+		t.Fatal(err)
+	}
+	// unbind doesn't fail but persists the unassign request
+	if err := fipPlugin.unbind(pod); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPKey(fipPlugin.ipam, ip, ""); err != nil {
+		t.Fatal(err)
+	}
+	op, err := waitForOperation(fipPlugin, ip, func(op *v1alpha1.CloudProviderOperation) bool { return op != nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(op.Spec.UnAssignNodes, []string{node3}) || op.Status.LastError == "" {
+		t.Fatalf("unexpected operation %v", op)
+	}
+	// a failed attempt updates status and backs off
+	retryAfter, err := fipPlugin.syncCloudProviderOperation(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retryAfter != minCloudProviderBackoff {
+		t.Fatalf("expect retry after %v, real %v", minCloudProviderBackoff, retryAfter)
+	}
+	if _, err := waitForOperation(fipPlugin, ip, func(op *v1alpha1.CloudProviderOperation) bool {
+		return op != nil && op.Status.Attempts == 1
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// no attempt during backoff
+	if retryAfter, err = fipPlugin.syncCloudProviderOperation(ip); err != nil || retryAfter <= 0 ||
+		retryAfter > minCloudProviderBackoff {
+		t.Fatalf("unexpected retry after %v, err %v", retryAfter, err)
+	}
+	// the operation becomes a dead letter after too many attempts
+	op, _ = fipPlugin.CPOLister.Get(ip)
+	op = op.DeepCopy()
+	op.Status.Attempts = maxCloudProviderAttempts - 1
+	op.Status.LastAttemptTime = v1.NewTime(time.Now().Add(-time.Hour))
+	if _, err := fipPlugin.GalaxyClient.GalaxyV1alpha1().CloudProviderOperations().Update(op); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waitForOperation(fipPlugin, ip, func(op *v1alpha1.CloudProviderOperation) bool {
+		return op != nil && op.Status.Attempts == maxCloudProviderAttempts-1
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if retryAfter, err = fipPlugin.syncCloudProviderOperation(ip); err != nil || retryAfter != 0 {
+		t.Fatalf("unexpected retry after %v, err %v", retryAfter, err)
+	}
+	if _, err := waitForOperation(fipPlugin, ip, func(op *v1alpha1.CloudProviderOperation) bool {
+		return op != nil && op.Status.DeadLetter
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// retrying a dead letter succeeds after the cloud provider recovers
+	cp.fail = false
+	op, _ = fipPlugin.CPOLister.Get(ip)
+	op = op.DeepCopy()
+	op.Status = v1alpha1.CloudProviderOperationStatus{}
+	if _, err := fipPlugin.GalaxyClient.GalaxyV1alpha1().CloudProviderOperations().Update(op); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waitForOperation(fipPlugin, ip, func(op *v1alpha1.CloudProviderOperation) bool {
+		return op != nil && !op.Status.DeadLetter
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fipPlugin.syncCloudProviderOperation(ip); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waitForOperation(fipPlugin, ip, func(op *v1alpha1.CloudProviderOperation) bool {
+		return op == nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if cp.UnAssigned[ip] != node3 {
+		t.Fatalf("expect %s unassigned from %s", ip, node3)
+	}
+}
+
+func TestCloudProviderOperationHandler(t *testing.T) {
+	fipPlugin, stopChan, _ := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	handler := fipPlugin.cloudProviderOperationHandler()
+	op := &v1alpha1.CloudProviderOperation{ObjectMeta: v1.ObjectMeta{Name: "10.49.27.205"},
+		Spec: v1alpha1.CloudProviderOperationSpec{UnAssignNodes: []string{node3}}}
+	// a new operation is enqueued without rate limiting
+	handler.OnAdd(op)
+	if fipPlugin.cpQueue.Len() != 1 {
+		t.Fatalf("expect new operation enqueued, got %d", fipPlugin.cpQueue.Len())
+	}
+	key, _ := fipPlugin.cpQueue.Get()
+	fipPlugin.cpQueue.Done(key)
+	// status written by the worker is skipped
+	updated := op.DeepCopy()
+	updated.Status.Attempts = 1
+	handler.OnUpdate(op, updated)
+	if fipPlugin.cpQueue.Len() != 0 {
+		t.Fatalf("expect status update skipped, got %d", fipPlugin.cpQueue.Len())
+	}
+	// a dead letter being retried is enqueued
+	dead := op.DeepCopy()
+	dead.Status.DeadLetter = true
+	handler.OnUpdate(dead, op)
+	if fipPlugin.cpQueue.Len() != 1 {
+		t.Fatalf("expect retried dead letter enqueued, got %d", fipPlugin.cpQueue.Len())
+	}
+}
+
+func TestCancelUnAssignIP(t *testing.T) {
+	fipPlugin, stopChan, _ := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	ip := "10.49.27.205"
+	if err := fipPlugin.enqueueUnAssignIP(&rpc.UnAssignIPRequest{NodeName: node3, IPAddress: ip},
+		fmt.Errorf("timeout")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := waitForOperation(fipPlugin, ip, func(op *v1alpha1.CloudProviderOperation) bool {
+		return op != nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// the ip is assigned to the same node again before retrying
+	fipPlugin.cancelUnAssignIP(ip, node3)
+	if _, err := waitForOperation(fipPlugin, ip, func(op *v1alpha1.CloudProviderOperation) bool {
+		return op == nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBindWithPendingUnAssign(t *testing.T) {
+	pod := CreateStatefulSetPod("sts-0", "demo", nil)
+	keyObj, _ := util.FormatKey(pod)
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, pod)
+	defer func() { stopChan <- struct{}{} }()
+	cp := &failingCloudProvider{FakeCloudProvider: NewFakeCloudProvider(), fail: true}
+	fipPlugin.cloudProvider = cp
+	ip := "10.49.27.205"
+	// the ip is kept for the pod after failing to unassign it from its previous node
+	if err := fipPlugin.ipam.AllocateSpecificIP(keyObj.KeyInDB, net.ParseIP(ip), floatingip.Attr{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.enqueueUnAssignIP(&rpc.UnAssignIPRequest{NodeName: node4, IPAddress: ip},
+		fmt.Errorf("timeout")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fipPlugin.allocateIP(keyObj.KeyInDB, node3, pod); allocateFailureReason(err) != "pending_unassign" {
+		t.Fatalf("expect binding fails with pending unassign, got %v", err)
+	}
+	if _, ok := cp.Assigned[ip]; ok {
+		t.Fatalf("expect %s not assigned", ip)
+	}
+	cp.fail = false
+	if _, err := fipPlugin.allocateIP(keyObj.KeyInDB, node3, pod); err != nil {
+		t.Fatal(err)
+	}
+	if cp.UnAssigned[ip] != node4 || cp.Assigned[ip] != node3 {
+		t.Fatalf("expect %s unassigned from %s and assigned to %s, got %v %v", ip, node4, node3, cp.UnAssigned,
+			cp.Assigned)
+	}
+	if _, err := waitForOperation(fipPlugin, ip, func(op *v1alpha1.CloudProviderOperation) bool {
+		return op == nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
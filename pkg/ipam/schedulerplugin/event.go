@@ -17,19 +17,10 @@
 package schedulerplugin
 
 import (
-	"time"
-
 	corev1 "k8s.io/api/core/v1"
 	glog "k8s.io/klog"
-	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
 )
 
-// releaseEvent keeps track of retried times of unbinding pod
-type releaseEvent struct {
-	pod        *corev1.Pod
-	retryTimes int
-}
-
 // AddPod does nothing
 func (p *FloatingIPPlugin) AddPod(pod *corev1.Pod) error {
 	return nil
@@ -37,14 +28,15 @@ func (p *FloatingIPPlugin) AddPod(pod *corev1.Pod) error {
 
 // UpdatePod syncs pod ip with ipam
 func (p *FloatingIPPlugin) UpdatePod(oldPod, newPod *corev1.Pod) error {
-	if !p.hasResourceName(&newPod.Spec) {
+	// pod events are handled by the leader, release workers are not running on other replicas
+	if !p.isLeader() || !p.hasResourceName(&newPod.Spec) {
 		return nil
 	}
 	if !finished(oldPod) && finished(newPod) {
 		// Deployments will leave evicted pods
 		// If it's a evicted one, release its ip
 		glog.Infof("release ip from %s_%s, phase %s", newPod.Name, newPod.Namespace, string(newPod.Status.Phase))
-		p.unreleased <- &releaseEvent{pod: newPod}
+		p.enqueueRelease(newPod)
 		return nil
 	}
 	if err := p.syncPodIP(newPod); err != nil {
@@ -55,37 +47,10 @@ func (p *FloatingIPPlugin) UpdatePod(oldPod, newPod *corev1.Pod) error {
 
 // DeletePod unbinds pod from ipam
 func (p *FloatingIPPlugin) DeletePod(pod *corev1.Pod) error {
-	if !p.hasResourceName(&pod.Spec) {
+	if !p.isLeader() || !p.hasResourceName(&pod.Spec) {
 		return nil
 	}
 	glog.Infof("handle pod delete event: %s_%s", pod.Name, pod.Namespace)
-	p.unreleased <- &releaseEvent{pod: pod}
+	p.enqueueRelease(pod)
 	return nil
 }
-
-// loop pulls release event from chan and calls unbind to unbind pod
-func (p *FloatingIPPlugin) loop(stop chan struct{}) {
-	for {
-		select {
-		case <-stop:
-			return
-		case event := <-p.unreleased:
-			go func(event *releaseEvent) {
-				if err := p.unbind(event.pod); err != nil {
-					event.retryTimes++
-					if event.retryTimes > 3 {
-						// leave it to resync to protect chan from explosion
-						glog.Errorf("abort unbind for pod %s, retried %d times: %v", util.PodName(event.pod),
-							event.retryTimes, err)
-					} else {
-						glog.Warningf("unbind pod %s failed for %d times: %v", util.PodName(event.pod),
-							event.retryTimes, err)
-						// backoff time if required
-						time.Sleep(100 * time.Millisecond * time.Duration(event.retryTimes))
-						p.unreleased <- event
-					}
-				}
-			}(event)
-		}
-	}
-}
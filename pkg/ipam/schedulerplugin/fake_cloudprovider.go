@@ -19,6 +19,7 @@ package schedulerplugin
 
 import (
 	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider"
 	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
 )
 
@@ -37,3 +38,15 @@ func (f *fakeCloudProvider1) UnAssignIP(in *rpc.UnAssignIPRequest) (*rpc.UnAssig
 	glog.Infof(`f.m["2"] = "b"`)
 	return &rpc.UnAssignIPReply{Success: true}, nil
 }
+
+func (f *fakeCloudProvider1) BatchAssignIP(in *rpc.BatchAssignIPRequest) (*rpc.BatchAssignIPReply, error) {
+	return cloudprovider.BatchAssignIPOneByOne(f.AssignIP, in)
+}
+
+func (f *fakeCloudProvider1) BatchUnAssignIP(in *rpc.BatchUnAssignIPRequest) (*rpc.BatchUnAssignIPReply, error) {
+	return cloudprovider.BatchUnAssignIPOneByOne(f.UnAssignIP, in)
+}
+
+func (f *fakeCloudProvider1) ListAssignedIPs(in *rpc.ListAssignedIPsRequest) (*rpc.ListAssignedIPsReply, error) {
+	return nil, cloudprovider.ErrNotSupported
+}
@@ -78,10 +78,17 @@ func (p *FloatingIPPlugin) getSubnet(pod *corev1.Pod) (sets.String, error) {
 	if err != nil {
 		return nil, err
 	}
-	cniArgs, err := getPodCniArgs(pod)
+	cniArgs, err := p.getPodCniArgs(pod)
 	if err != nil {
 		return nil, err
 	}
+	staticIP, err := constant.ParseStaticIP(pod.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	if staticIP != nil {
+		return p.getStaticIPSubnet(pod, keyObj, staticIP, cniArgs)
+	}
 	ipranges := cniArgs.RequestIPRange
 	// first check if exists an already allocated ip for this pod
 	ipInfos, err := p.ipam.ByKeyAndIPRanges(keyObj.KeyInDB, ipranges)
@@ -136,6 +143,32 @@ func (p *FloatingIPPlugin) getSubnet(pod *corev1.Pod) (sets.String, error) {
 		// Lock to make checking available subnets and allocating reserved ip atomic
 		defer p.LockDpPool(keyObj.PoolPrefix())()
 	}
+	gangSize, err := constant.ParseGangSize(pod.Annotations)
+	if err != nil {
+		return nil, err
+	}
+	var gangSubnets sets.String
+	if gangSize > 0 {
+		if len(cniArgs.RequestIPRange) > 0 {
+			return nil, fmt.Errorf("gang reservation for pod requesting ip ranges is not supported")
+		}
+		if !keyObj.Deployment() {
+			defer p.LockDpPool(keyObj.PoolPrefix())()
+		}
+		if gangSubnets, err = p.filterGang(keyObj, gangSize, policy); err != nil {
+			return nil, err
+		}
+		if !keyObj.Deployment() {
+			// pod may get a reserved ip of the gang
+			if ipInfo, err := p.ipam.First(keyObj.KeyInDB); err != nil {
+				return nil, fmt.Errorf("failed to query by key %s: %v", keyObj.KeyInDB, err)
+			} else if ipInfo != nil {
+				glog.V(3).Infof("%s got a reserved ip %s of gang in subnets %v", keyObj.KeyInDB,
+					ipInfo.IP.String(), ipInfo.NodeSubnets)
+				return ipInfo.NodeSubnets, nil
+			}
+		}
+	}
 	subnetSet, reserve, err := p.getAvailableSubnet(keyObj, policy, replicas, isPoolSizeDefined, ipranges)
 	if err != nil {
 		return nil, err
@@ -143,6 +176,10 @@ func (p *FloatingIPPlugin) getSubnet(pod *corev1.Pod) (sets.String, error) {
 	if allocatedSubnets.Len() > 0 {
 		subnetSet = subnetSet.Intersection(allocatedSubnets)
 	}
+	if gangSubnets != nil {
+		// pin pods of the gang to nodes of the gang's node subnet
+		subnetSet = subnetSet.Intersection(gangSubnets)
+	}
 	if (reserve || isPoolSizeDefined) && subnetSet.Len() > 0 {
 		// Since bind is in a different goroutine than filter in scheduler, we can't ensure this pod got binded
 		// before the next one got filtered to ensure max size of allocated ips.
@@ -178,3 +215,61 @@ func (p *FloatingIPPlugin) allocateDuringFilter(keyObj *util.KeyObj, reserve, is
 	}
 	return nil
 }
+
+// getStaticIPSubnet allocates the static ip to the pod if it is not allocated and returns node subnets of the ip
+func (p *FloatingIPPlugin) getStaticIPSubnet(pod *corev1.Pod, keyObj *util.KeyObj, staticIP net.IP,
+	cniArgs constant.CniArgs) (sets.String, error) {
+	if keyObj.Deployment() || keyObj.PoolName != "" {
+		return nil, fmt.Errorf("static ip is not supported for deployment or pool pod %s", keyObj.KeyInDB)
+	}
+	if len(cniArgs.RequestIPRange) > 0 {
+		return nil, fmt.Errorf("static ip can't be used together with request_ip_range")
+	}
+	ipInfos, err := p.ipam.ByKeyAndIPRanges(keyObj.KeyInDB, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query by key %s: %v", keyObj.KeyInDB, err)
+	}
+	for i := range ipInfos {
+		if ipInfos[i].IP.Equal(staticIP) {
+			glog.V(3).Infof("%s already have static ip %s in subnets %v", keyObj.KeyInDB, staticIP.String(),
+				ipInfos[i].NodeSubnets)
+			if !ipInfos[i].Static {
+				// mark static ips allocated by earlier versions
+				fip := &ipInfos[i].FloatingIP
+				attr := floatingip.Attr{Policy: constant.ReleasePolicy(fip.Policy), NodeName: fip.NodeName,
+					Uid: fip.PodUid, BindPhase: fip.BindPhase, Static: true}
+				if err := p.ipam.UpdateAttr(keyObj.KeyInDB, staticIP, attr); err != nil {
+					return nil, fmt.Errorf("failed to mark static ip %s of %s: %v", staticIP.String(),
+						keyObj.KeyInDB, err)
+				}
+			}
+			return ipInfos[i].NodeSubnets, nil
+		}
+		return nil, fmt.Errorf("%s already have ip %s other than static ip %s, please release it first",
+			keyObj.KeyInDB, ipInfos[i].IP.String(), staticIP.String())
+	}
+	fip, err := p.ipam.ByIP(staticIP)
+	if err != nil {
+		return nil, err
+	}
+	if fip.IP == nil {
+		return nil, fmt.Errorf("static ip %s is not within any floating ip pool", staticIP.String())
+	}
+	if fip.Key != "" {
+		return nil, fmt.Errorf("static ip %s has been allocated to %s", staticIP.String(), fip.Key)
+	}
+	// allocate in filter to reject other pods requesting the same ip
+	attr := floatingip.Attr{Policy: parseReleasePolicy(&pod.ObjectMeta), Uid: string(pod.UID), Static: true}
+	if err := p.ipam.AllocateSpecificIP(keyObj.KeyInDB, staticIP, attr); err != nil {
+		return nil, fmt.Errorf("failed to allocate static ip %s to %s: %v", staticIP.String(), keyObj.KeyInDB, err)
+	}
+	glog.Infof("allocated static ip %s to %s during filter", staticIP.String(), keyObj.KeyInDB)
+	ipInfo, err := p.ipam.First(keyObj.KeyInDB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query by key %s: %v", keyObj.KeyInDB, err)
+	}
+	if ipInfo == nil {
+		return nil, fmt.Errorf("static ip %s of %s not found after allocation", staticIP.String(), keyObj.KeyInDB)
+	}
+	return ipInfo.NodeSubnets, nil
+}
@@ -17,6 +17,7 @@
 package schedulerplugin
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"reflect"
@@ -32,6 +33,7 @@ import (
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
 	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
 	schedulerplugin_util "tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+	"tkestack.io/galaxy/pkg/ipam/utils"
 	. "tkestack.io/galaxy/pkg/utils/test"
 )
 
@@ -411,3 +413,205 @@ func TestFilterForCRDPod(t *testing.T) {
 		}
 	}
 }
+
+func TestFilterGang(t *testing.T) {
+	fipPlugin, stopChan, nodes := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	// 10.0.70.0/24 pool is the first node subnet which is able to hold the gang
+	nodes = append(nodes, CreateNode("node5", nil, "10.0.1.5"))
+	pod := CreateStatefulSetPod("sts-1", "ns1", map[string]string{
+		constant.ReleasePolicyAnnotation: constant.Immutable, constant.GangSizeAnnotation: "3"})
+	filtered, _, err := fipPlugin.Filter(pod, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// all pods of the gang should have a reserved ip in the same node subnet
+	var subnets sets.String
+	for i := 0; i < 3; i++ {
+		ipInfo, err := fipPlugin.ipam.First(fmt.Sprintf("sts_ns1_sts_sts-%d", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ipInfo == nil {
+			t.Fatalf("expect pod sts-%d has an reserved ip", i)
+		}
+		if subnets == nil {
+			subnets = ipInfo.NodeSubnets
+		} else if !subnets.Equal(ipInfo.NodeSubnets) {
+			t.Fatalf("expect same node subnets %v, got %v", subnets, ipInfo.NodeSubnets)
+		}
+	}
+	// pods of the gang should be pinned to nodes of the gang's node subnet
+	if err := checkFiltered(filtered, "node5"); err != nil {
+		t.Fatal(err)
+	}
+	// a gang larger than any node subnet can hold should fail
+	pod = CreateStatefulSetPod("sts2-0", "ns1", map[string]string{
+		constant.ReleasePolicyAnnotation: constant.Immutable, constant.GangSizeAnnotation: "1000"})
+	if _, _, err := fipPlugin.Filter(pod, nodes); err == nil || !strings.Contains(err.Error(), "ips left for gang") {
+		t.Fatalf("expect no enough ips error for gang, got %v", err)
+	}
+	if ipInfo, err := fipPlugin.ipam.First("sts_ns1_sts2_sts2-0"); err != nil || ipInfo != nil {
+		t.Fatalf("expect no ip reserved for the gang, got %v, err %v", ipInfo, err)
+	}
+}
+
+// #lizard forgives
+func TestGrowGang(t *testing.T) {
+	fipPlugin, stopChan, _ := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	dpPod := CreateDeploymentPod("dp-xxx-yyy", "ns1", immutableAnnotation)
+	dpKey, _ := schedulerplugin_util.FormatKey(dpPod)
+	stsPod := CreateStatefulSetPod("sts-0", "ns1", immutableAnnotation)
+	stsKey, _ := schedulerplugin_util.FormatKey(stsPod)
+	for _, keyObj := range []*schedulerplugin_util.KeyObj{dpKey, stsKey} {
+		if _, _, err := fipPlugin.ReserveGang(keyObj, 2, constant.ReleasePolicyImmutable); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// hand out a reserved ip of the deployment to its pod
+	fips, err := fipPlugin.ipam.ByPrefix(dpKey.PoolPrefix())
+	if err != nil || len(fips) != 2 {
+		t.Fatalf("expect 2 reserved ips, got %v, err %v", fips, err)
+	}
+	if err := fipPlugin.ipam.AllocateInSubnetWithKey(dpKey.PoolPrefix(), dpKey.KeyInDB, fips[0].NodeSubnets.List()[0],
+		floatingip.Attr{Policy: constant.ReleasePolicyImmutable}); err != nil {
+		t.Fatal(err)
+	}
+	for _, keyObj := range []*schedulerplugin_util.KeyObj{dpKey, stsKey} {
+		fips, subnets, err := fipPlugin.ReserveGang(keyObj, 3, constant.ReleasePolicyImmutable)
+		if err != nil {
+			t.Fatalf("failed to grow gang %s: %v", keyObj.PoolPrefix(), err)
+		}
+		if subnets.Len() == 0 {
+			t.Fatalf("expect ips of gang %s in the same node subnet", keyObj.PoolPrefix())
+		}
+		keys := map[string]int{}
+		for i := range fips {
+			keys[fips[i].Key]++
+		}
+		var expect map[string]int
+		if keyObj.Deployment() {
+			// ips handed out to pods are not counted
+			expect = map[string]int{dpKey.PoolPrefix(): 3, dpKey.KeyInDB: 1}
+		} else {
+			expect = map[string]int{"sts_ns1_sts_sts-0": 1, "sts_ns1_sts_sts-1": 1, "sts_ns1_sts_sts-2": 1}
+		}
+		if !reflect.DeepEqual(expect, keys) {
+			t.Fatalf("expect %v, got %v", expect, keys)
+		}
+	}
+	// filtering pods of the deployment doesn't reserve more ips
+	if _, err := fipPlugin.filterGang(dpKey, 3, constant.ReleasePolicyImmutable); err != nil {
+		t.Fatal(err)
+	}
+	if fips, err := fipPlugin.ipam.ByPrefix(dpKey.PoolPrefix()); err != nil || len(fips) != 4 {
+		t.Fatalf("expect 4 ips, got %v, err %v", fips, err)
+	}
+}
+
+func TestFilterByNodeSelector(t *testing.T) {
+	var conf Conf
+	if err := json.Unmarshal([]byte(utils.TestConfig), &conf); err != nil {
+		t.Fatal(err)
+	}
+	var rackPool floatingip.FloatingIPPool
+	if err := json.Unmarshal([]byte(`{"nodeSubnets":["10.1.0.0/24"],"nodeSelector":{"matchLabels":`+
+		`{"rack":"r1"}},"ips":["10.0.90.2~10.0.90.3"],"subnet":"10.0.90.0/24","gateway":"10.0.90.1"}`),
+		&rackPool); err != nil {
+		t.Fatal(err)
+	}
+	conf.FloatingIPs = append(conf.FloatingIPs, &rackPool)
+	// node ip of rackNode is in 10.49.27.0/24, but it is selected by the rack pool by labels
+	rackNode := CreateNode("rack-node", map[string]string{"rack": "r1"}, "10.49.27.4")
+	otherNode := CreateNode("other-node", map[string]string{"rack": "r2"}, "10.48.28.4")
+	pod := CreateStatefulSetPod("sts-0", "ns1", nil)
+	fipPlugin, stopChan := newPlugin(t, conf, []runtime.Object{&rackNode, &otherNode, pod}, nil, nil)
+	defer func() { stopChan <- struct{}{} }()
+	nodes := []corev1.Node{rackNode, otherNode}
+	filtered, failed, err := fipPlugin.Filter(pod, nodes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkFilterResult(filtered, failed, []string{"rack-node"}, []string{"other-node"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.Bind(&schedulerapi.ExtenderBindingArgs{PodName: pod.Name, PodNamespace: pod.Namespace,
+		Node: "rack-node"}); err != nil {
+		t.Fatal(err)
+	}
+	ipInfo, err := fipPlugin.ipam.First("sts_ns1_sts_sts-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ipInfo == nil || !ipInfo.NodeSubnets.Has("10.1.0.0/24") {
+		t.Fatalf("expect an ip of the rack pool, got %v", ipInfo)
+	}
+	// node subnet falls back to the one of node ip once the label is removed
+	rackNode.Labels = nil
+	if _, err := fipPlugin.Client.CoreV1().Nodes().Update(&rackNode); err != nil {
+		t.Fatal(err)
+	}
+	if subnet, err := fipPlugin.getNodeSubnet(&rackNode); err != nil || subnet.String() != "10.49.27.0/24" {
+		t.Fatalf("expect node subnet 10.49.27.0/24, got %v, err %v", subnet, err)
+	}
+	if subnet, err := fipPlugin.queryNodeSubnet(rackNode.Name); err != nil || subnet.String() != "10.49.27.0/24" {
+		t.Fatalf("expect node subnet 10.49.27.0/24, got %v, err %v", subnet, err)
+	}
+}
+
+// #lizard forgives
+func TestFilterStaticIP(t *testing.T) {
+	barePod := CreateSimplePod("pod1", "ns1", map[string]string{constant.StaticIPAnnotation: "10.49.27.216",
+		constant.ReleasePolicyAnnotation: constant.Immutable})
+	jobPod := CreatePodWithKind("job-xx", "ns1", "Job", map[string]string{constant.StaticIPAnnotation: "10.49.27.217"})
+	fipPlugin, stopChan, nodes := createPluginTestNodes(t, barePod, jobPod)
+	defer func() { stopChan <- struct{}{} }()
+	bareKey, _ := schedulerplugin_util.FormatKey(barePod)
+	jobKey, _ := schedulerplugin_util.FormatKey(jobPod)
+	for _, p := range []*corev1.Pod{barePod, jobPod} {
+		// pods should be scheduled to nodes of the static ip's node subnet
+		if err := checkFilterCase(fipPlugin, filterCase{testPod: p, expectFiltererd: []string{node3},
+			expectFailed: []string{drainedNode, nodeHasNoIP, node4}}, nodes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := checkIPKey(fipPlugin.ipam, "10.49.27.216", bareKey.KeyInDB); err != nil {
+		t.Fatal(err)
+	}
+	if fip, err := fipPlugin.ipam.ByIP(net.ParseIP("10.49.27.216")); err != nil || !fip.Static {
+		t.Fatalf("expect a static ip, got %v, %v", fip, err)
+	}
+	// other pods requesting the same ip are rejected
+	conflictPod := CreateSimplePod("pod2", "ns1", map[string]string{constant.StaticIPAnnotation: "10.49.27.216"})
+	if _, _, err := fipPlugin.Filter(conflictPod, nodes); err == nil ||
+		!strings.Contains(err.Error(), "has been allocated to "+bareKey.KeyInDB) {
+		t.Fatalf("expect conflict error, got %v", err)
+	}
+	for _, ip := range []string{"10.49.27", "10.49.30.2"} {
+		badPod := CreateSimplePod("pod3", "ns1", map[string]string{constant.StaticIPAnnotation: ip})
+		if _, _, err := fipPlugin.Filter(badPod, nodes); err == nil {
+			t.Fatalf("expect an error for static ip %s", ip)
+		}
+	}
+	for _, p := range []*corev1.Pod{barePod, jobPod} {
+		podKey, _ := schedulerplugin_util.FormatKey(p)
+		fipInfo, err := checkBind(fipPlugin, p, node3, podKey.KeyInDB, node3Subnet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fipInfo.IP.String() != p.Annotations[constant.StaticIPAnnotation] {
+			t.Fatalf("expect static ip %s, got %s", p.Annotations[constant.StaticIPAnnotation], fipInfo.IP.String())
+		}
+		if err := fipPlugin.unbind(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// immutable static ip is kept for the bare pod's name, while static ip of pod delete policy is released
+	if err := checkIPKey(fipPlugin.ipam, "10.49.27.216", bareKey.KeyInDB); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPKey(fipPlugin.ipam, "10.49.27.217", ""); err != nil {
+		t.Fatalf("%s: %v", jobKey.KeyInDB, err)
+	}
+}
@@ -21,12 +21,15 @@ import (
 	"net"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
 	glog "k8s.io/klog"
 	"k8s.io/utils/keymutex"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
@@ -36,6 +39,7 @@ import (
 	"tkestack.io/galaxy/pkg/ipam/context"
 	"tkestack.io/galaxy/pkg/ipam/crd"
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
 	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
 )
 
@@ -48,7 +52,6 @@ type FloatingIPPlugin struct {
 	*context.IPAMContext
 	lastIPConf    string
 	conf          *Conf
-	unreleased    chan *releaseEvent
 	cloudProvider cloudprovider.CloudProvider
 	// protect unbind immutable deployment pod
 	dpLockPool keymutex.KeyMutex
@@ -56,6 +59,23 @@ type FloatingIPPlugin struct {
 	podLockPool keymutex.KeyMutex
 	crdCache    crd.CrdCache
 	crdKey      CrdKey
+	// statefulset keys to reserve or release ips
+	stsQueue workqueue.RateLimitingInterface
+	// namespace_name of deleted statefulsets of pools to the key prefix of their ips
+	deletedStatefulSets     map[string]string
+	deletedStatefulSetsLock sync.Mutex
+	// ips of CloudProviderOperations to retry
+	cpQueue workqueue.RateLimitingInterface
+	// keys to release ips of deleted or finished pods or to resync with pods
+	releaseQueue workqueue.RateLimitingInterface
+	// the latest deleted or finished pod of each key in releaseQueue
+	releasePods     map[string]*corev1.Pod
+	releasePodsLock sync.Mutex
+	// leading is 1 if it runs background jobs, replicas other than the leader only serve requests if active-active
+	leading           int32
+	configMapSyncOnce sync.Once
+	// ip to the resource version of its floatingip of interrupted binds found by the last recoverBinds
+	bindRecoveryVersions map[string]string
 }
 
 // NewFloatingIPPlugin creates FloatingIPPlugin
@@ -66,15 +86,30 @@ func NewFloatingIPPlugin(conf Conf, ctx *context.IPAMContext) (*FloatingIPPlugin
 		nodeSubnet:  make(map[string]*net.IPNet),
 		IPAMContext: ctx,
 		conf:        &conf,
-		unreleased:  make(chan *releaseEvent, 50000),
 		dpLockPool:  keymutex.NewHashed(500000),
 		podLockPool: keymutex.NewHashed(500000),
 		crdKey:      NewCrdKey(ctx.ExtensionLister),
 		crdCache:    crd.NewCrdCache(ctx.DynamicClient, ctx.ExtensionLister, 0),
+		stsQueue:    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "statefulset"),
+		cpQueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "cloudprovider"),
+		releaseQueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(),
+			"release"),
+		releasePods:         map[string]*corev1.Pod{},
+		deletedStatefulSets: map[string]string{},
+	}
+	if conf.ActiveActive {
+		plugin.ipam = floatingip.NewSharedCrdIPAM(ctx.GalaxyClient, floatingip.InternalIp, plugin.FIPInformer)
+	} else {
+		plugin.ipam = floatingip.NewCrdIPAM(ctx.GalaxyClient, floatingip.InternalIp, plugin.FIPInformer)
+		plugin.leading = 1
+	}
+	if plugin.FIPInformer != nil {
+		plugin.FIPInformer.Informer().AddEventHandler(plugin.floatingIPResyncHandler())
 	}
-	plugin.ipam = floatingip.NewCrdIPAM(ctx.GalaxyClient, floatingip.InternalIp, plugin.FIPInformer)
 	if conf.CloudProviderGRPCAddr != "" {
-		plugin.cloudProvider = cloudprovider.NewGRPCCloudProvider(conf.CloudProviderGRPCAddr)
+		plugin.cloudProvider = cloudprovider.NewGRPCCloudProviderWithAuth(conf.CloudProviderGRPCAddr,
+			conf.CloudProviderTLS, conf.CloudProviderTokenFile)
+		ctx.CPOInformer.Informer().AddEventHandler(plugin.cloudProviderOperationHandler())
 	}
 	return plugin, nil
 }
@@ -101,43 +136,108 @@ func (p *FloatingIPPlugin) Init() error {
 	return nil
 }
 
+// RunFollower starts routines required to serve requests before leading if replicas are active-active
+func (p *FloatingIPPlugin) RunFollower(stop chan struct{}) {
+	p.startConfigMapSync(stop)
+}
+
 // Run starts resyncing pod routine
 func (p *FloatingIPPlugin) Run(stop chan struct{}) {
-	if len(p.conf.FloatingIPs) == 0 {
-		go wait.Until(func() {
-			if _, err := p.updateConfigMap(); err != nil {
-				glog.Warning(err)
-			}
-		}, time.Minute, stop)
+	atomic.StoreInt32(&p.leading, 1)
+	if p.conf.ActiveActive {
+		p.ipam.SetLeader(true)
+		// delete crds of ips removed from config which are left to the leader
+		if err := p.ipam.ConfigurePool(p.ipam.Pools()); err != nil {
+			glog.Warningf("failed to configure pool after leading: %v", err)
+		}
+		// followers don't enqueue, so the queues are empty
+		p.enqueueExisting()
 	}
+	p.startConfigMapSync(stop)
 	go wait.Until(func() {
 		if err := p.resyncPod(); err != nil {
 			glog.Warningf("resync pod: %v", err)
 		}
 		p.syncPodIPsIntoDB()
 	}, time.Duration(p.conf.ResyncInterval)*time.Minute, stop)
-	for i := 0; i < 5; i++ {
-		go p.loop(stop)
+	if p.cloudProvider != nil {
+		go wait.Until(p.reconcileCloudProvider, time.Duration(p.conf.CloudProviderReconcileInterval)*time.Minute,
+			stop)
+		go wait.Until(p.runCloudProviderWorker, time.Second, stop)
+	}
+	for i := 0; i < releaseWorkers; i++ {
+		go wait.Until(p.runReleaseWorker, time.Second, stop)
+	}
+	go wait.Until(p.runStatefulSetWorker, time.Second, stop)
+	go wait.Until(p.recoverBinds, bindRecoveryInterval, stop)
+}
+
+// startConfigMapSync starts syncing floatingips configmap once if floatingips are not configured in json config
+func (p *FloatingIPPlugin) startConfigMapSync(stop chan struct{}) {
+	if len(p.conf.FloatingIPs) > 0 {
+		return
+	}
+	p.configMapSyncOnce.Do(func() {
+		go wait.Until(func() {
+			if _, err := p.updateConfigMap(); err != nil {
+				glog.Warning(err)
+			}
+		}, time.Minute, stop)
+	})
+}
+
+// enqueueExisting enqueues existing statefulsets and CloudProviderOperations after it starts leading
+func (p *FloatingIPPlugin) enqueueExisting() {
+	if p.StatefulSetLister != nil {
+		statefulSets, err := p.StatefulSetLister.List(labels.Everything())
+		if err != nil {
+			glog.Warningf("failed to list statefulsets: %v", err)
+		}
+		for _, ss := range statefulSets {
+			p.enqueueStatefulSet(ss)
+		}
+	}
+	if p.cloudProvider != nil && p.CPOLister != nil {
+		ops, err := p.CPOLister.List(labels.Everything())
+		if err != nil {
+			glog.Warningf("failed to list cloud provider operations: %v", err)
+		}
+		for _, op := range ops {
+			p.cpQueue.Add(op.Name)
+		}
 	}
 }
 
+// isLeader returns true if it runs background jobs
+func (p *FloatingIPPlugin) isLeader() bool {
+	return atomic.LoadInt32(&p.leading) == 1
+}
+
 // updateConfigMap fetches the newest floatingips configmap and syncs in memory/db config,
 // returns true if successfully gets floatingip config.
 func (p *FloatingIPPlugin) updateConfigMap() (bool, error) {
 	cm, err := p.Client.CoreV1().ConfigMaps(p.conf.ConfigMapNamespace).Get(p.conf.ConfigMapName, v1.GetOptions{})
 	if err != nil {
+		metrics.ConfigMapReloadCount.WithLabelValues("failure").Inc()
 		return false, fmt.Errorf("failed to get floatingip configmap %s_%s: %v", p.conf.ConfigMapName,
 			p.conf.ConfigMapNamespace, err)
 	}
 	val, ok := cm.Data[p.conf.FloatingIPKey]
 	if !ok {
+		metrics.ConfigMapReloadCount.WithLabelValues("failure").Inc()
 		return false, fmt.Errorf("configmap %s_%s doesn't have a key floatingips", p.conf.ConfigMapName,
 			p.conf.ConfigMapNamespace)
 	}
 	var updated bool
 	if updated, err = p.ensureIPAMConf(&p.lastIPConf, val); err != nil {
+		metrics.ConfigMapReloadCount.WithLabelValues("failure").Inc()
 		return false, err
 	}
+	if updated {
+		metrics.ConfigMapReloadCount.WithLabelValues("updated").Inc()
+	} else {
+		metrics.ConfigMapReloadCount.WithLabelValues("unchanged").Inc()
+	}
 	defer func() {
 		if !updated {
 			return
@@ -183,11 +283,20 @@ func finished(pod *corev1.Pod) bool {
 func (p *FloatingIPPlugin) getNodeSubnet(node *corev1.Node) (*net.IPNet, error) {
 	p.nodeSubnetLock.Lock()
 	defer p.nodeSubnetLock.Unlock()
-	if subnet, ok := p.nodeSubnet[node.Name]; !ok {
-		return p.getNodeSubnetfromIPAM(node)
-	} else {
+	return p.nodeSubnetOf(node)
+}
+
+// nodeSubnetOf gets node subnet from pools selecting the node by labels, or the cache, or ipam. Make sure
+// nodeSubnetLock is held when calling it.
+func (p *FloatingIPPlugin) nodeSubnetOf(node *corev1.Node) (*net.IPNet, error) {
+	// node labels may change, so subnets of pools selecting nodes by labels are never cached
+	if ipNet := p.ipam.NodeSubnetByLabels(node.Labels); ipNet != nil {
+		return ipNet, nil
+	}
+	if subnet, ok := p.nodeSubnet[node.Name]; ok {
 		return subnet, nil
 	}
+	return p.getNodeSubnetfromIPAM(node)
 }
 
 // queryNodeSubnet gets node subnet from ipam
@@ -197,20 +306,30 @@ func (p *FloatingIPPlugin) queryNodeSubnet(nodeName string) (*net.IPNet, error)
 	)
 	p.nodeSubnetLock.Lock()
 	defer p.nodeSubnetLock.Unlock()
-	if subnet, ok := p.nodeSubnet[nodeName]; !ok {
-		if err := wait.Poll(time.Millisecond*100, time.Minute, func() (done bool, err error) {
-			node, err = p.Client.CoreV1().Nodes().Get(nodeName, v1.GetOptions{})
-			if !apierrors.IsServerTimeout(err) {
-				return true, err
-			}
-			return false, nil
-		}); err != nil {
-			return nil, err
-		}
-		return p.getNodeSubnetfromIPAM(node)
-	} else {
+	// labels of the node are needed to check pools selecting nodes by labels
+	if subnet, ok := p.nodeSubnet[nodeName]; ok && !p.selectNodesByLabels() {
 		return subnet, nil
 	}
+	if err := wait.Poll(time.Millisecond*100, time.Minute, func() (done bool, err error) {
+		node, err = p.Client.CoreV1().Nodes().Get(nodeName, v1.GetOptions{})
+		if !apierrors.IsServerTimeout(err) {
+			return true, err
+		}
+		return false, nil
+	}); err != nil {
+		return nil, err
+	}
+	return p.nodeSubnetOf(node)
+}
+
+// selectNodesByLabels returns true if any pool selects nodes by labels
+func (p *FloatingIPPlugin) selectNodesByLabels() bool {
+	for _, pool := range p.ipam.Pools() {
+		if pool.NodeSelector != nil {
+			return true
+		}
+	}
+	return false
 }
 
 func parseReleasePolicy(meta *v1.ObjectMeta) constant.ReleasePolicy {
@@ -249,20 +368,40 @@ func (p *FloatingIPPlugin) lockPod(name, namespace string) func() {
 	}
 }
 
-func getPodCniArgs(pod *corev1.Pod) (constant.CniArgs, error) {
+func (p *FloatingIPPlugin) getPodCniArgs(pod *corev1.Pod) (constant.CniArgs, error) {
 	m := pod.GetAnnotations()
 	if len(m) == 0 {
 		return constant.CniArgs{}, nil
 	}
-	str, ok := m[constant.ExtendedCNIArgsAnnotation]
-	if !ok {
-		return constant.CniArgs{}, nil
+	args, err := constant.UnmarshalCniArgs(m[constant.ExtendedCNIArgsAnnotation])
+	if err != nil {
+		return constant.CniArgs{}, err
 	}
-	args, err := constant.UnmarshalCniArgs(str)
 	if args == nil {
 		args = &constant.CniArgs{}
 	}
-	return *args, err
+	refs, err := constant.ParseNetworkPoolRefs(m)
+	if err != nil || len(refs) == 0 {
+		return *args, err
+	}
+	if len(args.RequestIPRange) > 0 {
+		// request_ip_range is written back together with allocated ips
+		if len(args.RequestIPRange) != len(refs) {
+			return *args, fmt.Errorf("%d networks refer to pools, but request_ip_range has %d elements",
+				len(refs), len(args.RequestIPRange))
+		}
+		return *args, nil
+	}
+	// allocate an ip from the referred pools for each network
+	for _, ref := range refs {
+		ipranges := p.ipam.IPRangesByPool(ref.Pool, ref.Subnet)
+		if len(ipranges) == 0 {
+			return *args, fmt.Errorf("network %s refers to unknown pool %q or subnet %q", ref.Name, ref.Pool,
+				ref.Subnet)
+		}
+		args.RequestIPRange = append(args.RequestIPRange, ipranges)
+	}
+	return *args, nil
 }
 
 // supportReserveIPPolicy checks if reserveIP release policy is supported for a given keyObj
@@ -283,3 +422,9 @@ func (p *FloatingIPPlugin) supportReserveIPPolicy(obj *util.KeyObj, policy const
 	}
 	return nil
 }
+
+// keepStaticIP returns true if the static ip should be kept for the pod's own name because its workload has no
+// replicas to check against the immutable or never release policy, e.g. bare pods or pods of jobs
+func (p *FloatingIPPlugin) keepStaticIP(obj *util.KeyObj, policy constant.ReleasePolicy, static bool) bool {
+	return static && policy != constant.ReleasePolicyPodDelete && p.supportReserveIPPolicy(obj, policy) != nil
+}
@@ -0,0 +1,135 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+// ReserveGang reserves size ips for the parent workload of keyObj in a single node subnet all at once. It returns
+// all ips of the workload and their intersection node subnets.
+func (p *FloatingIPPlugin) ReserveGang(keyObj *util.KeyObj, size int, policy constant.ReleasePolicy) (
+	[]*floatingip.FloatingIPInfo, sets.String, error) {
+	defer p.LockDpPool(keyObj.PoolPrefix())()
+	return p.reserveGang(keyObj, size, policy)
+}
+
+// reserveGang is the same as ReserveGang except that it doesn't lock the workload, callers should lock it.
+// For deployments, ips are reserved to the deployment key prefix until size ips are left to hand out to pods
+// during filtering. For statefulsets and other workloads, ips are reserved to pod keys of index from 0 to size-1.
+// #lizard forgives
+func (p *FloatingIPPlugin) reserveGang(keyObj *util.KeyObj, size int, policy constant.ReleasePolicy) (
+	[]*floatingip.FloatingIPInfo, sets.String, error) {
+	if keyObj.PoolName != "" {
+		return nil, nil, fmt.Errorf("gang reservation is not supported for pool %s", keyObj.PoolName)
+	}
+	if policy == constant.ReleasePolicyPodDelete {
+		return nil, nil, fmt.Errorf("gang reservation requires immutable or never release policy")
+	}
+	prefix := keyObj.PoolPrefix()
+	fips, err := p.ipam.ByPrefix(prefix)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed query prefix %s: %v", prefix, err)
+	}
+	subnets := intersectNodeSubnets(fips)
+	allocatedKeys := sets.NewString()
+	for i := range fips {
+		allocatedKeys.Insert(fips[i].Key)
+	}
+	if len(fips) > 0 && subnets.Len() == 0 {
+		return nil, nil, fmt.Errorf("allocated ips of %s are in different node subnets", prefix)
+	}
+	var missingKeys []string
+	if keyObj.Deployment() {
+		// ips handed out to pods are not counted
+		var reserved int
+		for i := range fips {
+			if fips[i].Key == prefix {
+				reserved++
+			}
+		}
+		for i := reserved; i < size; i++ {
+			missingKeys = append(missingKeys, prefix)
+		}
+	} else {
+		for i := 0; i < size; i++ {
+			podKey := util.NewKeyObj(keyObj.AppTypePrefix, keyObj.Namespace, keyObj.AppName,
+				fmt.Sprintf("%s-%d", keyObj.AppName, i), "").KeyInDB
+			if !allocatedKeys.Has(podKey) {
+				missingKeys = append(missingKeys, podKey)
+			}
+		}
+	}
+	if len(missingKeys) == 0 {
+		return fips, subnets, nil
+	}
+	ips, err := p.allocateInOneSubnet(missingKeys, subnets, floatingip.Attr{Policy: policy})
+	if err != nil {
+		if err == floatingip.ErrNoEnoughIP {
+			return nil, nil, fmt.Errorf("no node subnet has %d ips left for gang %s of size %d", len(missingKeys),
+				prefix, size)
+		}
+		return nil, nil, err
+	}
+	glog.Infof("reserved ips %v for gang %s of size %d", ips, prefix, size)
+	if fips, err = p.ipam.ByPrefix(prefix); err != nil {
+		return nil, nil, fmt.Errorf("failed query prefix %s: %v", prefix, err)
+	}
+	return fips, intersectNodeSubnets(fips), nil
+}
+
+// filterGang reserves ips of the gang if needed when filtering a pod of the workload and returns node subnets of the
+// gang. Callers should lock the workload.
+func (p *FloatingIPPlugin) filterGang(keyObj *util.KeyObj, size int, policy constant.ReleasePolicy) (sets.String,
+	error) {
+	if keyObj.Deployment() {
+		// ips reserved for the deployment are handed out to its pods, so only reserve them for the first pod
+		prefix := keyObj.PoolPrefix()
+		fips, err := p.ipam.ByPrefix(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed query prefix %s: %v", prefix, err)
+		}
+		if len(fips) > 0 {
+			subnets := intersectNodeSubnets(fips)
+			if subnets.Len() == 0 {
+				return nil, fmt.Errorf("allocated ips of %s are in different node subnets", prefix)
+			}
+			return subnets, nil
+		}
+	}
+	_, subnets, err := p.reserveGang(keyObj, size, policy)
+	return subnets, err
+}
+
+// intersectNodeSubnets returns the intersection node subnets of fips
+func intersectNodeSubnets(fips []*floatingip.FloatingIPInfo) sets.String {
+	subnets := sets.NewString()
+	for i := range fips {
+		if i == 0 {
+			subnets = fips[i].NodeSubnets
+		} else {
+			subnets = subnets.Intersection(fips[i].NodeSubnets)
+		}
+	}
+	return subnets
+}
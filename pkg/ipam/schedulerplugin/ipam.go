@@ -28,6 +28,7 @@ import (
 	glog "k8s.io/klog"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
 	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
 	"tkestack.io/galaxy/pkg/utils/nets"
 )
@@ -131,10 +132,15 @@ func (p *FloatingIPPlugin) releaseIP(key string, reason string) error {
 		return nil
 	}
 	m := map[string]string{}
+	policies := map[string]constant.ReleasePolicy{}
 	for i := range ipInfos {
 		m[ipInfos[i].IP.String()] = ipInfos[i].Key
+		policies[ipInfos[i].IP.String()] = constant.ReleasePolicy(ipInfos[i].Policy)
 	}
 	released, unreleased, err := p.ipam.ReleaseIPs(m)
+	for ip := range released {
+		metrics.IPReleaseCount.WithLabelValues(releasePolicyLabel(policies[ip])).Inc()
+	}
 	if err != nil {
 		return fmt.Errorf("released %v, unreleased %v of %s because of %s: %v", released, unreleased, key,
 			reason, err)
@@ -143,6 +149,14 @@ func (p *FloatingIPPlugin) releaseIP(key string, reason string) error {
 	return nil
 }
 
+// releasePolicyLabel returns the metric label of the release policy
+func releasePolicyLabel(policy constant.ReleasePolicy) string {
+	if policy == constant.ReleasePolicyPodDelete {
+		return "podDelete"
+	}
+	return constant.PolicyStr(policy)
+}
+
 func (p *FloatingIPPlugin) reserveIP(key, prefixKey string, reason string) error {
 	if reserved, err := p.ipam.ReserveIP(key, prefixKey, floatingip.Attr{}); err != nil {
 		return fmt.Errorf("reserve ip from pod %s to %s: %v", key, prefixKey, err)
@@ -0,0 +1,169 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+	"net"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+const (
+	driftStale   = "stale"
+	driftMissing = "missing"
+)
+
+// reconcileCloudProvider compares ip bindings of the cloud provider with NodeName of floatingips, unassigns
+// bindings floatingips don't have, e.g. assigned to a deleted node or left by a failed binding, and reassigns
+// bindings of running pods the cloud provider doesn't have.
+func (p *FloatingIPPlugin) reconcileCloudProvider() {
+	if p.cloudProvider == nil {
+		return
+	}
+	glog.V(4).Infof("reconcile cloud provider+")
+	defer glog.V(4).Infof("reconcile cloud provider-")
+	reply, err := p.cloudProvider.ListAssignedIPs(&rpc.ListAssignedIPsRequest{})
+	if err != nil {
+		if err == cloudprovider.ErrNotSupported {
+			glog.V(4).Infof("skip reconciling as cloud provider doesn't support listing assigned ips")
+		} else {
+			glog.Warningf("failed to list assigned ips from cloud provider: %v", err)
+		}
+		return
+	}
+	all, err := p.ipam.ByPrefix("")
+	if err != nil {
+		glog.Warningf("failed to list floatingips: %v", err)
+		return
+	}
+	// managed ip to the node it should be assigned to, or empty if it shouldn't be assigned
+	expected := make(map[string]string, len(all))
+	for i := range all {
+		var node string
+		if all[i].Key != "" {
+			node = all[i].NodeName
+		}
+		expected[all[i].IP.String()] = node
+	}
+	assigned := make(map[string]string, len(reply.Ips))
+	var stale []*rpc.UnAssignIPRequest
+	for _, ip := range reply.Ips {
+		node, ok := expected[ip.IPAddress]
+		if !ok {
+			// not managed by galaxy
+			continue
+		}
+		assigned[ip.IPAddress] = ip.NodeName
+		if node != ip.NodeName {
+			stale = append(stale, &rpc.UnAssignIPRequest{NodeName: ip.NodeName, IPAddress: ip.IPAddress})
+		}
+	}
+	var missing []string
+	for ip, node := range expected {
+		if node != "" && assigned[ip] != node {
+			missing = append(missing, ip)
+		}
+	}
+	metrics.CloudProviderDrift.WithLabelValues(driftStale).Set(float64(len(stale)))
+	metrics.CloudProviderDrift.WithLabelValues(driftMissing).Set(float64(len(missing)))
+	if len(stale) > 0 || len(missing) > 0 {
+		glog.Infof("found %d stale and %d missing ip bindings of cloud provider", len(stale), len(missing))
+	}
+	p.unassignStaleIPs(stale)
+	for _, ip := range missing {
+		p.reassignMissingIP(net.ParseIP(ip))
+	}
+}
+
+// unassignStaleIPs unassigns bindings which are still stale according to the latest floatingips
+func (p *FloatingIPPlugin) unassignStaleIPs(stale []*rpc.UnAssignIPRequest) {
+	var reqs []*rpc.UnAssignIPRequest
+	for _, req := range stale {
+		fip, err := p.ipam.ByIP(net.ParseIP(req.IPAddress))
+		if err != nil {
+			glog.Warning(err)
+			continue
+		}
+		if fip.Key != "" && fip.NodeName == req.NodeName {
+			// bound after listing
+			continue
+		}
+		reqs = append(reqs, req)
+	}
+	if len(reqs) == 0 {
+		return
+	}
+	reply, err := p.cloudProvider.BatchUnAssignIP(&rpc.BatchUnAssignIPRequest{Requests: reqs})
+	for i, req := range reqs {
+		reqErr := err
+		if err == nil && (reply.Replies[i] == nil || !reply.Replies[i].Success) {
+			reqErr = fmt.Errorf("reply %v", reply.Replies[i])
+		}
+		if reqErr != nil {
+			metrics.CloudProviderReconcileCount.WithLabelValues(driftStale, "failure").Inc()
+			if err := p.enqueueUnAssignIP(req, reqErr); err != nil {
+				glog.Warningf("failed to unassign stale ip %s from node %s: %v", req.IPAddress, req.NodeName, err)
+			}
+			continue
+		}
+		glog.Infof("unassigned stale ip %s from node %s", req.IPAddress, req.NodeName)
+		metrics.CloudProviderReconcileCount.WithLabelValues(driftStale, "success").Inc()
+	}
+}
+
+// reassignMissingIP assigns the ip to the node of the floatingip if its pod is still running on the node. Pods
+// not running are left to resync which releases their ips.
+func (p *FloatingIPPlugin) reassignMissingIP(ip net.IP) {
+	fip, err := p.ipam.ByIP(ip)
+	if err != nil || fip.Key == "" {
+		return
+	}
+	keyObj := util.ParseKey(fip.Key)
+	if keyObj.PodName == "" {
+		return
+	}
+	defer p.lockPod(keyObj.PodName, keyObj.Namespace)()
+	// query again as we are holding the pod's lock now
+	if fip, err = p.ipam.ByIP(ip); err != nil || fip.Key != keyObj.KeyInDB || fip.NodeName == "" {
+		return
+	}
+	pod, err := p.PodLister.Pods(keyObj.Namespace).Get(keyObj.PodName)
+	if err != nil || finished(pod) || (fip.PodUid != "" && fip.PodUid != string(pod.UID)) ||
+		pod.Spec.NodeName != fip.NodeName {
+		return
+	}
+	if _, err := p.Client.CoreV1().Nodes().Get(fip.NodeName, v1.GetOptions{}); apierrors.IsNotFound(err) {
+		return
+	}
+	req := &rpc.AssignIPRequest{NodeName: fip.NodeName, IPAddress: ip.String()}
+	if err := p.cloudProviderAssignIP(req); err != nil {
+		metrics.CloudProviderReconcileCount.WithLabelValues(driftMissing, "failure").Inc()
+		if err := p.enqueueAssignIP(req, err); err != nil {
+			glog.Warningf("failed to reassign missing ip %s to node %s: %v", ip.String(), fip.NodeName, err)
+		}
+		return
+	}
+	glog.Infof("reassigned missing ip %s of %s to node %s", ip.String(), fip.Key, fip.NodeName)
+	metrics.CloudProviderReconcileCount.WithLabelValues(driftMissing, "success").Inc()
+}
@@ -0,0 +1,94 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
+	. "tkestack.io/galaxy/pkg/ipam/cloudprovider/testing"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
+	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+func TestReconcileCloudProvider(t *testing.T) {
+	var pods []*corev1.Pod
+	for _, name := range []string{"sts-1", "sts-2", "sts-3"} {
+		pod := CreateStatefulSetPod(name, "demo", nil)
+		pod.UID = types.UID(name)
+		pod.Spec.NodeName = node3
+		pod.Status.Phase = corev1.PodRunning
+		pods = append(pods, pod)
+	}
+	// sts-3 is deleted
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, pods[0], pods[1])
+	defer func() { stopChan <- struct{}{} }()
+	for i, ip := range []string{"10.49.27.205", "10.49.27.216", "10.49.27.218"} {
+		keyObj, _ := util.FormatKey(pods[i])
+		if err := fipPlugin.ipam.AllocateSpecificIP(keyObj.KeyInDB, net.ParseIP(ip),
+			floatingip.Attr{NodeName: node3, Uid: string(pods[i].UID)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cp := NewFakeCloudProvider()
+	cp.Assigned["10.49.27.216"] = node4     // assigned to wrong node
+	cp.Assigned["10.49.27.217"] = "deleted" // unallocated ip assigned to a deleted node
+	cp.Assigned["1.1.1.1"] = node3          // not managed by galaxy
+	fipPlugin.cloudProvider = cp
+	fipPlugin.reconcileCloudProvider()
+
+	if v := testutil.ToFloat64(metrics.CloudProviderDrift.WithLabelValues(driftStale)); v != 2 {
+		t.Errorf("expect 2 stale bindings, real %v", v)
+	}
+	// 10.49.27.218 of deleted pod is missing but not reassigned
+	if v := testutil.ToFloat64(metrics.CloudProviderDrift.WithLabelValues(driftMissing)); v != 3 {
+		t.Errorf("expect 3 missing bindings, real %v", v)
+	}
+	if err := checkFakeCloudProviderState(cp, map[string]string{
+		"10.49.27.205": node3, "10.49.27.216": node3, "10.49.27.217": "deleted", "1.1.1.1": node3,
+	}, map[string]string{
+		"10.49.27.216": node4, "10.49.27.217": "deleted",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// no drift after reconciliation except the ip of deleted pod
+	fipPlugin.reconcileCloudProvider()
+	if v := testutil.ToFloat64(metrics.CloudProviderDrift.WithLabelValues(driftStale)); v != 0 {
+		t.Errorf("expect 0 stale bindings, real %v", v)
+	}
+	if v := testutil.ToFloat64(metrics.CloudProviderDrift.WithLabelValues(driftMissing)); v != 1 {
+		t.Errorf("expect 1 missing bindings, real %v", v)
+	}
+	list, err := cp.ListAssignedIPs(&rpc.ListAssignedIPsRequest{NodeName: node3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ips []string
+	for _, ip := range list.Ips {
+		ips = append(ips, ip.IPAddress)
+	}
+	if expect := []string{"1.1.1.1", "10.49.27.205", "10.49.27.216"}; !reflect.DeepEqual(ips, expect) {
+		t.Fatalf("expect %v, real %v", expect, ips)
+	}
+}
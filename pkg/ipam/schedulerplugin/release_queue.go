@@ -0,0 +1,174 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/apis/galaxy/v1alpha1"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+const (
+	// maxReleaseRetries is the number of retries of releasing ips of a key before leaving it to the full resync
+	maxReleaseRetries = 5
+	// releaseWorkers is the number of workers releasing ips concurrently
+	releaseWorkers = 10
+)
+
+// enqueueRelease enqueues the key of a deleted or finished pod to release its ips. The latest pod of each key is
+// kept to unbind it according to its release policy.
+func (p *FloatingIPPlugin) enqueueRelease(pod *corev1.Pod) {
+	keyObj, err := util.FormatKey(pod)
+	if err != nil {
+		glog.Warningf("failed to enqueue pod %s_%s to release its ips: %v", pod.Name, pod.Namespace, err)
+		return
+	}
+	p.releasePodsLock.Lock()
+	p.releasePods[keyObj.KeyInDB] = pod
+	p.releasePodsLock.Unlock()
+	p.releaseQueue.Add(keyObj.KeyInDB)
+	metrics.ReleaseQueueLength.Set(float64(p.releaseQueue.Len()))
+}
+
+// floatingIPResyncHandler enqueues keys of FloatingIPs to resync them with pods incrementally if they are allocated to
+// other keys or their pod uid or node is cleared. Other changes are left to the full resync since resyncing a key gets
+// its pod from apiserver.
+func (p *FloatingIPPlugin) floatingIPResyncHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldFIP, ok1 := oldObj.(*v1alpha1.FloatingIP)
+			newFIP, ok2 := newObj.(*v1alpha1.FloatingIP)
+			if !ok1 || !ok2 || !p.isLeader() {
+				return
+			}
+			if oldFIP.Spec.Key != newFIP.Spec.Key || attrCleared(oldFIP, newFIP) {
+				p.enqueueResync(newFIP)
+			}
+		},
+	}
+}
+
+// attrCleared returns true if the pod uid or node name in the attribute of the FloatingIP is cleared
+func attrCleared(oldFIP, newFIP *v1alpha1.FloatingIP) bool {
+	oldAttr, newAttr := parseAttr(oldFIP), parseAttr(newFIP)
+	return (oldAttr.Uid != "" && newAttr.Uid == "") || (oldAttr.NodeName != "" && newAttr.NodeName == "")
+}
+
+func parseAttr(fip *v1alpha1.FloatingIP) floatingip.Attr {
+	var attr floatingip.Attr
+	if fip.Spec.Attribute != "" {
+		if err := json.Unmarshal([]byte(fip.Spec.Attribute), &attr); err != nil {
+			glog.Warningf("invalid attribute of floatingip %s: %v", fip.Name, err)
+		}
+	}
+	return attr
+}
+
+func (p *FloatingIPPlugin) enqueueResync(fip *v1alpha1.FloatingIP) {
+	if util.ParseKey(fip.Spec.Key).PodName == "" {
+		return
+	}
+	p.releaseQueue.Add(fip.Spec.Key)
+	metrics.ReleaseQueueLength.Set(float64(p.releaseQueue.Len()))
+}
+
+// runReleaseWorker pulls keys from release queue and releases their ips until the queue shuts down
+func (p *FloatingIPPlugin) runReleaseWorker() {
+	for p.processNextRelease() {
+	}
+}
+
+func (p *FloatingIPPlugin) processNextRelease() bool {
+	key, quit := p.releaseQueue.Get()
+	if quit {
+		return false
+	}
+	defer p.releaseQueue.Done(key)
+	metrics.ReleaseQueueLength.Set(float64(p.releaseQueue.Len()))
+	pod, err := p.syncRelease(key.(string))
+	if err == nil {
+		metrics.ReleaseQueueCount.WithLabelValues("success").Inc()
+		p.releaseQueue.Forget(key)
+		return true
+	}
+	if retries := p.releaseQueue.NumRequeues(key); retries < maxReleaseRetries {
+		glog.Warningf("release ips of %s failed for %d times: %v", key, retries+1, err)
+		metrics.ReleaseQueueCount.WithLabelValues("retry").Inc()
+		p.releaseQueue.AddRateLimited(key)
+		return true
+	}
+	// leave it to the full resync
+	glog.Errorf("abort releasing ips of %s, retried %d times: %v", key, maxReleaseRetries, err)
+	metrics.ReleaseQueueCount.WithLabelValues("abort").Inc()
+	p.forgetReleasePod(key.(string), pod)
+	p.releaseQueue.Forget(key)
+	return true
+}
+
+// syncRelease unbinds the latest deleted or finished pod of the key if there is one, otherwise it releases ips of
+// the key if its pod is not running. It returns the unbound pod.
+func (p *FloatingIPPlugin) syncRelease(key string) (*corev1.Pod, error) {
+	p.releasePodsLock.Lock()
+	pod, ok := p.releasePods[key]
+	p.releasePodsLock.Unlock()
+	if !ok {
+		return nil, p.resyncKey(key)
+	}
+	if err := p.unbind(pod); err != nil {
+		return pod, err
+	}
+	p.forgetReleasePod(key, pod)
+	return pod, nil
+}
+
+// forgetReleasePod removes the pod of the key unless a newer one has been enqueued
+func (p *FloatingIPPlugin) forgetReleasePod(key string, pod *corev1.Pod) {
+	p.releasePodsLock.Lock()
+	defer p.releasePodsLock.Unlock()
+	if pod != nil && p.releasePods[key] == pod {
+		delete(p.releasePods, key)
+	}
+}
+
+// resyncKey releases ips of the key whose pod is not running
+func (p *FloatingIPPlugin) resyncKey(key string) error {
+	ipInfos, err := p.ipam.ByKeyAndIPRanges(key, nil)
+	if err != nil {
+		return err
+	}
+	var failed int
+	for i := range ipInfos {
+		obj, ok := newResyncObj(&ipInfos[i].FloatingIP)
+		if !ok {
+			continue
+		}
+		if p.resyncIP(obj) == "failure" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to repair %d ips", failed)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8stesting "k8s.io/client-go/testing"
+	fakeGalaxyCli "tkestack.io/galaxy/pkg/ipam/client/clientset/versioned/fake"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
+	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+func TestReleaseQueue(t *testing.T) {
+	fipPlugin, stopChan, _ := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	pod := CreateDeploymentPod("dp-xxx-yyy", "ns1", nil)
+	keyObj, _ := util.FormatKey(pod)
+	if err := fipPlugin.ipam.AllocateSpecificIP(keyObj.KeyInDB, net.ParseIP("10.49.27.205"),
+		floatingip.Attr{Policy: parseReleasePolicy(&pod.ObjectMeta)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.DeletePod(pod); err != nil {
+		t.Fatal(err)
+	}
+	// events of the same key are merged
+	if err := fipPlugin.DeletePod(pod); err != nil {
+		t.Fatal(err)
+	}
+	if l := fipPlugin.releaseQueue.Len(); l != 1 {
+		t.Fatalf("expect 1 key in queue, got %d", l)
+	}
+	success := testutil.ToFloat64(metrics.ReleaseQueueCount.WithLabelValues("success"))
+	fipPlugin.processNextRelease()
+	if err := checkIPKey(fipPlugin.ipam, "10.49.27.205", ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(fipPlugin.releasePods) != 0 {
+		t.Fatalf("expect no pods left, got %v", fipPlugin.releasePods)
+	}
+	if v := testutil.ToFloat64(metrics.ReleaseQueueCount.WithLabelValues("success")); v != success+1 {
+		t.Fatalf("expect %v, got %v", success+1, v)
+	}
+}
+
+func TestReleaseQueueRetry(t *testing.T) {
+	fipPlugin, stopChan, _ := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	pod := CreateDeploymentPod("dp-xxx-yyy", "ns1", nil)
+	keyObj, _ := util.FormatKey(pod)
+	if err := fipPlugin.ipam.AllocateSpecificIP(keyObj.KeyInDB, net.ParseIP("10.49.27.205"),
+		floatingip.Attr{Policy: parseReleasePolicy(&pod.ObjectMeta)}); err != nil {
+		t.Fatal(err)
+	}
+	fipPlugin.GalaxyClient.(*fakeGalaxyCli.Clientset).PrependReactor("delete", "floatingips",
+		func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, fmt.Errorf("apiserver unavailable")
+		})
+	retry := testutil.ToFloat64(metrics.ReleaseQueueCount.WithLabelValues("retry"))
+	abort := testutil.ToFloat64(metrics.ReleaseQueueCount.WithLabelValues("abort"))
+	fipPlugin.enqueueRelease(pod)
+	for i := 0; i <= maxReleaseRetries; i++ {
+		fipPlugin.processNextRelease()
+	}
+	if err := checkIPKey(fipPlugin.ipam, "10.49.27.205", keyObj.KeyInDB); err != nil {
+		t.Fatal(err)
+	}
+	if v := testutil.ToFloat64(metrics.ReleaseQueueCount.WithLabelValues("retry")); v != retry+maxReleaseRetries {
+		t.Fatalf("expect %v retries, got %v", retry+maxReleaseRetries, v)
+	}
+	if v := testutil.ToFloat64(metrics.ReleaseQueueCount.WithLabelValues("abort")); v != abort+1 {
+		t.Fatalf("expect %v aborts, got %v", abort+1, v)
+	}
+	// aborted keys are left to the full resync
+	if l := fipPlugin.releaseQueue.Len(); l != 0 || len(fipPlugin.releasePods) != 0 {
+		t.Fatalf("expect empty queue, got %d keys and pods %v", l, fipPlugin.releasePods)
+	}
+}
+
+func TestIncrementalResync(t *testing.T) {
+	fipPlugin, stopChan, _ := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	stop := make(chan struct{})
+	defer close(stop)
+	go fipPlugin.FIPInformer.Informer().Run(stop)
+	// the deployment of the pod doesn't exist
+	pod := CreateDeploymentPod("dp2-aaa-bbb", "ns2", immutableAnnotation)
+	keyObj, _ := util.FormatKey(pod)
+	policy := parseReleasePolicy(&pod.ObjectMeta)
+	ip := net.ParseIP("10.49.27.216")
+	if err := fipPlugin.ipam.AllocateSpecificIP(keyObj.KeyInDB, ip,
+		floatingip.Attr{Policy: policy, NodeName: node3, Uid: string(pod.UID)}); err != nil {
+		t.Fatal(err)
+	}
+	// allocating doesn't enqueue the key since resyncing it costs a request to apiserver
+	if err := wait.Poll(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		_, err := fipPlugin.FIPInformer.Lister().Get(ip.String())
+		return err == nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if fipPlugin.releaseQueue.Len() != 0 {
+		t.Fatalf("expect no key enqueued after allocating, got %d", fipPlugin.releaseQueue.Len())
+	}
+	// clearing the node of the floatingip enqueues the key
+	if err := fipPlugin.ipam.UpdateAttr(keyObj.KeyInDB, ip, floatingip.Attr{Policy: policy}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait.Poll(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		return fipPlugin.releaseQueue.Len() == 1, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	fipPlugin.processNextRelease()
+	if err := checkIPKey(fipPlugin.ipam, "10.49.27.216", ""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	metaErrs "k8s.io/apimachinery/pkg/api/errors"
@@ -30,6 +31,7 @@ import (
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 	"tkestack.io/galaxy/pkg/ipam/cloudprovider/rpc"
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	"tkestack.io/galaxy/pkg/ipam/metrics"
 	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
 )
 
@@ -47,6 +49,10 @@ type resyncObj struct {
 func (p *FloatingIPPlugin) resyncPod() error {
 	glog.V(4).Infof("resync pods+")
 	defer glog.V(4).Infof("resync pods-")
+	start := time.Now()
+	defer func() {
+		metrics.ResyncLatency.Observe(time.Since(start).Seconds())
+	}()
 	resyncMeta := &resyncMeta{}
 	if err := p.fetchChecklist(resyncMeta); err != nil {
 		return err
@@ -65,79 +71,104 @@ func (p *FloatingIPPlugin) fetchChecklist(meta *resyncMeta) error {
 		return err
 	}
 	for i := range all {
-		fip := all[i]
-		if fip.Key == "" {
-			continue
-		}
-		keyObj := util.ParseKey(fip.Key)
-		if keyObj.PodName == "" {
-			continue
-		}
-		if keyObj.AppName == "" {
-			glog.Warningf("unexpected key: %s", fip.Key)
-			continue
+		if obj, ok := newResyncObj(&all[i].FloatingIP); ok {
+			meta.allocatedIPs = append(meta.allocatedIPs, obj)
 		}
-		if fip.PodUid == "" && fip.NodeName == "" && !keyObj.Deployment() &&
-			constant.ReleasePolicy(fip.Policy) == constant.ReleasePolicyNever {
-			// skip endless checking pod exists for never policy
-			continue
-		}
-		meta.allocatedIPs = append(meta.allocatedIPs, resyncObj{keyObj: keyObj, fip: fip.FloatingIP})
 	}
 	return nil
 }
 
-// #lizard forgives
+// newResyncObj returns false if the ip doesn't need resyncing
+func newResyncObj(fip *floatingip.FloatingIP) (resyncObj, bool) {
+	if fip.Key == "" {
+		return resyncObj{}, false
+	}
+	keyObj := util.ParseKey(fip.Key)
+	if keyObj.PodName == "" {
+		return resyncObj{}, false
+	}
+	if keyObj.AppName == "" {
+		glog.Warningf("unexpected key: %s", fip.Key)
+		return resyncObj{}, false
+	}
+	if fip.PodUid == "" && fip.NodeName == "" && !keyObj.Deployment() &&
+		constant.ReleasePolicy(fip.Policy) == constant.ReleasePolicyNever {
+		// skip endless checking pod exists for never policy
+		return resyncObj{}, false
+	}
+	return resyncObj{keyObj: keyObj, fip: *fip}, true
+}
+
 func (p *FloatingIPPlugin) resyncAllocatedIPs(meta *resyncMeta) {
 	for _, obj := range meta.allocatedIPs {
-		key := obj.keyObj.KeyInDB
-		func() {
-			defer p.lockPod(obj.keyObj.PodName, obj.keyObj.Namespace)()
-			// we are holding the pod's lock, query again in case the ip has been reallocated.
-			fip, err := p.ipam.ByIP(obj.fip.IP)
-			if err != nil {
-				glog.Warning(err)
-				return
-			}
-			if fip.Key != obj.fip.Key {
-				// if key changed, abort
-				return
-			}
-			obj.fip = fip
-			running, reason := p.podRunning(obj.keyObj.PodName, obj.keyObj.Namespace, obj.fip.PodUid)
-			if running {
-				return
-			}
-			glog.Infof("%s is not running, %s", obj.keyObj.KeyInDB, reason)
-			if p.cloudProvider != nil && obj.fip.NodeName != "" {
-				// For tapp and sts pod, nodeName will be updated to empty after unassigning
-				glog.Infof("UnAssignIP nodeName %s, ip %s, key %s during resync", obj.fip.NodeName,
-					obj.fip.IP.String(), key)
-				if err := p.cloudProviderUnAssignIP(&rpc.UnAssignIPRequest{
-					NodeName:  obj.fip.NodeName,
-					IPAddress: obj.fip.IP.String(),
-				}); err != nil {
-					glog.Warningf("failed to unassign ip %s to %s: %v", obj.fip.IP.String(), key, err)
-					// return to retry unassign ip in the next resync loop
-					return
-				}
-				// for tapp and sts pod, we need to clean its node attr and uid
-				if err := p.reserveIP(key, key, "unassign ip during resync"); err != nil {
-					glog.Error(err)
-				}
-			}
-			releasePolicy := constant.ReleasePolicy(obj.fip.Policy)
-			if !obj.keyObj.Deployment() {
-				if err := p.unbindNoneDpPod(obj.keyObj, releasePolicy, "during resync"); err != nil {
-					glog.Error(err)
-				}
-				return
-			}
-			if err := p.unbindDpPod(obj.keyObj, releasePolicy, "during resync"); err != nil {
-				glog.Error(err)
+		p.resyncIP(obj)
+	}
+}
+
+// #lizard forgives
+// resyncIP unassigns, reserves or releases the ip if its pod is not running. It returns an empty result if the ip
+// doesn't need repairing, otherwise success or failure.
+func (p *FloatingIPPlugin) resyncIP(obj resyncObj) (result string) {
+	defer func() {
+		if result != "" {
+			metrics.ResyncRepairCount.WithLabelValues(result).Inc()
+		}
+	}()
+	key := obj.keyObj.KeyInDB
+	defer p.lockPod(obj.keyObj.PodName, obj.keyObj.Namespace)()
+	// we are holding the pod's lock, query again in case the ip has been reallocated.
+	fip, err := p.ipam.ByIP(obj.fip.IP)
+	if err != nil {
+		glog.Warning(err)
+		return ""
+	}
+	if fip.Key != obj.fip.Key {
+		// if key changed, abort
+		return ""
+	}
+	obj.fip = fip
+	running, reason := p.podRunning(obj.keyObj.PodName, obj.keyObj.Namespace, obj.fip.PodUid)
+	if running {
+		return ""
+	}
+	glog.Infof("%s is not running, %s", obj.keyObj.KeyInDB, reason)
+	if p.cloudProvider != nil && obj.fip.NodeName != "" {
+		// For tapp and sts pod, nodeName will be updated to empty after unassigning
+		glog.Infof("UnAssignIP nodeName %s, ip %s, key %s during resync", obj.fip.NodeName,
+			obj.fip.IP.String(), key)
+		req := &rpc.UnAssignIPRequest{NodeName: obj.fip.NodeName, IPAddress: obj.fip.IP.String()}
+		if err := p.cloudProviderUnAssignIP(req); err != nil {
+			if err := p.enqueueUnAssignIP(req, err); err != nil {
+				glog.Warningf("failed to unassign ip %s to %s: %v", obj.fip.IP.String(), key, err)
+				// return to retry unassign ip in the next resync loop
+				return "failure"
 			}
-		}()
+		}
+		// for tapp and sts pod, we need to clean its node attr and uid
+		if err := p.reserveIP(key, key, "unassign ip during resync"); err != nil {
+			glog.Error(err)
+		}
+	}
+	releasePolicy := constant.ReleasePolicy(obj.fip.Policy)
+	if p.keepStaticIP(obj.keyObj, releasePolicy, obj.fip.Static) {
+		if err := p.reserveIP(key, key, "release policy of static ip during resync"); err != nil {
+			glog.Error(err)
+			return "failure"
+		}
+		return "success"
+	}
+	if !obj.keyObj.Deployment() {
+		if err := p.unbindNoneDpPod(obj.keyObj, releasePolicy, "during resync"); err != nil {
+			glog.Error(err)
+			return "failure"
+		}
+		return "success"
+	}
+	if err := p.unbindDpPod(obj.keyObj, releasePolicy, "during resync"); err != nil {
+		glog.Error(err)
+		return "failure"
 	}
+	return "success"
 }
 
 func (p *FloatingIPPlugin) podRunning(podName, namespace, podUid string) (bool, string) {
@@ -25,6 +25,7 @@ import (
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
 	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
 	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
@@ -178,3 +179,54 @@ func TestResyncPodUidChanged(t *testing.T) {
 		t.Fatal(fip.NodeName)
 	}
 }
+
+func TestResyncStaticIP(t *testing.T) {
+	staticPod := CreateSimplePod("pod1", "ns1", neverAnnotation)
+	barePod := CreateSimplePod("pod2", "ns1", neverAnnotation)
+	immutablePod := CreateSimplePod("pod3", "ns1", immutableAnnotation)
+	fipPlugin, stopChan, _ := createPluginTestNodes(t)
+	defer func() { stopChan <- struct{}{} }()
+	staticKey, _ := util.FormatKey(staticPod)
+	bareKey, _ := util.FormatKey(barePod)
+	immutableKey, _ := util.FormatKey(immutablePod)
+	// the requested policy is kept for static ips
+	if policy := parseReleasePolicy(&immutablePod.ObjectMeta); policy != constant.ReleasePolicyImmutable {
+		t.Fatalf("expect immutable release policy, got %v", policy)
+	}
+	if err := fipPlugin.ipam.AllocateSpecificIP(immutableKey.KeyInDB, net.ParseIP("10.49.27.217"),
+		floatingip.Attr{Policy: parseReleasePolicy(&immutablePod.ObjectMeta), NodeName: "node-1", Uid: "uid-3",
+			Static: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.ipam.AllocateSpecificIP(staticKey.KeyInDB, net.ParseIP("10.49.27.205"),
+		floatingip.Attr{Policy: parseReleasePolicy(&staticPod.ObjectMeta), NodeName: "node-1", Uid: "uid-1",
+			Static: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.ipam.AllocateSpecificIP(bareKey.KeyInDB, net.ParseIP("10.49.27.216"),
+		floatingip.Attr{Policy: parseReleasePolicy(&barePod.ObjectMeta), NodeName: "node-1",
+			Uid: "uid-2"}); err != nil {
+		t.Fatal(err)
+	}
+	// both pods are deleted
+	if err := fipPlugin.resyncPod(); err != nil {
+		t.Fatal(err)
+	}
+	// immutable and never release policy of bare pods are only supported by static ips
+	if err := checkIPKey(fipPlugin.ipam, "10.49.27.205", staticKey.KeyInDB); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPKey(fipPlugin.ipam, "10.49.27.217", immutableKey.KeyInDB); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkIPKey(fipPlugin.ipam, "10.49.27.216", ""); err != nil {
+		t.Fatal(err)
+	}
+	fip, err := fipPlugin.ipam.ByIP(net.ParseIP("10.49.27.205"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fip.Static {
+		t.Fatalf("expect the reserved ip is still static")
+	}
+}
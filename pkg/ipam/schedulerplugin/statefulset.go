@@ -17,10 +17,21 @@
 package schedulerplugin
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
+	"strings"
 
+	appv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metaErrs "k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/cache"
+	glog "k8s.io/klog"
 	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
 	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
 )
 
@@ -100,3 +111,284 @@ func (p *FloatingIPPlugin) shouldRelease(keyObj *util.KeyObj, parentAppExist boo
 	}
 	return false, "pod index is less than replicas", nil
 }
+
+// AddStatefulSet enqueues statefulset to reserve ips for its pods
+func (p *FloatingIPPlugin) AddStatefulSet(ss *appv1.StatefulSet) error {
+	p.enqueueStatefulSet(ss)
+	return nil
+}
+
+// UpdateStatefulSet enqueues statefulset to reserve ips for scaled up pods or release ips of scaled down pods
+func (p *FloatingIPPlugin) UpdateStatefulSet(oldSS, newSS *appv1.StatefulSet) error {
+	p.enqueueStatefulSet(newSS)
+	return nil
+}
+
+// DeleteStatefulSet enqueues statefulset to release its reserved ips. The key prefix of its ips is recorded since the
+// pool of its pods is only known from the deleted object.
+func (p *FloatingIPPlugin) DeleteStatefulSet(ss *appv1.StatefulSet) error {
+	if !p.isLeader() || !p.hasResourceName(&ss.Spec.Template.Spec) {
+		return nil
+	}
+	templateKey, err := util.FormatKey(statefulSetPod(ss, 0))
+	if err != nil {
+		return err
+	}
+	if templateKey.PoolName != "" {
+		p.deletedStatefulSetsLock.Lock()
+		p.deletedStatefulSets[util.Join(ss.Name, ss.Namespace)] = templateKey.PoolAppPrefix()
+		p.deletedStatefulSetsLock.Unlock()
+	}
+	p.enqueueStatefulSet(ss)
+	return nil
+}
+
+// enqueueStatefulSet enqueues statefulset if it is the leader which drains the queue. The leader enqueues existing
+// statefulsets when it starts leading.
+func (p *FloatingIPPlugin) enqueueStatefulSet(ss *appv1.StatefulSet) {
+	if !p.isLeader() || !p.hasResourceName(&ss.Spec.Template.Spec) {
+		return
+	}
+	key, err := cache.MetaNamespaceKeyFunc(ss)
+	if err != nil {
+		glog.Warning(err)
+		return
+	}
+	p.stsQueue.Add(key)
+}
+
+// runStatefulSetWorker pulls statefulset keys from queue and syncs their reserved ips until the queue shuts down
+func (p *FloatingIPPlugin) runStatefulSetWorker() {
+	for p.processNextStatefulSet() {
+	}
+}
+
+func (p *FloatingIPPlugin) processNextStatefulSet() bool {
+	key, quit := p.stsQueue.Get()
+	if quit {
+		return false
+	}
+	defer p.stsQueue.Done(key)
+	if err := p.syncStatefulSet(key.(string)); err != nil {
+		glog.Warningf("sync statefulset %s: %v", key, err)
+		p.stsQueue.AddRateLimited(key)
+		return true
+	}
+	p.stsQueue.Forget(key)
+	return true
+}
+
+// syncStatefulSet reserves ips for all pods of a statefulset with immutable or never release policy before these
+// pods are created, so that the statefulset won't be half scheduled because of running out of ips. All ips are
+// reserved in a single node subnet. It also releases ips of pods which are scaled down or whose statefulset is
+// deleted according to the release policy, i.e. ips of never release policy are kept, while ips of pools are returned
+// to their pools.
+func (p *FloatingIPPlugin) syncStatefulSet(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	ss, err := p.StatefulSetLister.StatefulSets(namespace).Get(name)
+	if err != nil {
+		if !metaErrs.IsNotFound(err) {
+			return err
+		}
+		return p.releaseDeletedStatefulSetIPs(namespace, name)
+	}
+	policy := parseReleasePolicy(&ss.Spec.Template.ObjectMeta)
+	if policy == constant.ReleasePolicyPodDelete {
+		return nil
+	}
+	replicas := 1
+	if ss.Spec.Replicas != nil {
+		replicas = int(*ss.Spec.Replicas)
+	}
+	templateKey, err := util.FormatKey(statefulSetPod(ss, 0))
+	if err != nil {
+		return err
+	}
+	if err := p.releaseStatefulSetIPs(templateKey.PoolAppPrefix(), replicas); err != nil {
+		return err
+	}
+	cniArgs, err := p.getPodCniArgs(statefulSetPod(ss, 0))
+	if err != nil {
+		return err
+	}
+	if len(cniArgs.RequestIPRange) > 0 {
+		glog.V(4).Infof("skip reserving ips for statefulset %s which requests ip ranges", key)
+		return nil
+	}
+	ips, err := p.reserveStatefulSetIPs(ss, replicas, policy)
+	if err != nil {
+		return err
+	}
+	return p.updateReservedIPsAnnotation(ss, strings.Join(ips, ","))
+}
+
+// reserveStatefulSetIPs allocates ips for pods which are not created and have no allocated ips in a node subnet which
+// can hold all of them, and returns the allocated ips of all pods in the order of pod index
+func (p *FloatingIPPlugin) reserveStatefulSetIPs(ss *appv1.StatefulSet, replicas int,
+	policy constant.ReleasePolicy) ([]string, error) {
+	var (
+		missingKeys []string
+		ips         = make([]string, replicas)
+		// the intersection node subnets of already allocated ips
+		allocatedSubnets sets.String
+	)
+	for i := 0; i < replicas; i++ {
+		keyObj, err := util.FormatKey(statefulSetPod(ss, i))
+		if err != nil {
+			return nil, err
+		}
+		ipInfos, err := p.ipam.ByKeyAndIPRanges(keyObj.KeyInDB, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query by key %s: %v", keyObj.KeyInDB, err)
+		}
+		if len(ipInfos) > 0 {
+			ips[i] = ipInfos[0].IP.String()
+			if allocatedSubnets == nil {
+				allocatedSubnets = ipInfos[0].NodeSubnets
+			} else {
+				allocatedSubnets = allocatedSubnets.Intersection(ipInfos[0].NodeSubnets)
+			}
+			continue
+		}
+		if _, err := p.PodLister.Pods(ss.Namespace).Get(keyObj.PodName); err == nil {
+			// pod has been created, leave allocating to filter and bind
+			continue
+		}
+		missingKeys = append(missingKeys, keyObj.KeyInDB)
+	}
+	if len(missingKeys) > 0 {
+		allocated, err := p.allocateInOneSubnet(missingKeys, allocatedSubnets, floatingip.Attr{Policy: policy})
+		if err != nil {
+			return nil, fmt.Errorf("reserve %d ips for statefulset %s_%s: %w", len(missingKeys), ss.Namespace,
+				ss.Name, err)
+		}
+		for i := range missingKeys {
+			keyObj := util.ParseKey(missingKeys[i])
+			index, _ := parsePodIndex(keyObj.PodName)
+			ips[index] = allocated[i].String()
+		}
+		glog.Infof("reserved ips %v for statefulset %s_%s", allocated, ss.Namespace, ss.Name)
+	}
+	var reserved []string
+	for i := range ips {
+		if ips[i] != "" {
+			reserved = append(reserved, ips[i])
+		}
+	}
+	return reserved, nil
+}
+
+// allocateInOneSubnet allocates ips for all keys in a single node subnet. It prefers the given subnets if not empty.
+func (p *FloatingIPPlugin) allocateInOneSubnet(keys []string, preferredSubnets sets.String,
+	attr floatingip.Attr) ([]net.IP, error) {
+	subnets := preferredSubnets
+	if subnets.Len() == 0 {
+		var err error
+		if subnets, err = p.ipam.NodeSubnetsByIPRanges(nil); err != nil {
+			return nil, fmt.Errorf("failed to query allocatable subnet: %v", err)
+		}
+	}
+	for _, subnet := range subnets.List() {
+		_, ipNet, err := net.ParseCIDR(subnet)
+		if err != nil {
+			return nil, err
+		}
+		ips, err := p.ipam.AllocateInSubnetWithKeys(keys, ipNet, attr)
+		if err == nil {
+			return ips, nil
+		} else if err != floatingip.ErrNoEnoughIP {
+			return nil, err
+		}
+	}
+	return nil, floatingip.ErrNoEnoughIP
+}
+
+// releaseStatefulSetIPs releases ips of pods whose index is not less than replicas and which are not running
+func (p *FloatingIPPlugin) releaseStatefulSetIPs(prefix string, replicas int) error {
+	fips, err := p.ipam.ByPrefix(prefix)
+	if err != nil {
+		return err
+	}
+	for i := range fips {
+		keyObj := util.ParseKey(fips[i].Key)
+		index, err := parsePodIndex(keyObj.PodName)
+		if err != nil || index < replicas {
+			continue
+		}
+		if fips[i].NodeName != "" {
+			// pod may be running or cloud provider unassigning failed, leave it to unbind or resync
+			continue
+		}
+		if err := func() error {
+			defer p.lockPod(keyObj.PodName, keyObj.Namespace)()
+			if running, _ := p.podRunning(keyObj.PodName, keyObj.Namespace, fips[i].PodUid); running {
+				return nil
+			}
+			if keyObj.PoolName != "" {
+				// ips of pools are never released, return them to the pool for other pods of the pool
+				return p.reserveIP(keyObj.KeyInDB, keyObj.PoolPrefix(), "scaled down or deleted statefulset")
+			}
+			return p.unbindNoneDpPod(keyObj, constant.ReleasePolicy(fips[i].Policy), "during syncing statefulset")
+		}(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseDeletedStatefulSetIPs releases ips of a deleted statefulset, including ips in the pool of its pods
+func (p *FloatingIPPlugin) releaseDeletedStatefulSetIPs(namespace, name string) error {
+	if err := p.releaseStatefulSetIPs(util.NewKeyObj(util.StatefulsetPrefixKey, namespace, name, "", "").
+		PoolAppPrefix(), 0); err != nil {
+		return err
+	}
+	key := util.Join(name, namespace)
+	p.deletedStatefulSetsLock.Lock()
+	poolPrefix, ok := p.deletedStatefulSets[key]
+	p.deletedStatefulSetsLock.Unlock()
+	if !ok {
+		return nil
+	}
+	if err := p.releaseStatefulSetIPs(poolPrefix, 0); err != nil {
+		return err
+	}
+	p.deletedStatefulSetsLock.Lock()
+	delete(p.deletedStatefulSets, key)
+	p.deletedStatefulSetsLock.Unlock()
+	return nil
+}
+
+func (p *FloatingIPPlugin) updateReservedIPsAnnotation(ss *appv1.StatefulSet, ips string) error {
+	if ss.Annotations[constant.ReservedIPsAnnotation] == ips {
+		return nil
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{constant.ReservedIPsAnnotation: ips},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := p.Client.AppsV1().StatefulSets(ss.Namespace).Patch(ss.Name, types.MergePatchType,
+		data); err != nil {
+		return fmt.Errorf("update reserved ips annotation of statefulset %s_%s: %v", ss.Namespace, ss.Name, err)
+	}
+	return nil
+}
+
+// statefulSetPod creates the pod of the given index from the pod template of statefulset
+func statefulSetPod(ss *appv1.StatefulSet, index int) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: v1.ObjectMeta{
+			Name:            fmt.Sprintf("%s-%d", ss.Name, index),
+			Namespace:       ss.Namespace,
+			Annotations:     ss.Spec.Template.Annotations,
+			OwnerReferences: []v1.OwnerReference{{Kind: "StatefulSet", Name: ss.Name}},
+		},
+		Spec: ss.Spec.Template.Spec,
+	}
+}
@@ -17,12 +17,18 @@
 package schedulerplugin
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	appv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
 	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
 	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
 	. "tkestack.io/galaxy/pkg/utils/test"
@@ -143,3 +149,125 @@ func TestReleasePolicyForNotScalableCrd(t *testing.T) {
 		}
 	}
 }
+
+func TestSyncStatefulSet(t *testing.T) {
+	pod := CreateStatefulSetPod("sts-0", "ns1", immutableAnnotation)
+	sts := CreateStatefulSet(pod.ObjectMeta, 3)
+	sts.Spec.Template.Spec = pod.Spec
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, sts)
+	defer func() { stopChan <- struct{}{} }()
+	if err := fipPlugin.syncStatefulSet("ns1/sts"); err != nil {
+		t.Fatal(err)
+	}
+	// check all ips are reserved in the same node subnet
+	subnets := sets.NewString()
+	var ips []string
+	for i := 0; i < 3; i++ {
+		ipInfos, err := fipPlugin.ipam.ByKeyAndIPRanges(fmt.Sprintf("sts_ns1_sts_sts-%d", i), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ipInfos) != 1 {
+			t.Fatalf("expect pod sts-%d has an reserved ip, got %v", i, ipInfos)
+		}
+		subnets.Insert(ipInfos[0].NodeSubnets.List()...)
+		ips = append(ips, ipInfos[0].IP.String())
+	}
+	if subnets.Len() != 2 || !subnets.HasAll("10.0.1.0/24", "10.0.2.0/24") {
+		t.Fatalf("expect ips in node subnets 10.0.1.0/24 and 10.0.2.0/24, got %v", subnets.List())
+	}
+	got, err := fipPlugin.Client.AppsV1().StatefulSets("ns1").Get("sts", v1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Annotations[constant.ReservedIPsAnnotation] != strings.Join(ips, ",") {
+		t.Fatalf("expect reserved ips annotation %v, got %v", ips, got.Annotations)
+	}
+	// scale down statefulset, ips of pods whose index is not less than replicas should be released
+	replicas := int32(1)
+	got.Spec.Replicas = &replicas
+	if _, err := fipPlugin.Client.AppsV1().StatefulSets("ns1").Update(got); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait.Poll(time.Millisecond*10, time.Second*10, func() (done bool, err error) {
+		ss, err := fipPlugin.StatefulSetLister.StatefulSets("ns1").Get("sts")
+		return err == nil && *ss.Spec.Replicas == replicas, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.syncStatefulSet("ns1/sts"); err != nil {
+		t.Fatal(err)
+	}
+	for i, expectKey := range []string{"sts_ns1_sts_sts-0", "", ""} {
+		if err := checkIPKey(fipPlugin.ipam, ips[i], expectKey); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyncDeletedStatefulSetOfPool(t *testing.T) {
+	pod := CreateStatefulSetPod("sts-0", "ns1", map[string]string{
+		constant.ReleasePolicyAnnotation: constant.Immutable, constant.IPPoolAnnotation: "pool1"})
+	sts := CreateStatefulSet(pod.ObjectMeta, 2)
+	sts.Spec.Template.Spec = pod.Spec
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, sts)
+	defer func() { stopChan <- struct{}{} }()
+	if err := fipPlugin.syncStatefulSet("ns1/sts"); err != nil {
+		t.Fatal(err)
+	}
+	var ips []string
+	for i := 0; i < 2; i++ {
+		ipInfos, err := fipPlugin.ipam.ByKeyAndIPRanges(fmt.Sprintf("pool__pool1_sts_ns1_sts_sts-%d", i), nil)
+		if err != nil || len(ipInfos) != 1 {
+			t.Fatalf("expect pod sts-%d has an reserved ip in pool1, got %v, err %v", i, ipInfos, err)
+		}
+		ips = append(ips, ipInfos[0].IP.String())
+	}
+	// the deleted statefulset is only known by the delete event
+	if err := fipPlugin.Client.AppsV1().StatefulSets("ns1").Delete("sts", &v1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wait.Poll(time.Millisecond*10, time.Second*10, func() (done bool, err error) {
+		_, err = fipPlugin.StatefulSetLister.StatefulSets("ns1").Get("sts")
+		return err != nil, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.DeleteStatefulSet(sts); err != nil {
+		t.Fatal(err)
+	}
+	if err := fipPlugin.syncStatefulSet("ns1/sts"); err != nil {
+		t.Fatal(err)
+	}
+	// ips are returned to the pool
+	for _, ip := range ips {
+		if err := checkIPKey(fipPlugin.ipam, ip, "pool__pool1_"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(fipPlugin.deletedStatefulSets) != 0 {
+		t.Fatalf("expect deleted statefulsets cleared, got %v", fipPlugin.deletedStatefulSets)
+	}
+}
+
+func TestEnqueueStatefulSetOnlyIfLeader(t *testing.T) {
+	pod := CreateStatefulSetPod("sts-0", "ns1", immutableAnnotation)
+	sts := CreateStatefulSet(pod.ObjectMeta, 1)
+	sts.Spec.Template.Spec = pod.Spec
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, sts)
+	defer func() { stopChan <- struct{}{} }()
+	// followers don't enqueue since only the leader drains the queue
+	fipPlugin.leading = 0
+	if err := fipPlugin.AddStatefulSet(sts); err != nil {
+		t.Fatal(err)
+	}
+	if fipPlugin.stsQueue.Len() != 0 {
+		t.Fatalf("expect follower not to enqueue statefulset, got %d", fipPlugin.stsQueue.Len())
+	}
+	// statefulsets are enqueued after it starts leading
+	fipPlugin.leading = 1
+	fipPlugin.enqueueExisting()
+	if fipPlugin.stsQueue.Len() != 1 {
+		t.Fatalf("expect existing statefulset enqueued, got %d", fipPlugin.stsQueue.Len())
+	}
+}
@@ -0,0 +1,91 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	glog "k8s.io/klog"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+// TransferIPs moves all ips of the source workload to the target workload, e.g. when renaming a workload or moving it
+// to a new namespace. For statefulsets and other workloads whose pod names end with an index, the ip of each pod is
+// moved to the target pod of the same index. For deployments, ips are moved to the target deployment as reserved ips.
+// It returns moved ips and their new keys.
+// #lizard forgives
+func (p *FloatingIPPlugin) TransferIPs(from, to *util.KeyObj) (map[string]string, error) {
+	if from.PoolName != "" || to.PoolName != "" {
+		return nil, fmt.Errorf("transferring ips of pools is not supported")
+	}
+	if from.Deployment() != to.Deployment() {
+		return nil, fmt.Errorf("can't transfer ips between deployment and none deployment workloads")
+	}
+	fromPrefix, toPrefix := from.PoolPrefix(), to.PoolPrefix()
+	if fromPrefix == toPrefix {
+		return nil, fmt.Errorf("source and target are the same workload %s", fromPrefix)
+	}
+	// target ips are checked again by ipam atomically, so locking the source is enough
+	defer p.LockDpPool(fromPrefix)()
+	fips, err := p.ipam.ByPrefix(fromPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed query prefix %s: %v", fromPrefix, err)
+	}
+	if len(fips) == 0 {
+		return nil, fmt.Errorf("no ips of %s to transfer", fromPrefix)
+	}
+	targetFips, err := p.ipam.ByPrefix(toPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed query prefix %s: %v", toPrefix, err)
+	}
+	if len(targetFips) > 0 {
+		var conflicts []string
+		for i := range targetFips {
+			conflicts = append(conflicts, targetFips[i].IP.String())
+		}
+		return nil, fmt.Errorf("target %s already has reserved ips %v", toPrefix, conflicts)
+	}
+	keys := map[string]string{}
+	for i := range fips {
+		keyObj := util.ParseKey(fips[i].Key)
+		if keyObj.PodName != "" {
+			if _, err := p.PodLister.Pods(keyObj.Namespace).Get(keyObj.PodName); err == nil {
+				return nil, fmt.Errorf("pod %s_%s using ip %s still exists", keyObj.PodName, keyObj.Namespace,
+					fips[i].IP.String())
+			} else if !errors.IsNotFound(err) {
+				return nil, err
+			}
+		}
+		if to.Deployment() {
+			keys[fips[i].Key] = toPrefix
+			continue
+		}
+		index, err := parsePodIndex(keyObj.PodName)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pod name %q of ip %s: %v", keyObj.PodName, fips[i].IP.String(), err)
+		}
+		keys[fips[i].Key] = util.NewKeyObj(to.AppTypePrefix, to.Namespace, to.AppName,
+			fmt.Sprintf("%s-%d", to.AppName, index), "").KeyInDB
+	}
+	transferred, err := p.ipam.TransferKeys(keys)
+	if err != nil {
+		return nil, err
+	}
+	glog.Infof("transferred ips %v from %s to %s", transferred, fromPrefix, toPrefix)
+	return transferred, nil
+}
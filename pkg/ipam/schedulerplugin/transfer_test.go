@@ -0,0 +1,79 @@
+/*
+ * Tencent is pleased to support the open source community by making TKEStack available.
+ *
+ * Copyright (C) 2012-2019 Tencent. All Rights Reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License"); you may not use
+ * this file except in compliance with the License. You may obtain a copy of the
+ * License at
+ *
+ * https://opensource.org/licenses/Apache-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+ * WARRANTIES OF ANY KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations under the License.
+ */
+package schedulerplugin
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tkestack.io/galaxy/pkg/api/galaxy/constant"
+	"tkestack.io/galaxy/pkg/ipam/floatingip"
+	. "tkestack.io/galaxy/pkg/ipam/schedulerplugin/testing"
+	"tkestack.io/galaxy/pkg/ipam/schedulerplugin/util"
+)
+
+// #lizard forgives
+func TestTransferIPs(t *testing.T) {
+	pod := CreateStatefulSetPod("sts3-0", "ns1", nil)
+	fipPlugin, stopChan, _ := createPluginTestNodes(t, pod)
+	defer func() { stopChan <- struct{}{} }()
+	attr := floatingip.Attr{Policy: constant.ReleasePolicyNever}
+	for ip, key := range map[string]string{
+		"10.49.27.205": "sts_ns1_sts_sts-0", "10.49.27.216": "sts_ns1_sts_sts-1", "10.49.27.217": "sts_ns2_sts2_sts2-5",
+		"10.49.27.218": "sts_ns1_sts3_sts3-0", "10.173.13.2": "dp_ns1_dp_", "10.173.13.10": "dp_ns1_dp_dp-xx-yy",
+	} {
+		if err := fipPlugin.ipam.AllocateSpecificIP(key, net.ParseIP(ip), attr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sts := util.NewKeyObj(util.StatefulsetPrefixKey, "ns1", "sts", "", "")
+	sts2 := util.NewKeyObj(util.StatefulsetPrefixKey, "ns2", "sts2", "", "")
+	// target has a reserved ip
+	if _, err := fipPlugin.TransferIPs(sts, sts2); err == nil || !strings.Contains(err.Error(), "already has") {
+		t.Fatalf("expect conflict error, got %v", err)
+	}
+	if err := fipPlugin.ipam.Release("sts_ns2_sts2_sts2-5", net.ParseIP("10.49.27.217")); err != nil {
+		t.Fatal(err)
+	}
+	transferred, err := fipPlugin.TransferIPs(sts, sts2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(transferred, map[string]string{
+		"10.49.27.205": "sts_ns2_sts2_sts2-0", "10.49.27.216": "sts_ns2_sts2_sts2-1"}) {
+		t.Fatalf("unexpected transferred ips %v", transferred)
+	}
+	// pod of the source still exists
+	sts3 := util.NewKeyObj(util.StatefulsetPrefixKey, "ns1", "sts3", "", "")
+	if _, err := fipPlugin.TransferIPs(sts3, sts); err == nil || !strings.Contains(err.Error(), "still exists") {
+		t.Fatalf("expect pod exists error, got %v", err)
+	}
+	// ips of deployment are moved to the target deployment as reserved ips
+	dp := util.NewKeyObj(util.DeploymentPrefixKey, "ns1", "dp", "", "")
+	dp2 := util.NewKeyObj(util.DeploymentPrefixKey, "ns1", "dp2", "", "")
+	if _, err := fipPlugin.TransferIPs(dp, sts2); err == nil {
+		t.Fatal("expect an error of transferring from deployment to statefulset")
+	}
+	if transferred, err = fipPlugin.TransferIPs(dp, dp2); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(transferred, map[string]string{"10.173.13.2": "dp_ns1_dp2_", "10.173.13.10": "dp_ns1_dp2_"}) {
+		t.Fatalf("unexpected transferred ips %v", transferred)
+	}
+}
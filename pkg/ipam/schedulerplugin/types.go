@@ -19,6 +19,7 @@ package schedulerplugin
 import (
 	"errors"
 
+	"tkestack.io/galaxy/pkg/ipam/cloudprovider"
 	"tkestack.io/galaxy/pkg/ipam/floatingip"
 )
 
@@ -38,18 +39,31 @@ var (
 )
 
 type Conf struct {
-	FloatingIPs           []*floatingip.FloatingIPPool `json:"floatingips,omitempty"`
-	ResyncInterval        uint                         `json:"resyncInterval"`
-	ConfigMapName         string                       `json:"configMapName"`
-	ConfigMapNamespace    string                       `json:"configMapNamespace"`
-	FloatingIPKey         string                       `json:"floatingipKey"` // configmap floatingip data key
-	CloudProviderGRPCAddr string                       `json:"cloudProviderGrpcAddr"`
+	FloatingIPs []*floatingip.FloatingIPPool `json:"floatingips,omitempty"`
+	// ResyncInterval is the interval in minutes of resyncing all allocated ips with pods. It is a safety net since
+	// ips are released and resynced incrementally on pod and floatingip events.
+	ResyncInterval        uint   `json:"resyncInterval"`
+	ConfigMapName         string `json:"configMapName"`
+	ConfigMapNamespace    string `json:"configMapNamespace"`
+	FloatingIPKey         string `json:"floatingipKey"` // configmap floatingip data key
+	CloudProviderGRPCAddr string `json:"cloudProviderGrpcAddr"`
+	// CloudProviderTLS enables tls of the connection to cloud provider if not nil
+	CloudProviderTLS *cloudprovider.TLSConfig `json:"cloudProviderTLS,omitempty"`
+	// CloudProviderTokenFile is the file of the bearer token sent with each request to cloud provider
+	CloudProviderTokenFile string `json:"cloudProviderTokenFile"`
+	// CloudProviderReconcileInterval is the interval in minutes of reconciling ip bindings with cloud provider
+	CloudProviderReconcileInterval uint `json:"cloudProviderReconcileInterval"`
+	// ActiveActive is set by galaxy-ipam --active-active flag, replicas serve requests concurrently and share crds
+	ActiveActive bool `json:"-"`
 }
 
 func (conf *Conf) validate() {
 	if conf.ResyncInterval < 1 {
 		conf.ResyncInterval = 1
 	}
+	if conf.CloudProviderReconcileInterval < 1 {
+		conf.CloudProviderReconcileInterval = 5
+	}
 	if conf.ConfigMapName == "" {
 		conf.ConfigMapName = "floatingip-config"
 	}
@@ -113,7 +113,7 @@ func (k *KeyObj) PoolAppPrefix() string {
 
 const (
 	// ip pool may be shared with other namespaces, so leave namespace empty
-	poolPrefix           = "pool__"
+	poolPrefix           = constant.PoolPrefixKey
 	DeploymentPrefixKey  = "dp_"
 	StatefulsetPrefixKey = "sts_"
 
@@ -159,12 +159,11 @@ func ParseKey(key string) *KeyObj {
 	if strings.HasPrefix(key, poolPrefix) {
 		// pool__poolName_deployment_namespace_deploymentName_podName
 		// poolName and deployment_namespace_deploymentName_podName
-		parts := strings.SplitN(key[len(poolPrefix):], "_", 2)
-		if len(parts) != 2 {
+		keyObj.PoolName = constant.ParsePoolName(key)
+		if keyObj.PoolName == "" {
 			return keyObj
 		}
-		keyObj.PoolName = parts[0]
-		removedPoolKey = parts[1]
+		removedPoolKey = key[len(constant.PoolKey(keyObj.PoolName)):]
 	}
 	keyObj.AppTypePrefix, keyObj.AppName, keyObj.PodName, keyObj.Namespace = resolvePodKey(removedPoolKey)
 	return keyObj
@@ -32,6 +32,13 @@ type ServerRunOptions struct {
 	KubeConf       string
 	Swagger        bool
 	LeaderElection LeaderElectionConfiguration
+	// TLSCertFile and TLSPrivateKeyFile enable serving API over https
+	TLSCertFile       string
+	TLSPrivateKeyFile string
+	// APIAuth enables authenticating and authorizing API requests
+	APIAuth bool
+	// ActiveActive enables all replicas to serve requests while only the leader runs background jobs
+	ActiveActive bool
 }
 
 var (
@@ -65,5 +72,14 @@ func (s *ServerRunOptions) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.Master, "master", s.Master, "The address and port of the Kubernetes API server")
 	fs.StringVar(&s.KubeConf, "kubeconfig", s.KubeConf, "The kube config file location of APISwitch, used to support TLS")
 	fs.BoolVar(&s.Swagger, "swagger", s.Swagger, "Enable swagger via API web interface host:api-port/apidocs.json/")
+	fs.StringVar(&s.TLSCertFile, "tls-cert-file", s.TLSCertFile, "The x509 certificate file to serve API over "+
+		"https, API is served over http if not specified")
+	fs.StringVar(&s.TLSPrivateKeyFile, "tls-private-key-file", s.TLSPrivateKeyFile, "The x509 private key file "+
+		"matching --tls-cert-file")
+	fs.BoolVar(&s.APIAuth, "api-auth", s.APIAuth, "Authenticate API requests by bearer token via TokenReview "+
+		"and authorize them via SubjectAccessReview against floatingips and pools of galaxy.k8s.io group")
+	fs.BoolVar(&s.ActiveActive, "active-active", s.ActiveActive, "Serve scheduler extender and API requests on "+
+		"all replicas, allocating ips with optimistic concurrency, and run background jobs such as resync only on "+
+		"the leader. This is only applicable if leader election is enabled.")
 	BindFlags(&s.LeaderElection, fs)
 }
@@ -66,6 +66,8 @@ type Server struct {
 	*options.ServerRunOptions
 	*ipamcontext.IPAMContext
 	plugin               *schedulerplugin.FloatingIPPlugin
+	recorder             record.EventRecorder
+	watcher              *api.Watcher
 	stopChan             chan struct{}
 	leaderElectionConfig *leaderelection.LeaderElectionConfig
 }
@@ -89,11 +91,18 @@ func (s *Server) init() error {
 		return fmt.Errorf("bad config %s: %v", string(data), err)
 	}
 	s.initk8sClient()
+	if s.ActiveActive && !s.LeaderElection.LeaderElect {
+		glog.Warningf("--active-active is ignored since leader election is disabled")
+	}
+	s.SchedulePluginConf.ActiveActive = s.activeActive()
 	s.plugin, err = schedulerplugin.NewFloatingIPPlugin(s.SchedulePluginConf, s.IPAMContext)
 	if err != nil {
 		return err
 	}
 	s.PodInformer.Informer().AddEventHandler(eventhandler.NewPodEventHandler(s.plugin))
+	s.StatefulSetInformer.Informer().AddEventHandler(eventhandler.NewStatefulSetEventHandler(s.plugin))
+	s.watcher = api.NewWatcher()
+	s.FIPInformer.Informer().AddEventHandler(s.watcher)
 	return nil
 }
 
@@ -102,6 +111,17 @@ func (s *Server) Start() error {
 		return fmt.Errorf("init server: %v", err)
 	}
 	s.StartInformers(s.stopChan)
+	if s.activeActive() {
+		// all replicas serve requests, the leader runs background jobs in addition
+		if err := s.plugin.Init(); err != nil {
+			return err
+		}
+		s.plugin.RunFollower(s.stopChan)
+		go leaderelection.RunOrDie(context.Background(), *s.leaderElectionConfig)
+		go s.startAPIServer()
+		s.startServer()
+		return nil
+	}
 	if s.LeaderElection.LeaderElect && s.leaderElectionConfig != nil {
 		leaderelection.RunOrDie(context.Background(), *s.leaderElectionConfig)
 		return nil
@@ -109,6 +129,10 @@ func (s *Server) Start() error {
 	return s.Run()
 }
 
+func (s *Server) activeActive() bool {
+	return s.ActiveActive && s.LeaderElection.LeaderElect
+}
+
 func (s *Server) Run() error {
 	if err := s.plugin.Init(); err != nil {
 		return err
@@ -163,6 +187,7 @@ func (s *Server) initk8sClient() {
 	if err != nil {
 		glog.Fatalf("failed init event recorder: %v", err)
 	}
+	s.recorder = recorder
 	if s.LeaderElection.LeaderElect {
 		leaderElectionClient := kubernetes.NewForConfigOrDie(restclient.AddUserAgent(cfg, "leader-election"))
 		rl, err := resourcelock.New(s.LeaderElection.ResourceLock,
@@ -184,6 +209,11 @@ func (s *Server) initk8sClient() {
 			RetryPeriod:   s.LeaderElection.RetryPeriod.Duration,
 			Callbacks: leaderelection.LeaderCallbacks{
 				OnStartedLeading: func(ctx context.Context) {
+					if s.activeActive() {
+						glog.Infof("started leading, running background jobs")
+						s.plugin.Run(s.stopChan)
+						return
+					}
 					if err := s.Run(); err != nil {
 						glog.Fatal(err)
 					}
@@ -222,6 +252,7 @@ func (s *Server) startServer() {
 		Writes(schedulerapi.ExtenderBindingResult{}))
 	health := new(restful.WebService)
 	health.Route(health.GET("/healthy").To(s.healthy))
+	health.Route(health.GET("/ready").To(s.ready))
 	container := restful.NewContainer()
 	container.Add(ws)
 	container.Add(health)
@@ -236,10 +267,19 @@ func (s *Server) startAPIServer() {
 		Path("/v1").
 		Consumes(restful.MIME_JSON).
 		Produces(restful.MIME_JSON)
-	c := api.NewController(s.plugin.GetIpam(), s.PodLister)
+	// a nil authorizer allows all requests
+	var authorizer *api.Authorizer
+	if s.APIAuth {
+		authorizer = api.NewAuthorizer(s.Client)
+	}
+	c := api.NewController(s.plugin.GetIpam(), s.PodLister, s.watcher)
 	ws.Route(ws.GET("/ip").To(c.ListIPs).
+		Filter(authorizer.Filter("list", api.ResourceFloatingIPs, api.QueryNamespace)).
 		Doc("List ips by keyword or params").
-		Param(ws.QueryParameter("keyword", "keyword").DataType("string")).
+		Param(ws.QueryParameter("keyword", "keyword, matched ips are limited to the namespace if specified").
+			DataType("string")).
+		Param(ws.QueryParameter("ip", "ip, other params except namespace are ignored if specified").
+			DataType("string")).
 		Param(ws.QueryParameter("poolName", "pool name").DataType("string")).
 		Param(ws.QueryParameter("appName", "app name").DataType("string")).
 		Param(ws.QueryParameter("podName", "pod name").DataType("string")).
@@ -258,10 +298,24 @@ func (s *Server) startAPIServer() {
 				{IP: "10.0.70.118", PoolName: "sample-pool2", Namespace: "default", AppName: "app",
 					PodName: "app-xxx-yyy", Policy: 2, UpdateTime: time.Unix(1555924279, 0), Status: "Running",
 					AppType: "deployment"},
-			}}).
+			},
+			ResourceVersion: "1590750700123456789-1024"}).
 		Writes(api.ListIPResp{}))
 
+	ws.Route(ws.GET("/ip/watch").To(s.watcher.Watch).
+		Filter(authorizer.Filter("watch", api.ResourceFloatingIPs, api.QueryNamespace)).
+		Doc("Watch allocate, reserve, release and update events of ips as a stream of json lines").
+		Param(ws.QueryParameter("namespace", "namespace, watch all namespaces if empty").DataType("string")).
+		Param(ws.QueryParameter("resourceVersion", "watch changes after the list or the event of the resource version").
+			DataType("string")).
+		Returns(http.StatusGone, "resource version is too old or from another replica", nil).
+		Returns(http.StatusOK, "request succeed", api.WatchEvent{Type: api.EventAllocate,
+			ResourceVersion: "1590750700123456789-1025", IP: api.FloatingIP{IP: "10.0.0.2", Namespace: "default", AppName: "sts",
+				PodName: "sts-0", AppType: "statefulset"}, NodeName: "node1"}).
+		Writes(api.WatchEvent{}))
+
 	ws.Route(ws.POST("/ip").To(c.ReleaseIPs).
+		Filter(authorizer.Filter("delete", api.ResourceFloatingIPs, api.ReleaseIPNamespaces)).
 		Doc("Release ips").
 		Reads(api.ReleaseIPReq{}).
 		Returns(http.StatusBadRequest, "10.0.0 is not a valid ip", nil).
@@ -272,9 +326,41 @@ func (s *Server) startAPIServer() {
 		Returns(http.StatusOK, "request succeed", api.ReleaseIPResp{Resp: httputil.Resp{Code: http.StatusOK}}).
 		Writes(api.ReleaseIPResp{Resp: httputil.Resp{Code: http.StatusOK}}))
 
+	ws.Route(ws.GET("/subnet").To(c.ListSubnets).
+		Filter(authorizer.Filter("list", api.ResourceFloatingIPs, nil)).
+		Doc("List floating ip pools of the configmap with their utilization").
+		Param(ws.QueryParameter("page", "page number, valid range [0,99999]").DataType("integer")).
+		Param(ws.QueryParameter("size", "page size, valid range (0,9999]").DataType("integer").DefaultValue("10")).
+		Param(ws.QueryParameter("sort", "sort by which field, supports subnet/name/allocated/reserved/free asc/desc").
+			DataType("string").DefaultValue("subnet asc")).
+		Returns(http.StatusInternalServerError, "internal server error", nil).
+		Returns(http.StatusOK, "request succeed", api.ListSubnetResp{
+			Page: pageutil.Page{Last: true, TotalElements: 1, TotalPages: 1, First: true, NumberOfElements: 1,
+				Size: 10, Number: 0},
+			Content: []api.Subnet{{Subnet: "10.0.70.0/24", Gateway: "10.0.70.1", IPRanges: []string{"10.0.70.2~10.0.70.10"},
+				NodeSubnets: []string{"10.0.0.0/24"}, Usage: api.Usage{Allocated: 2, Reserved: 1, Free: 6}}}}).
+		Writes(api.ListSubnetResp{}))
+
 	poolController := api.PoolController{PoolLister: s.PoolLister, Client: s.GalaxyClient,
-		LockPoolFunc: s.plugin.LockDpPool, IPAM: s.plugin.GetIpam()}
+		LockPoolFunc: s.plugin.LockDpPool, IPAM: s.plugin.GetIpam(), PodLister: s.PodLister}
+	ws.Route(ws.GET("/pool").To(poolController.List).
+		Filter(authorizer.Filter("list", api.ResourcePools, api.StaticNamespace("kube-system"))).
+		Doc("List pools with their utilization").
+		Param(ws.QueryParameter("page", "page number, valid range [0,99999]").DataType("integer")).
+		Param(ws.QueryParameter("size", "page size, valid range (0,9999]").DataType("integer").DefaultValue("10")).
+		Param(ws.QueryParameter("sort", "sort by which field, supports name/size/allocated/reserved/free asc/desc").
+			DataType("string").DefaultValue("name asc")).
+		Returns(http.StatusInternalServerError, "internal server error", nil).
+		Returns(http.StatusOK, "request succeed", api.ListPoolResp{
+			Page: pageutil.Page{Last: true, TotalElements: 1, TotalPages: 1, First: true, NumberOfElements: 1,
+				Size: 10, Number: 0},
+			Content: []api.PoolInfo{{Pool: api.Pool{Name: "sample-pool", Size: 4},
+				IPRanges: []string{"10.0.70.2~10.0.70.10"}, Gateway: "10.0.70.1", Vlan: 2,
+				NodeSubnets: []string{"10.0.0.0/24"}, Usage: api.Usage{Allocated: 2, Reserved: 1, Free: 1}}}}).
+		Writes(api.ListPoolResp{}))
+
 	ws.Route(ws.GET("/pool/{name}").To(poolController.Get).
+		Filter(authorizer.Filter("get", api.ResourcePools, api.StaticNamespace("kube-system"))).
 		Doc("Get pool by name").
 		Param(ws.PathParameter("name", "pool name").DataType("string").Required(true)).
 		Returns(http.StatusNotFound, "pool not found", nil).
@@ -285,6 +371,7 @@ func (s *Server) startAPIServer() {
 		Writes(api.GetPoolResp{}))
 
 	ws.Route(ws.POST("/pool").To(poolController.CreateOrUpdate).
+		Filter(authorizer.Filter("update", api.ResourcePools, api.StaticNamespace("kube-system"))).
 		Doc("Create or update pool").
 		Reads(api.Pool{Name: "sample-pool"}).
 		Returns(http.StatusBadRequest, "pool name is empty", nil).
@@ -296,6 +383,7 @@ func (s *Server) startAPIServer() {
 		Writes(httputil.Resp{Code: http.StatusOK}))
 
 	ws.Route(ws.DELETE("/pool/{name}").To(poolController.Delete).
+		Filter(authorizer.Filter("delete", api.ResourcePools, api.StaticNamespace("kube-system"))).
 		Doc("Delete pool by name").
 		Param(ws.PathParameter("name", "pool name").DataType("string").Required(true)).
 		Returns(http.StatusNotFound, "pool not found", nil).
@@ -304,13 +392,87 @@ func (s *Server) startAPIServer() {
 		Returns(http.StatusOK, "request succeed", httputil.Resp{Code: http.StatusOK}).
 		Writes(httputil.Resp{Code: http.StatusOK}))
 
+	gangController := api.GangController{ReserveGangFunc: s.plugin.ReserveGang}
+	ws.Route(ws.POST("/gang").To(gangController.Reserve).
+		Filter(authorizer.Filter("create", api.ResourceFloatingIPs, api.GangNamespace)).
+		Doc("Reserve ips for a workload all at once in a single node subnet").
+		Reads(api.Gang{Namespace: "default", AppName: "sts", AppType: "statefulset", Size: 3}).
+		Returns(http.StatusBadRequest, "invalid gang request", nil).
+		Returns(http.StatusInternalServerError, "internal server error", nil).
+		Returns(http.StatusOK, "request succeed", api.GangResp{Resp: httputil.NewResp(http.StatusOK, ""),
+			IPs: []string{"10.0.0.2", "10.0.0.3", "10.0.0.4"}, NodeSubnets: []string{"10.0.0.0/24"}}).
+		Writes(api.GangResp{}))
+
+	ws.Route(ws.POST("/ip/import").To(c.ImportIPs).
+		Filter(authorizer.Filter("create", api.ResourceFloatingIPs, api.ImportIPNamespaces)).
+		Doc("Import allocated ips with their release policies and attributes, e.g. to restore exported ips").
+		Reads(api.ImportIPReq{IPs: []api.FloatingIP{{IP: "10.0.0.2", Namespace: "default", AppName: "sts",
+			PodName: "sts-0", AppType: "statefulset", Policy: 2}}}).
+		Returns(http.StatusBadRequest, "10.0.0 is not a valid ip", nil).
+		Returns(http.StatusAccepted, "Unimported ips have been allocated to other keys, or are not within valid "+
+			"range", api.ImportIPResp{Unimported: map[string]string{"10.0.0.3": "allocated to dp_default_dp_"}}).
+		Returns(http.StatusOK, "request succeed", api.ImportIPResp{Resp: httputil.NewResp(http.StatusOK, ""),
+			Imported: []string{"10.0.0.2"}}).
+		Writes(api.ImportIPResp{}))
+
+	transferController := api.TransferController{TransferFunc: s.plugin.TransferIPs, Recorder: s.recorder}
+	ws.Route(ws.POST("/ip/transfer").To(transferController.Transfer).
+		Filter(authorizer.Filter("update", api.ResourceFloatingIPs, api.TransferNamespaces)).
+		Doc("Transfer all ips of a workload to another workload").
+		Reads(api.TransferRequest{From: api.App{Namespace: "default", AppName: "sts", AppType: "statefulset"},
+			To: api.App{Namespace: "demo", AppName: "sts2", AppType: "statefulset"}}).
+		Returns(http.StatusBadRequest, "namespace or appName is empty", nil).
+		Returns(http.StatusInternalServerError, "internal server error", nil).
+		Returns(http.StatusOK, "request succeed", api.TransferResp{Resp: httputil.NewResp(http.StatusOK, ""),
+			Transferred: []api.FloatingIP{{IP: "10.0.0.2", Namespace: "demo", AppName: "sts2", PodName: "sts2-0",
+				AppType: "statefulset"}}}).
+		Writes(api.TransferResp{}))
+
+	cpController := api.CloudProviderController{Client: s.GalaxyClient, Lister: s.CPOLister}
+	ws.Route(ws.GET("/cloudprovider/operation").To(cpController.ListOperations).
+		Filter(authorizer.Filter("list", api.ResourceCloudProviderOperations, nil)).
+		Doc("List pending cloud provider operations which failed and are being retried").
+		Param(ws.QueryParameter("deadLetter", "list only dead letters which are not retried any more if true").
+			DataType("boolean")).
+		Returns(http.StatusInternalServerError, "internal server error", nil).
+		Returns(http.StatusOK, "request succeed", api.ListOperationResp{Resp: httputil.NewResp(http.StatusOK, ""),
+			Operations: []api.Operation{{IP: "10.0.0.2", UnAssignNodes: []string{"node1"}, Attempts: 10,
+				LastError: "cloud provider UnAssignIP reply err timeout", LastAttemptTime: time.Unix(1555924386, 0),
+				DeadLetter: true}}}).
+		Writes(api.ListOperationResp{}))
+
+	ws.Route(ws.POST("/cloudprovider/operation/{ip}/retry").To(cpController.RetryOperation).
+		Filter(authorizer.Filter("update", api.ResourceCloudProviderOperations, nil)).
+		Doc("Reset attempts of a cloud provider operation to retry it, e.g. a dead letter").
+		Param(ws.PathParameter("ip", "ip").DataType("string").Required(true)).
+		Returns(http.StatusNotFound, "operation not found", nil).
+		Returns(http.StatusInternalServerError, "internal server error", nil).
+		Returns(http.StatusOK, "request succeed", httputil.Resp{Code: http.StatusOK}).
+		Writes(httputil.Resp{Code: http.StatusOK}))
+
+	ws.Route(ws.DELETE("/cloudprovider/operation/{ip}").To(cpController.DeleteOperation).
+		Filter(authorizer.Filter("delete", api.ResourceCloudProviderOperations, nil)).
+		Doc("Give up a cloud provider operation").
+		Param(ws.PathParameter("ip", "ip").DataType("string").Required(true)).
+		Returns(http.StatusNotFound, "operation not found", nil).
+		Returns(http.StatusInternalServerError, "internal server error", nil).
+		Returns(http.StatusOK, "request succeed", httputil.Resp{Code: http.StatusOK}).
+		Writes(httputil.Resp{Code: http.StatusOK}))
+
 	restful.Add(ws)
 	// register prometheus metrics
 	prometheus.MustRegister(s.plugin.GetIpam())
 	metrics.MustRegister()
 	restful.DefaultContainer.Handle("/metrics", promhttp.Handler())
 	addSwaggerUISupport(restful.DefaultContainer)
-	if err := http.ListenAndServe(fmt.Sprintf("%s:%d", s.Bind, s.APIPort), nil); err != nil {
+	addr := fmt.Sprintf("%s:%d", s.Bind, s.APIPort)
+	var err error
+	if s.TLSCertFile != "" && s.TLSPrivateKeyFile != "" {
+		err = http.ListenAndServeTLS(addr, s.TLSCertFile, s.TLSPrivateKeyFile, nil)
+	} else {
+		err = http.ListenAndServe(addr, nil)
+	}
+	if err != nil {
 		glog.Fatalf("unable to listen: %v.", err)
 	}
 }
@@ -389,3 +551,14 @@ func (s *Server) healthy(request *restful.Request, response *restful.Response) {
 	response.WriteHeader(http.StatusOK)
 	_, _ = response.Write([]byte("ok"))
 }
+
+// ready checks dependencies, it fails if the connection to cloud provider is not usable
+func (s *Server) ready(request *restful.Request, response *restful.Response) {
+	if err := s.plugin.CloudProviderReady(); err != nil {
+		response.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = response.Write([]byte(err.Error()))
+		return
+	}
+	response.WriteHeader(http.StatusOK)
+	_, _ = response.Write([]byte("ok"))
+}
@@ -42,6 +42,7 @@ import (
 	utilexec "k8s.io/utils/exec"
 	"tkestack.io/galaxy/pkg/api/k8s"
 	"tkestack.io/galaxy/pkg/api/k8s/eventhandler"
+	"tkestack.io/galaxy/pkg/galaxy/metrics"
 	"tkestack.io/galaxy/pkg/utils/ipset"
 	utiliptables "tkestack.io/galaxy/pkg/utils/iptables"
 )
@@ -142,6 +143,9 @@ func (p *PolicyManager) startPodInformerFactory() {
 
 func (p *PolicyManager) Run() {
 	glog.Infof("start resyncing network policies")
+	defer func(start time.Time) {
+		metrics.PolicySyncLatency.WithLabelValues("full").Observe(time.Since(start).Seconds())
+	}(time.Now())
 	p.syncNetworkPolices()
 	p.syncNetworkPolicyRules()
 	p.syncPods()
@@ -719,6 +723,30 @@ func podChainName(pod *corev1.Pod) string {
 	return fmt.Sprintf("%s-%s", podChainPrefix, nameHash(fmt.Sprintf("%s_%s", pod.Name, pod.Namespace)))
 }
 
+// PodChains returns iptables chains of the pod and network policies which the pod is a target of, the first one is
+// the pod chain. It returns nil if the pod isn't a target of any network policy.
+func (p *PolicyManager) PodChains(namespace, name string) ([]string, error) {
+	pod, err := p.podLister.Pods(namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	var policies []policy
+	p.Lock()
+	policies = p.policies
+	p.Unlock()
+	filteredIngressPolicy, filteredEgressPolicy := filterMatchingPolicies(pod, policies)
+	if filteredIngressPolicy.Len() == 0 && filteredEgressPolicy.Len() == 0 {
+		return nil, nil
+	}
+	chains := []string{podChainName(pod)}
+	for i := range policies {
+		if filteredIngressPolicy.Has(i) || filteredEgressPolicy.Has(i) {
+			chains = append(chains, policyChainName(policies[i].np))
+		}
+	}
+	return chains, nil
+}
+
 func nameHash(data string) string {
 	hash := sha256.Sum256([]byte(data))
 	encoded := base32.StdEncoding.EncodeToString(hash[:])
@@ -817,6 +845,9 @@ func (p *PolicyManager) syncEgressInIPSet(policy *policy, pod *corev1.Pod, add b
 // SyncPodChains ensures GLX-INGRESS/GLX-EGRESS/GLX-POD-XXXX iptable chains are expected
 func (p *PolicyManager) SyncPodChains(pod *corev1.Pod) error {
 	glog.V(4).Infof("sync pod chain for %s_%s", pod.Name, pod.Namespace)
+	defer func(start time.Time) {
+		metrics.PolicySyncLatency.WithLabelValues("pod").Observe(time.Since(start).Seconds())
+	}(time.Now())
 	var policies []policy
 	p.Lock()
 	policies = p.policies
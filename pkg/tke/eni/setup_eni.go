@@ -21,13 +21,13 @@ import (
 	"net"
 	"time"
 
-	"github.com/containernetworking/plugins/pkg/ip"
 	"github.com/dbdd4us/qcloudapi-sdk-go/metadata"
 	"github.com/vishvananda/netlink"
 	"k8s.io/apimachinery/pkg/util/wait"
 	log "k8s.io/klog"
 
 	"tkestack.io/galaxy/pkg/utils/ips"
+	"tkestack.io/galaxy/pkg/utils/nets"
 )
 
 const (
@@ -159,7 +159,7 @@ func ensureENINetwork(ifname string, eniTable int, primaryIp net.IPNet) error {
 func ensureENIRoute(link netlink.Link, primaryIp *net.IPNet, eniTable int) error {
 	linkIndex := link.Attrs().Index
 	ipn := primaryIp.IP.Mask(primaryIp.Mask)
-	gw := ip.NextIP(ipn)
+	gw := nets.IntToIP(nets.IPToInt(ipn) + 1)
 
 	r := netlink.Route{
 		LinkIndex: linkIndex,
@@ -51,3 +51,13 @@ func ItemNotFound(resp *restful.Response, err error) {
 	resp.WriteHeaderAndEntity(http.StatusNotFound, NewResp(http.StatusNotFound,
 		fmt.Sprintf("not found: %v", err))) // nolint: errcheck
 }
+
+func Unauthorized(resp *restful.Response, err error) {
+	resp.WriteHeaderAndEntity(http.StatusUnauthorized, NewResp(http.StatusUnauthorized,
+		fmt.Sprintf("unauthorized: %v", err))) // nolint: errcheck
+}
+
+func Forbidden(resp *restful.Response, err error) {
+	resp.WriteHeaderAndEntity(http.StatusForbidden, NewResp(http.StatusForbidden,
+		fmt.Sprintf("forbidden: %v", err))) // nolint: errcheck
+}